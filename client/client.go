@@ -4,12 +4,15 @@ import (
 	"crypto/ed25519"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/threefoldtech/tfexplorer/models/generated/directory"
 	"github.com/threefoldtech/tfexplorer/models/generated/phonebook"
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
 	"github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	directorytypes "github.com/threefoldtech/tfexplorer/pkg/directory/types"
 	wrklds "github.com/threefoldtech/tfexplorer/pkg/workloads"
+	wrkldstypes "github.com/threefoldtech/tfexplorer/pkg/workloads/types"
 	"github.com/threefoldtech/tfexplorer/schema"
 	"github.com/threefoldtech/zos/pkg/capacity"
 	"github.com/threefoldtech/zos/pkg/capacity/dmi"
@@ -46,6 +49,21 @@ type (
 		Farms(cacheSize int) FarmIter
 		FarmAddIP(id schema.ID, ip directory.PublicIP) error
 		FarmDeleteIP(id schema.ID, ip schema.IPCidr) error
+		// FarmPolicyGet returns the workload approval policy of a farm
+		FarmPolicyGet(id schema.ID) (policy directorytypes.FarmPolicy, err error)
+		// FarmPolicySet replaces the workload approval policy of a farm
+		FarmPolicySet(policy directorytypes.FarmPolicy) error
+		// FarmSLA returns the availability of the nodes of a farm between from
+		// and to, zero times use the current month
+		FarmSLA(id schema.ID, from, to time.Time) (sla wrkldstypes.FarmSLA, err error)
+
+		// DomainChallenge issues the challenge token to publish as a TXT
+		// record to prove the ownership of a domain
+		DomainChallenge(domain string) (ownership directorytypes.DomainOwnership, err error)
+		// DomainVerify verifies the published challenge token of a domain
+		DomainVerify(domain string) (ownership directorytypes.DomainOwnership, err error)
+		DomainList() (ownerships []directorytypes.DomainOwnership, err error)
+		DomainDelete(domain string) error
 
 		GatewayRegister(Gateway directory.Gateway) error
 		GatewayList(tid schema.ID, name string, page *Pager) (farms []directory.Gateway, err error)
@@ -56,6 +74,8 @@ type (
 		NodeRegister(node directory.Node) error
 		NodeList(filter NodeFilter, pager *Pager) (nodes []directory.Node, err error)
 		NodeGet(id string, proofs bool) (node directory.Node, err error)
+		// NodeSearch returns the nodes with free capacity matching the filter
+		NodeSearch(filter NodeSearchFilter, pager *Pager) (nodes []directorytypes.NodeSearchResult, err error)
 		Nodes(cacheSize int, proofs bool) NodeIter
 
 		NodeSetInterfaces(id string, ifaces []directory.Iface) error
@@ -91,15 +111,57 @@ type (
 		Create(reservation workloads.Workloader) (resp wrklds.ReservationCreateResponse, err error)
 		List(nextAction *workloads.NextActionEnum, customerTid int64, page *Pager) (reservation []workloads.Reservation, err error)
 		Get(id schema.ID) (reservation workloads.Workloader, err error)
+		Update(id schema.ID, workload workloads.Workloader) (resp wrklds.WorkloadUpdateResponse, err error)
+		Revisions(id schema.ID) (revisions []wrkldstypes.WorkloadRevision, err error)
+		// Events returns the history of a workload
+		Events(id schema.ID, page *Pager) (events []wrkldstypes.WorkloadEvent, err error)
+		// ListWorkloads lists the workloads matching the filter
+		ListWorkloads(filter WorkloadFilter, page *Pager) (list []workloads.Workloader, err error)
+		// SetLabels replaces the labels of a workload
+		SetLabels(id schema.ID, labels map[string]string) error
+		// SetExpiration changes the time a workload expires at, a zero time
+		// removes the expiration. signature is the customer signature of the
+		// workload with the new expiration time.
+		SetExpiration(id schema.ID, expiresAt time.Time, signature string) error
+		// Migrate replaces a deployed workload with a signed copy on another
+		// node of the same pool, the current workload is deleted once the
+		// replacement is deployed
+		Migrate(id schema.ID, workload workloads.Workloader) (resp wrklds.ReservationCreateResponse, err error)
+		// Approve deploys a workload waiting for the approval of the farmer,
+		// signature is the farmer signature of the workload approval
+		Approve(id schema.ID, signature string) error
+		// Reject invalidates a workload waiting for the approval of the farmer
+		Reject(id schema.ID, reason string) error
 
 		SignProvision(id schema.ID, user schema.ID, signature string) error
 		SignDelete(id schema.ID, user schema.ID, signature string) error
 
+		GroupCreate(workloads []workloads.Workloader) (resp wrklds.DeploymentGroupCreateResponse, err error)
+		GroupGet(id schema.ID) (group wrklds.DeploymentGroupInfo, err error)
+		GroupList(customerTid int64, page *Pager) (groups []wrklds.DeploymentGroupInfo, err error)
+		GroupSignDelete(id schema.ID, signatures []wrkldstypes.DeploymentGroupSignature) error
+
+		// IPLeases lists the public ip leases of a customer
+		IPLeases(customerTid int64, page *Pager) (leases []wrkldstypes.IPLease, err error)
+		IPLeaseGet(id schema.ID) (lease wrkldstypes.IPLease, err error)
+		// IPLeaseHold sets the time the ip is held once its workload is deleted
+		IPLeaseHold(id schema.ID, period time.Duration) error
+		// IPLeaseRelease releases a held ip before its hold expires
+		IPLeaseRelease(id schema.ID) error
+		// IPLeaseTransfer moves a held ip to another pool, signature is the
+		// customer signature of the lease transfer challenge
+		IPLeaseTransfer(id schema.ID, poolID int64, signature string) error
+
 		PoolCreate(reservation types.Reservation) (resp wrklds.CapacityPoolCreateResponse, err error)
 		PoolGet(poolID string) (result types.Pool, err error)
 		PoolsGetByOwner(ownerID string) (result []types.Pool, err error)
 
 		NodeWorkloads(nodeID string, from uint64) ([]workloads.Workloader, uint64, error)
+		// NodeWorkloadsWait waits up to wait for new workloads if there are
+		// none, and verifies the explorer signature if key is not nil
+		NodeWorkloadsWait(nodeID string, from uint64, wait time.Duration, key ed25519.PublicKey) ([]workloads.Workloader, uint64, error)
+		// SigningKey returns the key the explorer signs node responses with
+		SigningKey() (ed25519.PublicKey, error)
 		NodeWorkloadGet(gwid string) (result workloads.Workloader, err error)
 		NodeWorkloadPutResult(nodeID, gwid string, result workloads.Result) error
 		NodeWorkloadPutDeleted(nodeID, gwid string) error
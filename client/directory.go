@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/threefoldtech/tfexplorer/models/generated/directory"
+	directorytypes "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	wrkldstypes "github.com/threefoldtech/tfexplorer/pkg/workloads/types"
 	"github.com/threefoldtech/tfexplorer/schema"
 	"github.com/threefoldtech/zos/pkg/capacity"
 	"github.com/threefoldtech/zos/pkg/capacity/dmi"
@@ -78,6 +81,52 @@ func (d *httpDirectory) FarmDeleteIP(id schema.ID, ipaddr schema.IPCidr) error {
 	return err
 }
 
+func (d *httpDirectory) FarmPolicyGet(id schema.ID) (policy directorytypes.FarmPolicy, err error) {
+	_, err = d.get(d.url("farms", fmt.Sprint(id), "policy"), nil, &policy, http.StatusOK)
+	return
+}
+
+func (d *httpDirectory) FarmPolicySet(policy directorytypes.FarmPolicy) error {
+	_, err := d.put(d.url("farms", fmt.Sprint(policy.FarmID), "policy"), policy, nil, http.StatusOK)
+	return err
+}
+
+func (d *httpDirectory) FarmSLA(id schema.ID, from, to time.Time) (sla wrkldstypes.FarmSLA, err error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", fmt.Sprint(from.Unix()))
+	}
+	if !to.IsZero() {
+		query.Set("to", fmt.Sprint(to.Unix()))
+	}
+	_, err = d.get(d.url("farms", fmt.Sprint(id), "sla"), query, &sla, http.StatusOK)
+	return
+}
+
+func (d *httpDirectory) DomainChallenge(domain string) (ownership directorytypes.DomainOwnership, err error) {
+	request := struct {
+		Domain string `json:"domain"`
+	}{Domain: domain}
+
+	_, err = d.post(d.url("domains"), request, &ownership, http.StatusCreated)
+	return
+}
+
+func (d *httpDirectory) DomainVerify(domain string) (ownership directorytypes.DomainOwnership, err error) {
+	_, err = d.post(d.url("domains", domain, "verify"), nil, &ownership, http.StatusOK)
+	return
+}
+
+func (d *httpDirectory) DomainList() (ownerships []directorytypes.DomainOwnership, err error) {
+	_, err = d.get(d.url("domains"), nil, &ownerships, http.StatusOK)
+	return
+}
+
+func (d *httpDirectory) DomainDelete(domain string) error {
+	_, err := d.delete(d.url("domains", domain), nil, nil, http.StatusOK)
+	return err
+}
+
 func (d *httpDirectory) Farms(cacheSize int) FarmIter {
 	// pages start at index 1
 	return &httpFarmIter{cl: d, size: cacheSize, page: 1}
@@ -123,6 +172,14 @@ func (d *httpDirectory) NodeList(filter NodeFilter, pager *Pager) (nodes []direc
 	return
 }
 
+func (d *httpDirectory) NodeSearch(filter NodeSearchFilter, pager *Pager) (nodes []directorytypes.NodeSearchResult, err error) {
+	query := url.Values{}
+	pager.apply(query)
+	filter.Apply(query)
+	_, err = d.get(d.url("nodes", "search"), query, &nodes, http.StatusOK)
+	return
+}
+
 func (d *httpDirectory) NodeGet(id string, proofs bool) (node directory.Node, err error) {
 	query := url.Values{}
 	query.Set("proofs", fmt.Sprint(proofs))
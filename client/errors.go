@@ -0,0 +1,44 @@
+package client
+
+import (
+	"github.com/threefoldtech/tfexplorer/mw"
+)
+
+// APIError is an error code returned by the explorer. The errors returned by
+// the client match the APIError of their code with errors.Is
+//
+//	if errors.Is(err, client.ErrPoolInsufficientCapacity) {
+//		// extend the pool
+//	}
+type APIError mw.ErrorCode
+
+func (e APIError) Error() string {
+	return string(e)
+}
+
+// Generic errors, matching all the errors of a response status
+var (
+	ErrBadRequest      = APIError(mw.CodeBadRequest)
+	ErrUnauthorized    = APIError(mw.CodeUnauthorized)
+	ErrPaymentRequired = APIError(mw.CodePaymentRequired)
+	ErrForbidden       = APIError(mw.CodeForbidden)
+	ErrNotFound        = APIError(mw.CodeNotFound)
+	ErrConflict        = APIError(mw.CodeConflict)
+	ErrTooManyRequests = APIError(mw.CodeTooManyRequests)
+	ErrInternal        = APIError(mw.CodeInternal)
+)
+
+// Specific errors
+var (
+	ErrPoolInsufficientCapacity  = APIError(mw.CodePoolInsufficientCapacity)
+	ErrPoolNotFound              = APIError(mw.CodePoolNotFound)
+	ErrSignatureInvalid          = APIError(mw.CodeSignatureInvalid)
+	ErrUserNotFound              = APIError(mw.CodeUserNotFound)
+	ErrNodeNotFound              = APIError(mw.CodeNodeNotFound)
+	ErrFarmNotFound              = APIError(mw.CodeFarmNotFound)
+	ErrGatewayNotFound           = APIError(mw.CodeGatewayNotFound)
+	ErrWorkloadNotFound          = APIError(mw.CodeWorkloadNotFound)
+	ErrWorkloadDependencyInvalid = APIError(mw.CodeWorkloadDependencyInvalid)
+	ErrDomainNotOwned            = APIError(mw.CodeDomainNotOwned)
+	ErrQuotaExceeded             = APIError(mw.CodeQuotaExceeded)
+)
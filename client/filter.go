@@ -3,6 +3,10 @@ package client
 import (
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
+
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
 )
 
 // NodeFilter used to build a query for node list
@@ -105,3 +109,284 @@ func (n NodeFilter) Apply(query url.Values) {
 		query.Set("deleted", fmt.Sprint(*n.deleted))
 	}
 }
+
+// NodeSearchFilter used to build a query for node search, the capacity is
+// the minimum free capacity of the nodes
+type NodeSearchFilter struct {
+	farm          *int64
+	country       *string
+	city          *string
+	cru           *int64
+	mru           *int64
+	sru           *int64
+	hru           *int64
+	publicIPs     *int64
+	ipv6          *bool
+	updatedWithin *time.Duration
+	maxCUPrice    *float64
+	maxSUPrice    *float64
+	area          *[3]float64
+	sort          *string
+}
+
+// WithFarm filter with farm
+func (n NodeSearchFilter) WithFarm(id int64) NodeSearchFilter {
+	n.farm = &id
+	return n
+}
+
+// WithLocation filter with country and city, an empty value is ignored
+func (n NodeSearchFilter) WithLocation(country, city string) NodeSearchFilter {
+	if country != "" {
+		n.country = &country
+	}
+	if city != "" {
+		n.city = &city
+	}
+	return n
+}
+
+// WithFreeCapacity filter with the free capacity, memory and storage in GB
+func (n NodeSearchFilter) WithFreeCapacity(cru, mru, sru, hru int64) NodeSearchFilter {
+	n.cru, n.mru, n.sru, n.hru = &cru, &mru, &sru, &hru
+	return n
+}
+
+// WithPublicIPs filter with the number of free public ips in the farm
+func (n NodeSearchFilter) WithPublicIPs(count int64) NodeSearchFilter {
+	n.publicIPs = &count
+	return n
+}
+
+// WithIPv6 filter with nodes with a public ipv6 config
+func (n NodeSearchFilter) WithIPv6(ipv6 bool) NodeSearchFilter {
+	n.ipv6 = &ipv6
+	return n
+}
+
+// WithUpdatedWithin filter with nodes which reported to the explorer within d
+func (n NodeSearchFilter) WithUpdatedWithin(d time.Duration) NodeSearchFilter {
+	n.updatedWithin = &d
+	return n
+}
+
+// WithMaxPrices filter with the maximum prices of the farm, a zero price is
+// ignored
+func (n NodeSearchFilter) WithMaxPrices(cu, su float64) NodeSearchFilter {
+	if cu > 0 {
+		n.maxCUPrice = &cu
+	}
+	if su > 0 {
+		n.maxSUPrice = &su
+	}
+	return n
+}
+
+// WithArea filter with nodes in radius km around the location
+func (n NodeSearchFilter) WithArea(latitude, longitude, radius float64) NodeSearchFilter {
+	n.area = &[3]float64{latitude, longitude, radius}
+	return n
+}
+
+// WithSort sorts the nodes by price, free capacity (cru, mru, sru, hru) or
+// distance
+func (n NodeSearchFilter) WithSort(sort string) NodeSearchFilter {
+	n.sort = &sort
+	return n
+}
+
+// Apply fills query
+func (n NodeSearchFilter) Apply(query url.Values) {
+	if n.farm != nil {
+		query.Set("farm", fmt.Sprint(*n.farm))
+	}
+
+	if n.country != nil {
+		query.Set("country", *n.country)
+	}
+
+	if n.city != nil {
+		query.Set("city", *n.city)
+	}
+
+	for name, value := range map[string]*int64{
+		"cru":        n.cru,
+		"mru":        n.mru,
+		"sru":        n.sru,
+		"hru":        n.hru,
+		"public_ips": n.publicIPs,
+	} {
+		if value != nil {
+			query.Set(name, fmt.Sprint(*value))
+		}
+	}
+
+	if n.ipv6 != nil {
+		query.Set("ipv6", fmt.Sprint(*n.ipv6))
+	}
+
+	if n.updatedWithin != nil {
+		query.Set("updated_within", fmt.Sprint(int64(n.updatedWithin.Seconds())))
+	}
+
+	if n.maxCUPrice != nil {
+		query.Set("max_cu_price", fmt.Sprint(*n.maxCUPrice))
+	}
+
+	if n.maxSUPrice != nil {
+		query.Set("max_su_price", fmt.Sprint(*n.maxSUPrice))
+	}
+
+	if n.area != nil {
+		query.Set("latitude", fmt.Sprint(n.area[0]))
+		query.Set("longitude", fmt.Sprint(n.area[1]))
+		query.Set("radius", fmt.Sprint(n.area[2]))
+	}
+
+	if n.sort != nil {
+		query.Set("sort", *n.sort)
+	}
+}
+
+// WorkloadFilter used to build a query for workload list
+type WorkloadFilter struct {
+	customer      *int64
+	pool          *int64
+	farm          *int64
+	nodes         []string
+	nextActions   []string
+	workloadTypes []string
+	resultStates  []string
+	from          *time.Time
+	to            *time.Time
+	labels        []string
+	sort          []string
+}
+
+// WithCustomer filter with customer
+func (w WorkloadFilter) WithCustomer(tid int64) WorkloadFilter {
+	w.customer = &tid
+	return w
+}
+
+// WithPool filter with pool
+func (w WorkloadFilter) WithPool(id int64) WorkloadFilter {
+	w.pool = &id
+	return w
+}
+
+// WithFarm filter with workloads deployed in a farm
+func (w WorkloadFilter) WithFarm(id int64) WorkloadFilter {
+	w.farm = &id
+	return w
+}
+
+// WithNodes filter with workloads deployed on any of the nodes
+func (w WorkloadFilter) WithNodes(ids ...string) WorkloadFilter {
+	w.nodes = append(w.nodes, ids...)
+	return w
+}
+
+// WithNextActions filter with any of the next actions
+func (w WorkloadFilter) WithNextActions(actions ...workloads.NextActionEnum) WorkloadFilter {
+	for _, action := range actions {
+		w.nextActions = append(w.nextActions, fmt.Sprint(uint8(action)))
+	}
+	return w
+}
+
+// WithWorkloadTypes filter with any of the workload types
+func (w WorkloadFilter) WithWorkloadTypes(types ...workloads.WorkloadTypeEnum) WorkloadFilter {
+	for _, typ := range types {
+		w.workloadTypes = append(w.workloadTypes, fmt.Sprint(uint8(typ)))
+	}
+	return w
+}
+
+// WithResultStates filter with workloads which have a result in any of the
+// states
+func (w WorkloadFilter) WithResultStates(states ...workloads.ResultStateEnum) WorkloadFilter {
+	for _, state := range states {
+		w.resultStates = append(w.resultStates, fmt.Sprint(uint8(state)))
+	}
+	return w
+}
+
+// WithEpochRange filter with workloads created in the time range, a zero
+// time leaves that side of the range open
+func (w WorkloadFilter) WithEpochRange(from, to time.Time) WorkloadFilter {
+	if !from.IsZero() {
+		w.from = &from
+	}
+	if !to.IsZero() {
+		w.to = &to
+	}
+	return w
+}
+
+// WithLabel filter with workloads which have the label key set to value
+func (w WorkloadFilter) WithLabel(key, value string) WorkloadFilter {
+	w.labels = append(w.labels, key+"="+value)
+	return w
+}
+
+// WithLabelSet filter with workloads which have the label key
+func (w WorkloadFilter) WithLabelSet(key string) WorkloadFilter {
+	w.labels = append(w.labels, key)
+	return w
+}
+
+// WithSort sorts the workloads on the fields, a field prefixed with - is
+// sorted in descending order
+func (w WorkloadFilter) WithSort(fields ...string) WorkloadFilter {
+	w.sort = append(w.sort, fields...)
+	return w
+}
+
+// Apply fills query
+func (w WorkloadFilter) Apply(query url.Values) {
+
+	if w.customer != nil {
+		query.Set("customer_tid", fmt.Sprint(*w.customer))
+	}
+
+	if w.pool != nil {
+		query.Set("pool_id", fmt.Sprint(*w.pool))
+	}
+
+	if w.farm != nil {
+		query.Set("farm_id", fmt.Sprint(*w.farm))
+	}
+
+	if len(w.nodes) != 0 {
+		query.Set("node_id", strings.Join(w.nodes, ","))
+	}
+
+	if len(w.nextActions) != 0 {
+		query.Set("next_action", strings.Join(w.nextActions, ","))
+	}
+
+	if len(w.workloadTypes) != 0 {
+		query.Set("workload_type", strings.Join(w.workloadTypes, ","))
+	}
+
+	if len(w.resultStates) != 0 {
+		query.Set("result_state", strings.Join(w.resultStates, ","))
+	}
+
+	if w.from != nil {
+		query.Set("from_epoch", fmt.Sprint(w.from.Unix()))
+	}
+
+	if w.to != nil {
+		query.Set("to_epoch", fmt.Sprint(w.to.Unix()))
+	}
+
+	for _, label := range w.labels {
+		query.Add("label", label)
+	}
+
+	if len(w.sort) != 0 {
+		query.Set("sort", strings.Join(w.sort, ","))
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/mw"
 	"github.com/zaibon/httpsig"
 )
 
@@ -36,8 +37,11 @@ type httpClient struct {
 // HTTPError is the error type returned by the client
 // it contains the error and the HTTP response
 type HTTPError struct {
-	resp *http.Response
-	err  error
+	resp      *http.Response
+	err       error
+	code      mw.ErrorCode
+	details   json.RawMessage
+	requestID string
 }
 
 func (h HTTPError) Error() string {
@@ -49,6 +53,38 @@ func (h HTTPError) Response() http.Response {
 	return *h.resp
 }
 
+// Code returns the error code returned by the explorer, the generic code of
+// the response status if the explorer did not return any
+func (h HTTPError) Code() mw.ErrorCode {
+	if h.code != "" {
+		return h.code
+	}
+
+	return mw.StatusErrorCode(h.resp.StatusCode)
+}
+
+// Details returns the raw json details of the error, nil if the error has no
+// details
+func (h HTTPError) Details() json.RawMessage {
+	return h.details
+}
+
+// RequestID returns the id the explorer assigned to the failed request
+func (h HTTPError) RequestID() string {
+	return h.requestID
+}
+
+// Is makes the errors returned by the client match the APIError of their
+// code, and the APIError of the generic code of their status
+func (h HTTPError) Is(target error) bool {
+	code, ok := target.(APIError)
+	if !ok {
+		return false
+	}
+
+	return mw.ErrorCode(code) == h.Code() || mw.ErrorCode(code) == mw.StatusErrorCode(h.resp.StatusCode)
+}
+
 func newHTTPClient(raw string, id Identity) (*httpClient, error) {
 	u, err := url.Parse(raw)
 	if err != nil {
@@ -106,7 +142,8 @@ func (c *httpClient) process(response *http.Response, output interface{}, expect
 	dec := json.NewDecoder(response.Body)
 	if !in(response.StatusCode, expect) {
 		var output struct {
-			E string `json:"error"`
+			mw.ErrorBody
+			Details json.RawMessage `json:"details"`
 		}
 
 		if err := dec.Decode(&output); err != nil {
@@ -117,8 +154,11 @@ func (c *httpClient) process(response *http.Response, output interface{}, expect
 		}
 
 		return HTTPError{
-			err:  fmt.Errorf(output.E),
-			resp: response,
+			err:       errors.New(output.Error),
+			resp:      response,
+			code:      output.Code,
+			details:   output.Details,
+			requestID: output.RequestID,
 		}
 	}
 
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/mw"
+)
+
+func TestHTTPErrorIs(t *testing.T) {
+	var response mw.Response
+	server := httptest.NewServer(mw.RequestID(mw.AsHandlerFunc(func(r *http.Request) (interface{}, mw.Response) {
+		return nil, response
+	})))
+	defer server.Close()
+
+	cl, err := newHTTPClient(server.URL, nil)
+	require.NoError(t, err)
+
+	response = mw.PaymentRequired(errors.New("pool needs additional capacity to support this workload")).
+		WithCode(mw.CodePoolInsufficientCapacity).
+		WithDetails(map[string]int64{"pool_id": 1})
+	_, err = cl.get(cl.url("workloads"), nil, nil)
+	require.Error(t, err)
+
+	assert.True(t, errors.Is(err, ErrPoolInsufficientCapacity))
+	assert.True(t, errors.Is(err, ErrPaymentRequired))
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.Contains(t, err.Error(), "pool needs additional capacity")
+
+	var httpErr HTTPError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, mw.CodePoolInsufficientCapacity, httpErr.Code())
+	assert.JSONEq(t, `{"pool_id": 1}`, string(httpErr.Details()))
+	assert.NotEmpty(t, httpErr.RequestID())
+
+	response = mw.NotFound(errors.New("workload not found"))
+	_, err = cl.get(cl.url("workloads", "1"), nil, nil)
+	assert.True(t, errors.Is(errors.Wrap(err, "failed to get workload"), ErrNotFound))
+	assert.False(t, errors.Is(err, ErrWorkloadNotFound))
+}
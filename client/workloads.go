@@ -1,10 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/stellar/go/support/errors"
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
@@ -37,6 +42,24 @@ func (w *httpWorkloads) List(nextAction *workloads.NextActionEnum, customerTid i
 	return
 }
 
+func (w *httpWorkloads) ListWorkloads(filter WorkloadFilter, page *Pager) (list []workloads.Workloader, err error) {
+	query := url.Values{}
+	filter.Apply(query)
+	page.apply(query)
+
+	var result []wrkldstypes.WorkloaderType
+	if _, err = w.get(w.url("reservations", "workloads"), query, &result, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	list = make([]workloads.Workloader, len(result))
+	for i, workload := range result {
+		list[i] = workload.Workloader
+	}
+
+	return list, nil
+}
+
 func (w *httpWorkloads) Get(id schema.ID) (workload workloads.Workloader, err error) {
 	_, err = w.get(w.url("reservations", "workloads", fmt.Sprint(id)), nil, &workload, http.StatusOK)
 	return
@@ -70,9 +93,150 @@ func (w *httpWorkloads) SignDelete(id schema.ID, user schema.ID, signature strin
 	return err
 }
 
+func (w *httpWorkloads) Update(id schema.ID, workload workloads.Workloader) (resp wrklds.WorkloadUpdateResponse, err error) {
+	_, err = w.post(w.url("reservations", "workloads", fmt.Sprint(id), "update"), workload, &resp, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) SetLabels(id schema.ID, labels map[string]string) error {
+	_, err := w.put(w.url("reservations", "workloads", fmt.Sprint(id), "labels"), labels, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) Migrate(id schema.ID, workload workloads.Workloader) (resp wrklds.ReservationCreateResponse, err error) {
+	_, err = w.post(w.url("reservations", "workloads", fmt.Sprint(id), "migrate"), workload, &resp, http.StatusCreated)
+	return
+}
+
+func (w *httpWorkloads) Approve(id schema.ID, signature string) error {
+	request := wrklds.WorkloadApprovalRequest{
+		Approved:  true,
+		Signature: signature,
+	}
+
+	_, err := w.post(w.url("reservations", "workloads", fmt.Sprint(id), "approval"), request, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) Reject(id schema.ID, reason string) error {
+	request := wrklds.WorkloadApprovalRequest{
+		Approved: false,
+		Reason:   reason,
+	}
+
+	_, err := w.post(w.url("reservations", "workloads", fmt.Sprint(id), "approval"), request, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) SetExpiration(id schema.ID, expiresAt time.Time, signature string) error {
+	request := wrklds.WorkloadExpirationRequest{
+		ExpiresAt:         schema.Date{Time: expiresAt},
+		CustomerSignature: signature,
+	}
+
+	_, err := w.post(w.url("reservations", "workloads", fmt.Sprint(id), "expiration"), request, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) Revisions(id schema.ID) (revisions []wrkldstypes.WorkloadRevision, err error) {
+	_, err = w.get(w.url("reservations", "workloads", fmt.Sprint(id), "revisions"), nil, &revisions, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) Events(id schema.ID, page *Pager) (events []wrkldstypes.WorkloadEvent, err error) {
+	query := url.Values{}
+	page.apply(query)
+
+	_, err = w.get(w.url("reservations", "workloads", fmt.Sprint(id), "events"), query, &events, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) GroupCreate(list []workloads.Workloader) (resp wrklds.DeploymentGroupCreateResponse, err error) {
+	request := struct {
+		Workloads []workloads.Workloader `json:"workloads"`
+	}{
+		Workloads: list,
+	}
+
+	_, err = w.post(w.url("reservations", "groups"), request, &resp, http.StatusCreated)
+	return
+}
+
+func (w *httpWorkloads) GroupGet(id schema.ID) (group wrklds.DeploymentGroupInfo, err error) {
+	_, err = w.get(w.url("reservations", "groups", fmt.Sprint(id)), nil, &group, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) GroupList(customerTid int64, page *Pager) (groups []wrklds.DeploymentGroupInfo, err error) {
+	query := url.Values{}
+	if customerTid != 0 {
+		query.Set("customer_tid", fmt.Sprint(customerTid))
+	}
+	page.apply(query)
+
+	_, err = w.get(w.url("reservations", "groups"), query, &groups, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) GroupSignDelete(id schema.ID, signatures []wrkldstypes.DeploymentGroupSignature) error {
+	_, err := w.post(
+		w.url("reservations", "groups", fmt.Sprint(id), "sign", "delete"),
+		wrklds.DeploymentGroupDeleteRequest{Signatures: signatures},
+		nil,
+		http.StatusCreated,
+	)
+
+	return err
+}
+
+func (w *httpWorkloads) IPLeases(customerTid int64, page *Pager) (leases []wrkldstypes.IPLease, err error) {
+	query := url.Values{}
+	if customerTid != 0 {
+		query.Set("customer_tid", fmt.Sprint(customerTid))
+	}
+	page.apply(query)
+
+	_, err = w.get(w.url("reservations", "ips"), query, &leases, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) IPLeaseGet(id schema.ID) (lease wrkldstypes.IPLease, err error) {
+	_, err = w.get(w.url("reservations", "ips", fmt.Sprint(id)), nil, &lease, http.StatusOK)
+	return
+}
+
+func (w *httpWorkloads) IPLeaseHold(id schema.ID, period time.Duration) error {
+	request := wrklds.IPLeaseHoldRequest{HoldPeriod: int64(period.Seconds())}
+
+	_, err := w.put(w.url("reservations", "ips", fmt.Sprint(id), "hold"), request, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) IPLeaseRelease(id schema.ID) error {
+	_, err := w.post(w.url("reservations", "ips", fmt.Sprint(id), "release"), nil, nil, http.StatusOK)
+	return err
+}
+
+func (w *httpWorkloads) IPLeaseTransfer(id schema.ID, poolID int64, signature string) error {
+	request := wrklds.IPLeaseTransferRequest{
+		PoolID:    poolID,
+		Signature: signature,
+	}
+
+	_, err := w.post(w.url("reservations", "ips", fmt.Sprint(id), "transfer"), request, nil, http.StatusOK)
+	return err
+}
+
 func (w *httpWorkloads) NodeWorkloads(nodeID string, from uint64) ([]workloads.Workloader, uint64, error) {
+	return w.NodeWorkloadsWait(nodeID, from, 0, nil)
+}
+
+func (w *httpWorkloads) NodeWorkloadsWait(nodeID string, from uint64, wait time.Duration, key ed25519.PublicKey) ([]workloads.Workloader, uint64, error) {
 	query := url.Values{}
 	query.Set("from", fmt.Sprint(from))
+	if wait > 0 {
+		query.Set("wait", fmt.Sprint(int64(wait/time.Second)))
+	}
 
 	var list []wrkldstypes.WorkloaderType
 
@@ -86,6 +250,19 @@ func (w *httpWorkloads) NodeWorkloads(nodeID string, from uint64) ([]workloads.W
 		return nil, 0, err
 	}
 
+	if key != nil && response.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read response")
+		}
+
+		if _, err := wrklds.VerifyNodeResponse(key, nodeID, response.Header, body); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to verify explorer signature")
+		}
+		response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
 	if err := w.process(response, &list, http.StatusOK); err != nil {
 		return nil, 0, err
 	}
@@ -106,6 +283,20 @@ func (w *httpWorkloads) NodeWorkloads(nodeID string, from uint64) ([]workloads.W
 	return output, lastID, err
 }
 
+func (w *httpWorkloads) SigningKey() (ed25519.PublicKey, error) {
+	var output wrklds.SigningKeyResponse
+	if _, err := w.get(w.url("signing-key"), nil, &output, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(output.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signing key")
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
 func (w *httpWorkloads) NodeWorkloadGet(gwid string) (result workloads.Workloader, err error) {
 	// var output intermediateWL
 	var output wrkldstypes.WorkloaderType
@@ -90,6 +90,102 @@ func main() {
 			},
 			Action: signAndSubmit,
 		},
+		{
+			Name:  "propose",
+			Usage: "Create a recovery proposal for one or more escrow accounts",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "network",
+					Usage:    "Stellar network type",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "asset",
+					Usage:    "Stellar asset",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "destination",
+					Usage:    "Destination address",
+					Required: true,
+				},
+				cli.StringSliceFlag{
+					Name:  "from",
+					Usage: "Escrow account address to recover, can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "accounts",
+					Usage: "File with escrow account addresses to recover, one per line",
+				},
+				cli.StringFlag{
+					Name:  "amount",
+					Usage: "Amount to transfer from every account, if not set the full balance of the asset is transferred",
+				},
+				cli.StringFlag{
+					Name:  "seed",
+					Usage: "Stellar secret key, if set the proposal is signed with it",
+				},
+				cli.DurationFlag{
+					Name:  "valid",
+					Usage: "Time the transactions in the proposal remain valid",
+					Value: proposalValidity,
+				},
+				cli.StringFlag{
+					Name:  "out",
+					Usage: "File to write the proposal to, if not set the proposal is printed base64 encoded",
+				},
+			},
+			Action: propose,
+		},
+		{
+			Name:  "cosign",
+			Usage: "Add a signature to a recovery proposal, this does not need network access",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "seed",
+					Usage:    "Stellar secret key",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "proposal",
+					Usage:    "Proposal file or base64 encoded proposal",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:  "out",
+					Usage: "File to write the signed proposal to, defaults to the proposal file",
+				},
+			},
+			Action: cosign,
+		},
+		{
+			Name:  "status",
+			Usage: "Show which signers signed a recovery proposal against the account thresholds",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "proposal",
+					Usage:    "Proposal file or base64 encoded proposal",
+					Required: true,
+				},
+			},
+			Action: status,
+		},
+		{
+			Name:  "submit",
+			Usage: "Submit the transactions of a recovery proposal which have enough signatures",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "proposal",
+					Usage:    "Proposal file or base64 encoded proposal",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:  "out",
+					Usage: "File to write the updated proposal to, defaults to the proposal file",
+				},
+			},
+			Action: submit,
+		},
 	}
 
 	err := app.Run(os.Args)
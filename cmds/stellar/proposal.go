@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/threefoldtech/tfexplorer/pkg/stellar"
+
+	"github.com/urfave/cli"
+)
+
+// proposalValidity is the default time signers have to sign a recovery proposal
+const proposalValidity = 7 * 24 * time.Hour
+
+// proposalFeeMultiplier is applied on the minimum base fee, since proposals
+// can be submitted a long time after they are created the fee is kept on the
+// high side so the transactions still make it into a ledger when the network is busy
+const proposalFeeMultiplier = 10
+
+// proposal is a set of recovery transactions, one per escrow account, which is
+// passed around between the signers of the escrow accounts until enough
+// signatures are collected to submit the transactions
+type proposal struct {
+	Network      string                `json:"network"`
+	Asset        string                `json:"asset"`
+	Destination  string                `json:"destination"`
+	Transactions []proposalTransaction `json:"transactions"`
+}
+
+// proposalTransaction is a recovery transaction for a single escrow account
+type proposalTransaction struct {
+	Account string `json:"account"`
+	Amount  string `json:"amount"`
+	XDR     string `json:"xdr"`
+	// Hash is set once the transaction is successfully submitted
+	Hash string `json:"hash,omitempty"`
+}
+
+// signatureStatus is the signing state of a proposal transaction, measured
+// against the signers and thresholds of the account
+type signatureStatus struct {
+	Signed    []string
+	Missing   []string
+	Weight    int32
+	Threshold int32
+}
+
+// Complete returns true if enough signatures are collected to submit the transaction
+func (s signatureStatus) Complete() bool {
+	return s.Weight >= s.Threshold
+}
+
+func propose(c *cli.Context) error {
+	network := c.String("network")
+	assetCode := c.String("asset")
+	destination := c.String("destination")
+	amount := c.String("amount")
+
+	accounts, err := proposalAccounts(c.StringSlice("from"), c.String("accounts"))
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return fmt.Errorf("at least one escrow account is required, use --from or --accounts")
+	}
+
+	wallet, err := stellar.New("", network, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	asset, err := wallet.AssetFromCode(assetCode)
+	if err != nil {
+		return errors.Wrap(err, "could not load asset")
+	}
+
+	var kp *keypair.Full
+	if seed := c.String("seed"); seed != "" {
+		kp, err = keypair.ParseFull(seed)
+		if err != nil {
+			return err
+		}
+	}
+
+	p := proposal{
+		Network:     network,
+		Asset:       assetCode,
+		Destination: destination,
+	}
+	timebounds := txnbuild.NewTimeout(int64(c.Duration("valid").Seconds()))
+
+	for _, account := range accounts {
+		tx, err := buildRecoveryTransaction(wallet, account, destination, amount, asset, timebounds)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create recovery transaction for %s", account)
+		}
+
+		if kp != nil {
+			tx.XDR, err = signXDR(tx.XDR, wallet.GetNetworkPassPhrase(), kp)
+			if err != nil {
+				return err
+			}
+		}
+
+		p.Transactions = append(p.Transactions, tx)
+	}
+
+	return writeProposal(p, c.String("out"))
+}
+
+func cosign(c *cli.Context) error {
+	p, err := readProposal(c.String("proposal"))
+	if err != nil {
+		return err
+	}
+
+	kp, err := keypair.ParseFull(c.String("seed"))
+	if err != nil {
+		return err
+	}
+
+	wallet, err := stellar.New("", p.Network, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for i, tx := range p.Transactions {
+		if tx.Hash != "" {
+			continue
+		}
+
+		p.Transactions[i].XDR, err = signXDR(tx.XDR, wallet.GetNetworkPassPhrase(), kp)
+		if err != nil {
+			return errors.Wrapf(err, "failed to sign recovery transaction for %s", tx.Account)
+		}
+	}
+
+	return writeProposal(p, proposalOutput(c))
+}
+
+func status(c *cli.Context) error {
+	p, err := readProposal(c.String("proposal"))
+	if err != nil {
+		return err
+	}
+
+	wallet, err := stellar.New("", p.Network, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Recovery of %s to %s on %s\n\n", p.Asset, p.Destination, p.Network)
+	for _, tx := range p.Transactions {
+		if tx.Hash != "" {
+			fmt.Printf("%s: submitted (%s)\n", tx.Account, tx.Hash)
+			continue
+		}
+
+		account, err := wallet.GetAccountDetails(tx.Account)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get account %s", tx.Account)
+		}
+
+		s, err := proposalSignatureStatus(tx.XDR, wallet.GetNetworkPassPhrase(), account)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check signatures for %s", tx.Account)
+		}
+
+		state := "needs more signatures"
+		if s.Complete() {
+			state = "ready to submit"
+		}
+		fmt.Printf("%s: %s, amount %s, weight %d/%d\n", tx.Account, state, tx.Amount, s.Weight, s.Threshold)
+		fmt.Printf("  signed:  %s\n", strings.Join(s.Signed, ", "))
+		fmt.Printf("  missing: %s\n", strings.Join(s.Missing, ", "))
+	}
+
+	return nil
+}
+
+func submit(c *cli.Context) error {
+	p, err := readProposal(c.String("proposal"))
+	if err != nil {
+		return err
+	}
+
+	wallet, err := stellar.New("", p.Network, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	client, err := wallet.GetHorizonClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to get horizon client")
+	}
+
+	var pending int
+	for i, tx := range p.Transactions {
+		if tx.Hash != "" {
+			continue
+		}
+
+		account, err := wallet.GetAccountDetails(tx.Account)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get account %s", tx.Account)
+		}
+
+		s, err := proposalSignatureStatus(tx.XDR, wallet.GetNetworkPassPhrase(), account)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check signatures for %s", tx.Account)
+		}
+
+		if !s.Complete() {
+			log.Warn().
+				Str("account", tx.Account).
+				Msgf("not enough signatures, weight %d/%d", s.Weight, s.Threshold)
+			pending++
+			continue
+		}
+
+		resp, err := client.SubmitTransactionXDR(tx.XDR)
+		if err != nil {
+			if hError, ok := err.(*horizonclient.Error); ok {
+				log.Debug().Msgf("%+v", hError.Problem.Extras)
+			}
+			log.Error().Err(err).Str("account", tx.Account).Msg("failed to submit recovery transaction")
+			pending++
+			continue
+		}
+
+		log.Info().Str("account", tx.Account).Str("hash", resp.Hash).Msg("recovery transaction submitted")
+		p.Transactions[i].Hash = resp.Hash
+	}
+
+	if err := writeProposal(p, proposalOutput(c)); err != nil {
+		return err
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%d recovery transaction(s) could not be submitted", pending)
+	}
+
+	return nil
+}
+
+// buildRecoveryTransaction creates an unsigned payment transaction which moves
+// amount of asset from the escrow account to the destination. If amount is empty,
+// the full balance of the asset on the account is moved.
+func buildRecoveryTransaction(wallet stellar.Wallet, from, destination, amount string, asset stellar.Asset, timebounds txnbuild.Timebounds) (proposalTransaction, error) {
+	sourceAccount, err := wallet.GetAccountDetails(from)
+	if err != nil {
+		return proposalTransaction{}, errors.Wrap(err, "failed to get source account")
+	}
+
+	if amount == "" {
+		amount = sourceAccount.GetCreditBalance(asset.Code(), asset.Issuer())
+	}
+
+	paymentOP := txnbuild.Payment{
+		Destination: destination,
+		Amount:      amount,
+		Asset: txnbuild.CreditAsset{
+			Code:   asset.Code(),
+			Issuer: asset.Issuer(),
+		},
+	}
+
+	tx, err := txnbuild.NewTransaction(
+		txnbuild.TransactionParams{
+			SourceAccount:        &sourceAccount,
+			IncrementSequenceNum: true,
+			Operations:           []txnbuild.Operation{&paymentOP},
+			Timebounds:           timebounds,
+			BaseFee:              txnbuild.MinBaseFee * proposalFeeMultiplier,
+		},
+	)
+	if err != nil {
+		return proposalTransaction{}, errors.Wrap(err, "failed to build transaction")
+	}
+
+	txXDR, err := tx.Base64()
+	if err != nil {
+		return proposalTransaction{}, errors.Wrap(err, "failed to parse transaction to xdr")
+	}
+
+	return proposalTransaction{
+		Account: from,
+		Amount:  amount,
+		XDR:     txXDR,
+	}, nil
+}
+
+// signXDR adds the signature of kp to the transaction, unless the transaction
+// is already signed by kp
+func signXDR(txXDR, passphrase string, kp *keypair.Full) (string, error) {
+	tx, err := parseTransaction(txXDR)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := tx.Hash(passphrase)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash transaction")
+	}
+
+	if hasSigned(tx.Signatures(), hash, kp.Address()) {
+		return txXDR, nil
+	}
+
+	tx, err = tx.Sign(passphrase, kp)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign transaction")
+	}
+
+	return tx.Base64()
+}
+
+// proposalSignatureStatus checks which of the account signers signed the
+// transaction. The threshold is the medium threshold of the account, which is
+// the one required for payments.
+func proposalSignatureStatus(txXDR, passphrase string, account hProtocol.Account) (signatureStatus, error) {
+	tx, err := parseTransaction(txXDR)
+	if err != nil {
+		return signatureStatus{}, err
+	}
+
+	hash, err := tx.Hash(passphrase)
+	if err != nil {
+		return signatureStatus{}, errors.Wrap(err, "failed to hash transaction")
+	}
+
+	s := signatureStatus{Threshold: int32(account.Thresholds.MedThreshold)}
+	// a threshold of 0 still requires a signature with a non zero weight
+	if s.Threshold == 0 {
+		s.Threshold = 1
+	}
+
+	for _, signer := range account.Signers {
+		if signer.Weight == 0 {
+			continue
+		}
+
+		if hasSigned(tx.Signatures(), hash, signer.Key) {
+			s.Signed = append(s.Signed, signer.Key)
+			s.Weight += signer.Weight
+		} else {
+			s.Missing = append(s.Missing, signer.Key)
+		}
+	}
+
+	return s, nil
+}
+
+// hasSigned checks if one of the signatures is a valid signature of address for the
+// transaction hash
+func hasSigned(signatures []xdr.DecoratedSignature, hash [32]byte, address string) bool {
+	kp, err := keypair.ParseAddress(address)
+	if err != nil {
+		// not an ed25519 signer, i.e. a hash or pre-authorized transaction
+		return false
+	}
+
+	hint := kp.Hint()
+	for _, sig := range signatures {
+		if sig.Hint != hint {
+			continue
+		}
+		if err := kp.Verify(hash[:], sig.Signature); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseTransaction(txXDR string) (*txnbuild.Transaction, error) {
+	generic, err := txnbuild.TransactionFromXDR(txXDR)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parse xdr to a transaction")
+	}
+
+	tx, ok := generic.Transaction()
+	if !ok {
+		return nil, fmt.Errorf("failed to unwrap transaction")
+	}
+
+	return tx, nil
+}
+
+// proposalAccounts merges the accounts given on the command line with the
+// accounts listed in file, one address per line
+func proposalAccounts(from []string, file string) ([]string, error) {
+	accounts := append([]string{}, from...)
+	if file == "" {
+		return accounts, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read accounts file")
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		accounts = append(accounts, line)
+	}
+
+	return accounts, nil
+}
+
+// proposalOutput returns where an updated proposal must be written. If no
+// explicit output is given, a proposal loaded from a file is updated in place
+func proposalOutput(c *cli.Context) string {
+	if out := c.String("out"); out != "" {
+		return out
+	}
+
+	if _, err := os.Stat(c.String("proposal")); err == nil {
+		return c.String("proposal")
+	}
+
+	return ""
+}
+
+// readProposal loads a proposal either from a file or from its base64 encoding
+func readProposal(input string) (proposal, error) {
+	var p proposal
+
+	data, err := ioutil.ReadFile(input)
+	if os.IsNotExist(err) {
+		data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(input))
+		if err != nil {
+			return p, errors.Wrap(err, "proposal is neither a file nor valid base64")
+		}
+	} else if err != nil {
+		return p, errors.Wrap(err, "failed to read proposal")
+	}
+
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, errors.Wrap(err, "failed to decode proposal")
+	}
+
+	return p, nil
+}
+
+// writeProposal writes the proposal as json to the out file, or prints it
+// base64 encoded if out is empty, so it can be passed around as text
+func writeProposal(p proposal, out string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode proposal")
+	}
+
+	if out == "" {
+		fmt.Println(base64.StdEncoding.EncodeToString(data))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write proposal")
+	}
+
+	log.Info().Str("file", out).Msg("proposal written")
+	return nil
+}
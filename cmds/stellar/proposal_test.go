@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProposalSignatureStatus(t *testing.T) {
+	escrow := keypair.MustRandom()
+	signers := []*keypair.Full{keypair.MustRandom(), keypair.MustRandom(), keypair.MustRandom()}
+
+	account := hProtocol.Account{
+		AccountID:  escrow.Address(),
+		Thresholds: hProtocol.AccountThresholds{MedThreshold: 2},
+		Signers: []hProtocol.Signer{
+			// the master key of the escrow is disabled for the purpose of this test
+			{Key: escrow.Address(), Weight: 0},
+		},
+	}
+	for _, s := range signers {
+		account.Signers = append(account.Signers, hProtocol.Signer{Key: s.Address(), Weight: 1})
+	}
+
+	source := txnbuild.NewSimpleAccount(escrow.Address(), 1)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &source,
+		Operations: []txnbuild.Operation{&txnbuild.Payment{
+			Destination: signers[0].Address(),
+			Amount:      "10",
+			Asset:       txnbuild.NativeAsset{},
+		}},
+		Timebounds: txnbuild.NewTimeout(int64(proposalValidity.Seconds())),
+		BaseFee:    txnbuild.MinBaseFee,
+	})
+	require.NoError(t, err)
+
+	txXDR, err := tx.Base64()
+	require.NoError(t, err)
+
+	s, err := proposalSignatureStatus(txXDR, network.TestNetworkPassphrase, account)
+	require.NoError(t, err)
+	assert.False(t, s.Complete())
+	assert.Empty(t, s.Signed)
+	assert.Len(t, s.Missing, 3)
+
+	txXDR, err = signXDR(txXDR, network.TestNetworkPassphrase, signers[0])
+	require.NoError(t, err)
+
+	// signing twice with the same key must not add a second signature
+	again, err := signXDR(txXDR, network.TestNetworkPassphrase, signers[0])
+	require.NoError(t, err)
+	assert.Equal(t, txXDR, again)
+
+	// a signature for another network is not counted
+	other, err := signXDR(txXDR, network.PublicNetworkPassphrase, signers[1])
+	require.NoError(t, err)
+	s, err = proposalSignatureStatus(other, network.TestNetworkPassphrase, account)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), s.Weight)
+	assert.False(t, s.Complete())
+
+	txXDR, err = signXDR(txXDR, network.TestNetworkPassphrase, signers[2])
+	require.NoError(t, err)
+
+	s, err = proposalSignatureStatus(txXDR, network.TestNetworkPassphrase, account)
+	require.NoError(t, err)
+	assert.True(t, s.Complete())
+	assert.Equal(t, int32(2), s.Weight)
+	assert.Equal(t, int32(2), s.Threshold)
+	assert.ElementsMatch(t, []string{signers[0].Address(), signers[2].Address()}, s.Signed)
+	assert.Equal(t, []string{signers[1].Address()}, s.Missing)
+}
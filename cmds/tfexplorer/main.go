@@ -3,6 +3,8 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
@@ -27,6 +29,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/rakyll/statik/fs"
 	"github.com/threefoldtech/tfexplorer/config"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
 	"github.com/threefoldtech/tfexplorer/mw"
 	"github.com/threefoldtech/tfexplorer/pkg/capacity"
 	capacitydb "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
@@ -34,6 +37,7 @@ import (
 	"github.com/threefoldtech/tfexplorer/pkg/escrow"
 	escrowdb "github.com/threefoldtech/tfexplorer/pkg/escrow/types"
 	"github.com/threefoldtech/tfexplorer/pkg/gridnetworks"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
 	"github.com/threefoldtech/tfexplorer/pkg/phonebook"
 	"github.com/threefoldtech/tfexplorer/pkg/stellar"
 	"github.com/threefoldtech/tfexplorer/pkg/workloads"
@@ -54,6 +58,13 @@ type flags struct {
 	backupSigners      stellar.Signers
 	enablePProf        bool
 	prometheusPort     int64
+	signingSeed        string
+	quota              mw.QuotaLimits
+	quotaOverrides     mw.QuotaOverrides
+	convert            bool
+	disableLegacy      bool
+	archiveAfter       int64
+	archiveExport      string
 }
 
 func main() {
@@ -73,7 +84,17 @@ func main() {
 	flag.BoolVar(&f.flushEscrows, "flush-escrows", false, "flush all escrows in the database, including currently active ones, and their associated addressses")
 	flag.BoolVar(&f.enablePProf, "pprof", false, "enable pprof")
 	flag.Int64Var(&f.prometheusPort, "prometheus-port", 3200, "port the run the prometheus server on")
-	flag.StringVar(&config.Config.HorizonURL, "horizon", "", "Horizon server URL to communicate with")
+	flag.Var(&config.Config.HorizonURLs, "horizon", "reusable flag which adds a horizon server URL to communicate with, the fastest healthy server is used. defaults to the public horizon server of the network")
+	flag.StringVar(&f.signingSeed, "signing-seed", "", "hex encoded ed25519 seed used to sign the workloads sent to the nodes, responses are not signed if not set")
+	flag.Var(&config.Config.Assets, "asset", "reusable flag which adds a supported stellar asset in the form <CODE>:<ISSUER>[:<USD_RATE>], the asset is accepted for capacity if the usd rate is set. defaults to TFT if not set")
+	flag.Int64Var(&f.quota.Workloads, "quota-workloads", 0, "maximum number of active workloads per user, 0 means unlimited")
+	flag.Int64Var(&f.quota.UnpaidReservations, "quota-unpaid-pools", 0, "maximum number of capacity reservations waiting for payment per user, 0 means unlimited")
+	flag.Int64Var(&f.quota.Rate, "quota-rate", 0, "maximum number of workload and pool creation requests per minute per user, 0 means unlimited")
+	flag.Var(&f.quotaOverrides, "quota-override", "reusable flag which overrides the quotas of a user in the form <tid>:<workloads>:<unpaid pools>:<rate>, 0 means unlimited")
+	flag.BoolVar(&f.convert, "convert-reservations", false, "convert the deployed legacy reservations of all users into workloads and exit")
+	flag.BoolVar(&f.disableLegacy, "disable-legacy-reservations", false, "stop serving the legacy reservations, the explorer refuses to start while deployed reservations are not converted")
+	flag.Int64Var(&f.archiveAfter, "archive-after", 0, "number of days after which deleted workloads are moved to the archive, 0 means never")
+	flag.StringVar(&f.archiveExport, "archive-export", "", "directory where the archived workloads are also exported as compressed JSON lines files, not exported if not set")
 
 	flag.Parse()
 
@@ -161,6 +182,7 @@ func createServer(f flags, client *mongo.Client, dropEscrowData bool) (*http.Ser
 		muxprom.Namespace("explorer"),
 	)
 	prom.Instrument()
+	router.Use(mw.RequestID)
 	router.Use(db.Middleware)
 
 	router.Path("/metrics").Handler(promhttp.Handler()).Name("metrics")
@@ -182,6 +204,14 @@ func createServer(f flags, client *mongo.Client, dropEscrowData bool) (*http.Ser
 		os.Exit(0)
 	}
 
+	if config.Config.WalletNetwork != "" {
+		config.Config.Horizon, err = stellar.NewHorizonPool(config.Config.WalletNetwork, config.Config.HorizonURLs)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create horizon pool")
+		}
+		go config.Config.Horizon.Run(context.Background())
+	}
+
 	var e escrow.Escrow
 	if f.seed != "" {
 		log.Info().Msgf("escrow enabled on %s", config.Config.WalletNetwork)
@@ -189,7 +219,7 @@ func createServer(f flags, client *mongo.Client, dropEscrowData bool) (*http.Ser
 			log.Fatal().Err(err).Msg("failed to create escrow database indexes")
 		}
 
-		wallet, err := stellar.New(f.seed, config.Config.WalletNetwork, f.backupSigners, config.Config.HorizonURL)
+		wallet, err := stellar.New(f.seed, config.Config.WalletNetwork, f.backupSigners, config.Config.Horizon, config.Config.Assets)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to create stellar wallet")
 		}
@@ -212,7 +242,18 @@ func createServer(f flags, client *mongo.Client, dropEscrowData bool) (*http.Ser
 		router.PathPrefix("/debug/").Handler(http.DefaultServeMux)
 	}
 
-	if err := directory.Setup(router, db.Database()); err != nil {
+	// the farms without custom pricing use the explorer prices
+	divisor, err := gridnetworks.GridNetwork(config.Config.TFNetwork).Divisor()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to get network divisor")
+	}
+	prices := generated.NodeCloudUnitPrice{
+		CU:    float64(escrow.CuPriceDollarMonth) / float64(divisor),
+		SU:    float64(escrow.SuPriceDollarMonth) / float64(divisor),
+		IPv4U: float64(escrow.IP4uPriceDollarMonth) / float64(divisor),
+	}
+
+	if err := directory.Setup(router, db.Database(), prices); err != nil {
 		log.Fatal().Err(err).Msg("failed to register directory package")
 	}
 
@@ -224,18 +265,70 @@ func createServer(f flags, client *mongo.Client, dropEscrowData bool) (*http.Ser
 		log.Fatal().Err(err).Msg("failed to create capacity database indexes")
 	}
 
+	var signer ed25519.PrivateKey
+	if f.signingSeed != "" {
+		seed, err := hex.DecodeString(f.signingSeed)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatal().Msg("signing seed must be a hex encoded ed25519 seed")
+		}
+		signer = ed25519.NewKeyFromSeed(seed)
+		log.Info().Str("public key", hex.EncodeToString(signer.Public().(ed25519.PublicKey))).Msg("signing node responses")
+	}
+
 	planner := capacity.NewNaivePlanner(e, db.Database())
 	go planner.Run(context.Background())
-	if err = workloads.Setup(router, db.Database(), gridnetworks.GridNetwork(config.Config.TFNetwork), e, planner); err != nil {
+
+	if f.convert {
+		log.Info().Msg("converting legacy reservations")
+		report, err := workloads.ConvertReservations(context.Background(), db.Database(), planner)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to convert legacy reservations")
+		}
+		log.Info().
+			Int("users", report.Users).
+			Int("workloads", report.Workloads).
+			Int("skipped", report.Skipped).
+			Int("failed", report.Failed).
+			Msg("legacy reservations converted. restart the explorer without \"convert-reservations\" flag")
+		os.Exit(0)
+	}
+
+	if f.disableLegacy {
+		pending, err := workloads.UnconvertedCustomers(context.Background(), db.Database())
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to check the conversion of legacy reservations")
+		}
+		if len(pending) > 0 {
+			log.Fatal().Int("users", len(pending)).Msg("deployed legacy reservations are not converted yet. run the explorer with \"convert-reservations\" flag first")
+		}
+	}
+
+	if err = workloads.Setup(router, db.Database(), gridnetworks.GridNetwork(config.Config.TFNetwork), e, planner, signer, mw.NewQuota(f.quota, f.quotaOverrides), !f.disableLegacy); err != nil {
 		log.Error().Err(err).Msg("failed to register workloads package")
 	}
 
+	openapi.Register(router, "/api/v1", "openapi-v1", openapi.Info{
+		Title:       "Threefold explorer API",
+		Description: "API of the threefold grid explorer",
+		Version:     "v1",
+	}, openapi.Merge(directory.Docs, phonebook.Docs, workloads.Docs))
+	openapi.Register(router, "/explorer", "openapi-legacy", openapi.Info{
+		Title:       "Threefold explorer legacy API",
+		Description: "legacy API of the threefold grid explorer, use the v1 API instead",
+		Version:     "legacy",
+	}, openapi.Merge(directory.LegacyDocs, phonebook.LegacyDocs, workloads.LegacyDocs))
+
+	if f.archiveAfter > 0 {
+		archiver := workloads.NewArchiver(db.Database(), time.Duration(f.archiveAfter)*24*time.Hour, f.archiveExport)
+		go archiver.Run(context.Background())
+	}
+
 	log.Printf("start on %s\n", f.listen)
-	r := handlers.LoggingHandler(os.Stderr, router)
+	r := handlers.LoggingHandler(os.Stderr, mw.FlusherMiddleware(router))
 	r = handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedHeaders([]string{"Content-Type"}),
-		handlers.ExposedHeaders([]string{"Pages"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Last-Event-ID"}),
+		handlers.ExposedHeaders([]string{"Pages", "Link", "X-Total-Count", "Retry-After"}),
 	)(r)
 
 	return &http.Server{
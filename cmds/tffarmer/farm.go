@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/threefoldtech/tfexplorer/client"
@@ -180,6 +184,77 @@ func listFarms(c *cli.Context) (err error) {
 	return nil
 }
 
+func farmSLA(c *cli.Context) (err error) {
+	from, to, err := slaPeriod(c.String("month"), c.String("from"), c.String("to"))
+	if err != nil {
+		return err
+	}
+
+	format := c.String("format")
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unsupported format '%s', use json or csv", format)
+	}
+
+	sla, err := db.FarmSLA(schema.ID(c.Int64("id")), from, to)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the farm sla")
+	}
+
+	var out io.Writer = os.Stdout
+	if path := c.String("output"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to create output file")
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = f
+	}
+
+	if format == "csv" {
+		return sla.WriteCSV(out)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sla)
+}
+
+// slaPeriod returns the period of a farm sla, either a month or the days
+// between from and to. Zero times let the explorer use the current month.
+func slaPeriod(month, from, to string) (start time.Time, end time.Time, err error) {
+	const day = "2006-01-02"
+
+	if month != "" {
+		if from != "" || to != "" {
+			return start, end, fmt.Errorf("a period is either a month or a from and to date")
+		}
+		start, err = time.Parse("2006-01", month)
+		if err != nil {
+			return start, end, errors.Wrap(err, "invalid month")
+		}
+		return start, start.AddDate(0, 1, 0), nil
+	}
+
+	if from != "" {
+		if start, err = time.Parse(day, from); err != nil {
+			return start, end, errors.Wrap(err, "invalid from date")
+		}
+	}
+	if to != "" {
+		if end, err = time.Parse(day, to); err != nil {
+			return start, end, errors.Wrap(err, "invalid to date")
+		}
+		// the last day is part of the period
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return start, end, nil
+}
+
 func splitAddressCode(addr string) (string, string, error) {
 	ss := strings.Split(addr, ":")
 	if len(ss) != 2 {
@@ -193,6 +193,40 @@ func main() {
 					Flags:    []cli.Flag{},
 					Action:   listFarms,
 				},
+				{
+					Name:     "sla",
+					Usage:    "report the availability of the nodes of a farm over a billing period",
+					Category: "identity",
+					Flags: []cli.Flag{
+						cli.Int64Flag{
+							Name:     "id",
+							Usage:    "farm ID",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:  "month",
+							Usage: "billing period as YYYY-MM, defaults to the current month",
+						},
+						cli.StringFlag{
+							Name:  "from",
+							Usage: "start of the period as YYYY-MM-DD, instead of a month",
+						},
+						cli.StringFlag{
+							Name:  "to",
+							Usage: "last day of the period as YYYY-MM-DD, included, instead of a month",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Usage: "output format, json or csv",
+							Value: "json",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "file to write the report to, defaults to stdout",
+						},
+					},
+					Action: farmSLA,
+				},
 			},
 		},
 		{
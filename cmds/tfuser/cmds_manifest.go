@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/provision"
+	"github.com/urfave/cli"
+)
+
+func loadManifestPlan(c *cli.Context) (*provision.ReservationClient, *provision.Plan, error) {
+	f, err := os.Open(c.String("file"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open manifest")
+	}
+	defer f.Close()
+
+	manifest, err := provision.LoadManifest(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reservationClient := provision.NewReservationClient(bcdb, mainui)
+	plan, err := reservationClient.Plan(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reservationClient, plan, nil
+}
+
+func printPlan(c *cli.Context, plan *provision.Plan) error {
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	if plan.Empty() {
+		fmt.Printf("manifest %s: %d workloads up to date, nothing to do\n", plan.Manifest, len(plan.Unchanged))
+		return nil
+	}
+
+	fmt.Printf("manifest %s: %d workloads up to date, %d actions\n", plan.Manifest, len(plan.Unchanged), len(plan.Actions))
+	for _, action := range plan.Actions {
+		fmt.Printf("  %s\n", action)
+	}
+
+	return nil
+}
+
+func cmdsManifestPlan(c *cli.Context) error {
+	_, plan, err := loadManifestPlan(c)
+	if err != nil {
+		return err
+	}
+
+	return printPlan(c, plan)
+}
+
+func cmdsManifestApply(c *cli.Context) error {
+	reservationClient, plan, err := loadManifestPlan(c)
+	if err != nil {
+		return err
+	}
+
+	if err := printPlan(c, plan); err != nil {
+		return err
+	}
+
+	if plan.Empty() {
+		return nil
+	}
+
+	if !c.Bool("yes") {
+		fmt.Print("apply these actions? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		if answer != "y" && answer != "yes" {
+			return fmt.Errorf("apply canceled")
+		}
+	}
+
+	err = reservationClient.Apply(plan)
+	for _, action := range plan.Actions {
+		if action.Type == provision.ActionCreate && action.WorkloadID != 0 {
+			fmt.Printf("created %s: ID %d\n", action.Reference, action.WorkloadID)
+		}
+	}
+
+	return err
+}
@@ -489,6 +489,49 @@ func main() {
 			},
 			Action: cmdsProvision,
 		},
+		{
+			Name:   "manifest",
+			Usage:  "Deploy the workloads described in a YAML manifest",
+			Before: requireSeed,
+			Subcommands: []cli.Command{
+				{
+					Name:  "plan",
+					Usage: "show the actions needed to bring the live workloads in line with the manifest",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "path to the manifest",
+							Required: true,
+						},
+						cli.BoolFlag{
+							Name:  "json",
+							Usage: "print the plan as json",
+						},
+					},
+					Action: cmdsManifestPlan,
+				},
+				{
+					Name:  "apply",
+					Usage: "create and delete workloads so the live workloads match the manifest",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "path to the manifest",
+							Required: true,
+						},
+						cli.BoolFlag{
+							Name:  "json",
+							Usage: "print the plan as json",
+						},
+						cli.BoolFlag{
+							Name:  "yes, y",
+							Usage: "apply the plan without asking for confirmation",
+						},
+					},
+					Action: cmdsManifestApply,
+				},
+			},
+		},
 		{
 			Name:   "delete",
 			Usage:  "Mark a workload as to be deleted",
@@ -13,7 +13,14 @@ import (
 type Settings struct {
 	WalletNetwork string
 	TFNetwork     string
-	HorizonURL    string
+	// HorizonURLs are the horizon endpoints to use, if empty the default
+	// endpoint of the wallet network is used
+	HorizonURLs stellar.HorizonURLs
+	// Horizon is the pool of horizon endpoints created from HorizonURLs,
+	// shared by the wallet and the address validation
+	Horizon *stellar.HorizonPool
+	// Assets supported by the wallet. If empty, the default assets are used
+	Assets stellar.Assets
 }
 
 var (
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cursor is the position in a keyset paginated list, it is sent to the
+// client as an opaque string
+type cursor struct {
+	After schema.ID `json:"after"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.Wrap(err, "invalid cursor")
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, errors.Wrap(err, "invalid cursor")
+	}
+
+	return c, nil
+}
+
+// Pagination is how a list request is paginated.
+//
+// Lists are paginated with page and size by default, which skips over all
+// the previous pages and counts the whole list to fill the Pages header. If
+// the cursor parameter is set (an empty cursor is the first page) the list
+// is paginated on _id instead, and the cursor of the next page is returned
+// in the Link header. Counting is then only done if count=true.
+type Pagination struct {
+	size   int64
+	page   int64
+	keyset bool
+	cursor cursor
+	count  bool
+}
+
+// PaginationFromRequest return pagination information from the page, size,
+// cursor and count url params
+func PaginationFromRequest(r *http.Request) (Pagination, error) {
+	if s := r.FormValue("size"); len(s) != 0 {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size <= 0 {
+			return Pagination{}, fmt.Errorf("size should be a positive number")
+		}
+	}
+
+	pager := PageFromRequest(r)
+	p := Pagination{
+		size: *pager.Limit,
+		page: *pager.Skip / *pager.Limit,
+	}
+
+	query := r.URL.Query()
+	if values, ok := query["cursor"]; ok {
+		p.keyset = true
+		if len(values[0]) != 0 {
+			c, err := decodeCursor(values[0])
+			if err != nil {
+				return p, err
+			}
+			p.cursor = c
+		}
+	}
+
+	p.count = !p.keyset
+	if s := query.Get("count"); len(s) != 0 {
+		count, err := strconv.ParseBool(s)
+		if err != nil {
+			return p, errors.Wrap(err, "count should be a boolean")
+		}
+		p.count = count
+	}
+
+	return p, nil
+}
+
+// Size is the maximum number of items in a page
+func (p Pagination) Size() int64 {
+	return p.size
+}
+
+// Keyset returns true if the list is paginated with a cursor
+func (p Pagination) Keyset() bool {
+	return p.keyset
+}
+
+// Count returns true if the list needs to be counted
+func (p Pagination) Count() bool {
+	return p.count
+}
+
+// Filter returns the condition on _id which selects the items after the
+// cursor, it is empty for the first page. If desc is true the list is sorted
+// in descending _id order.
+func (p Pagination) Filter(desc bool) bson.D {
+	if !p.keyset || p.cursor.After == 0 {
+		return bson.D{}
+	}
+
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+
+	return bson.D{{Key: "_id", Value: bson.M{op: p.cursor.After}}}
+}
+
+// FindOptions returns the find options of the page, sorted on _id. In
+// keyset mode one more item than the page size is loaded, so Trim can tell
+// if there is a next page.
+func (p Pagination) FindOptions() *options.FindOptions {
+	if !p.keyset {
+		return Page(p.page, p.size)
+	}
+
+	return options.Find().SetLimit(p.size + 1).SetSort(bson.D{{Key: "_id", Value: 1}})
+}
+
+// Trim returns the number of the loaded items which are part of the page,
+// and if there are more items after the page
+func (p Pagination) Trim(n int) (int, bool) {
+	if p.keyset && int64(n) > p.size {
+		return int(p.size), true
+	}
+
+	return n, false
+}
+
+// Pages returns the number of pages for the total number of items
+func (p Pagination) Pages(total int64) int64 {
+	return NrPages(total, p.size)
+}
+
+// Next returns the url of the page after the given last item of the current
+// page, it keeps all the other parameters of the request
+func (p Pagination) Next(r *http.Request, last schema.ID) string {
+	query := r.URL.Query()
+	query.Del("page")
+	query.Set("cursor", cursor{After: last}.encode())
+
+	return fmt.Sprintf("%s?%s", r.URL.Path, query.Encode())
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPaginationPage(t *testing.T) {
+	r := httptest.NewRequest("GET", "/nodes?page=3&size=20", nil)
+	p, err := PaginationFromRequest(r)
+	require.NoError(t, err)
+
+	assert.False(t, p.Keyset())
+	assert.True(t, p.Count())
+	assert.Equal(t, bson.D{}, p.Filter(false))
+
+	opts := p.FindOptions()
+	assert.Equal(t, int64(20), *opts.Limit)
+	assert.Equal(t, int64(40), *opts.Skip)
+
+	n, more := p.Trim(20)
+	assert.Equal(t, 20, n)
+	assert.False(t, more)
+
+	for _, size := range []string{"0", "-1", "many"} {
+		_, err := PaginationFromRequest(httptest.NewRequest("GET", "/nodes?size="+size, nil))
+		assert.Error(t, err, size)
+	}
+}
+
+func TestPaginationCursor(t *testing.T) {
+	r := httptest.NewRequest("GET", "/nodes?cursor=&size=2&farm=1&page=4", nil)
+	p, err := PaginationFromRequest(r)
+	require.NoError(t, err)
+
+	assert.True(t, p.Keyset())
+	assert.False(t, p.Count())
+	assert.Equal(t, bson.D{}, p.Filter(false))
+	assert.Equal(t, int64(3), *p.FindOptions().Limit)
+	assert.Nil(t, p.FindOptions().Skip)
+
+	n, more := p.Trim(3)
+	assert.Equal(t, 2, n)
+	assert.True(t, more)
+
+	next, err := url.Parse(p.Next(r, 12))
+	require.NoError(t, err)
+	assert.Equal(t, "/nodes", next.Path)
+	assert.Equal(t, "1", next.Query().Get("farm"))
+	assert.Empty(t, next.Query().Get("page"))
+
+	r = httptest.NewRequest("GET", next.String()+"&count=true", nil)
+	p, err = PaginationFromRequest(r)
+	require.NoError(t, err)
+
+	assert.True(t, p.Count())
+	assert.Equal(t, bson.D{{Key: "_id", Value: bson.M{"$gt": schema.ID(12)}}}, p.Filter(false))
+	assert.Equal(t, bson.D{{Key: "_id", Value: bson.M{"$lt": schema.ID(12)}}}, p.Filter(true))
+
+	_, err = PaginationFromRequest(httptest.NewRequest("GET", "/nodes?cursor=garbage", nil))
+	assert.Error(t, err)
+}
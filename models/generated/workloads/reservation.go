@@ -32,6 +32,8 @@ const (
 	NextActionInvalid
 	NextActionDeleted
 	NextActionMigrated
+	// NextActionApprove workloads wait for the farmer to approve them
+	NextActionApprove
 )
 
 func (e NextActionEnum) String() string {
@@ -50,6 +52,8 @@ func (e NextActionEnum) String() string {
 		return "invalid"
 	case NextActionDeleted:
 		return "deleted"
+	case NextActionApprove:
+		return "approve"
 	}
 	return "UNKNOWN"
 }
@@ -114,3 +114,41 @@ func TestContainerSigningChalenge(t *testing.T) {
 	err = crypto.Verify(kp.PublicKey, msg[:], signature)
 	assert.Error(t, err)
 }
+
+func TestExpirationSigningChalenge(t *testing.T) {
+	v := &Volume{
+		ReservationInfo: ReservationInfo{
+			CustomerTid:  1,
+			ID:           1,
+			WorkloadId:   1,
+			PoolId:       1,
+			Epoch:        schema.Date{Time: time.Now()},
+			WorkloadType: WorkloadTypeVolume,
+			NodeId:       "node1",
+		},
+		Size: 1,
+		Type: VolumeTypeSSD,
+	}
+
+	sc, err := v.SignatureChallenge()
+	require.NoError(t, err)
+
+	// a workload decoded from json without expiration has the unix epoch as
+	// expiration, the challenge must not change for existing workloads
+	v.ExpiresAt = schema.Date{Time: time.Unix(0, 0)}
+	require.False(t, v.HasExpiration())
+	unset, err := v.SignatureChallenge()
+	require.NoError(t, err)
+	assert.Equal(t, sc, unset)
+
+	v.ExpiresAt = schema.Date{Time: time.Now().Add(time.Hour)}
+	require.True(t, v.HasExpiration())
+	expiring, err := v.SignatureChallenge()
+	require.NoError(t, err)
+	assert.NotEqual(t, sc, expiring)
+
+	v.ExpiresAt = schema.Date{Time: v.ExpiresAt.Add(time.Hour)}
+	extended, err := v.SignatureChallenge()
+	require.NoError(t, err)
+	assert.NotEqual(t, expiring, extended)
+}
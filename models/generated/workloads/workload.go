@@ -56,6 +56,21 @@ type (
 		GetReference() string
 		GetVersion() int
 		SetVersion(version int)
+		GetLabels() map[string]string
+		SetLabels(labels map[string]string)
+		GetExpiresAt() schema.Date
+		SetExpiresAt(date schema.Date)
+		HasExpiration() bool
+		GetMigratedFrom() schema.ID
+		SetMigratedFrom(id schema.ID)
+		GetMigratedTo() schema.ID
+		SetMigratedTo(id schema.ID)
+		GetConvertedFrom() schema.ID
+		SetConvertedFrom(id schema.ID)
+		IsExplorerConverted() bool
+		SetExplorerConverted(converted bool)
+		GetDeletedAt() schema.Date
+		SetDeletedAt(date schema.Date)
 
 		Capaciter
 	}
@@ -236,6 +251,31 @@ type ReservationInfo struct {
 	Result              Result             `bson:"result" json:"result"`
 	WorkloadType        WorkloadTypeEnum   `bson:"workload_type" json:"workload_type"`
 	Version             int                `bson:"version" json:"version"`
+
+	// ExpiresAt is the time the workload is deleted at, if it is set. It is
+	// part of the signature challenge
+	ExpiresAt schema.Date `bson:"expires_at" json:"expires_at"`
+
+	// Labels are user defined key/value pairs used to organize and search
+	// workloads, they are not part of the signature challenge
+	Labels map[string]string `bson:"labels,omitempty" json:"labels,omitempty"`
+
+	// MigratedFrom is the workload this workload replaces on another node,
+	// and MigratedTo the workload replacing this one. They are set by the
+	// explorer and are not part of the signature challenge
+	MigratedFrom schema.ID `bson:"migrated_from,omitempty" json:"migrated_from,omitempty"`
+	MigratedTo   schema.ID `bson:"migrated_to,omitempty" json:"migrated_to,omitempty"`
+
+	// ConvertedFrom is the legacy reservation this workload was converted
+	// from. ExplorerConverted is set if the explorer converted it on behalf of
+	// the customer, in which case the workload is not signed by the customer.
+	// They are not part of the signature challenge
+	ConvertedFrom     schema.ID `bson:"converted_from,omitempty" json:"converted_from,omitempty"`
+	ExplorerConverted bool      `bson:"explorer_converted,omitempty" json:"explorer_converted,omitempty"`
+
+	// DeletedAt is the time the node reported the workload deleted, it is set
+	// by the explorer and is not part of the signature challenge
+	DeletedAt schema.Date `bson:"deleted_at,omitempty" json:"deleted_at"`
 }
 
 func (i *ReservationInfo) WorkloadID() int64 {
@@ -410,6 +450,13 @@ func (i *ReservationInfo) SignatureChallenge() ([]byte, error) { //TODO: name of
 	if _, err := fmt.Fprintf(b, "%s", i.Metadata); err != nil {
 		return nil, err
 	}
+	// the expiration is only added when it is set, so the signature of the
+	// workloads without expiration doesn't change
+	if i.HasExpiration() {
+		if _, err := fmt.Fprintf(b, "%d", i.ExpiresAt.Unix()); err != nil {
+			return nil, err
+		}
+	}
 
 	return b.Bytes(), nil
 }
@@ -446,6 +493,68 @@ func (i *ReservationInfo) SetVersion(version int) {
 	i.Version = version
 }
 
+func (i *ReservationInfo) GetExpiresAt() schema.Date {
+	return i.ExpiresAt
+}
+
+func (i *ReservationInfo) SetExpiresAt(date schema.Date) {
+	i.ExpiresAt = date
+}
+
+// HasExpiration returns true if the workload has an expiration time, a zero
+// date is encoded as 0 in JSON so both are considered unset
+func (i *ReservationInfo) HasExpiration() bool {
+	return i.ExpiresAt.Unix() > 0
+}
+
+func (i *ReservationInfo) GetLabels() map[string]string {
+	return i.Labels
+}
+
+func (i *ReservationInfo) SetLabels(labels map[string]string) {
+	i.Labels = labels
+}
+
+func (i *ReservationInfo) GetMigratedFrom() schema.ID {
+	return i.MigratedFrom
+}
+
+func (i *ReservationInfo) SetMigratedFrom(id schema.ID) {
+	i.MigratedFrom = id
+}
+
+func (i *ReservationInfo) GetMigratedTo() schema.ID {
+	return i.MigratedTo
+}
+
+func (i *ReservationInfo) SetMigratedTo(id schema.ID) {
+	i.MigratedTo = id
+}
+
+func (i *ReservationInfo) GetConvertedFrom() schema.ID {
+	return i.ConvertedFrom
+}
+
+func (i *ReservationInfo) SetConvertedFrom(id schema.ID) {
+	i.ConvertedFrom = id
+}
+
+func (i *ReservationInfo) IsExplorerConverted() bool {
+	return i.ExplorerConverted
+}
+
+func (i *ReservationInfo) SetExplorerConverted(converted bool) {
+	i.ExplorerConverted = converted
+}
+
+func (i *ReservationInfo) GetDeletedAt() schema.Date {
+	return i.DeletedAt
+}
+
+func (i *ReservationInfo) SetDeletedAt(date schema.Date) {
+	i.DeletedAt = date
+}
+
 // Stub type not used (for now)
 type StatsAggregator struct {
 	// To be defined
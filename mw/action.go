@@ -2,6 +2,7 @@ package mw
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -13,6 +14,15 @@ type Response interface {
 	Status() int
 	Err() error
 	ErrorAsBytes() []byte
+	// Code returns the error code of the response, the generic code of the
+	// status if none was set
+	Code() ErrorCode
+	// WithCode sets the error code of the response
+	WithCode(code ErrorCode) Response
+	// Details returns the details of the error, if any
+	Details() interface{}
+	// WithDetails sets the details returned with the error
+	WithDetails(details interface{}) Response
 	// header getter
 	Header() http.Header
 	// header setter
@@ -22,6 +32,18 @@ type Response interface {
 // Action interface
 type Action func(r *http.Request) (interface{}, Response)
 
+// ErrorDetails is implemented by errors carrying structured details, which
+// are returned next to the error message unless the response has details set
+type ErrorDetails interface {
+	Details() interface{}
+}
+
+// ErrorCoder is implemented by errors carrying their own error code, which is
+// used if the response has no code set
+type ErrorCoder interface {
+	Code() ErrorCode
+}
+
 // AsHandlerFunc is a helper wrapper to make implementing actions easier
 func AsHandlerFunc(a Action) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -42,12 +64,9 @@ func AsHandlerFunc(a Action) http.HandlerFunc {
 
 			w.WriteHeader(result.Status())
 			if err := result.Err(); err != nil {
-				log.Error().Msgf("%s", err.Error())
-				object = struct {
-					Error string `json:"error"`
-				}{
-					Error: err.Error(),
-				}
+				body := errorBody(r, result)
+				log.Error().Str("request_id", body.RequestID).Str("code", string(body.Code)).Msgf("%s", err.Error())
+				object = body
 			}
 		}
 
@@ -57,10 +76,32 @@ func AsHandlerFunc(a Action) http.HandlerFunc {
 	}
 }
 
+// WriteError writes the error response of a request, it is meant for the
+// middlewares which fail a request before it reaches its action
+func WriteError(w http.ResponseWriter, r *http.Request, result Response) {
+	AsHandlerFunc(func(r *http.Request) (interface{}, Response) {
+		return nil, result
+	})(w, r)
+}
+
+// errorBody builds the body of an error response
+func errorBody(r *http.Request, result Response) ErrorBody {
+	message := result.Err().Error()
+	return ErrorBody{
+		Code:      result.Code(),
+		Message:   message,
+		Error:     message,
+		Details:   result.Details(),
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+}
+
 type genericResponse struct {
-	status int
-	err    error
-	header http.Header
+	status  int
+	err     error
+	header  http.Header
+	code    ErrorCode
+	details interface{}
 }
 
 func (r genericResponse) Status() int {
@@ -75,6 +116,42 @@ func (r genericResponse) ErrorAsBytes() []byte {
 	return []byte(r.err.Error())
 }
 
+func (r genericResponse) Code() ErrorCode {
+	if r.code != "" {
+		return r.code
+	}
+
+	var coder ErrorCoder
+	if r.err != nil && errors.As(r.err, &coder) {
+		return coder.Code()
+	}
+
+	return StatusErrorCode(r.status)
+}
+
+func (r genericResponse) WithCode(code ErrorCode) Response {
+	r.code = code
+	return r
+}
+
+func (r genericResponse) Details() interface{} {
+	if r.details != nil {
+		return r.details
+	}
+
+	var detailed ErrorDetails
+	if r.err != nil && errors.As(r.err, &detailed) {
+		return detailed.Details()
+	}
+
+	return nil
+}
+
+func (r genericResponse) WithDetails(details interface{}) Response {
+	r.details = details
+	return r
+}
+
 func (r genericResponse) Header() http.Header {
 	if r.header == nil {
 		r.header = http.Header{}
@@ -145,6 +222,11 @@ func Forbidden(err error) Response {
 	return Error(err, http.StatusForbidden)
 }
 
+// TooManyRequests response
+func TooManyRequests(err error) Response {
+	return Error(err, http.StatusTooManyRequests)
+}
+
 // NoContent response
 func NoContent() Response {
 	return genericResponse{status: http.StatusNoContent}
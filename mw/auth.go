@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -105,18 +104,9 @@ func (a *AuthMiddleware) Middleware(handler http.Handler) http.Handler {
 		keyID, err := a.verifier.Verify(req)
 		if err != nil {
 			w.Header()["WWW-Authenticate"] = []string{challenge}
-			w.WriteHeader(http.StatusUnauthorized)
-
 			log.Error().Err(err).Msgf("unauthorized access to %s", req.URL.Path)
 
-			object := struct {
-				Error string `json:"error"`
-			}{
-				Error: errors.Wrap(err, "unauthorized access").Error(),
-			}
-			if err := json.NewEncoder(w).Encode(object); err != nil {
-				log.Error().Err(err).Msg("failed to encode return object")
-			}
+			WriteError(w, req, UnAuthorized(errors.Wrap(err, "unauthorized access")).WithCode(CodeSignatureInvalid))
 			return
 		}
 		handler.ServeHTTP(w, req.WithContext(httpsig.WithKeyID(req.Context(), keyID)))
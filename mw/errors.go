@@ -0,0 +1,111 @@
+package mw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// ErrorCode is the stable machine readable code of an api error. Unlike the
+// error message, codes never change so clients can match on them.
+type ErrorCode string
+
+// Generic error codes, used when a response has no specific code
+const (
+	CodeBadRequest      ErrorCode = "BAD_REQUEST"
+	CodeUnauthorized    ErrorCode = "UNAUTHORIZED"
+	CodePaymentRequired ErrorCode = "PAYMENT_REQUIRED"
+	CodeForbidden       ErrorCode = "FORBIDDEN"
+	CodeNotFound        ErrorCode = "NOT_FOUND"
+	CodeConflict        ErrorCode = "CONFLICT"
+	CodeTooManyRequests ErrorCode = "TOO_MANY_REQUESTS"
+	CodeInternal        ErrorCode = "INTERNAL_ERROR"
+)
+
+// Specific error codes
+const (
+	CodePoolInsufficientCapacity  ErrorCode = "POOL_INSUFFICIENT_CAPACITY"
+	CodePoolNotFound              ErrorCode = "POOL_NOT_FOUND"
+	CodeSignatureInvalid          ErrorCode = "SIGNATURE_INVALID"
+	CodeUserNotFound              ErrorCode = "USER_NOT_FOUND"
+	CodeNodeNotFound              ErrorCode = "NODE_NOT_FOUND"
+	CodeFarmNotFound              ErrorCode = "FARM_NOT_FOUND"
+	CodeGatewayNotFound           ErrorCode = "GATEWAY_NOT_FOUND"
+	CodeWorkloadNotFound          ErrorCode = "WORKLOAD_NOT_FOUND"
+	CodeWorkloadDependencyInvalid ErrorCode = "WORKLOAD_DEPENDENCY_INVALID"
+	CodeDomainNotOwned            ErrorCode = "DOMAIN_NOT_OWNED"
+	CodeQuotaExceeded             ErrorCode = "QUOTA_EXCEEDED"
+)
+
+// statusCodes are the generic codes of the error statuses
+var statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:      CodeBadRequest,
+	http.StatusUnauthorized:    CodeUnauthorized,
+	http.StatusPaymentRequired: CodePaymentRequired,
+	http.StatusForbidden:       CodeForbidden,
+	http.StatusNotFound:        CodeNotFound,
+	http.StatusConflict:        CodeConflict,
+	http.StatusTooManyRequests: CodeTooManyRequests,
+}
+
+// StatusErrorCode returns the generic error code of an http status
+func StatusErrorCode(status int) ErrorCode {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeBadRequest
+}
+
+// ErrorBody is the body of all the error responses of the api
+type ErrorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Error is the same as Message, it is kept for the clients that
+	// only know about the `error` field
+	Error     string      `json:"error"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+type requestIDKey struct{}
+
+// RequestIDHeader is the header carrying the request id
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID middleware assigns an id to every request, which is returned in
+// the X-Request-ID header and in the error responses so a failure reported by
+// a user can be found in the logs. The id sent by the caller is kept if set.
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the id of the request, empty if the request
+// did not go through the RequestID middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,93 @@
+package mw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponseBody(t *testing.T) {
+	cases := []struct {
+		name     string
+		response Response
+		status   int
+		code     ErrorCode
+		details  interface{}
+	}{
+		{
+			name:     "generic",
+			response: NotFound(fmt.Errorf("workload not found")),
+			status:   http.StatusNotFound,
+			code:     CodeNotFound,
+		},
+		{
+			name:     "specific",
+			response: PaymentRequired(fmt.Errorf("pool needs additional capacity")).WithCode(CodePoolInsufficientCapacity),
+			status:   http.StatusPaymentRequired,
+			code:     CodePoolInsufficientCapacity,
+		},
+		{
+			name:     "internal",
+			response: Error(fmt.Errorf("database is down")),
+			status:   http.StatusInternalServerError,
+			code:     CodeInternal,
+		},
+		{
+			name:     "coded error",
+			response: QuotaError(errors.Wrap(QuotaExceededError{Kind: QuotaWorkloads, Limit: 10}, "user 12")),
+			status:   http.StatusForbidden,
+			code:     CodeQuotaExceeded,
+			details:  map[string]interface{}{"kind": "workloads", "limit": float64(10)},
+		},
+		{
+			name:     "details",
+			response: BadRequest(fmt.Errorf("invalid field")).WithDetails(map[string]string{"field": "size"}),
+			status:   http.StatusBadRequest,
+			code:     CodeBadRequest,
+			details:  map[string]interface{}{"field": "size"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := RequestID(AsHandlerFunc(func(r *http.Request) (interface{}, Response) {
+				return nil, c.response
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set(RequestIDHeader, "request-1")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, c.status, recorder.Code)
+			assert.Equal(t, "request-1", recorder.Header().Get(RequestIDHeader))
+
+			var body ErrorBody
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+			assert.Equal(t, c.code, body.Code)
+			assert.Equal(t, c.response.Err().Error(), body.Message)
+			assert.Equal(t, body.Message, body.Error)
+			assert.Equal(t, "request-1", body.RequestID)
+			assert.Equal(t, c.details, body.Details)
+		})
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Len(t, seen, 24)
+	assert.Equal(t, seen, recorder.Header().Get(RequestIDHeader))
+}
@@ -0,0 +1,27 @@
+package mw
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+// Page builds the response of a page of a paginated list. The Link header
+// points to the next page if there is one, and the Pages and X-Total-Count
+// headers are only set if the list was counted.
+func Page(r *http.Request, p models.Pagination, last schema.ID, more bool, total int64) Response {
+	response := Ok()
+	if more {
+		response = response.WithHeader("Link", fmt.Sprintf(`<%s>; rel="next"`, p.Next(r, last)))
+	}
+
+	if p.Count() {
+		response = response.
+			WithHeader("Pages", fmt.Sprint(p.Pages(total))).
+			WithHeader("X-Total-Count", fmt.Sprint(total))
+	}
+
+	return response
+}
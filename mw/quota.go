@@ -0,0 +1,295 @@
+package mw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zaibon/httpsig"
+)
+
+// QuotaKind is a resource limited per user
+type QuotaKind string
+
+const (
+	// QuotaRate limits the number of requests per minute of an identity
+	QuotaRate QuotaKind = "rate"
+	// QuotaWorkloads limits the number of active workloads of a user
+	QuotaWorkloads QuotaKind = "workloads"
+	// QuotaUnpaidReservations limits the number of capacity reservations of
+	// a user waiting for payment
+	QuotaUnpaidReservations QuotaKind = "unpaid_reservations"
+)
+
+// rateBucketIdle is the time after which the rate bucket of an identity is
+// dropped if it is not used
+const rateBucketIdle = 10 * time.Minute
+
+var quotaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "explorer",
+	Name:      "quota_rejections_total",
+	Help:      "The total number of requests rejected because a user quota is exceeded, by quota",
+}, []string{"quota"})
+
+func init() {
+	prometheus.MustRegister(quotaRejections)
+}
+
+// QuotaLimits are the limits of a user, a zero limit means unlimited
+type QuotaLimits struct {
+	// Workloads is the maximum number of active workloads
+	Workloads int64
+	// UnpaidReservations is the maximum number of capacity reservations
+	// waiting for payment
+	UnpaidReservations int64
+	// Rate is the maximum number of requests per minute, up to a minute worth
+	// of requests can be done at once
+	Rate int64
+}
+
+func (l QuotaLimits) limit(kind QuotaKind) int64 {
+	switch kind {
+	case QuotaRate:
+		return l.Rate
+	case QuotaWorkloads:
+		return l.Workloads
+	case QuotaUnpaidReservations:
+		return l.UnpaidReservations
+	}
+
+	return 0
+}
+
+// QuotaOverrides are the limits of specific users, like trusted sales
+// channels, which replace the default limits
+type QuotaOverrides map[int64]QuotaLimits
+
+// String implements the flag.Value interface
+func (o *QuotaOverrides) String() string {
+	var overrides []string
+	for tid, l := range *o {
+		overrides = append(overrides, fmt.Sprintf("%d:%d:%d:%d", tid, l.Workloads, l.UnpaidReservations, l.Rate))
+	}
+
+	return strings.Join(overrides, " ")
+}
+
+// Set implements the flag.Value interface, an override is set in the form
+// <tid>:<workloads>:<unpaid reservations>:<rate>
+func (o *QuotaOverrides) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return fmt.Errorf("invalid quota override '%s', expecting <tid>:<workloads>:<unpaid reservations>:<rate>", value)
+	}
+
+	values := make([]int64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid quota override '%s', all values must be positive integers", value)
+		}
+		values[i] = v
+	}
+
+	if *o == nil {
+		*o = make(QuotaOverrides)
+	}
+
+	(*o)[values[0]] = QuotaLimits{
+		Workloads:          values[1],
+		UnpaidReservations: values[2],
+		Rate:               values[3],
+	}
+
+	return nil
+}
+
+// QuotaCounter counts the resources of a kind a user currently has
+type QuotaCounter func(ctx context.Context, userID int64) (int64, error)
+
+// QuotaExceededError is returned when a request goes over a user quota
+type QuotaExceededError struct {
+	Kind  QuotaKind `json:"kind"`
+	Limit int64     `json:"limit"`
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s is limited to %d", e.Kind, e.Limit)
+}
+
+// Code implements ErrorCoder
+func (e QuotaExceededError) Code() ErrorCode {
+	return CodeQuotaExceeded
+}
+
+// Details implements ErrorDetails
+func (e QuotaExceededError) Details() interface{} {
+	return e
+}
+
+// rateBucket is a token bucket refilled at the rate limit
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket if there is one, and returns the time
+// to wait for the next token otherwise
+func (b *rateBucket) take(now time.Time, rate int64) (bool, time.Duration) {
+	perSecond := float64(rate) / 60
+	b.tokens = math.Min(float64(rate), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+}
+
+// Quota enforces the per user limits on the creation endpoints. The rate is
+// limited per identity: the threebot id of authenticated requests, the remote
+// address otherwise. The other limits are checked against the counters set
+// with SetCounter.
+type Quota struct {
+	defaults  QuotaLimits
+	overrides QuotaOverrides
+	counters  map[QuotaKind]QuotaCounter
+
+	m       sync.Mutex
+	buckets map[string]*rateBucket
+	swept   time.Time
+}
+
+// NewQuota creates a quota with the default limits, and the limits of the
+// overridden users
+func NewQuota(defaults QuotaLimits, overrides QuotaOverrides) *Quota {
+	return &Quota{
+		defaults:  defaults,
+		overrides: overrides,
+		counters:  make(map[QuotaKind]QuotaCounter),
+		buckets:   make(map[string]*rateBucket),
+	}
+}
+
+// SetCounter sets the counter of a kind of resource, a kind without counter
+// is never limited
+func (q *Quota) SetCounter(kind QuotaKind, counter QuotaCounter) {
+	q.counters[kind] = counter
+}
+
+// Limits returns the limits of a user
+func (q *Quota) Limits(userID int64) QuotaLimits {
+	if l, ok := q.overrides[userID]; ok {
+		return l
+	}
+
+	return q.defaults
+}
+
+// Check makes sure the user can get n more resources of the given kind, it
+// returns a QuotaExceededError if not
+func (q *Quota) Check(ctx context.Context, userID int64, kind QuotaKind, n int64) error {
+	limit := q.Limits(userID).limit(kind)
+	counter, ok := q.counters[kind]
+	if limit == 0 || !ok {
+		return nil
+	}
+
+	count, err := counter(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to count user %s", kind)
+	}
+
+	if count+n > limit {
+		quotaRejections.WithLabelValues(string(kind)).Inc()
+		return QuotaExceededError{Kind: kind, Limit: limit}
+	}
+
+	return nil
+}
+
+// allow takes a request from the rate bucket of the identity
+func (q *Quota) allow(identity string, rate int64, now time.Time) (bool, time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if now.Sub(q.swept) > rateBucketIdle {
+		for id, bucket := range q.buckets {
+			if now.Sub(bucket.last) > rateBucketIdle {
+				delete(q.buckets, id)
+			}
+		}
+		q.swept = now
+	}
+
+	bucket, ok := q.buckets[identity]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(rate), last: now}
+		q.buckets[identity] = bucket
+	}
+
+	return bucket.take(now, rate)
+}
+
+// requestIdentity returns the identity of the request for rate limiting, and
+// the user id if the request is authenticated
+func requestIdentity(r *http.Request) (string, int64) {
+	if keyID := httpsig.KeyIDFromContext(r.Context()); keyID != "" {
+		if userID, err := strconv.ParseInt(keyID, 10, 64); err == nil {
+			return keyID, userID
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return host, 0
+}
+
+// RateLimit implements mux.Middlware interface, it limits the requests rate
+// of an identity. To limit authenticated users by threebot id it must run
+// after the AuthMiddleware.
+func (q *Quota) RateLimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, userID := requestIdentity(r)
+		rate := q.Limits(userID).Rate
+		if rate == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := q.allow(identity, rate, time.Now()); !ok {
+			quotaRejections.WithLabelValues(string(QuotaRate)).Inc()
+			AsHandlerFunc(func(r *http.Request) (interface{}, Response) {
+				retry := int64(math.Ceil(wait.Seconds()))
+				return nil, TooManyRequests(QuotaExceededError{Kind: QuotaRate, Limit: rate}).
+					WithHeader("Retry-After", fmt.Sprint(retry))
+			})(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// QuotaError returns the response of an error returned by Quota.Check
+func QuotaError(err error) Response {
+	var exceeded QuotaExceededError
+	if errors.As(err, &exceeded) {
+		return Forbidden(err)
+	}
+
+	return Error(err)
+}
@@ -0,0 +1,94 @@
+package mw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaibon/httpsig"
+)
+
+func TestQuotaOverrides(t *testing.T) {
+	var overrides QuotaOverrides
+	require.NoError(t, overrides.Set("12:100:5:60"))
+	assert.Equal(t, QuotaLimits{Workloads: 100, UnpaidReservations: 5, Rate: 60}, overrides[12])
+
+	assert.Error(t, overrides.Set("12:100:5"))
+	assert.Error(t, overrides.Set("12:100:-1:60"))
+	assert.Error(t, overrides.Set("a:100:5:60"))
+
+	quota := NewQuota(QuotaLimits{Workloads: 10}, overrides)
+	assert.Equal(t, int64(100), quota.Limits(12).Workloads)
+	assert.Equal(t, int64(10), quota.Limits(13).Workloads)
+}
+
+func TestQuotaCheck(t *testing.T) {
+	quota := NewQuota(QuotaLimits{Workloads: 3}, QuotaOverrides{2: {}})
+	quota.SetCounter(QuotaWorkloads, func(ctx context.Context, userID int64) (int64, error) {
+		return 2, nil
+	})
+
+	assert.NoError(t, quota.Check(context.Background(), 1, QuotaWorkloads, 1))
+
+	err := quota.Check(context.Background(), 1, QuotaWorkloads, 2)
+	var exceeded QuotaExceededError
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, QuotaWorkloads, exceeded.Kind)
+	assert.Equal(t, http.StatusForbidden, QuotaError(err).Status())
+
+	// user 2 is not limited
+	assert.NoError(t, quota.Check(context.Background(), 2, QuotaWorkloads, 10))
+	// there is no counter for unpaid reservations
+	assert.NoError(t, quota.Check(context.Background(), 1, QuotaUnpaidReservations, 10))
+}
+
+func TestQuotaRateLimit(t *testing.T) {
+	quota := NewQuota(QuotaLimits{Rate: 2}, QuotaOverrides{7: {Rate: 3}})
+	handler := quota.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if userID != "" {
+			r = r.WithContext(httpsig.WithKeyID(r.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do("1").Code)
+	assert.Equal(t, http.StatusOK, do("1").Code)
+	limited := do("1")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.NotEmpty(t, limited.Header().Get("Retry-After"))
+
+	// identities have their own bucket
+	assert.Equal(t, http.StatusOK, do("").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, do("7").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, do("7").Code)
+}
+
+func TestRateBucket(t *testing.T) {
+	now := time.Now()
+	bucket := rateBucket{tokens: 1, last: now}
+
+	ok, _ := bucket.take(now, 60)
+	assert.True(t, ok)
+
+	ok, wait := bucket.take(now, 60)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait.Round(time.Millisecond))
+
+	// a token per second is added back
+	ok, _ = bucket.take(now.Add(time.Second), 60)
+	assert.True(t, ok)
+}
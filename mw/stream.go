@@ -0,0 +1,33 @@
+package mw
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	flusherMiddlewareKey struct{}
+)
+
+// FlusherMiddleware keeps the flusher of the connection on the request, so
+// handlers can stream their response even when other middlewares wrap the
+// response writer in a writer that can't be flushed. It must wrap the router.
+func FlusherMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f, ok := w.(http.Flusher); ok {
+			r = r.WithContext(context.WithValue(r.Context(), flusherMiddlewareKey{}, f))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Flusher gets the flusher of the connection of the request
+func Flusher(w http.ResponseWriter, r *http.Request) (http.Flusher, bool) {
+	if f, ok := r.Context().Value(flusherMiddlewareKey{}).(http.Flusher); ok {
+		return f, true
+	}
+
+	f, ok := w.(http.Flusher)
+	return f, ok
+}
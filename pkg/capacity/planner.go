@@ -30,6 +30,13 @@ type (
 		// HasCapacity checks if the workload could be provisioned with its attached
 		// pool as it is right now.
 		HasCapacity(w workloads.Workloader, seconds uint) (bool, error)
+		// HasCapacityForAll checks if all the workloads together could be
+		// provisioned with their attached pools as they are right now.
+		HasCapacityForAll(ws []workloads.Workloader, seconds uint) (bool, error)
+		// HasCapacityForUpdate checks if the updated workload could be provisioned
+		// with its attached pool, once the current version of the workload is
+		// released from the pool.
+		HasCapacityForUpdate(current, updated workloads.Workloader, seconds uint) (bool, error)
 		// AddUsedCapacity adds a deployed workload to the pool. If the workload
 		// is already in the pool (based on ID), nothing happens.
 		AddUsedCapacity(w workloads.Workloader) error
@@ -82,7 +89,8 @@ type (
 	}
 
 	hasCapacityJob struct {
-		w            workloads.Workloader
+		ws           []workloads.Workloader
+		replaced     []workloads.Workloader
 		seconds      uint
 		responseChan chan<- hasCapacityResponse
 	}
@@ -172,7 +180,7 @@ func (p *NaivePlanner) Run(ctx context.Context) {
 			status, err := p.isAllowed(job.w)
 			job.responseChan <- allowedResponse{status: status, err: err}
 		case job := <-p.hasCapacityChan:
-			status, err := p.hasCapacity(job.w, job.seconds)
+			status, err := p.hasCapacity(job.ws, job.replaced, job.seconds)
 			job.responseChan <- hasCapacityResponse{status: status, err: err}
 		case job := <-p.listChan:
 			var pools []types.Pool
@@ -229,11 +237,33 @@ func (p *NaivePlanner) IsAllowed(w workloads.Workloader) (bool, error) {
 
 // HasCapacity implements Planner
 func (p *NaivePlanner) HasCapacity(w workloads.Workloader, seconds uint) (bool, error) {
+	return p.HasCapacityForAll([]workloads.Workloader{w}, seconds)
+}
+
+// HasCapacityForAll implements Planner
+func (p *NaivePlanner) HasCapacityForAll(ws []workloads.Workloader, seconds uint) (bool, error) {
 	ch := make(chan hasCapacityResponse)
 	defer close(ch)
 
 	p.hasCapacityChan <- hasCapacityJob{
-		w:            w,
+		ws:           ws,
+		seconds:      seconds,
+		responseChan: ch,
+	}
+
+	res := <-ch
+
+	return res.status, res.err
+}
+
+// HasCapacityForUpdate implements Planner
+func (p *NaivePlanner) HasCapacityForUpdate(current, updated workloads.Workloader, seconds uint) (bool, error) {
+	ch := make(chan hasCapacityResponse)
+	defer close(ch)
+
+	p.hasCapacityChan <- hasCapacityJob{
+		ws:           []workloads.Workloader{updated},
+		replaced:     []workloads.Workloader{current},
 		seconds:      seconds,
 		responseChan: ch,
 	}
@@ -373,22 +403,75 @@ func (p *NaivePlanner) isAllowed(w workloads.Workloader) (bool, error) {
 	return pool.CustomerTid == w.GetCustomerTid() && pool.AllowedInPool(w.GetNodeID()), nil
 }
 
-// hasCapacity checks if the pool set on the workload has enough capacity to support
-// the workload for the given amount of time
-func (p *NaivePlanner) hasCapacity(w workloads.Workloader, seconds uint) (bool, error) {
-	pool, err := types.GetPool(p.ctx, p.db, schema.ID(w.GetPoolID()))
-	if err != nil {
-		return false, errors.Wrap(err, "could not load pool")
+// hasCapacity checks if the pools set on the workloads have enough capacity to
+// support all the workloads together for the given amount of time. The replaced
+// workloads are released from their pools first.
+func (p *NaivePlanner) hasCapacity(ws []workloads.Workloader, replaced []workloads.Workloader, seconds uint) (bool, error) {
+	type units struct {
+		cu, su, ipu float64
 	}
 
-	rsu, err := w.GetRSU()
-	if err != nil {
-		return false, err
+	pools := make(map[int64]*types.Pool)
+	poolOf := func(w workloads.Workloader) (*types.Pool, error) {
+		pool, ok := pools[w.GetPoolID()]
+		if !ok {
+			loaded, err := types.GetPool(p.ctx, p.db, schema.ID(w.GetPoolID()))
+			if err != nil {
+				return nil, errors.Wrap(err, "could not load pool")
+			}
+			pool = &loaded
+			pools[w.GetPoolID()] = pool
+		}
+		return pool, nil
+	}
+
+	for _, w := range replaced {
+		pool, err := poolOf(w)
+		if err != nil {
+			return false, err
+		}
+
+		rsu, err := w.GetRSU()
+		if err != nil {
+			return false, err
+		}
+		cu, su, ipu := CloudUnitsFromResourceUnits(rsu)
+		pool.RemoveWorkload(w.GetID(), cu, su, ipu)
+	}
+
+	// workloads which are not saved yet don't have an ID, and the pool only
+	// counts a workload ID once, so their units are added in one go
+	unsaved := make(map[int64]units)
+	for _, w := range ws {
+		pool, err := poolOf(w)
+		if err != nil {
+			return false, err
+		}
+
+		rsu, err := w.GetRSU()
+		if err != nil {
+			return false, err
+		}
+		cu, su, ipu := CloudUnitsFromResourceUnits(rsu)
+		if w.GetID() == 0 {
+			u := unsaved[w.GetPoolID()]
+			unsaved[w.GetPoolID()] = units{cu: u.cu + cu, su: u.su + su, ipu: u.ipu + ipu}
+			continue
+		}
+		pool.AddWorkload(w.GetID(), cu, su, ipu)
+	}
+
+	deadline := time.Now().Add(time.Second * time.Duration(seconds)).Unix()
+	for id, pool := range pools {
+		if u, ok := unsaved[id]; ok {
+			pool.AddWorkload(0, u.cu, u.su, u.ipu)
+		}
+		if deadline >= pool.EmptyAt {
+			return false, nil
+		}
 	}
-	cu, su, ipu := CloudUnitsFromResourceUnits(rsu)
-	pool.AddWorkload(w.GetID(), cu, su, ipu)
 
-	return time.Now().Add(time.Second*time.Duration(seconds)).Unix() < pool.EmptyAt, nil
+	return true, nil
 }
 
 // poolByID returns the pool with the given ID
@@ -458,7 +541,7 @@ func (p *NaivePlanner) addCapacity(id schema.ID) error {
 	}
 
 	for i := range workloads {
-		if err = workloadtypes.WorkloadToDeploy(p.ctx, p.db, workloads[i]); err != nil {
+		if err = workloadtypes.WorkloadToDeploy(p.ctx, p.db, workloads[i], workloadtypes.ReasonPoolPaid); err != nil {
 			return errors.Wrap(err, "failed to try and deploy workload")
 		}
 	}
@@ -539,7 +622,7 @@ func (p *NaivePlanner) handlePoolExpiration(cancelOld bool) error {
 				}
 				log.Debug().Int64("Pool ID", int64(expiredPools[i].ID)).Int64("Workload", int64(workloads[j].GetID())).Msg("expire workload")
 				workloads[j].SetNextAction(workloadtypes.Delete)
-				if err = workloadtypes.WorkloadSetNextAction(p.ctx, p.db, workloads[j].GetID(), workloadtypes.Delete); err != nil {
+				if err = workloadtypes.WorkloadSetNextAction(p.ctx, p.db, workloads[j].GetID(), workloadtypes.Delete, workloadtypes.ReasonPoolExpired); err != nil {
 					return errors.Wrap(err, "could not set workload to delete state")
 				}
 				if err = workloadtypes.WorkloadPush(p.ctx, p.db, workloads[j]); err != nil {
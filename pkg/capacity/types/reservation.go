@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/threefoldtech/tfexplorer/models"
@@ -170,3 +171,41 @@ func CapacityReservationGet(ctx context.Context, db *mongo.Database, id schema.I
 	err := res.Decode(&reservation)
 	return reservation, err
 }
+
+// CapacityReservationUnpaidCount counts the capacity reservations of a customer
+// which are still waiting for payment. escrowCollection is the collection
+// holding the payment information of the reservations.
+func CapacityReservationUnpaidCount(ctx context.Context, db *mongo.Database, escrowCollection string, customerTid int64) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"customer_tid": customerTid}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         escrowCollection,
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "payment",
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"payment.paid":            false,
+			"payment.canceled":        false,
+			"payment.expiration.time": bson.M{"$gt": time.Now()},
+		}}},
+		{{Key: "$count", Value: "count"}},
+	}
+
+	cur, err := db.Collection(CapacityReservationCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count unpaid capacity reservations")
+	}
+	defer cur.Close(ctx)
+
+	var result struct {
+		Count int64 `bson:"count"`
+	}
+	if cur.Next(ctx) {
+		if err := cur.Decode(&result); err != nil {
+			return 0, errors.Wrap(err, "failed to decode unpaid capacity reservations count")
+		}
+	}
+
+	return result.Count, cur.Err()
+}
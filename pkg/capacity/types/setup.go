@@ -25,5 +25,11 @@ func Setup(ctx context.Context, db *mongo.Database) error {
 		return err
 	}
 
+	// used to count the unpaid reservations of a customer
+	col = db.Collection(CapacityReservationCollection)
+	if _, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"customer_tid": 1}}); err != nil {
+		return err
+	}
+
 	return nil
 }
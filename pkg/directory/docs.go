@@ -0,0 +1,408 @@
+package directory
+
+import (
+	"net/http"
+
+	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+// Docs are the documentation of the versioned routes of the package
+var Docs = openapi.Routes{
+	"farm-register-v1": {
+		Summary:  "Create a farm",
+		Tags:     []string{"farms"},
+		Request:  directory.Farm{},
+		Response: FarmCreateResponse{},
+		Status:   http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid farm",
+		},
+	},
+	"farm-list-v1": {
+		Summary:     "List the farms",
+		Description: "the email of the farms is only returned to authenticated users",
+		Tags:        []string{"farms"},
+		Params: openapi.Paginated(
+			openapi.Query("name", "filter farms by name", ""),
+			openapi.Query("owner", "filter farms by the threebot id of their owner", int64(0)),
+		),
+		Response: []directory.Farm{},
+	},
+	"farm-get-v1": {
+		Summary:  "Get a farm",
+		Tags:     []string{"farms"},
+		Response: directory.Farm{},
+		Errors: map[int]string{
+			http.StatusNotFound: "farm not found",
+		},
+	},
+	"farm-update-v1": {
+		Summary: "Update a farm",
+		Tags:    []string{"farms"},
+		Auth:    true,
+		Request: directory.Farm{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid farm",
+			http.StatusNotFound:   "farm not found or not owned by the user",
+		},
+	},
+	"farm-add-ip-v1": {
+		Summary: "Add public ips to a farm",
+		Tags:    []string{"farms"},
+		Auth:    true,
+		Request: []FarmIPRequest{},
+		Errors: map[int]string{
+			http.StatusNotFound: "farm not found or not owned by the user",
+		},
+	},
+	"farm-delete-ip-v1": {
+		Summary:     "Remove public ips from a farm",
+		Description: "ips reserved by a workload can't be removed",
+		Tags:        []string{"farms"},
+		Auth:        true,
+		Request:     []schema.IPCidr{},
+		Errors: map[int]string{
+			http.StatusNotFound: "farm not found or not owned by the user",
+		},
+	},
+	"farm-node-delete-v1": {
+		Summary: "Delete a node from a farm",
+		Tags:    []string{"farms"},
+		Auth:    true,
+		Errors: map[int]string{
+			http.StatusNotFound: "farm or node not found",
+		},
+	},
+	"farm-get-prices-v1": {
+		Summary:     "List the custom prices of a farm",
+		Description: "the farmer gets all the custom prices of the farm, other users only get their own",
+		Tags:        []string{"farms"},
+		Auth:        true,
+		Response:    []directory.FarmThreebotPrice{},
+	},
+	"farm-get-prices-for-threebot-v1": {
+		Summary:     "Get the custom price of a farm for a threebot",
+		Description: "only the farmer and the threebot of the price can get it",
+		Tags:        []string{"farms"},
+		Auth:        true,
+		Response:    directory.FarmThreebotPrice{},
+	},
+	"farm-update-prices-v1": {
+		Summary: "Set the custom price of a farm for a threebot",
+		Tags:    []string{"farms"},
+		Auth:    true,
+		Request: directory.FarmThreebotPrice{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid price, or the user is not the farmer",
+		},
+	},
+	"farm-delete-prices-v1": {
+		Summary: "Delete the custom price of a farm for a threebot",
+		Tags:    []string{"farms"},
+		Auth:    true,
+		Errors: map[int]string{
+			http.StatusBadRequest: "the user is not the farmer",
+		},
+	},
+	"farm-get-policy-v1": {
+		Summary:  "Get the workload approval policy of a farm",
+		Tags:     []string{"farms"},
+		Response: directory.FarmPolicy{},
+		Errors: map[int]string{
+			http.StatusNotFound: "farm not found",
+		},
+	},
+	"farm-update-policy-v1": {
+		Summary:     "Set the workload approval policy of a farm",
+		Description: "the policy only applies to the workloads created after it is set",
+		Tags:        []string{"farms"},
+		Auth:        true,
+		Request:     directory.FarmPolicy{},
+		Response:    directory.FarmPolicy{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid policy",
+			http.StatusNotFound:   "farm not found or not owned by the user",
+		},
+	},
+
+	"node-register-v1": {
+		Summary:     "Register a node",
+		Description: "called by the node itself, the request is signed with the node key",
+		Tags:        []string{"nodes"},
+		Auth:        true,
+		Request:     directory.Node{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid node",
+			http.StatusNotFound:   "farm not found",
+		},
+	},
+	"nodes-list-v1": {
+		Summary: "List the nodes",
+		Tags:    []string{"nodes"},
+		Params: openapi.Paginated(
+			openapi.Query("farm", "filter nodes by farm id", int64(0)),
+			openapi.Query("country", "filter nodes by country", ""),
+			openapi.Query("city", "filter nodes by city", ""),
+			openapi.Query("cru", "minimum free cpu cores", int64(0)),
+			openapi.Query("mru", "minimum free memory in GB", int64(0)),
+			openapi.Query("sru", "minimum free ssd storage in GB", int64(0)),
+			openapi.Query("hru", "minimum free hdd storage in GB", int64(0)),
+			openapi.Query("proofs", "include the capacity proofs of the nodes", false),
+			openapi.Query("deleted", "include the deleted nodes", false),
+			openapi.Query("status", "filter on the liveness status, up, standby or down", ""),
+		),
+		Response: []directory.NodeInfo{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid query",
+		},
+	},
+	"nodes-search-v1": {
+		Summary:     "Search the nodes with free capacity",
+		Description: "the free capacity of a node is its total capacity minus the capacity reserved on it. farms without custom pricing use the explorer prices",
+		Tags:        []string{"nodes"},
+		Params: []openapi.Parameter{
+			openapi.Query("page", "page number, starting at 1", int64(0)),
+			openapi.Query("size", "number of nodes per page", int64(0)),
+			openapi.Query("farm", "filter nodes by farm id", int64(0)),
+			openapi.Query("country", "filter nodes by country", ""),
+			openapi.Query("city", "filter nodes by city", ""),
+			openapi.Query("cru", "minimum free cpu cores", int64(0)),
+			openapi.Query("mru", "minimum free memory in GB", int64(0)),
+			openapi.Query("sru", "minimum free ssd storage in GB", int64(0)),
+			openapi.Query("hru", "minimum free hdd storage in GB", int64(0)),
+			openapi.Query("public_ips", "minimum number of free public ips in the farm of the nodes", int64(0)),
+			openapi.Query("ipv6", "only the nodes with a public ipv6 config", false),
+			openapi.Query("updated_within", "only the nodes which reported to the explorer in the last seconds", int64(0)),
+			openapi.Query("max_cu_price", "maximum price of a compute unit in the farm of the nodes", float64(0)),
+			openapi.Query("max_su_price", "maximum price of a storage unit in the farm of the nodes", float64(0)),
+			openapi.Query("latitude", "latitude of the center of the searched area", float64(0)),
+			openapi.Query("longitude", "longitude of the center of the searched area", float64(0)),
+			openapi.Query("radius", "radius in km of the searched area", float64(0)),
+			openapi.Query("status", "filter on the liveness status, up, standby or down", ""),
+			openapi.Query("sort", "price for the cheapest farms first, cru, mru, sru or hru for the nodes with the most free capacity first, distance for the closest nodes first", ""),
+			openapi.Query("proofs", "include the capacity proofs of the nodes", false),
+		},
+		Response: []directory.NodeSearchResult{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid search",
+		},
+	},
+	"node-get-v1": {
+		Summary: "Get a node",
+		Tags:    []string{"nodes"},
+		Params: []openapi.Parameter{
+			openapi.Query("proofs", "include the capacity proofs of the node", false),
+		},
+		Response: directory.NodeInfo{},
+		Errors: map[int]string{
+			http.StatusNotFound: "node not found",
+		},
+	},
+	"node-interfaces-v1": {
+		Summary: "Set the network interfaces of a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: []generated.Iface{},
+		Status:  http.StatusCreated,
+	},
+	"node-set-ports-v1": {
+		Summary: "Set the wireguard ports used on a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: NodePortsRequest{},
+	},
+	"node-configure-public-v1": {
+		Summary: "Configure the public interface of a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: generated.PublicIface{},
+		Status:  http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid interface",
+			http.StatusForbidden:  "the user is not the farmer of the node",
+			http.StatusNotFound:   "node not found",
+		},
+	},
+	"node-configure-free-v1": {
+		Summary: "Set if a node is free to use",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: NodeFreeToUseRequest{},
+		Errors: map[int]string{
+			http.StatusForbidden: "the user is not the farmer of the node",
+			http.StatusNotFound:  "node not found",
+		},
+	},
+	"node-capacity-v1": {
+		Summary: "Report the total capacity of a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: NodeCapacityRequest{},
+	},
+	"node-uptime-v1": {
+		Summary: "Report the uptime of a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: UptimeRequest{},
+	},
+	"node-uptime-history-v1": {
+		Summary: "List the uptime reports of a node",
+		Tags:    []string{"nodes"},
+		Params: []openapi.Parameter{
+			openapi.Query("from", "only the reports received after this unix timestamp", int64(0)),
+			openapi.Query("to", "only the reports received before this unix timestamp", int64(0)),
+			openapi.Query("page", "page number, starting at 1", int64(0)),
+			openapi.Query("size", "number of reports per page", int64(0)),
+		},
+		Response: []directory.UptimeReport{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid period",
+			http.StatusNotFound:   "node not found",
+		},
+	},
+	"node-reserved-resources-v1": {
+		Summary: "Report the resources reserved on a node",
+		Tags:    []string{"nodes"},
+		Auth:    true,
+		Request: ReservedResourcesRequest{},
+	},
+
+	"gateway-register-v1": {
+		Summary:     "Register a gateway",
+		Description: "called by the gateway itself, the request is signed with the gateway key",
+		Tags:        []string{"gateways"},
+		Auth:        true,
+		Request:     directory.Gateway{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid gateway",
+			http.StatusNotFound:   "farm not found",
+		},
+	},
+	"gateway-list-v1": {
+		Summary: "List the gateways",
+		Tags:    []string{"gateways"},
+		Params: openapi.Paginated(
+			openapi.Query("farm_id", "filter gateways by farm id", int64(0)),
+			openapi.Query("country", "filter gateways by country", ""),
+			openapi.Query("city", "filter gateways by city", ""),
+			openapi.Query("status", "filter on the liveness status, up, standby or down", ""),
+		),
+		Response: []directory.GatewayInfo{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid query",
+		},
+	},
+	"gateway-get-v1": {
+		Summary:  "Get a gateway",
+		Tags:     []string{"gateways"},
+		Response: directory.GatewayInfo{},
+		Errors: map[int]string{
+			http.StatusNotFound: "gateway not found",
+		},
+	},
+	"gateway-uptime-v1": {
+		Summary: "Report the uptime of a gateway",
+		Tags:    []string{"gateways"},
+		Auth:    true,
+		Request: UptimeRequest{},
+	},
+	"gateway-uptime-history-v1": {
+		Summary: "List the uptime reports of a gateway",
+		Tags:    []string{"gateways"},
+		Params: []openapi.Parameter{
+			openapi.Query("from", "only the reports received after this unix timestamp", int64(0)),
+			openapi.Query("to", "only the reports received before this unix timestamp", int64(0)),
+			openapi.Query("page", "page number, starting at 1", int64(0)),
+			openapi.Query("size", "number of reports per page", int64(0)),
+		},
+		Response: []directory.UptimeReport{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid period",
+			http.StatusNotFound:   "gateway not found",
+		},
+	},
+	"gateway-reserved-resources-v1": {
+		Summary: "Report the resources reserved on a gateway",
+		Tags:    []string{"gateways"},
+		Auth:    true,
+		Request: ReservedResourcesRequest{},
+	},
+
+	"domain-challenge-v1": {
+		Summary:     "Request a domain ownership challenge",
+		Description: "the challenge token must be published in a TXT record on the returned host, then the domain can be verified. requesting a challenge again returns the same token",
+		Tags:        []string{"domains"},
+		Auth:        true,
+		Request:     DomainChallengeRequest{},
+		Response:    DomainChallengeResponse{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid domain",
+		},
+	},
+	"domain-list-v1": {
+		Summary:  "List the domains of the user",
+		Tags:     []string{"domains"},
+		Auth:     true,
+		Response: []DomainChallengeResponse{},
+	},
+	"domain-get-v1": {
+		Summary:  "Get a domain of the user",
+		Tags:     []string{"domains"},
+		Auth:     true,
+		Response: DomainChallengeResponse{},
+		Errors: map[int]string{
+			http.StatusNotFound: "no challenge was issued for the domain",
+		},
+	},
+	"domain-delete-v1": {
+		Summary: "Delete a domain of the user",
+		Tags:    []string{"domains"},
+		Auth:    true,
+		Errors: map[int]string{
+			http.StatusNotFound: "no challenge was issued for the domain",
+		},
+	},
+	"domain-verify-v1": {
+		Summary:     "Verify the ownership of a domain",
+		Description: "looks up the challenge token in the TXT records of the challenge host. a verified domain can be used by the gateway workloads of the user, with all its subdomains",
+		Tags:        []string{"domains"},
+		Auth:        true,
+		Response:    DomainChallengeResponse{},
+		Errors: map[int]string{
+			http.StatusForbidden: "the challenge token was not found",
+			http.StatusNotFound:  "no challenge was issued for the domain",
+		},
+	},
+}
+
+// LegacyDocs are the documentation of the legacy routes of the package
+var LegacyDocs = openapi.Legacy(Docs, map[string]string{
+	"farm-register":    "farm-register-v1",
+	"farm-list":        "farm-list-v1",
+	"farm-get":         "farm-get-v1",
+	"farm-update":      "farm-update-v1",
+	"farm-node-delete": "farm-node-delete-v1",
+
+	"node-register":           "node-register-v1",
+	"nodes-list":              "nodes-list-v1",
+	"node-get":                "node-get-v1",
+	"node-interfaces":         "node-interfaces-v1",
+	"node-set-ports":          "node-set-ports-v1",
+	"node-configure-public":   "node-configure-public-v1",
+	"node-configure-free":     "node-configure-free-v1",
+	"node-capacity":           "node-capacity-v1",
+	"node-uptime":             "node-uptime-v1",
+	"node-reserved-resources": "node-reserved-resources-v1",
+
+	"gateway-register":           "gateway-register-v1",
+	"gateway-list":               "gateway-list-v1",
+	"gateway-get":                "gateway-get-v1",
+	"gateway-uptime":             "gateway-uptime-v1",
+	"gateway-reserved-resources": "gateway-reserved-resources-v1",
+})
@@ -0,0 +1,18 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, nil, generated.NodeCloudUnitPrice{})
+
+	require.NoError(t, openapi.Check(router, "/api/v1", Docs))
+	require.NoError(t, openapi.Check(router, "/explorer", LegacyDocs))
+}
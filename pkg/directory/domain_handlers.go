@@ -0,0 +1,198 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/threefoldtech/tfexplorer/mw"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+)
+
+// Resolver looks up the DNS records used to verify domains, net.Resolver
+// implements it
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DomainAPI holds the api to prove the ownership of domains, a gateway
+// workload can only use a domain owned by its customer
+type DomainAPI struct {
+	resolver Resolver
+}
+
+// DomainChallengeRequest is the body of a domain challenge request
+type DomainChallengeRequest struct {
+	Domain string `json:"domain"`
+}
+
+// DomainChallengeResponse is the domain ownership with the host name where
+// the challenge token must be published as a TXT record
+type DomainChallengeResponse struct {
+	directory.DomainOwnership
+	Host string `json:"host"`
+}
+
+func newDomainChallengeResponse(ownership directory.DomainOwnership) DomainChallengeResponse {
+	return DomainChallengeResponse{
+		DomainOwnership: ownership,
+		Host:            ownership.ChallengeHost(),
+	}
+}
+
+// verifyDomainChallenge checks that the challenge token of the ownership is
+// published in a TXT record of the domain
+func verifyDomainChallenge(ctx context.Context, resolver Resolver, ownership directory.DomainOwnership) error {
+	host := ownership.ChallengeHost()
+
+	records, err := resolver.LookupTXT(ctx, host)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up '%s' for TXT records", host)
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == ownership.Token {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to verify domain '%s'. no txt record with the challenge token found on '%s'", ownership.Domain, host)
+}
+
+func (d *DomainAPI) userTid(r *http.Request) (int64, mw.Response) {
+	tid, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return 0, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	return tid, nil
+}
+
+func (d *DomainAPI) ownership(r *http.Request) (directory.DomainOwnership, mw.Response) {
+	tid, mwErr := d.userTid(r)
+	if mwErr != nil {
+		return directory.DomainOwnership{}, mwErr
+	}
+
+	domain, err := directory.NormalizeDomain(mux.Vars(r)["domain"])
+	if err != nil {
+		return directory.DomainOwnership{}, mw.BadRequest(err)
+	}
+
+	var filter directory.DomainOwnershipFilter
+	filter = filter.WithUserTid(tid).WithDomain(domain)
+
+	ownership, err := filter.Get(r.Context(), mw.Database(r))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ownership, mw.NotFound(fmt.Errorf("no challenge issued for domain '%s'", domain))
+	} else if err != nil {
+		return ownership, mw.Error(err)
+	}
+
+	return ownership, nil
+}
+
+// createChallenge issues the challenge token of a domain for the request user,
+// requesting a challenge again returns the same token
+func (d *DomainAPI) createChallenge(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	tid, mwErr := d.userTid(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	var request DomainChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	domain, err := directory.NormalizeDomain(request.Domain)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	ownership, err := directory.DomainChallenge(r.Context(), mw.Database(r), tid, domain)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return newDomainChallengeResponse(ownership), mw.Created()
+}
+
+// verifyDomain looks up the challenge token of the domain, and marks the
+// domain as owned by the request user if it is found
+func (d *DomainAPI) verifyDomain(r *http.Request) (interface{}, mw.Response) {
+	ownership, mwErr := d.ownership(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	if err := verifyDomainChallenge(r.Context(), d.resolver, ownership); err != nil {
+		return nil, mw.Forbidden(err)
+	}
+
+	until := time.Now().Add(directory.DomainOwnershipValidity)
+	if err := directory.DomainSetVerified(r.Context(), mw.Database(r), ownership.UserTid, ownership.Domain, until); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	log.Info().Int64("user", ownership.UserTid).Str("domain", ownership.Domain).Msg("domain ownership verified")
+	ownership.VerifiedUntil.Time = until
+
+	return newDomainChallengeResponse(ownership), mw.Ok()
+}
+
+func (d *DomainAPI) getDomain(r *http.Request) (interface{}, mw.Response) {
+	ownership, mwErr := d.ownership(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	return newDomainChallengeResponse(ownership), nil
+}
+
+func (d *DomainAPI) listDomains(r *http.Request) (interface{}, mw.Response) {
+	tid, mwErr := d.userTid(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	var filter directory.DomainOwnershipFilter
+	filter = filter.WithUserTid(tid)
+
+	ownerships, err := filter.Find(r.Context(), mw.Database(r))
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	responses := make([]DomainChallengeResponse, 0, len(ownerships))
+	for _, ownership := range ownerships {
+		responses = append(responses, newDomainChallengeResponse(ownership))
+	}
+
+	return responses, nil
+}
+
+func (d *DomainAPI) deleteDomain(r *http.Request) (interface{}, mw.Response) {
+	ownership, mwErr := d.ownership(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	if err := directory.DomainOwnershipRemove(r.Context(), mw.Database(r), ownership.UserTid, ownership.Domain); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return nil, mw.Ok()
+}
@@ -0,0 +1,53 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("no such host")
+	}
+
+	return records, nil
+}
+
+func TestVerifyDomainChallenge(t *testing.T) {
+	ownership := directory.DomainOwnership{
+		UserTid: 1,
+		Domain:  "example.com",
+		Token:   "0123456789abcdef",
+	}
+
+	resolver := fakeResolver{
+		"__explorer__.example.com": {"v=spf1 -all", "0123456789abcdef"},
+		"__explorer__.other.com":   {"0123456789abcdef"},
+	}
+	assert.NoError(t, verifyDomainChallenge(context.Background(), resolver, ownership))
+
+	ownership.Token = "fedcba9876543210"
+	assert.Error(t, verifyDomainChallenge(context.Background(), resolver, ownership))
+
+	ownership.Domain = "missing.com"
+	assert.Error(t, verifyDomainChallenge(context.Background(), resolver, ownership))
+}
+
+func TestIsManagedDomain(t *testing.T) {
+	gw := GatewayAPI{
+		resolver: fakeResolver{
+			"__owner__.example.com": {`{"identity": "gw1", "owner": "gw1"}`},
+		},
+	}
+
+	assert.NoError(t, gw.isManagedDomain(context.Background(), "gw1", "example.com"))
+	assert.Error(t, gw.isManagedDomain(context.Background(), "gw2", "example.com"))
+	assert.Error(t, gw.isManagedDomain(context.Background(), "gw1", "other.com"))
+}
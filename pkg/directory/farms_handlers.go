@@ -24,6 +24,17 @@ import (
 
 type farmKey struct{}
 
+// FarmCreateResponse is the id of a created farm
+type FarmCreateResponse struct {
+	ID schema.ID `json:"id"`
+}
+
+// FarmIPRequest is a public ip added to a farm
+type FarmIPRequest struct {
+	IP schema.IPCidr `json:"address"`
+	GW net.IP        `json:"gateway"`
+}
+
 func (f FarmAPI) isAuthenticated(r *http.Request) bool {
 	_, err := f.verifier.Verify(r)
 	return err == nil
@@ -52,11 +63,7 @@ func (f *FarmAPI) registerFarm(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.Error(err)
 	}
 
-	return struct {
-		ID schema.ID `json:"id"`
-	}{
-		id,
-	}, mw.Created()
+	return FarmCreateResponse{ID: id}, mw.Created()
 }
 
 func (f *FarmAPI) updateFarm(r *http.Request) (interface{}, mw.Response) {
@@ -88,10 +95,13 @@ func (f *FarmAPI) listFarm(r *http.Request) (interface{}, mw.Response) {
 
 	db := mw.Database(r)
 
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
 	var findOpts []*options.FindOptions
 
-	pager := models.PageFromRequest(r)
-	findOpts = append(findOpts, pager)
 	// hide the email of the farm for any non authenticated user
 	if !f.isAuthenticated(r) {
 		findOpts = append(findOpts, options.Find().SetProjection(bson.D{
@@ -99,13 +109,20 @@ func (f *FarmAPI) listFarm(r *http.Request) (interface{}, mw.Response) {
 		}))
 	}
 
-	farms, total, err := f.List(r.Context(), db, filter, findOpts...)
+	farms, total, err := f.List(r.Context(), db, filter, pagination, findOpts...)
 	if err != nil {
 		return nil, mw.Error(err)
 	}
 
-	pages := fmt.Sprintf("%d", models.Pages(pager, total))
-	return farms, mw.Ok().WithHeader("Pages", pages)
+	n, more := pagination.Trim(len(farms))
+	farms = farms[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = farms[n-1].ID
+	}
+
+	return farms, mw.Page(r, pagination, last, more, total)
 }
 
 func (f *FarmAPI) getFarm(r *http.Request) (interface{}, mw.Response) {
@@ -120,7 +137,7 @@ func (f *FarmAPI) getFarm(r *http.Request) (interface{}, mw.Response) {
 
 	farm, err := f.GetByID(r.Context(), db, id)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeFarmNotFound)
 	}
 
 	// hide the email of the farm for any non authenticated user
@@ -140,7 +157,7 @@ func (f *FarmAPI) deleteNodeFromFarm(r *http.Request) (interface{}, mw.Response)
 	db := mw.Database(r)
 	node, err := nodeAPI.Get(r.Context(), db, nodeID, false)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	if node.FarmId != int64(farmID) {
@@ -159,10 +176,7 @@ func (f *FarmAPI) addFarmIPs(r *http.Request) (interface{}, mw.Response) {
 	// Get the farm from the middleware context
 	farmID := getFarmID(r.Context())
 
-	var info []struct {
-		IP schema.IPCidr `json:"address"`
-		GW net.IP        `json:"gateway"`
-	}
+	var info []FarmIPRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
 		return nil, mw.BadRequest(err)
@@ -214,11 +228,7 @@ func LoadFarmMiddleware(next http.Handler) http.Handler {
 		sid := mux.Vars(r)["farm_id"]
 		id, err := strconv.ParseInt(sid, 10, 64)
 		if err != nil {
-			res := mw.BadRequest(err)
-
-			w.WriteHeader(res.Status())
-			w.Write([]byte(res.ErrorAsBytes()))
-
+			mw.WriteError(w, r, mw.BadRequest(err))
 			return
 		}
 
@@ -228,10 +238,7 @@ func LoadFarmMiddleware(next http.Handler) http.Handler {
 		requestFarmerID, err := strconv.ParseInt(farmerID, 10, 64)
 
 		if err != nil {
-			res := mw.BadRequest(err)
-
-			w.WriteHeader(res.Status())
-			w.Write([]byte(res.ErrorAsBytes()))
+			mw.WriteError(w, r, mw.BadRequest(err))
 			return
 		}
 
@@ -239,9 +246,7 @@ func LoadFarmMiddleware(next http.Handler) http.Handler {
 		filter = filter.WithID(schema.ID(id)).WithOwner(requestFarmerID)
 		farm, err := filter.Get(r.Context(), db)
 		if err != nil {
-			res := mw.NotFound(err)
-			w.WriteHeader(res.Status())
-			w.Write([]byte(res.ErrorAsBytes()))
+			mw.WriteError(w, r, mw.NotFound(err).WithCode(mw.CodeFarmNotFound))
 			return
 		}
 
@@ -413,3 +418,45 @@ func (f *FarmAPI) deleteFarmCustomPrice(r *http.Request) (interface{}, mw.Respon
 	}
 	return nil, mw.Ok()
 }
+
+func (f *FarmAPI) getFarmPolicy(r *http.Request) (interface{}, mw.Response) {
+	farmID, err := strconv.ParseInt(mux.Vars(r)["farm_id"], 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Errorf("invalid farm id"))
+	}
+
+	db := mw.Database(r)
+	if _, err := f.GetByID(r.Context(), db, farmID); err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeFarmNotFound)
+	}
+
+	policy, err := directory.FarmPolicyGet(r.Context(), db, schema.ID(farmID))
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return policy, nil
+}
+
+// setFarmPolicy replaces the workload approval policy of the farm. The policy
+// only applies to workloads created after it is set.
+func (f *FarmAPI) setFarmPolicy(r *http.Request) (interface{}, mw.Response) {
+	farmID := getFarmID(r.Context())
+
+	var policy directory.FarmPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	policy.FarmID = farmID
+	if err := policy.Validate(); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	if err := directory.FarmPolicySet(r.Context(), db, policy); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return policy, mw.Ok()
+}
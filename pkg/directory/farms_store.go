@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
 	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
 	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
 
@@ -20,10 +21,19 @@ type FarmAPI struct {
 	verifier *httpsig.Verifier
 }
 
-// List farms
-// TODO: add paging arguments
-func (s *FarmAPI) List(ctx context.Context, db *mongo.Database, filter directory.FarmFilter, opts ...*options.FindOptions) ([]directory.Farm, int64, error) {
+// List farms, the total is only counted if the pagination requires it
+func (s *FarmAPI) List(ctx context.Context, db *mongo.Database, filter directory.FarmFilter, pagination models.Pagination, opts ...*options.FindOptions) ([]directory.Farm, int64, error) {
+	var count int64
+	if pagination.Count() {
+		var err error
+		count, err = filter.Count(ctx, db)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to count entries in farms collection")
+		}
+	}
 
+	filter = append(filter, pagination.Filter(false)...)
+	opts = append([]*options.FindOptions{pagination.FindOptions()}, opts...)
 	cur, err := filter.Find(ctx, db, opts...)
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed to list farms")
@@ -34,11 +44,6 @@ func (s *FarmAPI) List(ctx context.Context, db *mongo.Database, filter directory
 		return nil, 0, errors.Wrap(err, "failed to load farm list")
 	}
 
-	count, err := filter.Count(ctx, db)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed to count entries in farms collection")
-	}
-
 	return out, count, nil
 }
 
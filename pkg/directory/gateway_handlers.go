@@ -1,17 +1,17 @@
 package directory
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/zaibon/httpsig"
 
 	"github.com/threefoldtech/tfexplorer/models"
-	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
 	"github.com/threefoldtech/tfexplorer/mw"
 	"github.com/threefoldtech/tfexplorer/pkg/directory/types"
 	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
@@ -44,11 +44,11 @@ func (s *GatewayAPI) registerGateway(r *http.Request) (interface{}, mw.Response)
 	var farmFilter types.FarmFilter
 	farmFilter = farmFilter.WithID(schema.ID(gw.FarmId))
 	if _, err := farmFilter.Get(r.Context(), db); err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "unknown farm id"))
+		return nil, mw.NotFound(errors.Wrap(err, "unknown farm id")).WithCode(mw.CodeFarmNotFound)
 	}
 
 	for _, domain := range gw.ManagedDomains {
-		if err := s.isManagedDomain(gw.NodeId, domain); err != nil {
+		if err := s.isManagedDomain(r.Context(), gw.NodeId, domain); err != nil {
 			return nil, mw.Forbidden(err)
 		}
 	}
@@ -62,11 +62,11 @@ func (s *GatewayAPI) registerGateway(r *http.Request) (interface{}, mw.Response)
 	return nil, mw.Created()
 }
 
-func (s *GatewayAPI) isManagedDomain(identity, domain string) error {
+func (s *GatewayAPI) isManagedDomain(ctx context.Context, identity, domain string) error {
 	const name = "__owner__"
 	host := fmt.Sprintf("%s.%s", name, domain)
 
-	records, err := net.LookupTXT(host)
+	records, err := s.resolver.LookupTXT(ctx, host)
 	if err != nil {
 		return errors.Wrapf(err, "failed to look up '%s' for TXT records", host)
 	}
@@ -102,12 +102,17 @@ func (s *GatewayAPI) gatewayDetail(r *http.Request) (interface{}, mw.Response) {
 	}
 	db := mw.Database(r)
 
-	node, err := s.Get(r.Context(), db, nodeID)
+	gateway, err := s.Get(r.Context(), db, nodeID)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeGatewayNotFound)
 	}
 
-	return node, nil
+	live, err := directory.NodeLiveness(r.Context(), db, directory.GatewayCollection, time.Now(), gateway.NodeId)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return directory.GatewayInfo{Gateway: gateway, Liveness: live[gateway.NodeId]}, nil
 }
 
 func (s *GatewayAPI) listGateways(r *http.Request) (interface{}, mw.Response) {
@@ -116,15 +121,40 @@ func (s *GatewayAPI) listGateways(r *http.Request) (interface{}, mw.Response) {
 		return nil, err
 	}
 
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
 	db := mw.Database(r)
-	pager := models.PageFromRequest(r)
-	nodes, total, err := s.List(r.Context(), db, q, pager)
+	gateways, total, err := s.List(r.Context(), db, q, pagination)
 	if err != nil {
 		return nil, mw.Error(err)
 	}
 
-	pages := fmt.Sprintf("%d", models.Pages(pager, total))
-	return nodes, mw.Ok().WithHeader("Pages", pages)
+	n, more := pagination.Trim(len(gateways))
+	gateways = gateways[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = gateways[n-1].ID
+	}
+
+	ids := make([]string, 0, len(gateways))
+	for _, gateway := range gateways {
+		ids = append(ids, gateway.NodeId)
+	}
+	live, err := directory.NodeLiveness(r.Context(), db, directory.GatewayCollection, time.Now(), ids...)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	infos := make([]directory.GatewayInfo, 0, len(gateways))
+	for _, gateway := range gateways {
+		infos = append(infos, directory.GatewayInfo{Gateway: gateway, Liveness: live[gateway.NodeId]})
+	}
+
+	return infos, mw.Page(r, pagination, last, more, total)
 }
 
 func (s *GatewayAPI) updateUptimeHandler(r *http.Request) (interface{}, mw.Response) {
@@ -136,9 +166,7 @@ func (s *GatewayAPI) updateUptimeHandler(r *http.Request) (interface{}, mw.Respo
 		return nil, mw.Forbidden(fmt.Errorf("trying to register uptime for nodeID %s while you are %s", nodeID, hNodeID))
 	}
 
-	input := struct {
-		Uptime uint64 `json:"uptime"`
-	}{}
+	var input UptimeRequest
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, mw.BadRequest(err)
 	}
@@ -146,8 +174,13 @@ func (s *GatewayAPI) updateUptimeHandler(r *http.Request) (interface{}, mw.Respo
 	db := mw.Database(r)
 	log.Debug().Str("gateway", nodeID).Uint64("uptime", input.Uptime).Msg("gateway uptime received")
 
-	if err := s.updateUptime(r.Context(), db, nodeID, int64(input.Uptime)); err != nil {
-		return nil, mw.NotFound(err)
+	now := time.Now()
+	if err := s.updateUptime(r.Context(), db, nodeID, int64(input.Uptime), now); err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeGatewayNotFound)
+	}
+
+	if _, err := directory.UptimeReportCreate(r.Context(), db, directory.GatewayCollection, nodeID, int64(input.Uptime), now); err != nil {
+		return nil, mw.Error(err)
 	}
 
 	return nil, nil
@@ -162,10 +195,7 @@ func (s *GatewayAPI) updateReservedResources(r *http.Request) (interface{}, mw.R
 		return nil, mw.Forbidden(fmt.Errorf("trying to update reserved capacity for nodeID %s while you are %s", nodeID, hNodeID))
 	}
 
-	input := struct {
-		generated.ResourceAmount
-		generated.WorkloadAmount
-	}{}
+	var input ReservedResourcesRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, mw.BadRequest(err)
@@ -173,10 +203,10 @@ func (s *GatewayAPI) updateReservedResources(r *http.Request) (interface{}, mw.R
 
 	db := mw.Database(r)
 	if err := s.updateReservedCapacity(r.Context(), db, nodeID, input.ResourceAmount); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeGatewayNotFound)
 	}
 	if err := s.updateWorkloadsAmount(r.Context(), db, nodeID, input.WorkloadAmount); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeGatewayNotFound)
 	}
 
 	return nil, nil
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
 	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
 	"github.com/threefoldtech/tfexplorer/mw"
 	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
@@ -17,12 +19,15 @@ import (
 )
 
 // GatewayAPI holds api for gateways
-type GatewayAPI struct{}
+type GatewayAPI struct {
+	resolver Resolver
+}
 
 type gatewayQuery struct {
 	Country string
 	City    string
 	FarmID  int
+	Status  directory.NodeStatus
 }
 
 func (n *gatewayQuery) Parse(r *http.Request) mw.Response {
@@ -33,15 +38,32 @@ func (n *gatewayQuery) Parse(r *http.Request) mw.Response {
 	if err == nil {
 		n.FarmID = iID
 	}
-	return nil
+
+	var resp mw.Response
+	n.Status, resp = parseStatus(r)
+	return resp
 }
 
-// List all gateways
-func (s *GatewayAPI) List(ctx context.Context, db *mongo.Database, q gatewayQuery, opts ...*options.FindOptions) ([]directory.Gateway, int64, error) {
+// List all gateways, the total is only counted if the pagination requires it
+func (s *GatewayAPI) List(ctx context.Context, db *mongo.Database, q gatewayQuery, pagination models.Pagination, opts ...*options.FindOptions) ([]directory.Gateway, int64, error) {
 	var filter directory.GatewayFilter
 	filter = filter.WithLocation(q.Country, q.City)
 	filter = filter.WithFarmID(q.FarmID)
+	if q.Status != "" {
+		filter = filter.WithStatus(q.Status, time.Now())
+	}
 
+	var count int64
+	if pagination.Count() {
+		var err error
+		count, err = filter.Count(ctx, db)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to count entries in nodes collection")
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
+	opts = append([]*options.FindOptions{pagination.FindOptions()}, opts...)
 	cur, err := filter.Find(ctx, db, opts...)
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed to list nodes")
@@ -53,11 +75,6 @@ func (s *GatewayAPI) List(ctx context.Context, db *mongo.Database, q gatewayQuer
 		return nil, 0, errors.Wrap(err, "failed to load node list")
 	}
 
-	count, err := filter.Count(ctx, db)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed to count entries in nodes collection")
-	}
-
 	return out, count, nil
 }
 
@@ -95,8 +112,8 @@ func (s *GatewayAPI) updateReservedCapacity(ctx context.Context, db *mongo.Datab
 	return directory.GatewayUpdateReservedResources(ctx, db, gwID, capacity)
 }
 
-func (s *GatewayAPI) updateUptime(ctx context.Context, db *mongo.Database, gwID string, uptime int64) error {
-	return directory.GatewayUpdateUptime(ctx, db, gwID, uptime)
+func (s *GatewayAPI) updateUptime(ctx context.Context, db *mongo.Database, gwID string, uptime int64, now time.Time) error {
+	return directory.GatewayUpdateUptime(ctx, db, gwID, uptime, now)
 }
 
 func (s *GatewayAPI) updateWorkloadsAmount(ctx context.Context, db *mongo.Database, gwID string, workloads generated.WorkloadAmount) error {
@@ -119,7 +136,7 @@ func (s *GatewayAPI) Requires(key string, handler mw.Action) mw.Action {
 		if err != nil {
 			return nil, mw.Error(err)
 		} else if !exists {
-			return nil, mw.NotFound(fmt.Errorf("gateway '%s' not found", gwID))
+			return nil, mw.NotFound(fmt.Errorf("gateway '%s' not found", gwID)).WithCode(mw.CodeGatewayNotFound)
 		}
 
 		return handler(r)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -24,6 +25,36 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// NodeCapacityRequest is the capacity reported by a node
+type NodeCapacityRequest struct {
+	Capacity   generated.ResourceAmount `json:"capacity,omitempty"`
+	DMI        dmi.DMI                  `json:"dmi,omitempty"`
+	Disks      capacity.Disks           `json:"disks,omitempty"`
+	Hypervisor []string                 `json:"hypervisor,omitempty"`
+}
+
+// NodeFreeToUseRequest is the choice of a farmer to make a node free to use
+type NodeFreeToUseRequest struct {
+	FreeToUse bool `json:"free_to_use"`
+}
+
+// NodePortsRequest are the wireguard ports used on a node
+type NodePortsRequest struct {
+	Ports []uint `json:"ports"`
+}
+
+// UptimeRequest is the uptime reported by a node or a gateway, in seconds
+type UptimeRequest struct {
+	Uptime uint64 `json:"uptime"`
+}
+
+// ReservedResourcesRequest are the resources and workloads reserved on a node
+// or a gateway
+type ReservedResourcesRequest struct {
+	generated.ResourceAmount
+	generated.WorkloadAmount
+}
+
 func (s *NodeAPI) registerNode(r *http.Request) (interface{}, mw.Response) {
 	log.Info().Msg("node register request received")
 
@@ -49,7 +80,7 @@ func (s *NodeAPI) registerNode(r *http.Request) (interface{}, mw.Response) {
 	var farmFilter types.FarmFilter
 	farmFilter = farmFilter.WithID(schema.ID(n.FarmId))
 	if _, err := farmFilter.Get(r.Context(), db); err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "unknown farm id"))
+		return nil, mw.NotFound(errors.Wrap(err, "unknown farm id")).WithCode(mw.CodeFarmNotFound)
 	}
 
 	//make sure node can not set public config
@@ -58,7 +89,7 @@ func (s *NodeAPI) registerNode(r *http.Request) (interface{}, mw.Response) {
 	n.Deleted = false
 	if _, err := s.Add(r.Context(), db, n); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, mw.NotFound(fmt.Errorf("farm with id:%d does not exists", n.FarmId))
+			return nil, mw.NotFound(fmt.Errorf("farm with id:%d does not exists", n.FarmId)).WithCode(mw.CodeFarmNotFound)
 		}
 		return nil, mw.Error(err)
 	}
@@ -78,10 +109,15 @@ func (s *NodeAPI) nodeDetail(r *http.Request) (interface{}, mw.Response) {
 
 	node, err := s.Get(r.Context(), db, nodeID, q.Proofs)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
+	}
+
+	live, err := directory.NodeLiveness(r.Context(), db, directory.NodeCollection, time.Now(), node.NodeId)
+	if err != nil {
+		return nil, mw.Error(err)
 	}
 
-	return node, nil
+	return directory.NodeInfo{Node: node, Liveness: live[node.NodeId]}, nil
 }
 
 func (s *NodeAPI) listNodes(r *http.Request) (interface{}, mw.Response) {
@@ -90,24 +126,75 @@ func (s *NodeAPI) listNodes(r *http.Request) (interface{}, mw.Response) {
 		return nil, err
 	}
 
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	nodes, total, err := s.List(r.Context(), db, q, pagination)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	n, more := pagination.Trim(len(nodes))
+	nodes = nodes[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = nodes[n-1].ID
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.NodeId)
+	}
+	live, err := directory.NodeLiveness(r.Context(), db, directory.NodeCollection, time.Now(), ids...)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	infos := make([]directory.NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		infos = append(infos, directory.NodeInfo{Node: node, Liveness: live[node.NodeId]})
+	}
+
+	return infos, mw.Page(r, pagination, last, more, total)
+}
+
+func (s *NodeAPI) searchNodes(r *http.Request) (interface{}, mw.Response) {
+	q := nodeSearch{}
+	if err := q.Parse(r); err != nil {
+		return nil, err
+	}
+
 	db := mw.Database(r)
-	pager := models.PageFromRequest(r)
-	nodes, total, err := s.List(r.Context(), db, q, pager)
+	results, total, err := s.Search(r.Context(), db, q)
+	if errors.Is(err, errTooManyCandidates) {
+		return nil, mw.BadRequest(err)
+	} else if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	// the liveness is only computed for the nodes of the page
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.NodeId)
+	}
+	live, err := directory.NodeLiveness(r.Context(), db, directory.NodeCollection, time.Now(), ids...)
 	if err != nil {
 		return nil, mw.Error(err)
 	}
+	for i := range results {
+		results[i].Liveness = live[results[i].NodeId]
+	}
 
-	pages := fmt.Sprintf("%d", models.Pages(pager, total))
-	return nodes, mw.Ok().WithHeader("Pages", pages)
+	pages := fmt.Sprintf("%d", models.NrPages(total, q.Limit))
+	return results, mw.Ok().WithHeader("Pages", pages).WithHeader("X-Total-Count", fmt.Sprint(total))
 }
 
 func (s *NodeAPI) registerCapacity(r *http.Request) (interface{}, mw.Response) {
-	x := struct {
-		Capacity   generated.ResourceAmount `json:"capacity,omitempty"`
-		DMI        dmi.DMI                  `json:"dmi,omitempty"`
-		Disks      capacity.Disks           `json:"disks,omitempty"`
-		Hypervisor []string                 `json:"hypervisor,omitempty"`
-	}{}
+	var x NodeCapacityRequest
 
 	defer r.Body.Close()
 
@@ -124,7 +211,7 @@ func (s *NodeAPI) registerCapacity(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 
 	if err := s.updateTotalCapacity(r.Context(), db, nodeID, x.Capacity); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	if err := s.StoreProof(r.Context(), db, nodeID, x.DMI, x.Disks, x.Hypervisor); err != nil {
@@ -175,7 +262,7 @@ func (s *NodeAPI) configurePublic(r *http.Request) (interface{}, mw.Response) {
 
 	node, err := s.Get(r.Context(), db, nodeID, false)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	// ensure it is the farmer that does the call
@@ -201,7 +288,7 @@ func (s *NodeAPI) configureFreeToUse(r *http.Request) (interface{}, mw.Response)
 
 	node, err := s.Get(r.Context(), db, nodeID, false)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	// ensure it is the farmer that does the call
@@ -214,9 +301,7 @@ func (s *NodeAPI) configureFreeToUse(r *http.Request) (interface{}, mw.Response)
 		return nil, mw.Forbidden(fmt.Errorf("only the farmer can configured the if the node is free to use"))
 	}
 
-	choice := struct {
-		FreeToUse bool `json:"free_to_use"`
-	}{}
+	var choice NodeFreeToUseRequest
 
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&choice); err != nil {
@@ -240,9 +325,7 @@ func (s *NodeAPI) registerPorts(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.Forbidden(fmt.Errorf("trying to register ports for nodeID %s while you are %s", nodeID, hNodeID))
 	}
 
-	input := struct {
-		Ports []uint `json:"ports"`
-	}{}
+	var input NodePortsRequest
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, mw.BadRequest(err)
 	}
@@ -251,7 +334,7 @@ func (s *NodeAPI) registerPorts(r *http.Request) (interface{}, mw.Response) {
 
 	db := mw.Database(r)
 	if err := s.SetWGPorts(r.Context(), db, nodeID, input.Ports); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	return nil, nil
@@ -266,9 +349,7 @@ func (s *NodeAPI) updateUptimeHandler(r *http.Request) (interface{}, mw.Response
 		return nil, mw.Forbidden(fmt.Errorf("trying to register uptime for nodeID %s while you are %s", nodeID, hNodeID))
 	}
 
-	input := struct {
-		Uptime uint64 `json:"uptime"`
-	}{}
+	var input UptimeRequest
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, mw.BadRequest(err)
 	}
@@ -276,8 +357,13 @@ func (s *NodeAPI) updateUptimeHandler(r *http.Request) (interface{}, mw.Response
 	db := mw.Database(r)
 	log.Debug().Str("node", nodeID).Uint64("uptime", input.Uptime).Msg("node uptime received")
 
-	if err := s.updateUptime(r.Context(), db, nodeID, int64(input.Uptime)); err != nil {
-		return nil, mw.NotFound(err)
+	now := time.Now()
+	if err := s.updateUptime(r.Context(), db, nodeID, int64(input.Uptime), now); err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
+	}
+
+	if _, err := directory.UptimeReportCreate(r.Context(), db, directory.NodeCollection, nodeID, int64(input.Uptime), now); err != nil {
+		return nil, mw.Error(err)
 	}
 
 	return nil, nil
@@ -292,10 +378,7 @@ func (s *NodeAPI) updateReservedResources(r *http.Request) (interface{}, mw.Resp
 		return nil, mw.Forbidden(fmt.Errorf("trying to update reserved capacity for nodeID %s while you are %s", nodeID, hNodeID))
 	}
 
-	input := struct {
-		generated.ResourceAmount
-		generated.WorkloadAmount
-	}{}
+	var input ReservedResourcesRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, mw.BadRequest(err)
@@ -303,10 +386,10 @@ func (s *NodeAPI) updateReservedResources(r *http.Request) (interface{}, mw.Resp
 
 	db := mw.Database(r)
 	if err := s.updateReservedCapacity(r.Context(), db, nodeID, input.ResourceAmount); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 	if err := s.updateWorkloadsAmount(r.Context(), db, nodeID, input.WorkloadAmount); err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	return nil, nil
@@ -0,0 +1,420 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/mw"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// earthRadius in km
+	earthRadius = 6371
+	// maxSearchCandidates is the maximum number of nodes loaded from the
+	// database when the search can't be done by the database only
+	maxSearchCandidates = 5000
+)
+
+// errTooManyCandidates is returned when too many nodes must be filtered
+// in memory
+var errTooManyCandidates = fmt.Errorf("too many nodes match the search, narrow it down")
+
+// nodeSorts are the orders of the search results, the nodes with the cheapest
+// farm first, or the nodes with the most free capacity or the closest nodes
+// first
+var nodeSorts = map[string]func(a, b *directory.NodeSearchResult) bool{
+	"price": func(a, b *directory.NodeSearchResult) bool {
+		if a.Price.CU != b.Price.CU {
+			return a.Price.CU < b.Price.CU
+		}
+		return a.Price.SU < b.Price.SU
+	},
+	"cru": func(a, b *directory.NodeSearchResult) bool {
+		return a.FreeResources.Cru > b.FreeResources.Cru
+	},
+	"mru": func(a, b *directory.NodeSearchResult) bool {
+		return a.FreeResources.Mru > b.FreeResources.Mru
+	},
+	"sru": func(a, b *directory.NodeSearchResult) bool {
+		return a.FreeResources.Sru > b.FreeResources.Sru
+	},
+	"hru": func(a, b *directory.NodeSearchResult) bool {
+		return a.FreeResources.Hru > b.FreeResources.Hru
+	},
+	"distance": func(a, b *directory.NodeSearchResult) bool {
+		return a.Distance < b.Distance
+	},
+}
+
+// nodeSearch are the parameters of a node search. The capacity of the node
+// query is the minimum free capacity of the nodes.
+type nodeSearch struct {
+	nodeQuery
+	// PublicIPs is the minimum number of free public ips in the farm
+	PublicIPs int64
+	// IPv6 nodes only, the nodes with a public config with an ipv6 address
+	IPv6 bool
+	// UpdatedWithin is the maximum time since the last report of the nodes
+	UpdatedWithin time.Duration
+	// MaxCUPrice and MaxSUPrice are the maximum prices of the farms
+	MaxCUPrice float64
+	MaxSUPrice float64
+	// Latitude, Longitude and Radius in km of the area of the nodes
+	Latitude  float64
+	Longitude float64
+	Radius    float64
+	Sort      string
+	// Skip and Limit are the page of the results
+	Skip  int64
+	Limit int64
+}
+
+func (n *nodeSearch) Parse(r *http.Request) mw.Response {
+	if err := n.nodeQuery.Parse(r); err != nil {
+		return err
+	}
+
+	var err error
+	n.PublicIPs, err = models.QueryInt(r, "public_ips")
+	if err != nil {
+		return mw.BadRequest(errors.Wrap(err, "invalid public_ips"))
+	}
+	n.IPv6 = r.URL.Query().Get("ipv6") == "true"
+
+	seconds, err := models.QueryInt(r, "updated_within")
+	if err != nil {
+		return mw.BadRequest(errors.Wrap(err, "invalid updated_within"))
+	}
+	n.UpdatedWithin = time.Duration(seconds) * time.Second
+
+	for name, value := range map[string]*float64{
+		"max_cu_price": &n.MaxCUPrice,
+		"max_su_price": &n.MaxSUPrice,
+		"latitude":     &n.Latitude,
+		"longitude":    &n.Longitude,
+		"radius":       &n.Radius,
+	} {
+		if *value, err = queryFloat(r, name); err != nil {
+			return mw.BadRequest(errors.Wrapf(err, "invalid %s", name))
+		}
+	}
+
+	query := r.URL.Query()
+	if n.Radius < 0 {
+		return mw.BadRequest(fmt.Errorf("radius can't be negative"))
+	}
+	if n.Radius > 0 && (query.Get("latitude") == "" || query.Get("longitude") == "") {
+		return mw.BadRequest(fmt.Errorf("latitude and longitude are required to search in a radius"))
+	}
+
+	n.Sort = query.Get("sort")
+	if _, ok := nodeSorts[n.Sort]; n.Sort != "" && !ok {
+		return mw.BadRequest(fmt.Errorf("can not sort nodes on '%s'", n.Sort))
+	}
+	if n.Sort == "distance" && n.Radius == 0 {
+		return mw.BadRequest(fmt.Errorf("nodes can only be sorted by distance when searching in a radius"))
+	}
+
+	// a page has at least one node and the pages start at the first one
+	pager := models.PageFromRequest(r)
+	var page int64
+	if *pager.Limit != 0 {
+		page = *pager.Skip / *pager.Limit
+	}
+	n.Limit = *pager.Limit
+	if n.Limit < 1 {
+		n.Limit = 1
+	}
+	n.Skip = page * n.Limit
+	if n.Skip < 0 {
+		n.Skip = 0
+	}
+
+	return nil
+}
+
+// inDatabase checks if the whole search, sorting included, can be done by the
+// database. The free ips, ipv6, price and distance need the farms of the nodes
+// or a computation on the results.
+func (n *nodeSearch) inDatabase() bool {
+	return n.PublicIPs == 0 &&
+		!n.IPv6 &&
+		n.MaxCUPrice == 0 &&
+		n.MaxSUPrice == 0 &&
+		n.Radius == 0 &&
+		n.Sort != "price" &&
+		n.Sort != "distance"
+}
+
+// pipeline is the aggregation which returns the page of the search when it
+// is done by the database. The nodes are sorted by id, or by free capacity
+// and then by id like the in memory sort.
+func (n *nodeSearch) pipeline(now time.Time) mongo.Pipeline {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: n.filter(now)}},
+	}
+
+	sort := bson.D{{Key: "_id", Value: 1}}
+	if n.Sort != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{
+			"free": bson.M{"$max": bson.A{
+				bson.M{"$subtract": bson.A{
+					"$total_resources." + n.Sort,
+					bson.M{"$ifNull": bson.A{"$reserved_resources." + n.Sort, 0}},
+				}},
+				0,
+			}},
+		}}})
+		sort = append(bson.D{{Key: "free", Value: -1}}, sort...)
+	}
+
+	projection := bson.M{"free": 0}
+	if !n.Proofs {
+		projection["proofs"] = 0
+	}
+
+	return append(pipeline,
+		bson.D{{Key: "$sort", Value: sort}},
+		bson.D{{Key: "$skip", Value: n.Skip}},
+		bson.D{{Key: "$limit", Value: n.Limit}},
+		bson.D{{Key: "$project", Value: projection}},
+	)
+}
+
+// filter returns the part of the search done by the database
+func (n *nodeSearch) filter(now time.Time) directory.NodeFilter {
+	filter := directory.NodeFilter{}
+	if n.FarmID > 0 {
+		filter = filter.WithFarmID(schema.ID(n.FarmID))
+	}
+	filter = filter.WithFreeCap(n.CRU, n.MRU, n.HRU, n.SRU)
+	filter = filter.WithLocation(n.Country, n.City)
+	if n.UpdatedWithin > 0 {
+		filter = filter.WithUpdatedSince(now.Add(-n.UpdatedWithin))
+	}
+	if n.Status != "" {
+		filter = filter.WithStatus(n.Status, now)
+	}
+	if !n.Deleted {
+		filter = filter.ExcludeDeleted()
+	}
+
+	return filter
+}
+
+// matches checks the part of the search which can't be done by the database
+func (n *nodeSearch) matches(result *directory.NodeSearchResult) bool {
+	if int64(result.FreePublicIPs) < n.PublicIPs {
+		return false
+	}
+
+	if n.IPv6 && (result.PublicConfig == nil || len(result.PublicConfig.Ipv6.IP) == 0) {
+		return false
+	}
+
+	if n.MaxCUPrice > 0 && result.Price.CU > n.MaxCUPrice {
+		return false
+	}
+	if n.MaxSUPrice > 0 && result.Price.SU > n.MaxSUPrice {
+		return false
+	}
+
+	if n.Radius > 0 && result.Distance > n.Radius {
+		return false
+	}
+
+	return true
+}
+
+// Search the nodes with free capacity and returns the page of the query with
+// the total number of results. When the search can't be done by the database
+// only, the nodes matching the database filter are filtered and sorted in
+// memory, as long as they are not more than maxSearchCandidates.
+func (s *NodeAPI) Search(ctx context.Context, db *mongo.Database, q nodeSearch) ([]directory.NodeSearchResult, int64, error) {
+	now := time.Now()
+	if q.inDatabase() {
+		return s.searchInDatabase(ctx, db, q, now)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(maxSearchCandidates + 1)
+	if !q.Proofs {
+		opts = opts.SetProjection(bson.D{{Key: "proofs", Value: 0}})
+	}
+
+	cur, err := q.filter(now).Find(ctx, db, opts)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to search nodes")
+	}
+	defer cur.Close(ctx)
+
+	nodes := []directory.Node{}
+	if err := cur.All(ctx, &nodes); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to load node list")
+	}
+	if len(nodes) > maxSearchCandidates {
+		return nil, 0, errTooManyCandidates
+	}
+
+	farms, err := s.farms(ctx, db, nodes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := s.search(q, nodes, farms)
+	total := int64(len(results))
+
+	return page(results, q.Skip, q.Limit), total, nil
+}
+
+// searchInDatabase loads the page of the search from the database, the total
+// is the number of nodes matching the filter
+func (s *NodeAPI) searchInDatabase(ctx context.Context, db *mongo.Database, q nodeSearch, now time.Time) ([]directory.NodeSearchResult, int64, error) {
+	total, err := q.filter(now).Count(ctx, db)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count nodes")
+	}
+
+	cur, err := db.Collection(directory.NodeCollection).Aggregate(ctx, q.pipeline(now))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to search nodes")
+	}
+	defer cur.Close(ctx)
+
+	nodes := []directory.Node{}
+	if err := cur.All(ctx, &nodes); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to load node list")
+	}
+
+	farms, err := s.farms(ctx, db, nodes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.search(q, nodes, farms), total, nil
+}
+
+// page returns the results between skip and skip + limit
+func page(results []directory.NodeSearchResult, skip, limit int64) []directory.NodeSearchResult {
+	total := int64(len(results))
+	if skip > total {
+		skip = total
+	}
+	end := skip + limit
+	if end > total {
+		end = total
+	}
+
+	return results[skip:end]
+}
+
+// farms loads the farms of the nodes by id
+func (s *NodeAPI) farms(ctx context.Context, db *mongo.Database, nodes []directory.Node) (map[schema.ID]directory.Farm, error) {
+	farms := make(map[schema.ID]directory.Farm)
+	if len(nodes) == 0 {
+		return farms, nil
+	}
+
+	seen := make(map[schema.ID]struct{})
+	var ids []schema.ID
+	for _, node := range nodes {
+		id := schema.ID(node.FarmId)
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+
+	cur, err := directory.FarmFilter{}.WithIDs(ids).Find(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the farms of the nodes")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var farm directory.Farm
+		if err := cur.Decode(&farm); err != nil {
+			return nil, errors.Wrap(err, "failed to load the farms of the nodes")
+		}
+		farms[farm.ID] = farm
+	}
+
+	return farms, cur.Err()
+}
+
+// search filters and sorts the nodes, nodes without a farm are skipped
+func (s *NodeAPI) search(q nodeSearch, nodes []directory.Node, farms map[schema.ID]directory.Farm) []directory.NodeSearchResult {
+	results := []directory.NodeSearchResult{}
+	for _, node := range nodes {
+		farm, ok := farms[schema.ID(node.FarmId)]
+		if !ok {
+			continue
+		}
+
+		result := directory.NodeSearchResult{
+			Node:          node,
+			FreeResources: node.FreeResources(),
+			Price:         s.prices,
+		}
+		for _, ip := range farm.IPAddresses {
+			if ip.ReservationID == 0 {
+				result.FreePublicIPs++
+			}
+		}
+		if farm.EnableCustomPricing {
+			result.Price = farm.FarmCloudUnitsPrice
+		}
+		if q.Radius > 0 {
+			result.Distance = distance(q.Latitude, q.Longitude, node.Location.Latitude, node.Location.Longitude)
+		}
+
+		if q.matches(&result) {
+			results = append(results, result)
+		}
+	}
+
+	if less, ok := nodeSorts[q.Sort]; ok {
+		sort.SliceStable(results, func(i, j int) bool {
+			return less(&results[i], &results[j])
+		})
+	}
+
+	return results
+}
+
+// distance returns the great circle distance in km between two locations
+func distance(lat1, long1, lat2, long2 float64) float64 {
+	radians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+
+	dLat := radians(lat2 - lat1)
+	dLong := radians(long2 - long1)
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLong/2), 2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// queryFloat get a float from query string
+func queryFloat(r *http.Request, q string) (float64, error) {
+	s := r.URL.Query().Get(q)
+	if s == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,176 @@
+package directory
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNodeSearchParse(t *testing.T) {
+	r := httptest.NewRequest("GET", "/nodes/search?farm=1&cru=4&mru=16&public_ips=1&ipv6=true&updated_within=600&max_cu_price=8.5&latitude=30.1&longitude=31.2&radius=100&sort=distance&status=up", nil)
+
+	var q nodeSearch
+	require.Nil(t, q.Parse(r))
+	assert.Equal(t, int64(1), q.FarmID)
+	assert.Equal(t, int64(4), q.CRU)
+	assert.Equal(t, int64(16), q.MRU)
+	assert.Equal(t, int64(1), q.PublicIPs)
+	assert.True(t, q.IPv6)
+	assert.Equal(t, 10*time.Minute, q.UpdatedWithin)
+	assert.Equal(t, 8.5, q.MaxCUPrice)
+	assert.Equal(t, 30.1, q.Latitude)
+	assert.Equal(t, 31.2, q.Longitude)
+	assert.Equal(t, 100.0, q.Radius)
+	assert.Equal(t, "distance", q.Sort)
+	assert.Equal(t, directory.NodeStatusUp, q.Status)
+
+	now := time.Unix(10000, 0)
+	assert.Equal(t, directory.NodeFilter{
+		{Key: "farm_id", Value: schema.ID(1)},
+		{Key: "$expr", Value: bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{bson.M{"$subtract": bson.A{"$total_resources.cru", bson.M{"$ifNull": bson.A{"$reserved_resources.cru", 0}}}}, int64(4)}},
+			bson.M{"$gte": bson.A{bson.M{"$subtract": bson.A{"$total_resources.mru", bson.M{"$ifNull": bson.A{"$reserved_resources.mru", 0}}}}, int64(16)}},
+		}}},
+		{Key: "updated.time", Value: bson.M{"$gte": now.Add(-10 * time.Minute)}},
+		{Key: "last_report.time", Value: bson.M{"$gte": now.Add(-20 * time.Minute)}},
+		directory.NodeFilter{}.ExcludeDeleted()[0],
+	}, q.filter(now))
+
+	for _, query := range []string{
+		"cru=many",
+		"max_su_price=cheap",
+		"radius=-1&latitude=1&longitude=1",
+		"radius=10&latitude=1",
+		"sort=name",
+		"sort=distance",
+		"status=sleeping",
+	} {
+		r := httptest.NewRequest("GET", "/nodes/search?"+query, nil)
+		var q nodeSearch
+		assert.NotNil(t, q.Parse(r), query)
+	}
+	assert.False(t, q.inDatabase())
+
+	for query, page := range map[string][2]int64{
+		"page=3&size=10": {20, 10},
+		"size=0":         {0, 1},
+		"size=-1":        {0, 1},
+		"page=2&size=-5": {1, 1},
+		"page=-2":        {0, models.DefaultPageSize},
+	} {
+		r := httptest.NewRequest("GET", "/nodes/search?"+query, nil)
+		var q nodeSearch
+		require.Nil(t, q.Parse(r), query)
+		assert.Equal(t, page, [2]int64{q.Skip, q.Limit}, query)
+	}
+}
+
+func TestNodeSearchPipeline(t *testing.T) {
+	now := time.Unix(10000, 0)
+	q := nodeSearch{Sort: "cru", Skip: 10, Limit: 5}
+	require.True(t, q.inDatabase())
+
+	pipeline := q.pipeline(now)
+	require.Len(t, pipeline, 6)
+	assert.Equal(t, bson.D{{Key: "$match", Value: q.filter(now)}}, pipeline[0])
+	assert.Equal(t, bson.D{{Key: "$sort", Value: bson.D{{Key: "free", Value: -1}, {Key: "_id", Value: 1}}}}, pipeline[2])
+	assert.Equal(t, bson.D{{Key: "$skip", Value: int64(10)}}, pipeline[3])
+	assert.Equal(t, bson.D{{Key: "$limit", Value: int64(5)}}, pipeline[4])
+
+	q = nodeSearch{Limit: 5}
+	pipeline = q.pipeline(now)
+	require.Len(t, pipeline, 5)
+	assert.Equal(t, bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}}, pipeline[1])
+	assert.Equal(t, bson.D{{Key: "$project", Value: bson.M{"free": 0, "proofs": 0}}}, pipeline[4])
+
+	for _, q := range []nodeSearch{{PublicIPs: 1}, {IPv6: true}, {MaxSUPrice: 1}, {Sort: "price"}} {
+		assert.False(t, q.inDatabase())
+	}
+}
+
+func TestNodeSearch(t *testing.T) {
+	api := NodeAPI{prices: generated.NodeCloudUnitPrice{CU: 10, SU: 8}}
+
+	farms := map[schema.ID]directory.Farm{
+		1: {
+			ID: 1,
+			IPAddresses: []generated.PublicIP{
+				{ReservationID: 0},
+				{ReservationID: 12},
+			},
+		},
+		2: {
+			ID:                  2,
+			EnableCustomPricing: true,
+			FarmCloudUnitsPrice: generated.NodeCloudUnitPrice{CU: 5, SU: 9},
+		},
+	}
+
+	ipv6, err := schema.ParseIPRange("2a02:1802:5e::1/64")
+	require.NoError(t, err)
+
+	nodes := []directory.Node{
+		{
+			NodeId:            "cairo",
+			FarmId:            1,
+			Location:          generated.Location{Latitude: 30.04, Longitude: 31.23},
+			TotalResources:    generated.ResourceAmount{Cru: 8, Mru: 32},
+			ReservedResources: generated.ResourceAmount{Cru: 2, Mru: 30},
+		},
+		{
+			NodeId:         "ghent",
+			FarmId:         2,
+			Location:       generated.Location{Latitude: 51.05, Longitude: 3.72},
+			TotalResources: generated.ResourceAmount{Cru: 4, Mru: 16},
+			PublicConfig:   &generated.PublicIface{Ipv6: ipv6},
+		},
+		{
+			NodeId:         "orphan",
+			FarmId:         3,
+			TotalResources: generated.ResourceAmount{Cru: 64},
+		},
+	}
+
+	ids := func(results []directory.NodeSearchResult) []string {
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.NodeId)
+		}
+		return ids
+	}
+
+	results := api.search(nodeSearch{}, nodes, farms)
+	require.Len(t, results, 2)
+	assert.Equal(t, []string{"ghent"}, ids(page(results, 1, 5)))
+	assert.Empty(t, page(results, 4, 5))
+	assert.Equal(t, generated.ResourceAmount{Cru: 6, Mru: 2}, results[0].FreeResources)
+	assert.Equal(t, 1, results[0].FreePublicIPs)
+	assert.Equal(t, api.prices, results[0].Price)
+	assert.Equal(t, farms[2].FarmCloudUnitsPrice, results[1].Price)
+	assert.Zero(t, results[0].Distance)
+
+	assert.Equal(t, []string{"cairo"}, ids(api.search(nodeSearch{PublicIPs: 1}, nodes, farms)))
+	assert.Equal(t, []string{"ghent"}, ids(api.search(nodeSearch{IPv6: true}, nodes, farms)))
+	assert.Equal(t, []string{"ghent"}, ids(api.search(nodeSearch{MaxCUPrice: 6}, nodes, farms)))
+	assert.Equal(t, []string{"cairo"}, ids(api.search(nodeSearch{MaxSUPrice: 8}, nodes, farms)))
+	assert.Equal(t, []string{"ghent", "cairo"}, ids(api.search(nodeSearch{Sort: "price"}, nodes, farms)))
+	assert.Equal(t, []string{"ghent", "cairo"}, ids(api.search(nodeSearch{Sort: "mru"}, nodes, farms)))
+	assert.Equal(t, []string{"cairo", "ghent"}, ids(api.search(nodeSearch{Sort: "cru"}, nodes, farms)))
+
+	// around brussels
+	brussels := nodeSearch{Latitude: 50.85, Longitude: 4.35, Radius: 100, Sort: "distance"}
+	results = api.search(brussels, nodes, farms)
+	require.Equal(t, []string{"ghent"}, ids(results))
+	assert.InDelta(t, 50, results[0].Distance, 5)
+
+	brussels.Radius = 5000
+	assert.Equal(t, []string{"ghent", "cairo"}, ids(api.search(brussels, nodes, farms)))
+}
@@ -24,7 +24,11 @@ import (
 )
 
 // NodeAPI holds api for nodes
-type NodeAPI struct{}
+type NodeAPI struct {
+	// prices are the prices of the capacity of the farms without custom
+	// pricing
+	prices generated.NodeCloudUnitPrice
+}
 
 type nodeQuery struct {
 	FarmID  int64
@@ -36,6 +40,7 @@ type nodeQuery struct {
 	HRU     int64
 	Proofs  bool
 	Deleted bool
+	Status  directory.NodeStatus
 }
 
 func (n *nodeQuery) Parse(r *http.Request) mw.Response {
@@ -65,12 +70,13 @@ func (n *nodeQuery) Parse(r *http.Request) mw.Response {
 	n.Proofs = r.URL.Query().Get("proofs") == "true"
 	n.Deleted = r.URL.Query().Get("deleted") == "true"
 
-	return nil
+	var resp mw.Response
+	n.Status, resp = parseStatus(r)
+	return resp
 }
 
-// List farms
-// TODO: add paging arguments
-func (s *NodeAPI) List(ctx context.Context, db *mongo.Database, q nodeQuery, opts ...*options.FindOptions) ([]directory.Node, int64, error) {
+// List nodes, the total is only counted if the pagination requires it
+func (s *NodeAPI) List(ctx context.Context, db *mongo.Database, q nodeQuery, pagination models.Pagination, opts ...*options.FindOptions) ([]directory.Node, int64, error) {
 	// Initialize the filter since we don't want a default, we might want a fully
 	// empty one
 	filter := directory.NodeFilter{}
@@ -79,6 +85,9 @@ func (s *NodeAPI) List(ctx context.Context, db *mongo.Database, q nodeQuery, opt
 	}
 	filter = filter.WithTotalCap(q.CRU, q.MRU, q.HRU, q.SRU)
 	filter = filter.WithLocation(q.Country, q.City)
+	if q.Status != "" {
+		filter = filter.WithStatus(q.Status, time.Now())
+	}
 	if !q.Deleted {
 		filter = filter.ExcludeDeleted()
 	}
@@ -90,6 +99,17 @@ func (s *NodeAPI) List(ctx context.Context, db *mongo.Database, q nodeQuery, opt
 		opts = append(opts, options.Find().SetProjection(projection))
 	}
 
+	var count int64
+	if pagination.Count() {
+		var err error
+		count, err = filter.Count(ctx, db)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to count entries in nodes collection")
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
+	opts = append([]*options.FindOptions{pagination.FindOptions()}, opts...)
 	cur, err := filter.Find(ctx, db, opts...)
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed to list nodes")
@@ -101,11 +121,6 @@ func (s *NodeAPI) List(ctx context.Context, db *mongo.Database, q nodeQuery, opt
 		return nil, 0, errors.Wrap(err, "failed to load node list")
 	}
 
-	count, err := filter.Count(ctx, db)
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed to count entries in nodes collection")
-	}
-
 	return out, count, nil
 }
 
@@ -152,8 +167,8 @@ func (s *NodeAPI) updateReservedCapacity(ctx context.Context, db *mongo.Database
 	return directory.NodeUpdateReservedResources(ctx, db, nodeID, capacity)
 }
 
-func (s *NodeAPI) updateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64) error {
-	return directory.NodeUpdateUptime(ctx, db, nodeID, uptime)
+func (s *NodeAPI) updateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64, now time.Time) error {
+	return directory.NodeUpdateUptime(ctx, db, nodeID, uptime, now)
 }
 
 func (s *NodeAPI) updateFreeToUse(ctx context.Context, db *mongo.Database, nodeID string, freeToUse bool) error {
@@ -237,7 +252,7 @@ func (s *NodeAPI) Requires(key string, handler mw.Action) mw.Action {
 		if err != nil {
 			return nil, mw.Error(err)
 		} else if !exists {
-			return nil, mw.NotFound(fmt.Errorf("node '%s' not found", nodeID))
+			return nil, mw.NotFound(fmt.Errorf("node '%s' not found", nodeID)).WithCode(mw.CodeNodeNotFound)
 		}
 
 		return handler(r)
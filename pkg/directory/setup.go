@@ -2,27 +2,40 @@ package directory
 
 import (
 	"context"
+	"net"
 
 	"github.com/gorilla/mux"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/directory"
 	"github.com/threefoldtech/tfexplorer/mw"
 	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
 	"github.com/zaibon/httpsig"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Setup injects and initializes directory package
-func Setup(parent *mux.Router, db *mongo.Database) error {
+// Setup injects and initializes directory package. The prices are the prices
+// of the capacity of the farms without custom pricing.
+func Setup(parent *mux.Router, db *mongo.Database, prices generated.NodeCloudUnitPrice) error {
 	if err := directory.Setup(context.TODO(), db); err != nil {
 		return err
 	}
 
+	registerRoutes(parent, db, prices)
+
+	return nil
+}
+
+// registerRoutes registers the routes of the package, the routes are only
+// bound to the database when they are called
+func registerRoutes(parent *mux.Router, db *mongo.Database, prices generated.NodeCloudUnitPrice) {
 	userVerifier := httpsig.NewVerifier(mw.NewUserKeyGetter(db))
 	nodeVerifier := httpsig.NewVerifier(mw.NewNodeKeyGetter())
 
 	var farmAPI = FarmAPI{
 		verifier: userVerifier,
 	}
-	var nodeAPI NodeAPI
+	nodeAPI := NodeAPI{
+		prices: prices,
+	}
 
 	// versionned endpoints
 	api := parent.PathPrefix("/api/v1").Subrouter()
@@ -33,6 +46,7 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 	farms.HandleFunc("/{farm_id}", mw.AsHandlerFunc(farmAPI.getFarm)).Methods("GET").Name("farm-get-v1")
 	farms.HandleFunc("/{farm_id}/deals", mw.AsHandlerFunc(farmAPI.getFarmCustomPrices)).Methods("GET").Name("farm-get-prices-v1")
 	farms.HandleFunc("/{farm_id}/deals/{threebot_id}", mw.AsHandlerFunc(farmAPI.getFarmCustomPriceForThreebot)).Methods("GET").Name("farm-get-prices-for-threebot-v1")
+	farms.HandleFunc("/{farm_id}/policy", mw.AsHandlerFunc(farmAPI.getFarmPolicy)).Methods("GET").Name("farm-get-policy-v1")
 
 	farmsAuthenticated := farms.PathPrefix("/{farm_id}").Subrouter()
 	farmsAuthenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
@@ -43,6 +57,7 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 	farmsAuthenticated.HandleFunc("/{node_id}", mw.AsHandlerFunc(nodeAPI.Requires("node_id", farmAPI.deleteNodeFromFarm))).Methods("DELETE").Name("farm-node-delete-v1")
 	farmsAuthenticated.HandleFunc("/deals", mw.AsHandlerFunc(farmAPI.createOrUpdateFarmCustomPrice)).Methods("POST", "PUT").Name("farm-update-prices-v1")
 	farmsAuthenticated.HandleFunc("/deals/{threebot_id}", mw.AsHandlerFunc(farmAPI.deleteFarmCustomPrice)).Methods("DELETE").Name("farm-delete-prices-v1")
+	farmsAuthenticated.HandleFunc("/policy", mw.AsHandlerFunc(farmAPI.setFarmPolicy)).Methods("PUT").Name("farm-update-policy-v1")
 
 	nodes := api.PathPrefix("/nodes").Subrouter()
 	nodesAuthenticated := api.PathPrefix("/nodes").Subrouter()
@@ -56,6 +71,7 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 
 	nodesAuthenticated.HandleFunc("", mw.AsHandlerFunc(nodeAPI.registerNode)).Methods("POST").Name("node-register-v1")
 	nodes.HandleFunc("", mw.AsHandlerFunc(nodeAPI.listNodes)).Methods("GET").Name("nodes-list-v1")
+	nodes.HandleFunc("/search", mw.AsHandlerFunc(nodeAPI.searchNodes)).Methods("GET").Name("nodes-search-v1")
 	nodes.HandleFunc("/{node_id}", mw.AsHandlerFunc(nodeAPI.nodeDetail)).Methods("GET").Name(("node-get-v1"))
 	nodesAuthenticated.HandleFunc("/{node_id}/interfaces", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.registerIfaces))).Methods("POST").Name("node-interfaces-v1")
 	nodesAuthenticated.HandleFunc("/{node_id}/ports", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.registerPorts))).Methods("POST").Name("node-set-ports-v1")
@@ -63,9 +79,12 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 	userAuthenticated.HandleFunc("/{node_id}/configure_free", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.configureFreeToUse))).Methods("POST").Name("node-configure-free-v1")
 	nodesAuthenticated.HandleFunc("/{node_id}/capacity", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.registerCapacity))).Methods("POST").Name("node-capacity-v1")
 	nodesAuthenticated.HandleFunc("/{node_id}/uptime", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.updateUptimeHandler))).Methods("POST").Name("node-uptime-v1")
+	nodes.HandleFunc("/{node_id}/uptime", mw.AsHandlerFunc(nodeAPI.Requires("node_id", listUptimeReports))).Methods("GET").Name("node-uptime-history-v1")
 	nodesAuthenticated.HandleFunc("/{node_id}/used_resources", mw.AsHandlerFunc(nodeAPI.Requires("node_id", nodeAPI.updateReservedResources))).Methods("POST").Name("node-reserved-resources-v1")
 
-	var gwAPI GatewayAPI
+	gwAPI := GatewayAPI{
+		resolver: net.DefaultResolver,
+	}
 	gw := api.PathPrefix("/gateways").Subrouter()
 	gwAuthenticated := api.PathPrefix("/gateways").Subrouter()
 	gwAuthMW := mw.NewAuthMiddleware(nodeVerifier)
@@ -75,8 +94,21 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 	gw.HandleFunc("", mw.AsHandlerFunc(gwAPI.listGateways)).Methods("GET").Name("gateway-list-v1")
 	gw.HandleFunc("/{node_id}", mw.AsHandlerFunc(gwAPI.gatewayDetail)).Methods("GET").Name(("gateway-get-v1"))
 	gwAuthenticated.HandleFunc("/{node_id}/uptime", mw.AsHandlerFunc(gwAPI.Requires("node_id", gwAPI.updateUptimeHandler))).Methods("POST").Name("gateway-uptime-v1")
+	gw.HandleFunc("/{node_id}/uptime", mw.AsHandlerFunc(gwAPI.Requires("node_id", listUptimeReports))).Methods("GET").Name("gateway-uptime-history-v1")
 	gwAuthenticated.HandleFunc("/{node_id}/reserved_resources", mw.AsHandlerFunc(gwAPI.Requires("node_id", gwAPI.updateReservedResources))).Methods("POST").Name("gateway-reserved-resources-v1")
 
+	domainAPI := DomainAPI{
+		resolver: net.DefaultResolver,
+	}
+	domains := api.PathPrefix("/domains").Subrouter()
+	domains.Use(userAuthMW.Middleware)
+
+	domains.HandleFunc("", mw.AsHandlerFunc(domainAPI.createChallenge)).Methods("POST").Name("domain-challenge-v1")
+	domains.HandleFunc("", mw.AsHandlerFunc(domainAPI.listDomains)).Methods("GET").Name("domain-list-v1")
+	domains.HandleFunc("/{domain}", mw.AsHandlerFunc(domainAPI.getDomain)).Methods("GET").Name("domain-get-v1")
+	domains.HandleFunc("/{domain}", mw.AsHandlerFunc(domainAPI.deleteDomain)).Methods("DELETE").Name("domain-delete-v1")
+	domains.HandleFunc("/{domain}/verify", mw.AsHandlerFunc(domainAPI.verifyDomain)).Methods("POST").Name("domain-verify-v1")
+
 	// legacy endpoints
 	legacyFarms := parent.PathPrefix("/explorer/farms").Subrouter()
 	legacyFarmsAuthenticated := parent.PathPrefix("/explorer/farms").Subrouter()
@@ -119,6 +151,4 @@ func Setup(parent *mux.Router, db *mongo.Database) error {
 	legacyGw.HandleFunc("/{node_id}", mw.AsHandlerFunc(gwAPI.gatewayDetail)).Methods("GET").Name(("gateway-get"))
 	legacyGwAuthenticated.HandleFunc("/{node_id}/uptime", mw.AsHandlerFunc(gwAPI.Requires("node_id", gwAPI.updateUptimeHandler))).Methods("POST").Name("gateway-uptime")
 	legacyGwAuthenticated.HandleFunc("/{node_id}/reserved_resources", mw.AsHandlerFunc(gwAPI.Requires("node_id", gwAPI.updateReservedResources))).Methods("POST").Name("gateway-reserved-resources")
-
-	return nil
 }
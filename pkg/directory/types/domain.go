@@ -0,0 +1,237 @@
+package types
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DomainOwnershipCollection db collection name
+	DomainOwnershipCollection = "domain_ownership"
+
+	// DomainChallengeName is the name under the domain where the TXT record
+	// with the challenge token must be published
+	DomainChallengeName = "__explorer__"
+
+	// DomainOwnershipValidity is the time a verified domain ownership is
+	// trusted before the domain has to be verified again
+	DomainOwnershipValidity = 30 * 24 * time.Hour
+)
+
+// DomainOwnership is the proof that a user owns a domain. The explorer issues
+// a challenge token per user and domain, the user proves the ownership by
+// publishing the token in a TXT record of the domain. A verified ownership
+// also covers all the subdomains of the domain.
+type DomainOwnership struct {
+	UserTid int64  `bson:"user_tid" json:"user_tid"`
+	Domain  string `bson:"domain" json:"domain"`
+	Token   string `bson:"token" json:"token"`
+	// VerifiedUntil is the time the ownership stays verified, zero if the
+	// domain was never verified
+	VerifiedUntil schema.Date `bson:"verified_until" json:"verified_until"`
+	Epoch         schema.Date `bson:"epoch" json:"epoch"`
+}
+
+// ChallengeHost is the host name the TXT record must be published under
+func (o *DomainOwnership) ChallengeHost() string {
+	return fmt.Sprintf("%s.%s", DomainChallengeName, o.Domain)
+}
+
+// Verified checks if the ownership is verified at the given time
+func (o *DomainOwnership) Verified(now time.Time) bool {
+	return o.VerifiedUntil.After(now)
+}
+
+// NormalizeDomain validates a domain name and returns it in lower case
+// without the trailing dot
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(domain) == 0 || len(domain) > 253 {
+		return "", fmt.Errorf("invalid domain '%s'", domain)
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("invalid domain '%s', expecting at least a name and a top level domain", domain)
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 {
+			return "", fmt.Errorf("invalid domain '%s'", domain)
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", fmt.Errorf("invalid character '%c' in domain '%s'", c, domain)
+			}
+		}
+	}
+
+	return domain, nil
+}
+
+// DomainParents returns the domain itself followed by all its parent domains,
+// top level domain excluded
+func DomainParents(domain string) []string {
+	labels := strings.Split(domain, ".")
+	parents := make([]string, 0, len(labels))
+	for i := 0; i < len(labels)-1; i++ {
+		parents = append(parents, strings.Join(labels[i:], "."))
+	}
+
+	return parents
+}
+
+// IsSubdomain checks if domain is equal to parent or one of its subdomains
+func IsSubdomain(domain, parent string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	parent = strings.TrimSuffix(strings.ToLower(parent), ".")
+
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
+
+// DomainOwnershipFilter type
+type DomainOwnershipFilter bson.D
+
+// WithUserTid filter ownerships of a user
+func (f DomainOwnershipFilter) WithUserTid(tid int64) DomainOwnershipFilter {
+	return append(f, bson.E{Key: "user_tid", Value: tid})
+}
+
+// WithDomain filter ownership of a domain
+func (f DomainOwnershipFilter) WithDomain(domain string) DomainOwnershipFilter {
+	return append(f, bson.E{Key: "domain", Value: domain})
+}
+
+// WithDomains filter ownerships of any of the given domains
+func (f DomainOwnershipFilter) WithDomains(domains []string) DomainOwnershipFilter {
+	return append(f, bson.E{Key: "domain", Value: bson.M{"$in": domains}})
+}
+
+// WithVerifiedAt filter ownerships which are verified at the given time
+func (f DomainOwnershipFilter) WithVerifiedAt(t time.Time) DomainOwnershipFilter {
+	return append(f, bson.E{Key: "verified_until.time", Value: bson.M{"$gt": t}})
+}
+
+// Get gets single ownership that matches the filter
+func (f DomainOwnershipFilter) Get(ctx context.Context, db *mongo.Database) (DomainOwnership, error) {
+	if f == nil {
+		f = DomainOwnershipFilter{}
+	}
+	var ownership DomainOwnership
+
+	result := db.Collection(DomainOwnershipCollection).FindOne(ctx, f)
+	if err := result.Err(); err != nil {
+		return ownership, err
+	}
+
+	return ownership, errors.Wrap(result.Decode(&ownership), "could not decode domain ownership")
+}
+
+// Find all ownerships that match the filter
+func (f DomainOwnershipFilter) Find(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) ([]DomainOwnership, error) {
+	if f == nil {
+		f = DomainOwnershipFilter{}
+	}
+
+	cursor, err := db.Collection(DomainOwnershipCollection).Find(ctx, f, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get domain ownership cursor")
+	}
+	defer cursor.Close(ctx)
+
+	ownerships := []DomainOwnership{}
+	if err := cursor.All(ctx, &ownerships); err != nil {
+		return nil, errors.Wrap(err, "could not decode domain ownerships")
+	}
+
+	return ownerships, nil
+}
+
+// Count number of ownerships matching
+func (f DomainOwnershipFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	if f == nil {
+		f = DomainOwnershipFilter{}
+	}
+
+	return db.Collection(DomainOwnershipCollection).CountDocuments(ctx, f)
+}
+
+// DomainChallenge returns the ownership of a domain by a user, a new challenge
+// token is issued the first time. The token of an existing ownership is kept
+// so the published record stays valid.
+func DomainChallenge(ctx context.Context, db *mongo.Database, userTid int64, domain string) (DomainOwnership, error) {
+	var ownership DomainOwnership
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return ownership, errors.Wrap(err, "failed to generate challenge token")
+	}
+
+	var filter DomainOwnershipFilter
+	filter = filter.WithUserTid(userTid).WithDomain(domain)
+
+	result := db.Collection(DomainOwnershipCollection).FindOneAndUpdate(ctx, filter, bson.M{
+		"$setOnInsert": bson.M{
+			"token":          hex.EncodeToString(token),
+			"verified_until": schema.Date{},
+			"epoch":          schema.Date{Time: time.Now()},
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+
+	if err := result.Err(); err != nil {
+		return ownership, errors.Wrap(err, "failed to issue domain challenge")
+	}
+
+	return ownership, errors.Wrap(result.Decode(&ownership), "could not decode domain ownership")
+}
+
+// DomainSetVerified marks the ownership of a domain by a user as verified
+// until the given time
+func DomainSetVerified(ctx context.Context, db *mongo.Database, userTid int64, domain string, until time.Time) error {
+	var filter DomainOwnershipFilter
+	filter = filter.WithUserTid(userTid).WithDomain(domain)
+
+	_, err := db.Collection(DomainOwnershipCollection).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"verified_until": schema.Date{Time: until}},
+	})
+
+	return errors.Wrap(err, "failed to set domain ownership verified")
+}
+
+// DomainIsOwned checks if the user has a verified ownership of the domain or
+// of one of its parent domains
+func DomainIsOwned(ctx context.Context, db *mongo.Database, userTid int64, domain string, now time.Time) (bool, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return false, err
+	}
+
+	var filter DomainOwnershipFilter
+	filter = filter.WithUserTid(userTid).WithDomains(DomainParents(domain)).WithVerifiedAt(now)
+
+	count, err := filter.Count(ctx, db)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check domain ownership")
+	}
+
+	return count > 0, nil
+}
+
+// DomainOwnershipRemove removes the ownership of a domain by a user
+func DomainOwnershipRemove(ctx context.Context, db *mongo.Database, userTid int64, domain string) error {
+	var filter DomainOwnershipFilter
+	filter = filter.WithUserTid(userTid).WithDomain(domain)
+
+	_, err := db.Collection(DomainOwnershipCollection).DeleteOne(ctx, filter)
+	return errors.Wrap(err, "failed to remove domain ownership")
+}
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	domain, err := NormalizeDomain(" Example.COM. ")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", domain)
+
+	for _, invalid := range []string{"", "com", "example..com", "exa mple.com", "example.com/path"} {
+		_, err := NormalizeDomain(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDomainParents(t *testing.T) {
+	assert.Equal(t, []string{"a.b.example.com", "b.example.com", "example.com"}, DomainParents("a.b.example.com"))
+	assert.Equal(t, []string{"example.com"}, DomainParents("example.com"))
+}
+
+func TestIsSubdomain(t *testing.T) {
+	assert.True(t, IsSubdomain("example.com", "example.com"))
+	assert.True(t, IsSubdomain("web.example.com", "Example.com."))
+	assert.False(t, IsSubdomain("badexample.com", "example.com"))
+	assert.False(t, IsSubdomain("example.com", "web.example.com"))
+}
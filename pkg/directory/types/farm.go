@@ -49,7 +49,7 @@ func (f *Farm) Validate() error {
 	if config.Config.WalletNetwork != "" {
 		found := false
 		for _, a := range f.WalletAddresses {
-			validator, err := stellar.NewAddressValidator(config.Config.WalletNetwork, a.Asset, config.Config.HorizonURL)
+			validator, err := stellar.NewAddressValidator(config.Config.WalletNetwork, a.Asset, config.Config.Horizon, config.Config.Assets)
 			if err != nil {
 				if errors.Is(err, stellar.ErrAssetCodeNotSupported) {
 					continue
@@ -98,6 +98,11 @@ func (f FarmFilter) WithID(id schema.ID) FarmFilter {
 	return append(f, bson.E{Key: "_id", Value: id})
 }
 
+// WithIDs filter farms which id is in ids
+func (f FarmFilter) WithIDs(ids []schema.ID) FarmFilter {
+	return append(f, bson.E{Key: "_id", Value: bson.M{"$in": ids}})
+}
+
 // WithName filter farm with name
 func (f FarmFilter) WithName(name string) FarmFilter {
 	return append(f, bson.E{Key: "name", Value: name})
@@ -108,6 +113,11 @@ func (f FarmFilter) WithOwner(tid int64) FarmFilter {
 	return append(f, bson.E{Key: "threebot_id", Value: tid})
 }
 
+// WithReservedIPs filter farms with at least one reserved ip address
+func (f FarmFilter) WithReservedIPs() FarmFilter {
+	return append(f, bson.E{Key: "ipaddresses.reservation_id", Value: bson.M{"$gt": 0}})
+}
+
 // WithIP filter farm ipaddresses by ipaddress (including reservation id)
 func (f FarmFilter) WithIP(ip schema.IPCidr, reservation schema.ID) FarmFilter {
 	return append(f, bson.E{
@@ -25,6 +25,12 @@ const (
 // Gateway model
 type Gateway generated.Gateway
 
+// GatewayInfo is a gateway with its liveness
+type GatewayInfo struct {
+	Gateway
+	Liveness
+}
+
 // Validate node
 func (n *Gateway) Validate() error {
 	if len(n.NodeId) == 0 {
@@ -227,10 +233,11 @@ func GatewayUpdateWorkloadsAmount(ctx context.Context, db *mongo.Database, nodeI
 	return gwUpdate(ctx, db, nodeID, bson.M{"workloads": workloads})
 }
 
-// GatewayUpdateUptime updates node uptime
-func GatewayUpdateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64) error {
+// GatewayUpdateUptime updates the uptime of the gateway reported at now
+func GatewayUpdateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64, now time.Time) error {
 	return gwUpdate(ctx, db, nodeID, bson.M{
-		"uptime":  uptime,
-		"updated": schema.Date{Time: time.Now()},
+		"uptime":      uptime,
+		"updated":     schema.Date{Time: now},
+		"last_report": schema.Date{Time: now},
 	})
 }
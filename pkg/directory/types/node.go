@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/jbenet/go-base58"
@@ -62,6 +63,43 @@ func (n *Node) Validate() error {
 	return nil
 }
 
+// FreeResources returns the resources of the node which are not reserved
+func (n *Node) FreeResources() generated.ResourceAmount {
+	free := generated.ResourceAmount{
+		Mru: math.Max(n.TotalResources.Mru-n.ReservedResources.Mru, 0),
+		Hru: math.Max(n.TotalResources.Hru-n.ReservedResources.Hru, 0),
+		Sru: math.Max(n.TotalResources.Sru-n.ReservedResources.Sru, 0),
+	}
+	if n.TotalResources.Cru > n.ReservedResources.Cru {
+		free.Cru = n.TotalResources.Cru - n.ReservedResources.Cru
+	}
+
+	return free
+}
+
+// NodeInfo is a node with its liveness
+type NodeInfo struct {
+	Node
+	Liveness
+}
+
+// NodeSearchResult is a node found by a search, with its liveness, its free
+// capacity and the prices of its farm
+type NodeSearchResult struct {
+	Node
+	Liveness
+	FreeResources generated.ResourceAmount `json:"free_resources"`
+	// FreePublicIPs is the number of public ips of the farm which are not
+	// reserved
+	FreePublicIPs int `json:"free_public_ips"`
+	// Price is the custom price of the farm, or the explorer price if the
+	// farm has no custom pricing
+	Price generated.NodeCloudUnitPrice `json:"price"`
+	// Distance in km to the searched location, only set when searching
+	// around a location
+	Distance float64 `json:"distance,omitempty"`
+}
+
 // NodeFilter type
 type NodeFilter bson.D
 
@@ -105,6 +143,37 @@ func (f NodeFilter) WithTotalCap(cru, mru, hru, sru int64) NodeFilter {
 	return f
 }
 
+// WithFreeCap filter with free capacity, the total resources minus the
+// reserved resources. Only units that > 0 are used in the query
+func (f NodeFilter) WithFreeCap(cru, mru, hru, sru int64) NodeFilter {
+	var conditions bson.A
+	for _, unit := range []struct {
+		key   string
+		value int64
+	}{{"cru", cru}, {"mru", mru}, {"hru", hru}, {"sru", sru}} {
+		if unit.value <= 0 {
+			continue
+		}
+
+		free := bson.M{"$subtract": bson.A{
+			"$total_resources." + unit.key,
+			bson.M{"$ifNull": bson.A{"$reserved_resources." + unit.key, 0}},
+		}}
+		conditions = append(conditions, bson.M{"$gte": bson.A{free, unit.value}})
+	}
+
+	if len(conditions) == 0 {
+		return f
+	}
+
+	return append(f, bson.E{Key: "$expr", Value: bson.M{"$and": conditions}})
+}
+
+// WithUpdatedSince search the nodes which reported to the explorer since t
+func (f NodeFilter) WithUpdatedSince(t time.Time) NodeFilter {
+	return append(f, bson.E{Key: "updated.time", Value: bson.M{"$gte": t}})
+}
+
 // WithLocation search the nodes that are located in country and or city
 func (f NodeFilter) WithLocation(country, city string) NodeFilter {
 	if country != "" {
@@ -273,11 +342,12 @@ func NodeUpdateWorkloadsAmount(ctx context.Context, db *mongo.Database, nodeID s
 	return nodeUpdate(ctx, db, nodeID, bson.M{"workloads": workloads})
 }
 
-// NodeUpdateUptime updates node uptime
-func NodeUpdateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64) error {
+// NodeUpdateUptime updates the uptime of the node reported at now
+func NodeUpdateUptime(ctx context.Context, db *mongo.Database, nodeID string, uptime int64, now time.Time) error {
 	return nodeUpdate(ctx, db, nodeID, bson.M{
-		"uptime":  uptime,
-		"updated": schema.Date{Time: time.Now()},
+		"uptime":      uptime,
+		"updated":     schema.Date{Time: now},
+		"last_report": schema.Date{Time: now},
 	})
 }
 
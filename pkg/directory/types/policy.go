@@ -0,0 +1,110 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// FarmPolicyCollection db collection name
+	FarmPolicyCollection = "farm_policy"
+
+	// DefaultApprovalTimeout is the time a farmer has to approve a workload
+	// if the farm policy does not set it
+	DefaultApprovalTimeout = 24 * time.Hour
+)
+
+// FarmPolicy decides which workloads deployed on the nodes of a farm must be
+// approved by the farmer first
+type FarmPolicy struct {
+	FarmID          schema.ID `bson:"_id" json:"farm_id"`
+	RequireApproval bool      `bson:"require_approval" json:"require_approval"`
+	// AutoApproveCustomers are the customers whose workloads never need approval
+	AutoApproveCustomers []int64 `bson:"auto_approve_customers" json:"auto_approve_customers"`
+	// AutoApproveTypes are the workload types which never need approval
+	AutoApproveTypes []workloads.WorkloadTypeEnum `bson:"auto_approve_types" json:"auto_approve_types"`
+	// ApprovalTimeout is the number of seconds after which a workload which
+	// is not approved is invalidated, 0 means the default timeout
+	ApprovalTimeout int64 `bson:"approval_timeout" json:"approval_timeout"`
+}
+
+// Validate validates the farm policy
+func (p *FarmPolicy) Validate() error {
+	if p.ApprovalTimeout < 0 {
+		return fmt.Errorf("approval_timeout can not be negative")
+	}
+
+	for _, t := range p.AutoApproveTypes {
+		if _, ok := workloads.WorkloadTypes[t]; !ok {
+			return fmt.Errorf("unknown workload type '%d' in auto_approve_types", t)
+		}
+	}
+
+	return nil
+}
+
+// RequiresApproval checks if a workload of the given customer and type must
+// be approved by the farmer before it is deployed
+func (p *FarmPolicy) RequiresApproval(customerTid int64, workloadType workloads.WorkloadTypeEnum) bool {
+	if !p.RequireApproval {
+		return false
+	}
+
+	for _, tid := range p.AutoApproveCustomers {
+		if tid == customerTid {
+			return false
+		}
+	}
+
+	for _, t := range p.AutoApproveTypes {
+		if t == workloadType {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Timeout returns the time a farmer has to approve a workload
+func (p *FarmPolicy) Timeout() time.Duration {
+	if p.ApprovalTimeout == 0 {
+		return DefaultApprovalTimeout
+	}
+
+	return time.Duration(p.ApprovalTimeout) * time.Second
+}
+
+// FarmPolicyGet gets the policy of a farm, a farm which never set its policy
+// does not require approval
+func FarmPolicyGet(ctx context.Context, db *mongo.Database, farmID schema.ID) (FarmPolicy, error) {
+	policy := FarmPolicy{FarmID: farmID}
+
+	col := db.Collection(FarmPolicyCollection)
+	err := col.FindOne(ctx, bson.M{"_id": farmID}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return policy, nil
+	} else if err != nil {
+		return policy, errors.Wrapf(err, "failed to get policy of farm '%d'", farmID)
+	}
+
+	return policy, nil
+}
+
+// FarmPolicySet creates or replaces the policy of a farm
+func FarmPolicySet(ctx context.Context, db *mongo.Database, policy FarmPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	col := db.Collection(FarmPolicyCollection)
+	_, err := col.ReplaceOne(ctx, bson.M{"_id": policy.FarmID}, policy, options.Replace().SetUpsert(true))
+	return errors.Wrapf(err, "failed to set policy of farm '%d'", policy.FarmID)
+}
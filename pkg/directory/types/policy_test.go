@@ -0,0 +1,39 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+)
+
+func TestFarmPolicyRequiresApproval(t *testing.T) {
+	policy := FarmPolicy{
+		AutoApproveCustomers: []int64{1},
+		AutoApproveTypes:     []workloads.WorkloadTypeEnum{workloads.WorkloadTypeVolume},
+	}
+
+	// approval is opt-in
+	assert.False(t, policy.RequiresApproval(2, workloads.WorkloadTypeContainer))
+
+	policy.RequireApproval = true
+	assert.True(t, policy.RequiresApproval(2, workloads.WorkloadTypeContainer))
+	assert.False(t, policy.RequiresApproval(1, workloads.WorkloadTypeContainer))
+	assert.False(t, policy.RequiresApproval(2, workloads.WorkloadTypeVolume))
+}
+
+func TestFarmPolicyValidate(t *testing.T) {
+	policy := FarmPolicy{RequireApproval: true}
+	assert.NoError(t, policy.Validate())
+	assert.Equal(t, DefaultApprovalTimeout, policy.Timeout())
+
+	policy.ApprovalTimeout = 60
+	assert.Equal(t, time.Minute, policy.Timeout())
+
+	policy.ApprovalTimeout = -1
+	assert.Error(t, policy.Validate())
+
+	policy = FarmPolicy{AutoApproveTypes: []workloads.WorkloadTypeEnum{255}}
+	assert.Error(t, policy.Validate())
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/rs/zerolog/log"
+	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -21,7 +21,7 @@ func Setup(ctx context.Context, db *mongo.Database) error {
 		},
 	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to initialize farm index")
+		return errors.Wrap(err, "failed to initialize farm index")
 	}
 
 	node := db.Collection(NodeCollection)
@@ -34,6 +34,9 @@ func Setup(ctx context.Context, db *mongo.Database) error {
 		{
 			Keys: bson.M{"farm_id": 1},
 		},
+		{
+			Keys: bson.M{"last_report.time": 1},
+		},
 	}
 
 	farmThreebotPrice := db.Collection(FarmThreebotPriceCollection)
@@ -54,16 +57,38 @@ func Setup(ctx context.Context, db *mongo.Database) error {
 		}
 	}
 
-	_, err = node.Indexes().CreateMany(ctx, nodeIdexes)
+	if _, err := node.Indexes().CreateMany(ctx, nodeIdexes); err != nil {
+		return errors.Wrap(err, "failed to initialize node index")
+	}
 
-	if err != nil {
-		log.Error().Err(err).Msg("failed to initialize node index")
+	if _, err := farmThreebotPrice.Indexes().CreateMany(ctx, farmThreebotPriceIndexes); err != nil {
+		return errors.Wrap(err, "failed to initialize farm threebot price index")
 	}
 
-	_, err = farmThreebotPrice.Indexes().CreateMany(ctx, farmThreebotPriceIndexes)
+	ownership := db.Collection(DomainOwnershipCollection)
+	_, err = ownership.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_tid", Value: 1}, {Key: "domain", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize domain ownership index")
+	}
 
+	uptime := db.Collection(UptimeReportCollection)
+	_, err = uptime.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "node_id", Value: 1}, {Key: "timestamp.time", Value: 1}},
+		},
+		{
+			Keys:    bson.M{"timestamp.time": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(uptimeReportRetention.Seconds())),
+		},
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to initialize node index")
+		return errors.Wrap(err, "failed to initialize uptime report index")
 	}
-	return err
+
+	return nil
 }
@@ -0,0 +1,618 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// UptimeReportCollection db collection name
+	UptimeReportCollection = "uptime_report"
+
+	// ReportInterval is the interval between two uptime reports of a node
+	ReportInterval = 10 * time.Minute
+
+	// uptimeReportRetention is how long the uptime reports are kept, a bit
+	// more than a year so the sla of the last year can still be computed
+	uptimeReportRetention = 400 * 24 * time.Hour
+
+	// upTimeout is the time after which a node without reports is not up
+	// anymore, it leaves room for one late report
+	upTimeout = 2 * ReportInterval
+	// standbyTimeout is the time after which a node without reports is down,
+	// until then the node is most probably rebooting or upgrading
+	standbyTimeout = time.Hour
+)
+
+// NodeStatus is the liveness status of a node or a gateway
+type NodeStatus string
+
+const (
+	// NodeStatusUp the node reports its uptime on time
+	NodeStatusUp NodeStatus = "up"
+	// NodeStatusStandby the node missed its last reports
+	NodeStatusStandby NodeStatus = "standby"
+	// NodeStatusDown the node did not report for more than an hour
+	NodeStatusDown NodeStatus = "down"
+)
+
+// ParseNodeStatus parses a node status
+func ParseNodeStatus(s string) (NodeStatus, error) {
+	status := NodeStatus(s)
+	switch status {
+	case NodeStatusUp, NodeStatusStandby, NodeStatusDown:
+		return status, nil
+	}
+
+	return "", fmt.Errorf("unknown node status '%s'", s)
+}
+
+// NodeStatusAt returns the status at now of a node which last reported its
+// uptime at last
+func NodeStatusAt(last, now time.Time) NodeStatus {
+	since := now.Sub(last)
+	switch {
+	case since <= upTimeout:
+		return NodeStatusUp
+	case since <= standbyTimeout:
+		return NodeStatusStandby
+	default:
+		return NodeStatusDown
+	}
+}
+
+// statusFilter returns the filter on the last uptime report of the nodes in
+// status
+func statusFilter(status NodeStatus, now time.Time) bson.E {
+	const key = "last_report.time"
+	switch status {
+	case NodeStatusUp:
+		return bson.E{Key: key, Value: bson.M{"$gte": now.Add(-upTimeout)}}
+	case NodeStatusStandby:
+		return bson.E{Key: key, Value: bson.M{"$lt": now.Add(-upTimeout), "$gte": now.Add(-standbyTimeout)}}
+	default:
+		// nodes that never reported are down too
+		return bson.E{Key: key, Value: bson.M{"$not": bson.M{"$gte": now.Add(-standbyTimeout)}}}
+	}
+}
+
+// WithStatus filter nodes with status at now
+func (f NodeFilter) WithStatus(status NodeStatus, now time.Time) NodeFilter {
+	return append(f, statusFilter(status, now))
+}
+
+// WithStatus filter gateways with status at now
+func (f GatewayFilter) WithStatus(status NodeStatus, now time.Time) GatewayFilter {
+	return append(f, statusFilter(status, now))
+}
+
+// UptimePercentage is the percentage of time a node was up over the last
+// day, week and month
+type UptimePercentage struct {
+	Day   float64 `json:"24h"`
+	Week  float64 `json:"7d"`
+	Month float64 `json:"30d"`
+}
+
+// Liveness of a node or a gateway
+type Liveness struct {
+	Status           NodeStatus       `json:"status"`
+	UptimePercentage UptimePercentage `json:"uptime_percentage"`
+}
+
+// UptimeReport is a single uptime report of a node or a gateway
+type UptimeReport struct {
+	NodeID    string      `bson:"node_id" json:"node_id"`
+	Timestamp schema.Date `bson:"timestamp" json:"timestamp"`
+	// Uptime is the uptime reported by the node in seconds
+	Uptime int64 `bson:"uptime" json:"uptime"`
+	// Up is the number of seconds the node was up since the previous report
+	Up int64 `bson:"up" json:"up"`
+	// Reboot is set if the node rebooted since the previous report
+	Reboot bool `bson:"reboot" json:"reboot"`
+	// Missed is the number of reports missed since the previous report
+	Missed int64 `bson:"missed" json:"missed"`
+	// First is set on the first report of the node
+	First bool `bson:"first" json:"first"`
+}
+
+// Start returns the start of the period covered by the report
+func (r *UptimeReport) Start() time.Time {
+	return r.Timestamp.Add(-time.Duration(r.Up) * time.Second)
+}
+
+// NewUptimeReport creates the report of uptime received at now, following the
+// previous report of the node if any
+func NewUptimeReport(nodeID string, uptime int64, now time.Time, previous *UptimeReport) UptimeReport {
+	report := UptimeReport{
+		NodeID:    nodeID,
+		Timestamp: schema.Date{Time: now},
+		Uptime:    uptime,
+		Up:        uptime,
+	}
+
+	if previous == nil {
+		report.First = true
+		return report
+	}
+
+	gap := now.Sub(previous.Timestamp.Time)
+	if gap < 0 {
+		gap = 0
+	}
+	// the node can't be up longer than the time since its previous report
+	if seconds := int64(gap.Seconds()); report.Up > seconds {
+		report.Up = seconds
+	}
+
+	report.Reboot = uptime < previous.Uptime
+	if missed := int64(math.Round(float64(gap)/float64(ReportInterval))) - 1; missed > 0 {
+		report.Missed = missed
+	}
+
+	return report
+}
+
+// UptimeReportFilter type
+type UptimeReportFilter bson.D
+
+// WithNodeID filter reports of the node with id
+func (f UptimeReportFilter) WithNodeID(id string) UptimeReportFilter {
+	return append(f, bson.E{Key: "node_id", Value: id})
+}
+
+// WithNodeIDs filter reports of the nodes in ids
+func (f UptimeReportFilter) WithNodeIDs(ids []string) UptimeReportFilter {
+	return append(f, bson.E{Key: "node_id", Value: bson.M{"$in": ids}})
+}
+
+// WithRange filter reports received between from and to, zero times are
+// ignored
+func (f UptimeReportFilter) WithRange(from, to time.Time) UptimeReportFilter {
+	query := bson.M{}
+	if !from.IsZero() {
+		query["$gte"] = from
+	}
+	if !to.IsZero() {
+		query["$lte"] = to
+	}
+	if len(query) == 0 {
+		return f
+	}
+
+	return append(f, bson.E{Key: "timestamp.time", Value: query})
+}
+
+// Find run the filter and return a cursor result
+func (f UptimeReportFilter) Find(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	col := db.Collection(UptimeReportCollection)
+	if f == nil {
+		f = UptimeReportFilter{}
+	}
+
+	return col.Find(ctx, f, opts...)
+}
+
+// Count number of documents matching
+func (f UptimeReportFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	col := db.Collection(UptimeReportCollection)
+	if f == nil {
+		f = UptimeReportFilter{}
+	}
+
+	return col.CountDocuments(ctx, f)
+}
+
+// NodeIDs returns the ids of the nodes with reports matching the filter
+func (f UptimeReportFilter) NodeIDs(ctx context.Context, db *mongo.Database) ([]string, error) {
+	if f == nil {
+		f = UptimeReportFilter{}
+	}
+
+	values, err := db.Collection(UptimeReportCollection).Distinct(ctx, "node_id", f)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Last returns the last report matching the filter
+func (f UptimeReportFilter) Last(ctx context.Context, db *mongo.Database) (report UptimeReport, err error) {
+	if f == nil {
+		f = UptimeReportFilter{}
+	}
+
+	col := db.Collection(UptimeReportCollection)
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp.time", Value: -1}})
+	result := col.FindOne(ctx, f, opts)
+	if err = result.Err(); err != nil {
+		return
+	}
+
+	err = result.Decode(&report)
+	return
+}
+
+// UptimeReportCreate stores the uptime reported at now by a node of the
+// collection, nodes or gateways, and updates the uptime counters of the node
+func UptimeReportCreate(ctx context.Context, db *mongo.Database, collection, nodeID string, uptime int64, now time.Time) (UptimeReport, error) {
+	var previous *UptimeReport
+	last, err := UptimeReportFilter{}.WithNodeID(nodeID).Last(ctx, db)
+	if err == nil {
+		previous = &last
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return UptimeReport{}, errors.Wrap(err, "failed to load the last uptime report")
+	}
+
+	counters, err := uptimeCounters(ctx, db, collection, nodeID, now)
+	if err != nil {
+		return UptimeReport{}, err
+	}
+
+	report := NewUptimeReport(nodeID, uptime, now, previous)
+	if _, err := db.Collection(UptimeReportCollection).InsertOne(ctx, report); err != nil {
+		return report, errors.Wrap(err, "failed to store uptime report")
+	}
+
+	counters.Add(report)
+
+	_, err = db.Collection(collection).UpdateOne(ctx, bson.M{"node_id": nodeID}, bson.M{
+		"$set": bson.M{uptimeCountersKey: counters},
+	})
+	if err != nil {
+		return report, errors.Wrap(err, "failed to update uptime counters")
+	}
+
+	return report, nil
+}
+
+// uptimeCounters loads the uptime counters of a node at now. The counters of
+// a node which has none yet are computed once from its reports of the last
+// month.
+func uptimeCounters(ctx context.Context, db *mongo.Database, collection, nodeID string, now time.Time) (UptimeCounters, error) {
+	var node nodeUptimeCounters
+	opts := options.FindOne().SetProjection(bson.M{"node_id": 1, uptimeCountersKey: 1})
+	err := db.Collection(collection).FindOne(ctx, bson.M{"node_id": nodeID}, opts).Decode(&node)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return UptimeCounters{}, errors.Wrap(err, "failed to load uptime counters")
+	}
+	if node.Counters != nil {
+		return *node.Counters, nil
+	}
+
+	var counters UptimeCounters
+	filter := UptimeReportFilter{}.WithNodeID(nodeID).WithRange(now.Add(-dayRetention), time.Time{})
+	cur, err := filter.Find(ctx, db, options.Find().SetSort(bson.D{{Key: "timestamp.time", Value: 1}}))
+	if err != nil {
+		return counters, errors.Wrap(err, "failed to list uptime reports")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var report UptimeReport
+		if err := cur.Decode(&report); err != nil {
+			return counters, errors.Wrap(err, "failed to load uptime report")
+		}
+		counters.Add(report)
+	}
+
+	return counters, cur.Err()
+}
+
+const (
+	// uptimeCountersKey is the field of the uptime counters on the nodes and
+	// the gateways
+	uptimeCountersKey = "uptime_counters"
+
+	// hourRetention and dayRetention are how long the hourly and daily
+	// counters are kept, one bucket more than the longest window they serve
+	hourRetention = 25 * time.Hour
+	dayRetention  = 31 * 24 * time.Hour
+)
+
+// UptimeBucket is the number of seconds a node was up in the hour or the day
+// starting at Start
+type UptimeBucket struct {
+	Start time.Time `bson:"start"`
+	Up    float64   `bson:"up"`
+}
+
+// UptimeCounters are the rolling uptime counters of a node. The up time is
+// counted per hour over the last day and per day over the last month, so the
+// liveness of a node is computed without going through its reports.
+type UptimeCounters struct {
+	Last time.Time `bson:"last"`
+	// Since is the boot time of the first report of the node
+	Since *time.Time     `bson:"since,omitempty"`
+	Hours []UptimeBucket `bson:"hours"`
+	Days  []UptimeBucket `bson:"days"`
+}
+
+type nodeUptimeCounters struct {
+	NodeID   string          `bson:"node_id"`
+	Counters *UptimeCounters `bson:"uptime_counters"`
+}
+
+// addUp adds the seconds of window to the buckets of length size, and drops
+// the buckets older than retention at the end of the window
+func addUp(buckets []UptimeBucket, window TimeWindow, size, retention time.Duration) []UptimeBucket {
+	oldest := window.End.Add(-retention).Truncate(size)
+	if window.Start.Before(oldest) {
+		window.Start = oldest
+	}
+
+	for start := window.Start.Truncate(size); start.Before(window.End); start = start.Add(size) {
+		from, to := start, start.Add(size)
+		if window.Start.After(from) {
+			from = window.Start
+		}
+		if window.End.Before(to) {
+			to = window.End
+		}
+
+		// the reports are added in order, so the bucket is the last one or a
+		// new one
+		if n := len(buckets); n == 0 || buckets[n-1].Start.Before(start) {
+			buckets = append(buckets, UptimeBucket{Start: start})
+		}
+		for i := len(buckets) - 1; i >= 0; i-- {
+			if buckets[i].Start.Equal(start) {
+				buckets[i].Up += to.Sub(from).Seconds()
+				break
+			}
+		}
+	}
+
+	for len(buckets) > 0 && buckets[0].Start.Before(oldest) {
+		buckets = buckets[1:]
+	}
+
+	return buckets
+}
+
+// Add counts the up time of the report
+func (c *UptimeCounters) Add(report UptimeReport) {
+	if report.First && c.Since == nil {
+		since := report.Start()
+		c.Since = &since
+	}
+	if report.Timestamp.After(c.Last) {
+		c.Last = report.Timestamp.Time
+	}
+
+	window := TimeWindow{Start: report.Start(), End: report.Timestamp.Time}
+	c.Hours = addUp(c.Hours, window, time.Hour, hourRetention)
+	c.Days = addUp(c.Days, window, 24*time.Hour, dayRetention)
+}
+
+// percentage returns the percentage of time the node was up since start in
+// the buckets. The window starts at the start of its first bucket, or when the
+// node was first seen if it's more recent, and ends at the last report if the
+// node is up.
+func (c *UptimeCounters) percentage(buckets []UptimeBucket, size time.Duration, start, now time.Time) float64 {
+	start = start.Truncate(size)
+	var up float64
+	for _, bucket := range buckets {
+		if !bucket.Start.Before(start) {
+			up += bucket.Up
+		}
+	}
+
+	if c.Since != nil && c.Since.After(start) {
+		start = *c.Since
+	}
+
+	end := now
+	if now.Sub(c.Last) <= upTimeout {
+		end = c.Last
+	}
+
+	period := end.Sub(start).Seconds()
+	if period <= 0 {
+		return 0
+	}
+
+	return math.Max(0, math.Min(100, up/period*100))
+}
+
+// Liveness returns the liveness of the node at now. Nodes without reports in
+// the last month are down.
+func (c *UptimeCounters) Liveness(now time.Time) Liveness {
+	const day = 24 * time.Hour
+	if now.Sub(c.Last) > 30*day {
+		return Liveness{Status: NodeStatusDown}
+	}
+
+	return Liveness{
+		Status: NodeStatusAt(c.Last, now),
+		UptimePercentage: UptimePercentage{
+			Day:   c.percentage(c.Hours, time.Hour, now.Add(-day), now),
+			Week:  c.percentage(c.Days, day, now.Add(-7*day), now),
+			Month: c.percentage(c.Days, day, now.Add(-30*day), now),
+		},
+	}
+}
+
+// NodeLiveness computes the liveness at now of the nodes of the collection,
+// nodes or gateways, with ids from their uptime counters
+func NodeLiveness(ctx context.Context, db *mongo.Database, collection string, now time.Time, ids ...string) (map[string]Liveness, error) {
+	liveness := make(map[string]Liveness, len(ids))
+	for _, id := range ids {
+		liveness[id] = Liveness{Status: NodeStatusDown}
+	}
+	if len(ids) == 0 {
+		return liveness, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"node_id": 1, uptimeCountersKey: 1})
+	cur, err := db.Collection(collection).Find(ctx, bson.M{"node_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list uptime counters")
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var node nodeUptimeCounters
+		if err := cur.Decode(&node); err != nil {
+			return nil, errors.Wrap(err, "failed to load uptime counters")
+		}
+		if node.Counters != nil {
+			liveness[node.NodeID] = node.Counters.Liveness(now)
+		}
+	}
+
+	return liveness, cur.Err()
+}
+
+// TimeWindow is a period of time
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration of the window
+func (w TimeWindow) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+// Availability of a node over a period
+type Availability struct {
+	// Tracked is the part of the period the node was tracked by the explorer
+	Tracked time.Duration
+	Up      time.Duration
+	Reboots int
+	// Downtime are the windows of the tracked period the node was not up
+	Downtime []TimeWindow
+}
+
+// Percentage returns the percentage of the tracked period the node was up
+func (a *Availability) Percentage() float64 {
+	if a.Tracked <= 0 {
+		return 0
+	}
+
+	return math.Min(100, float64(a.Up)/float64(a.Tracked)*100)
+}
+
+// AvailabilityTracker computes the availability of a node over a period one
+// report at a time, so the reports of a long period never have to be loaded
+// at once
+type AvailabilityTracker struct {
+	tracked  bool
+	from, to time.Time
+
+	started bool
+	begin   time.Time
+	cursor  time.Time
+	last    time.Time
+
+	availability Availability
+}
+
+// NewAvailabilityTracker creates a tracker of the availability of a node
+// between from and to. If the node was not tracked before from, the period
+// starts when the node booted before its first report.
+func NewAvailabilityTracker(tracked bool, from, to time.Time) *AvailabilityTracker {
+	return &AvailabilityTracker{tracked: tracked, from: from, to: to}
+}
+
+// start must be called before the first report is covered
+func (t *AvailabilityTracker) start(first *UptimeReport) {
+	t.started = true
+	t.begin = t.from
+	if first != nil && !t.tracked {
+		if start := first.Start(); start.After(t.begin) {
+			t.begin = start
+		}
+	}
+	t.cursor = t.begin
+}
+
+// cover marks the part of the window inside the period as up, the time
+// between the previous covered window and this one is down
+func (t *AvailabilityTracker) cover(window TimeWindow) {
+	if window.End.After(t.to) {
+		window.End = t.to
+	}
+	if !window.End.After(t.begin) {
+		return
+	}
+
+	if window.Start.After(t.cursor) {
+		t.availability.Downtime = append(t.availability.Downtime, TimeWindow{Start: t.cursor, End: window.Start})
+		t.cursor = window.Start
+	}
+	if window.End.After(t.cursor) {
+		t.availability.Up += window.End.Sub(t.cursor)
+		t.cursor = window.End
+	}
+}
+
+// Add adds the next report of the node. The reports must be added sorted by
+// timestamp, and the reports received up to two report intervals after the
+// end of the period must be added too since they cover its end.
+func (t *AvailabilityTracker) Add(report UptimeReport) {
+	if !t.started {
+		t.start(&report)
+	}
+
+	if report.Reboot && !report.Timestamp.Before(t.begin) && !report.Timestamp.After(t.to) {
+		t.availability.Reboots++
+	}
+	t.cover(TimeWindow{Start: report.Start(), End: report.Timestamp.Time})
+	t.last = report.Timestamp.Time
+}
+
+// Availability returns the availability at now of the node once all its
+// reports are added
+func (t *AvailabilityTracker) Availability(now time.Time) Availability {
+	if !t.started {
+		if !t.tracked {
+			return Availability{}
+		}
+		t.start(nil)
+	}
+	if !t.to.After(t.begin) {
+		return Availability{}
+	}
+
+	// the next report of a node which is up is not due yet
+	result := *t
+	result.availability.Downtime = append([]TimeWindow(nil), t.availability.Downtime...)
+	if !t.last.IsZero() && now.Sub(t.last) <= upTimeout {
+		result.cover(TimeWindow{Start: t.last, End: t.to})
+	}
+	if t.to.After(result.cursor) {
+		result.availability.Downtime = append(result.availability.Downtime, TimeWindow{Start: result.cursor, End: t.to})
+	}
+
+	result.availability.Tracked = t.to.Sub(t.begin)
+	return result.availability
+}
+
+// NodeAvailability computes the availability at now of a node between from
+// and to from its reports sorted by timestamp, see AvailabilityTracker
+func NodeAvailability(reports []UptimeReport, tracked bool, from, to, now time.Time) Availability {
+	tracker := NewAvailabilityTracker(tracked, from, to)
+	for _, report := range reports {
+		tracker.Add(report)
+	}
+
+	return tracker.Availability(now)
+}
@@ -0,0 +1,253 @@
+package types
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNewUptimeReport(t *testing.T) {
+	now := time.Unix(1000000, 0)
+
+	first := NewUptimeReport("node", 3600, now, nil)
+	assert.True(t, first.First)
+	assert.Equal(t, int64(3600), first.Up)
+	assert.Equal(t, now.Add(-time.Hour), first.Start())
+
+	// on time report
+	next := NewUptimeReport("node", 4200, now.Add(ReportInterval), &first)
+	assert.False(t, next.First)
+	assert.False(t, next.Reboot)
+	assert.Equal(t, int64(600), next.Up)
+	assert.Zero(t, next.Missed)
+
+	// two reports missed
+	late := NewUptimeReport("node", 6000, now.Add(40*time.Minute), &next)
+	assert.False(t, late.Reboot)
+	assert.Equal(t, int64(1800), late.Up)
+	assert.Equal(t, int64(2), late.Missed)
+
+	// rebooted, only the uptime since the boot is up
+	reboot := NewUptimeReport("node", 120, now.Add(time.Hour), &late)
+	assert.True(t, reboot.Reboot)
+	assert.Equal(t, int64(120), reboot.Up)
+	assert.Equal(t, int64(1), reboot.Missed)
+}
+
+func TestNodeStatus(t *testing.T) {
+	now := time.Unix(1000000, 0)
+
+	assert.Equal(t, NodeStatusUp, NodeStatusAt(now.Add(-5*time.Minute), now))
+	assert.Equal(t, NodeStatusUp, NodeStatusAt(now.Add(-20*time.Minute), now))
+	assert.Equal(t, NodeStatusStandby, NodeStatusAt(now.Add(-30*time.Minute), now))
+	assert.Equal(t, NodeStatusDown, NodeStatusAt(now.Add(-2*time.Hour), now))
+	assert.Equal(t, NodeStatusDown, NodeStatusAt(time.Time{}, now))
+
+	status, err := ParseNodeStatus("standby")
+	require.NoError(t, err)
+	assert.Equal(t, NodeStatusStandby, status)
+	_, err = ParseNodeStatus("sleeping")
+	assert.Error(t, err)
+
+	assert.Equal(t, NodeFilter{
+		{Key: "last_report.time", Value: bson.M{"$lt": now.Add(-20 * time.Minute), "$gte": now.Add(-time.Hour)}},
+	}, NodeFilter{}.WithStatus(NodeStatusStandby, now))
+}
+
+func TestNodeLiveness(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("uptime counters", func(mt *mtest.T) {
+		now := time.Unix(10000000, 0).UTC()
+		hour := now.Truncate(time.Hour)
+		ns := mt.DB.Name() + "." + NodeCollection
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			bson.D{
+				{Key: "node_id", Value: "up"},
+				{Key: uptimeCountersKey, Value: bson.D{
+					{Key: "last", Value: now.Add(-5 * time.Minute)},
+					{Key: "hours", Value: bson.A{bson.D{{Key: "start", Value: hour}, {Key: "up", Value: now.Add(-5 * time.Minute).Sub(hour).Seconds()}}}},
+				}},
+			},
+			// not reported since the counters exist
+			bson.D{{Key: "node_id", Value: "old"}},
+		))
+
+		liveness, err := NodeLiveness(context.Background(), mt.DB, NodeCollection, now, "up", "old", "silent")
+		require.NoError(mt, err)
+		assert.Equal(mt, NodeStatusUp, liveness["up"].Status)
+		assert.Greater(mt, liveness["up"].UptimePercentage.Day, 0.0)
+		assert.Equal(mt, Liveness{Status: NodeStatusDown}, liveness["old"])
+		assert.Equal(mt, Liveness{Status: NodeStatusDown}, liveness["silent"])
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "find", started.CommandName)
+		assert.Equal(mt, NodeCollection, started.Command.Lookup("find").StringValue())
+	})
+}
+
+func TestUptimeCounters(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Unix(100*86400, 0).UTC()
+
+	// booted 2 days ago for the first time and reported every 10 minutes
+	var counters UptimeCounters
+	since := now.Add(-2 * day)
+	var previous *UptimeReport
+	for at := since.Add(ReportInterval); !at.After(now); at = at.Add(ReportInterval) {
+		report := NewUptimeReport("node", int64(at.Sub(since).Seconds()), at, previous)
+		counters.Add(report)
+		previous = &report
+	}
+	require.NotNil(t, counters.Since)
+	assert.Equal(t, since, *counters.Since)
+	assert.Len(t, counters.Hours, 25)
+	assert.Len(t, counters.Days, 2)
+	assert.Equal(t, Liveness{
+		Status:           NodeStatusUp,
+		UptimePercentage: UptimePercentage{Day: 100, Week: 100, Month: 100},
+	}, counters.Liveness(now))
+
+	// down for the last 12 hours
+	later := now.Add(12 * time.Hour)
+	liveness := counters.Liveness(later)
+	assert.Equal(t, NodeStatusDown, liveness.Status)
+	assert.InDelta(t, 50.0, liveness.UptimePercentage.Day, 0.01)
+	assert.InDelta(t, 80.0, liveness.UptimePercentage.Week, 0.01)
+
+	// the old buckets are dropped
+	report := NewUptimeReport("node", 60, later.Add(40*day), previous)
+	counters.Add(report)
+	assert.Len(t, counters.Hours, 1)
+	assert.Len(t, counters.Days, 1)
+
+	// nodes without reports in the last month are down
+	assert.Equal(t, Liveness{Status: NodeStatusDown}, counters.Liveness(later.Add(80*day)))
+}
+
+func TestNodeAvailability(t *testing.T) {
+	from := time.Unix(1000000, 0)
+	to := from.Add(2 * time.Hour)
+	now := to.Add(time.Hour)
+
+	at := func(offset time.Duration, up time.Duration) UptimeReport {
+		return UptimeReport{Timestamp: schema.Date{Time: from.Add(offset)}, Up: int64(up.Seconds())}
+	}
+
+	// reports every 10 minutes for the first hour, then down for 30
+	// minutes and rebooted
+	var reports []UptimeReport
+	for offset := 10 * time.Minute; offset <= time.Hour; offset += ReportInterval {
+		reports = append(reports, at(offset, ReportInterval))
+	}
+	reboot := at(100*time.Minute, 10*time.Minute)
+	reboot.Reboot = true
+	reports = append(reports, reboot)
+	for offset := 110 * time.Minute; offset <= 130*time.Minute; offset += ReportInterval {
+		reports = append(reports, at(offset, ReportInterval))
+	}
+
+	availability := NodeAvailability(reports, true, from, to, now)
+	assert.Equal(t, 2*time.Hour, availability.Tracked)
+	assert.Equal(t, 90*time.Minute, availability.Up)
+	assert.Equal(t, 75.0, availability.Percentage())
+	assert.Equal(t, 1, availability.Reboots)
+	assert.Equal(t, []TimeWindow{{Start: from.Add(time.Hour), End: from.Add(90 * time.Minute)}}, availability.Downtime)
+
+	// first seen during the period, booted 30 minutes before its first
+	// report, and still up at the end of the period
+	first := at(time.Hour, 30*time.Minute)
+	first.First = true
+	end := from.Add(75 * time.Minute)
+	availability = NodeAvailability([]UptimeReport{first, at(70*time.Minute, ReportInterval)}, false, from, end, end)
+	assert.Equal(t, 45*time.Minute, availability.Tracked)
+	assert.Equal(t, 45*time.Minute, availability.Up)
+	assert.Equal(t, 100.0, availability.Percentage())
+	assert.Empty(t, availability.Downtime)
+
+	// not tracked at all
+	availability = NodeAvailability(nil, false, from, to, now)
+	assert.Zero(t, availability.Tracked)
+	assert.Zero(t, availability.Percentage())
+
+	// tracked but never reported during the period
+	availability = NodeAvailability(nil, true, from, to, now)
+	assert.Zero(t, availability.Up)
+	assert.Equal(t, []TimeWindow{{Start: from, End: to}}, availability.Downtime)
+}
+
+func TestAvailabilityTracker(t *testing.T) {
+	from := time.Unix(1000000, 0)
+	to := from.Add(time.Hour)
+
+	tracker := NewAvailabilityTracker(true, from, to)
+	for offset := 10 * time.Minute; offset <= 30*time.Minute; offset += ReportInterval {
+		tracker.Add(UptimeReport{Timestamp: schema.Date{Time: from.Add(offset)}, Up: int64(ReportInterval.Seconds())})
+	}
+
+	// the node is still up at now, so the rest of the period is up
+	now := from.Add(35 * time.Minute)
+	up := tracker.Availability(now)
+	assert.Equal(t, time.Hour, up.Up)
+	assert.Empty(t, up.Downtime)
+
+	// computing the availability doesn't change the tracker
+	down := tracker.Availability(to.Add(time.Hour))
+	assert.Equal(t, 30*time.Minute, down.Up)
+	assert.Equal(t, []TimeWindow{{Start: from.Add(30 * time.Minute), End: to}}, down.Downtime)
+}
+
+func TestUptimeReportCreate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("counters computed from the reports", func(mt *mtest.T) {
+		now := time.Unix(10000000, 0).UTC()
+		previous := NewUptimeReport("node", 3600, now.Add(-ReportInterval), nil)
+		doc, err := bson.Marshal(previous)
+		require.NoError(mt, err)
+		var report bson.D
+		require.NoError(mt, bson.Unmarshal(doc, &report))
+
+		reports := mt.DB.Name() + "." + UptimeReportCollection
+		nodes := mt.DB.Name() + "." + NodeCollection
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, reports, mtest.FirstBatch, report),
+			// the node has no counters yet
+			mtest.CreateCursorResponse(0, nodes, mtest.FirstBatch, bson.D{{Key: "node_id", Value: "node"}}),
+			mtest.CreateCursorResponse(0, reports, mtest.FirstBatch, report),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		_, err = UptimeReportCreate(context.Background(), mt.DB, NodeCollection, "node", 4200, now)
+		require.NoError(mt, err)
+
+		var update *event.CommandStartedEvent
+		for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+			update = started
+		}
+		require.Equal(mt, "update", update.CommandName)
+
+		var counters UptimeCounters
+		value := update.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set", uptimeCountersKey)
+		require.NoError(mt, value.Unmarshal(&counters))
+		assert.Equal(mt, now, counters.Last)
+		assert.Equal(mt, now.Add(-ReportInterval-time.Hour), *counters.Since)
+		// the reported hour and ten minutes are counted once
+		var up float64
+		for _, bucket := range counters.Hours {
+			up += bucket.Up
+		}
+		assert.Equal(mt, (time.Hour + ReportInterval).Seconds(), up)
+	})
+}
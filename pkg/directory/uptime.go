@@ -0,0 +1,89 @@
+package directory
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/mw"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// parseStatus parses the status query of a list or a search
+func parseStatus(r *http.Request) (directory.NodeStatus, mw.Response) {
+	s := r.URL.Query().Get("status")
+	if s == "" {
+		return "", nil
+	}
+
+	status, err := directory.ParseNodeStatus(s)
+	if err != nil {
+		return "", mw.BadRequest(err)
+	}
+
+	return status, nil
+}
+
+// uptimeQuery is the period of an uptime history, as unix timestamps
+type uptimeQuery struct {
+	From time.Time
+	To   time.Time
+}
+
+func (q *uptimeQuery) Parse(r *http.Request) mw.Response {
+	for name, value := range map[string]*time.Time{
+		"from": &q.From,
+		"to":   &q.To,
+	} {
+		ts, err := models.QueryInt(r, name)
+		if err != nil {
+			return mw.BadRequest(errors.Wrapf(err, "invalid %s", name))
+		}
+		if ts > 0 {
+			*value = time.Unix(ts, 0)
+		}
+	}
+
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return mw.BadRequest(fmt.Errorf("to can't be before from"))
+	}
+
+	return nil
+}
+
+// listUptimeReports lists the uptime reports of a node or a gateway, oldest
+// first
+func listUptimeReports(r *http.Request) (interface{}, mw.Response) {
+	var q uptimeQuery
+	if err := q.Parse(r); err != nil {
+		return nil, err
+	}
+
+	db := mw.Database(r)
+	filter := directory.UptimeReportFilter{}.WithNodeID(mux.Vars(r)["node_id"]).WithRange(q.From, q.To)
+
+	pager := models.PageFromRequest(r)
+	total, err := filter.Count(r.Context(), db)
+	if err != nil {
+		return nil, mw.Error(errors.Wrap(err, "failed to count uptime reports"))
+	}
+
+	cur, err := filter.Find(r.Context(), db, pager, options.Find().SetSort(bson.D{{Key: "timestamp.time", Value: 1}}))
+	if err != nil {
+		return nil, mw.Error(errors.Wrap(err, "failed to list uptime reports"))
+	}
+	defer cur.Close(r.Context())
+
+	reports := []directory.UptimeReport{}
+	if err := cur.All(r.Context(), &reports); err != nil {
+		return nil, mw.Error(errors.Wrap(err, "failed to load uptime reports"))
+	}
+
+	pages := fmt.Sprintf("%d", models.NrPages(total, *pager.Limit))
+	return reports, mw.Ok().WithHeader("Pages", pages).WithHeader("X-Total-Count", fmt.Sprint(total))
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stellar/go/xdr"
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/stellar"
 )
 
 type (
@@ -29,10 +30,10 @@ type (
 )
 
 // Price for 1 CU or SU for 1 month is 10$
-// TFT price is fixed at 0.05
+// TFT price is fixed at 0.1
 // CU and SU price per second is
-// CU -> (10 / 0.15) / (3600 *24*30) = 257.2
-// SU -> (8 / 0.15) / (3600 *24*30) = 257.2
+// CU -> (10 / 0.1) / (3600 *24*30) = 385.8
+// SU -> (8 / 0.1) / (3600 *24*30) = 308.6
 const (
 	// CuPriceDollarMonth CU price per month in dollar
 	CuPriceDollarMonth = 10
@@ -42,13 +43,7 @@ const (
 	IP4uPriceDollarMonth = 6
 
 	// TftPriceMill tft price in millies
-	TftPriceMill = 100 // 0.01 * 1000 (1mill = 1/1000 of a dollar)
-
-	// express as stropes, to simplify things a bit
-	// TODO: check if the rounding errors here matter
-	computeUnitSecondTFTStropesCost = (CuPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30)
-	storageUnitSecondTFTStropesCost = (SuPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30)
-	ipv4UnitSecondTFTStropesCost    = (IP4uPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30)
+	TftPriceMill = stellar.TFTMainnetUSDRate * 1000 // 0.1 * 1000 (1mill = 1/1000 of a dollar)
 )
 
 const (
@@ -75,32 +70,39 @@ func getDiscount(d time.Duration) float64 {
 
 }
 
-func getComputeUnitSecondTFTStropesCost(cuPriceDollarMonth float64) int64 {
-	return int64((cuPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30))
+// express as stropes, to simplify things a bit
+// TODO: check if the rounding errors here matter
+func getComputeUnitSecondStropesCost(cuPriceDollarMonth, assetPriceMill float64) int64 {
+	return int64((cuPriceDollarMonth * 10_000_000_000 / assetPriceMill) / (3600 * 24 * 30))
 }
 
-func getStorageUnitSecondTFTStropesCost(suPriceDollarMonth float64) int64 {
-	return int64((suPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30))
+func getStorageUnitSecondStropesCost(suPriceDollarMonth, assetPriceMill float64) int64 {
+	return int64((suPriceDollarMonth * 10_000_000_000 / assetPriceMill) / (3600 * 24 * 30))
 }
 
-func getIPv4UnitSecondTFTStropesCost(ip4uPriceDollarMonth float64) int64 {
-	return int64((ip4uPriceDollarMonth * 10_000_000_000 / TftPriceMill) / (3600 * 24 * 30))
+func getIPv4UnitSecondStropesCost(ip4uPriceDollarMonth, assetPriceMill float64) int64 {
+	return int64((ip4uPriceDollarMonth * 10_000_000_000 / assetPriceMill) / (3600 * 24 * 30))
 }
 
-// calculateCapacityReservationCost calculates the cost of a capacity reservation
-func (e Stellar) calculateCustomCapacityReservationCost(CUs, SUs, IPv4Us uint64, cuDollarPerMonth, suDollarPerMonth, ip4uDollarPerMonth float64) (xdr.Int64, error) {
+// calculateCustomCapacityReservationCost calculates the cost of a capacity reservation
+// with custom cloud unit prices, in an asset with the given price
+func (e Stellar) calculateCustomCapacityReservationCost(CUs, SUs, IPv4Us uint64, cuDollarPerMonth, suDollarPerMonth, ip4uDollarPerMonth, assetPriceMill float64) (xdr.Int64, error) {
+	if assetPriceMill <= 0 {
+		return 0, errors.New("asset price must be positive")
+	}
+
 	total := big.NewInt(0)
 	cuCost := big.NewInt(0)
 	suCost := big.NewInt(0)
 	ipuCost := big.NewInt(0)
 
-	cuSecondTFTStropesCost := getComputeUnitSecondTFTStropesCost(cuDollarPerMonth)
-	suSecondTFTStropesCost := getStorageUnitSecondTFTStropesCost(suDollarPerMonth)
-	ip4uSecondTFTStropesCost := getIPv4UnitSecondTFTStropesCost(ip4uDollarPerMonth)
+	cuSecondStropesCost := getComputeUnitSecondStropesCost(cuDollarPerMonth, assetPriceMill)
+	suSecondStropesCost := getStorageUnitSecondStropesCost(suDollarPerMonth, assetPriceMill)
+	ip4uSecondStropesCost := getIPv4UnitSecondStropesCost(ip4uDollarPerMonth, assetPriceMill)
 
-	cuCost = cuCost.Mul(big.NewInt(cuSecondTFTStropesCost), big.NewInt(int64(CUs)))
-	suCost = suCost.Mul(big.NewInt(suSecondTFTStropesCost), big.NewInt(int64(SUs)))
-	ipuCost = ipuCost.Mul(big.NewInt(ip4uSecondTFTStropesCost), big.NewInt(int64(IPv4Us)))
+	cuCost = cuCost.Mul(big.NewInt(cuSecondStropesCost), big.NewInt(int64(CUs)))
+	suCost = suCost.Mul(big.NewInt(suSecondStropesCost), big.NewInt(int64(SUs)))
+	ipuCost = ipuCost.Mul(big.NewInt(ip4uSecondStropesCost), big.NewInt(int64(IPv4Us)))
 	// TODO: Discount??
 	total = total.Add(total.Add(cuCost, suCost), ipuCost)
 
@@ -110,21 +112,9 @@ func (e Stellar) calculateCustomCapacityReservationCost(CUs, SUs, IPv4Us uint64,
 }
 
 // calculateCapacityReservationCost calculates the cost of a capacity reservation
-func (e Stellar) calculateCapacityReservationCost(CUs, SUs, IPv4Us uint64) (xdr.Int64, error) {
-	total := big.NewInt(0)
-	cuCost := big.NewInt(0)
-	suCost := big.NewInt(0)
-	ipuCost := big.NewInt(0)
-
-	cuCost = cuCost.Mul(big.NewInt(computeUnitSecondTFTStropesCost), big.NewInt(int64(CUs)))
-	suCost = suCost.Mul(big.NewInt(storageUnitSecondTFTStropesCost), big.NewInt(int64(SUs)))
-	ipuCost = ipuCost.Mul(big.NewInt(ipv4UnitSecondTFTStropesCost), big.NewInt(int64(IPv4Us)))
-	// TODO: Discount??
-	total = total.Add(total.Add(cuCost, suCost), ipuCost)
-
-	total = total.Div(total, big.NewInt(e.getNetworkDivisor()))
-
-	return xdr.Int64(total.Int64()), nil
+// with the default cloud unit prices, in an asset with the given price
+func (e Stellar) calculateCapacityReservationCost(CUs, SUs, IPv4Us uint64, assetPriceMill float64) (xdr.Int64, error) {
+	return e.calculateCustomCapacityReservationCost(CUs, SUs, IPv4Us, CuPriceDollarMonth, SuPriceDollarMonth, IP4uPriceDollarMonth, assetPriceMill)
 }
 
 func (e Stellar) processReservationResources(resData workloads.ReservationData) (rsuPerFarmer, error) {
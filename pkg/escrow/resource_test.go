@@ -9,9 +9,11 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/stellar/go/xdr"
 	"github.com/stretchr/testify/assert"
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
 	directorytypes "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/pkg/gridnetworks"
 	"github.com/threefoldtech/tfexplorer/schema"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -558,3 +560,20 @@ func Test_rsuToCu(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateCapacityReservationCost(t *testing.T) {
+	escrow := Stellar{gridNetwork: gridnetworks.GridNetworkMainnet}
+
+	// 1 CU and 1 SU for a second, paid in TFT
+	cost, err := escrow.calculateCapacityReservationCost(1, 1, 1, TftPriceMill)
+	assert.NoError(t, err)
+	assert.Equal(t, xdr.Int64(385+308+231), cost)
+
+	// an asset worth twice as much costs half the amount of units per second
+	cost, err = escrow.calculateCapacityReservationCost(2, 2, 2, TftPriceMill*2)
+	assert.NoError(t, err)
+	assert.Equal(t, xdr.Int64(2*(192+154+115)), cost)
+
+	_, err = escrow.calculateCapacityReservationCost(1, 1, 1, 0)
+	assert.Error(t, err)
+}
@@ -39,6 +39,10 @@ type (
 
 		paymentsChannel chan stellar.PayoutJob
 
+		// escrow addresses which are known to have trustlines for all
+		// assets supported by the wallet
+		trustlinesChecked map[string]struct{}
+
 		nodeAPI    NodeAPI
 		gatewayAPI GatewayAPI
 		farmAPI    FarmAPI
@@ -177,6 +181,7 @@ func NewStellar(wallet stellar.Wallet, db *mongo.Database, foundationAddress str
 		gatewayAPI:        &directory.GatewayAPI{},
 		farmAPI:           &directory.FarmAPI{},
 		paymentsChannel:   make(chan stellar.PayoutJob, 100),
+		trustlinesChecked: make(map[string]struct{}),
 		// paidCapacityInfoChannel is buffered since it is used to communicate
 		// with other workers, which might also try to communicate with this
 		// worker
@@ -533,9 +538,12 @@ func (e *Stellar) processCapacityReservation(reservation capacitytypes.Reservati
 			}
 			return customerInfo, err
 		}
-		// we currently only support ONE asset
-		if asset != stellar.TFTMainnet {
-			log.Error().Msgf("asset %s supported by wallet but no payout distribution found in escrow", asset)
+		info, err := e.wallet.AssetInfo(asset)
+		if err != nil {
+			return customerInfo, err
+		}
+		if !info.Capacity {
+			log.Debug().Msgf("asset %s supported by wallet but not accepted for capacity", asset)
 			continue
 		}
 
@@ -586,6 +594,11 @@ func (e *Stellar) processCapacityReservation(reservation capacitytypes.Reservati
 		return customerInfo, ErrNoCurrencyShared
 	}
 
+	assetInfo, err := e.wallet.AssetInfo(asset)
+	if err != nil {
+		return customerInfo, err
+	}
+
 	address, err := e.createOrLoadAccount(reservation.CustomerTid)
 	if err != nil {
 		return customerInfo, errors.Wrap(err, "failed to get escrow address for customer")
@@ -608,7 +621,7 @@ func (e *Stellar) processCapacityReservation(reservation capacitytypes.Reservati
 	price, err := e.farmAPI.GetFarmCustomPriceForThreebot(e.ctx, e.db, farmIDs[0], whichThreebotID)
 	// safe to ignore the error here, we already have a farm
 	if err != nil {
-		amount, err = e.calculateCapacityReservationCost(reservation.DataReservation.CUs, reservation.DataReservation.SUs, reservation.DataReservation.IPv4Us)
+		amount, err = e.calculateCapacityReservationCost(reservation.DataReservation.CUs, reservation.DataReservation.SUs, reservation.DataReservation.IPv4Us, assetInfo.PriceMill())
 		if err != nil {
 			return customerInfo, errors.Wrap(err, "failed to calculate capacity reservation cost")
 		}
@@ -616,7 +629,7 @@ func (e *Stellar) processCapacityReservation(reservation capacitytypes.Reservati
 		cuDollarPerMonth := price.CustomCloudUnitPrice.CU
 		suDollarPerMonth := price.CustomCloudUnitPrice.SU
 		ip4uDollarPerMonth := price.CustomCloudUnitPrice.IPv4U
-		amount, err = e.calculateCustomCapacityReservationCost(reservation.DataReservation.CUs, reservation.DataReservation.SUs, reservation.DataReservation.IPv4Us, cuDollarPerMonth, suDollarPerMonth, ip4uDollarPerMonth)
+		amount, err = e.calculateCustomCapacityReservationCost(reservation.DataReservation.CUs, reservation.DataReservation.SUs, reservation.DataReservation.IPv4Us, cuDollarPerMonth, suDollarPerMonth, ip4uDollarPerMonth, assetInfo.PriceMill())
 		if err != nil {
 			return customerInfo, errors.Wrap(err, "failed to calculate capacity reservation cost")
 		}
@@ -876,6 +889,16 @@ func (e *Stellar) createOrLoadAccount(customerTID int64) (string, error) {
 		}
 		return "", errors.Wrap(err, "failed to get customer address")
 	}
+
+	// the account might have been created before some of the currently
+	// supported assets were configured, so add the missing trustlines
+	if _, ok := e.trustlinesChecked[res.Address]; !ok {
+		if err := e.wallet.EnsureTrustlines(res.Secret); err != nil {
+			return "", errors.Wrapf(err, "failed to set up trustlines for customer %d", customerTID)
+		}
+		e.trustlinesChecked[res.Address] = struct{}{}
+	}
+
 	log.Debug().
 		Int64("customer", int64(customerTID)).
 		Str("address", res.Address).
@@ -0,0 +1,339 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/threefoldtech/tfexplorer/mw"
+)
+
+// signatureScheme is the name of the security scheme of the signed requests
+const signatureScheme = "HttpSignature"
+
+// endpoint is a route of the router with a handler and methods
+type endpoint struct {
+	name    string
+	path    string
+	methods []string
+	// params are the path parameters and the query parameters the route
+	// matches on
+	params []Parameter
+}
+
+// endpoints returns all the routes of the router under prefix, routes
+// without methods are mounted file servers and are skipped
+func endpoints(router *mux.Router, prefix string) ([]endpoint, error) {
+	var found []endpoint
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, prefix) {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path, params, err := parseTemplate(template)
+		if err != nil {
+			return err
+		}
+
+		queries, err := route.GetQueriesTemplates()
+		if err == nil {
+			for _, query := range queries {
+				idx := strings.Index(query, "=")
+				if idx == -1 {
+					continue
+				}
+				_, pattern := splitVariable(strings.Trim(query[idx+1:], "{}"))
+				params = append(params, Parameter{
+					Name:     query[:idx],
+					In:       "query",
+					Required: true,
+					Schema:   patternSchema(pattern),
+				})
+			}
+		}
+
+		found = append(found, endpoint{
+			name:    route.GetName(),
+			path:    path,
+			methods: methods,
+			params:  params,
+		})
+
+		return nil
+	})
+
+	return found, err
+}
+
+// parseTemplate converts a mux path template to an openapi path, and returns
+// the parameters of the path
+func parseTemplate(template string) (string, []Parameter, error) {
+	var path strings.Builder
+	var params []Parameter
+
+	for len(template) > 0 {
+		start := strings.Index(template, "{")
+		if start == -1 {
+			path.WriteString(template)
+			break
+		}
+
+		end, depth := -1, 0
+		for i := start; i < len(template); i++ {
+			switch template[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return "", nil, fmt.Errorf("unbalanced braces in route '%s'", template)
+		}
+
+		name, pattern := splitVariable(template[start+1 : end])
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   patternSchema(pattern),
+		})
+
+		path.WriteString(template[:start])
+		path.WriteString("{" + name + "}")
+		template = template[end+1:]
+	}
+
+	return path.String(), params, nil
+}
+
+// splitVariable splits a mux variable in its name and pattern
+func splitVariable(variable string) (string, string) {
+	if idx := strings.Index(variable, ":"); idx != -1 {
+		return variable[:idx], variable[idx+1:]
+	}
+
+	return variable, ""
+}
+
+func patternSchema(pattern string) *Schema {
+	switch pattern {
+	case "":
+		return &Schema{Type: "string"}
+	case `\d+`:
+		return &Schema{Type: "integer", Format: "int64"}
+	}
+
+	return &Schema{Type: "string", Pattern: "^" + pattern + "$"}
+}
+
+// Generate builds the document of the routes of the router under prefix.
+// Routes without documentation are added with their path and parameters only,
+// Check reports them.
+func Generate(router *mux.Router, prefix string, info Info, routes Routes) (*Document, error) {
+	found, err := endpoints(router, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := newSchemas()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				signatureScheme: {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "Authorization",
+					Description: "http signature of the request made with the ed25519 key of the caller, the id of the caller is set in the Threebot-Id header",
+				},
+			},
+		},
+	}
+
+	errorSchema := schemas.of(mw.ErrorBody{})
+	tags := make(map[string]struct{})
+
+	for _, endpoint := range found {
+		route := routes[endpoint.name]
+
+		for i, method := range endpoint.methods {
+			id := endpoint.name
+			if i > 0 {
+				id = fmt.Sprintf("%s-%s", id, strings.ToLower(method))
+			}
+
+			operation := &Operation{
+				OperationID: id,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  route.Deprecated,
+				Responses:   make(map[string]Response),
+			}
+
+			operation.Parameters = append(operation.Parameters, endpoint.params...)
+			for _, param := range route.Params {
+				param.Schema = schemas.of(param.sample)
+				operation.Parameters = append(operation.Parameters, param)
+			}
+
+			if route.Request != nil {
+				operation.RequestBody = &RequestBody{
+					Required: true,
+					Content:  map[string]MediaType{"application/json": {Schema: schemas.of(route.Request)}},
+				}
+			}
+
+			success := Response{Description: http.StatusText(route.status())}
+			if route.Response != nil {
+				success.Content = map[string]MediaType{route.contentType(): {Schema: schemas.of(route.Response)}}
+			}
+			operation.Responses[strconv.Itoa(route.status())] = success
+
+			errors := route.Errors
+			if route.Auth {
+				operation.Security = []map[string][]string{{signatureScheme: {}}}
+				if _, ok := errors[http.StatusUnauthorized]; !ok {
+					errors = withError(errors, http.StatusUnauthorized, "the request signature is missing or invalid")
+				}
+			}
+
+			for status, description := range errors {
+				operation.Responses[strconv.Itoa(status)] = Response{
+					Description: description,
+					Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+				}
+			}
+
+			for _, tag := range route.Tags {
+				tags[tag] = struct{}{}
+			}
+
+			item, ok := doc.Paths[endpoint.path]
+			if !ok {
+				item = make(PathItem)
+				doc.Paths[endpoint.path] = item
+			}
+			item[strings.ToLower(method)] = operation
+		}
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool {
+		return doc.Tags[i].Name < doc.Tags[j].Name
+	})
+
+	doc.Components.Schemas = schemas.components
+
+	return doc, nil
+}
+
+// withError returns a copy of the errors with the given error added
+func withError(errors map[int]string, status int, description string) map[int]string {
+	result := make(map[int]string, len(errors)+1)
+	for s, d := range errors {
+		result[s] = d
+	}
+	result[status] = description
+
+	return result
+}
+
+// Check returns an error listing the routes under prefix which are not
+// documented, and the documented routes which are not registered
+func Check(router *mux.Router, prefix string, routes Routes) error {
+	found, err := endpoints(router, prefix)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	registered := make(map[string]struct{})
+	for _, endpoint := range found {
+		if endpoint.name == "" {
+			problems = append(problems, fmt.Sprintf("route %s %s has no name", strings.Join(endpoint.methods, ","), endpoint.path))
+			continue
+		}
+
+		registered[endpoint.name] = struct{}{}
+		if _, ok := routes[endpoint.name]; !ok {
+			problems = append(problems, fmt.Sprintf("route '%s' (%s %s) is not documented", endpoint.name, strings.Join(endpoint.methods, ","), endpoint.path))
+		}
+	}
+
+	for name := range routes {
+		if _, ok := registered[name]; !ok {
+			problems = append(problems, fmt.Sprintf("route '%s' is documented but not registered", name))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	return fmt.Errorf("%d problems with the api documentation:\n%s", len(problems), strings.Join(problems, "\n"))
+}
+
+// Handler serves the document of the routes of the router. The document is
+// generated on the first request, once all the routes are registered.
+func Handler(router *mux.Router, prefix string, info Info, routes Routes) http.HandlerFunc {
+	var (
+		once sync.Once
+		doc  *Document
+		err  error
+	)
+
+	return mw.AsHandlerFunc(func(r *http.Request) (interface{}, mw.Response) {
+		once.Do(func() {
+			doc, err = Generate(router, prefix, info, routes)
+		})
+
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+
+		return doc, nil
+	})
+}
+
+// Register serves the document of the routes under prefix at
+// prefix/openapi.json under the given route name. The returned routes are
+// the given routes with the route of the document, so the document
+// describes itself.
+func Register(router *mux.Router, prefix, name string, info Info, routes Routes) Routes {
+	routes = Merge(routes, Routes{
+		name: {
+			Summary:  "Get the OpenAPI document of the api",
+			Tags:     []string{"docs"},
+			Response: Document{},
+		},
+	})
+
+	router.Path(prefix + "/openapi.json").Methods(http.MethodGet).HandlerFunc(Handler(router, prefix, info, routes)).Name(name)
+
+	return routes
+}
@@ -0,0 +1,204 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testItem struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name,omitempty"`
+	Size    int64     `json:"size,string"`
+	Created time.Time `json:"created"`
+	Hidden  string    `json:"-"`
+	Parent  *testItem `json:"parent"`
+	testEmbedded
+}
+
+type testEmbedded struct {
+	Labels map[string]string `json:"labels"`
+}
+
+type testCircle struct {
+	Radius float64 `json:"radius"`
+}
+
+type testSquare struct {
+	Side float64 `json:"side"`
+}
+
+type testShape struct{}
+
+func (testShape) OneOf() []interface{} {
+	return []interface{}{testCircle{}, testSquare{}}
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {}
+
+func testRouter() *mux.Router {
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/items", handler).Methods(http.MethodGet).Name("items-list")
+	api.HandleFunc("/items", handler).Methods(http.MethodPost).Name("items-create")
+	api.HandleFunc("/items/{id:\\d+}", handler).Methods(http.MethodGet, http.MethodHead).Name("items-get")
+	api.HandleFunc("/items/{id:\\d+}/shapes/{name}", handler).Queries("from", "{from:\\d+}").Methods(http.MethodGet).Name("shapes-get")
+	// routes outside of the prefix are ignored
+	router.HandleFunc("/metrics", handler).Name("metrics")
+
+	return router
+}
+
+var testRoutes = Routes{
+	"items-list": {
+		Summary:  "List the items",
+		Tags:     []string{"items"},
+		Params:   Paginated(Query("name", "filter items by name", "")),
+		Response: []testItem{},
+	},
+	"items-create": {
+		Summary:  "Create an item",
+		Tags:     []string{"items"},
+		Auth:     true,
+		Request:  testItem{},
+		Response: testItem{},
+		Status:   http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid item",
+		},
+	},
+	"items-get": {
+		Summary:  "Get an item",
+		Tags:     []string{"items"},
+		Response: testItem{},
+	},
+	"shapes-get": {
+		Summary:  "Get a shape of an item",
+		Tags:     []string{"shapes"},
+		Response: testShape{},
+	},
+}
+
+func TestParseTemplate(t *testing.T) {
+	path, params, err := parseTemplate(`/api/v1/nodes/{node_id}/workloads/{gwid:\d+-\d+}/{id:\d+}/{name:[a-z]{2,4}}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/api/v1/nodes/{node_id}/workloads/{gwid}/{id}/{name}", path)
+	assert.Equal(t, []Parameter{
+		{Name: "node_id", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "gwid", In: "path", Required: true, Schema: &Schema{Type: "string", Pattern: `^\d+-\d+$`}},
+		{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer", Format: "int64"}},
+		{Name: "name", In: "path", Required: true, Schema: &Schema{Type: "string", Pattern: `^[a-z]{2,4}$`}},
+	}, params)
+
+	_, _, err = parseTemplate("/api/v1/nodes/{node_id")
+	assert.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	router := testRouter()
+	require.NoError(t, Check(router, "/api/v1", testRoutes))
+
+	routes := Merge(testRoutes, Routes{"items-delete": {Summary: "Delete an item"}})
+	delete(routes, "items-get")
+	router.HandleFunc("/api/v1/unnamed", handler).Methods(http.MethodGet)
+
+	err := Check(router, "/api/v1", routes)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "route 'items-get' (GET,HEAD /api/v1/items/{id}) is not documented")
+	assert.Contains(t, err.Error(), "route 'items-delete' is documented but not registered")
+	assert.Contains(t, err.Error(), "route GET /api/v1/unnamed has no name")
+}
+
+func TestRegister(t *testing.T) {
+	router := testRouter()
+	routes := Register(router, "/api/v1", "openapi-v1", Info{Title: "test", Version: "v1"}, testRoutes)
+	require.NoError(t, Check(router, "/api/v1", routes))
+	assert.NotContains(t, testRoutes, "openapi-v1")
+
+	doc, err := Generate(router, "/api/v1", Info{Title: "test", Version: "v1"}, routes)
+	require.NoError(t, err)
+	require.Contains(t, doc.Paths, "/api/v1/openapi.json")
+	assert.Equal(t, "openapi-v1", doc.Paths["/api/v1/openapi.json"]["get"].OperationID)
+}
+
+func TestLegacy(t *testing.T) {
+	legacy := Legacy(testRoutes, map[string]string{
+		"items-list-legacy": "items-list",
+		"items-missing":     "missing",
+	})
+
+	require.Contains(t, legacy, "items-list-legacy")
+	assert.True(t, legacy["items-list-legacy"].Deprecated)
+	assert.Equal(t, testRoutes["items-list"].Summary, legacy["items-list-legacy"].Summary)
+	assert.False(t, testRoutes["items-list"].Deprecated)
+	// missing routes are reported by Check as not documented
+	assert.NotContains(t, legacy, "items-missing")
+}
+
+func TestGenerate(t *testing.T) {
+	doc, err := Generate(testRouter(), "/api/v1", Info{Title: "test", Version: "v1"}, testRoutes)
+	require.NoError(t, err)
+
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Equal(t, []Tag{{Name: "items"}, {Name: "shapes"}}, doc.Tags)
+	assert.Len(t, doc.Paths, 3)
+	assert.NotContains(t, doc.Paths, "/metrics")
+
+	list := doc.Paths["/api/v1/items"]["get"]
+	require.NotNil(t, list)
+	assert.Equal(t, "items-list", list.OperationID)
+	assert.Len(t, list.Parameters, len(Pagination)+1)
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/testItem"}}, list.Responses["200"].Content["application/json"].Schema)
+	assert.Nil(t, list.Security)
+
+	create := doc.Paths["/api/v1/items"]["post"]
+	require.NotNil(t, create)
+	assert.Equal(t, []map[string][]string{{signatureScheme: {}}}, create.Security)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testItem"}, create.RequestBody.Content["application/json"].Schema)
+	assert.Contains(t, create.Responses, "201")
+	assert.Contains(t, create.Responses, "400")
+	assert.Contains(t, create.Responses, "401")
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/ErrorBody"}, create.Responses["400"].Content["application/json"].Schema)
+	// the default error is not added to the documentation of the route
+	assert.NotContains(t, testRoutes["items-create"].Errors, http.StatusUnauthorized)
+
+	get := doc.Paths["/api/v1/items/{id}"]
+	assert.Equal(t, "items-get", get["get"].OperationID)
+	assert.Equal(t, "items-get-head", get["head"].OperationID)
+
+	shape := doc.Paths["/api/v1/items/{id}/shapes/{name}"]["get"]
+	require.NotNil(t, shape)
+	assert.Equal(t, []Parameter{
+		{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer", Format: "int64"}},
+		{Name: "name", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "from", In: "query", Required: true, Schema: &Schema{Type: "integer", Format: "int64"}},
+	}, shape.Parameters)
+
+	item := doc.Components.Schemas["testItem"]
+	require.NotNil(t, item)
+	assert.Equal(t, &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":      {Type: "integer", Format: "int64"},
+			"name":    {Type: "string"},
+			"size":    {Type: "string"},
+			"created": {Type: "string", Format: "date-time"},
+			"parent":  {Ref: "#/components/schemas/testItem"},
+			"labels":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+		},
+	}, item)
+
+	assert.Equal(t, &Schema{
+		OneOf: []*Schema{
+			{Ref: "#/components/schemas/testCircle"},
+			{Ref: "#/components/schemas/testSquare"},
+		},
+	}, doc.Components.Schemas["testShape"])
+	assert.Contains(t, doc.Components.Schemas, "testCircle")
+	assert.Contains(t, doc.Components.Schemas, "testSquare")
+}
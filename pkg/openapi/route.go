@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"net/http"
+)
+
+// Route is the documentation of a named route of the router. The path, the
+// methods and the path parameters come from the route itself, the request
+// and response schemas are built from the types of the Request and Response
+// values.
+type Route struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Auth is set if the request must be signed by the caller
+	Auth bool
+	// Params are the query and header parameters of the route
+	Params []Parameter
+	// Request is a value of the type of the request body, nil if the route
+	// has no body
+	Request interface{}
+	// Response is a value of the type of the response body, nil if the route
+	// returns no body
+	Response interface{}
+	// ContentType of the response, application/json if not set
+	ContentType string
+	// Status of the successful response, http.StatusOK if not set
+	Status int
+	// Errors are the descriptions of the error responses by status
+	Errors map[int]string
+	// Deprecated routes are kept for compatibility
+	Deprecated bool
+}
+
+// Routes are the documentations of the routes by route name
+type Routes map[string]Route
+
+// Merge returns the routes of all the given routes
+func Merge(routes ...Routes) Routes {
+	merged := make(Routes)
+	for _, r := range routes {
+		for name, route := range r {
+			merged[name] = route
+		}
+	}
+
+	return merged
+}
+
+// Legacy returns the documentation of legacy routes from the documentation
+// of their versioned equivalent. names maps the name of the legacy routes to
+// the name of the versioned routes, the legacy routes are deprecated.
+func Legacy(routes Routes, names map[string]string) Routes {
+	legacy := make(Routes, len(names))
+	for name, versioned := range names {
+		route, ok := routes[versioned]
+		if !ok {
+			continue
+		}
+		route.Deprecated = true
+		legacy[name] = route
+	}
+
+	return legacy
+}
+
+// Query returns a query parameter, its schema is built from the type of sample
+func Query(name, description string, sample interface{}) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, sample: sample}
+}
+
+// Header returns a header parameter, its schema is built from the type of
+// sample
+func Header(name, description string, sample interface{}) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, sample: sample}
+}
+
+// Pagination are the query parameters of the paginated lists
+var Pagination = []Parameter{
+	Query("page", "page number, starting at 1", int64(0)),
+	Query("size", "number of items per page", int64(0)),
+	Query("cursor", "paginate with a cursor instead of page numbers, an empty cursor is the first page. the cursor of the next page is returned in the Link header", ""),
+	Query("count", "count the total number of items, returned in the X-Total-Count and Pages headers. true by default unless a cursor is set", false),
+}
+
+// Paginated returns the query parameters of a paginated list followed by the
+// given parameters
+func Paginated(params ...Parameter) []Parameter {
+	return append(append([]Parameter{}, Pagination...), params...)
+}
+
+func (r *Route) status() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+
+	return r.Status
+}
+
+func (r *Route) contentType() string {
+	if r.ContentType == "" {
+		return "application/json"
+	}
+
+	return r.ContentType
+}
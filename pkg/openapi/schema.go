@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"net"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+// OneOf is implemented by the types encoded as one of several other types,
+// like a wrapper of an interface. Their schema is one of the schemas of the
+// variants.
+type OneOf interface {
+	OneOf() []interface{}
+}
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	oneOf         = reflect.TypeOf((*OneOf)(nil)).Elem()
+)
+
+// knownTypes are the types which are not encoded as their go structure
+var knownTypes = map[reflect.Type]Schema{
+	reflect.TypeOf(time.Time{}):         {Type: "string", Format: "date-time"},
+	reflect.TypeOf(time.Duration(0)):    {Type: "integer", Format: "int64", Description: "duration in nanoseconds"},
+	reflect.TypeOf(json.RawMessage{}):   {},
+	reflect.TypeOf(net.IP{}):            {Type: "string", Format: "ip"},
+	reflect.TypeOf(net.IPNet{}):         {Type: "string", Format: "cidr"},
+	reflect.TypeOf(schema.Date{}):       {Type: "integer", Format: "int64", Description: "unix timestamp"},
+	reflect.TypeOf(schema.IP{}):         {Type: "string", Format: "ip"},
+	reflect.TypeOf(schema.IPCidr{}):     {Type: "string", Format: "cidr"},
+	reflect.TypeOf(schema.IPRange{}):    {Type: "string", Format: "cidr"},
+	reflect.TypeOf(schema.MacAddress{}): {Type: "string", Format: "mac"},
+	reflect.TypeOf(schema.Numeric("")):  {Type: "string", Format: "numeric"},
+}
+
+// schemas builds the schemas of go types. Named structs are added to the
+// components and referenced, anonymous structs are inlined.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// of returns the schema of the type of a value, nil if v is nil
+func (s *schemas) of(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemas) schema(t reflect.Type) *Schema {
+	if known, ok := knownTypes[t]; ok {
+		return &known
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Struct:
+		if t.Implements(oneOf) {
+			return &Schema{Ref: "#/components/schemas/" + s.component(t, s.variants)}
+		}
+		if t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler) {
+			return &Schema{Type: "string"}
+		}
+		if t.Implements(jsonMarshaler) {
+			return &Schema{}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + s.component(t, s.object)}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	}
+
+	// interfaces, the encoded value can be anything
+	return &Schema{}
+}
+
+// component adds the schema of a named type to the components and returns
+// its name
+func (s *schemas) component(t reflect.Type, build func(t reflect.Type) *Schema) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, ok := s.components[name]; ok {
+		// another type has the same name, qualify it with its package
+		pkg := path.Base(t.PkgPath())
+		name = strings.Title(pkg) + name
+	}
+
+	s.names[t] = name
+	// register the name before building the schema so recursive types
+	// reference themselves
+	s.components[name] = &Schema{}
+	*s.components[name] = *build(t)
+
+	return name
+}
+
+// variants builds the schema of a type implementing OneOf
+func (s *schemas) variants(t reflect.Type) *Schema {
+	variants := reflect.Zero(t).Interface().(OneOf).OneOf()
+
+	schema := &Schema{}
+	for _, variant := range variants {
+		schema.OneOf = append(schema.OneOf, s.of(variant))
+	}
+
+	return schema
+}
+
+// object builds the schema of a struct from its json encoding
+func (s *schemas) object(t reflect.Type) *Schema {
+	object := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	s.fields(t, object)
+
+	return object
+}
+
+func (s *schemas) fields(t reflect.Type, object *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, options = tag[:idx], tag[idx+1:]
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// embedded structs without a name have their fields promoted
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if _, known := knownTypes[ft]; !known {
+				s.fields(ft, object)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schema(field.Type)
+		for _, option := range strings.Split(options, ",") {
+			if option == "string" {
+				property = &Schema{Type: "string"}
+			}
+		}
+
+		object.Properties[name] = property
+	}
+}
@@ -0,0 +1,68 @@
+package phonebook
+
+import (
+	"net/http"
+
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+	"github.com/threefoldtech/tfexplorer/pkg/phonebook/types"
+)
+
+// Docs are the documentation of the versioned routes of the package
+var Docs = openapi.Routes{
+	"user-create-v1": {
+		Summary:     "Create a user",
+		Description: "the name and public key of the user must not be used by another user, or by another threebot connect user",
+		Tags:        []string{"users"},
+		Request:     types.User{},
+		Response:    types.User{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid user, or the name or public key is already used",
+		},
+	},
+	"user-list-v1": {
+		Summary: "List the users",
+		Tags:    []string{"users"},
+		Params: openapi.Paginated(
+			openapi.Query("name", "filter users by name", ""),
+			openapi.Query("email", "filter users by email", ""),
+		),
+		Response: []types.User{},
+	},
+	"user-register-v1": {
+		Summary:     "Update a user",
+		Description: "the update must be signed by the user, the signature is made over the encoded user",
+		Tags:        []string{"users"},
+		Request:     UserUpdateRequest{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid user or signature",
+		},
+	},
+	"user-get-v1": {
+		Summary:  "Get a user",
+		Tags:     []string{"users"},
+		Response: types.User{},
+		Errors: map[int]string{
+			http.StatusNotFound: "user not found",
+		},
+	},
+	"user-validate-v1": {
+		Summary:     "Validate a signature of a user",
+		Description: "checks the payload is signed with the key of the user",
+		Tags:        []string{"users"},
+		Request:     UserValidateRequest{},
+		Response:    UserValidateResponse{},
+		Errors: map[int]string{
+			http.StatusNotFound: "user not found",
+		},
+	},
+}
+
+// LegacyDocs are the documentation of the legacy routes of the package
+var LegacyDocs = openapi.Legacy(Docs, map[string]string{
+	"user-create":   "user-create-v1",
+	"user-list":     "user-list-v1",
+	"user-register": "user-register-v1",
+	"user-get":      "user-get-v1",
+	"user-validate": "user-validate-v1",
+})
@@ -0,0 +1,17 @@
+package phonebook
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, nil, "")
+
+	require.NoError(t, openapi.Check(router, "/api/v1", Docs))
+	require.NoError(t, openapi.Check(router, "/explorer", LegacyDocs))
+}
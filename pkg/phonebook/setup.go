@@ -17,6 +17,14 @@ func Setup(parent *mux.Router, db *mongo.Database, threebotConnectURL string) er
 		return err
 	}
 
+	registerRoutes(parent, db, threebotConnectURL)
+
+	return nil
+}
+
+// registerRoutes registers the routes of the package, the routes are only
+// bound to the database when they are called
+func registerRoutes(parent *mux.Router, db *mongo.Database, threebotConnectURL string) {
 	userVerifier := httpsig.NewVerifier(mw.NewUserKeyGetter(db))
 
 	var userAPI = UserAPI{
@@ -42,6 +50,4 @@ func Setup(parent *mux.Router, db *mongo.Database, threebotConnectURL string) er
 	legacyUsers.HandleFunc("/{user_id}", mw.AsHandlerFunc(userAPI.register)).Methods(http.MethodPut).Name("user-register")
 	legacyUsers.HandleFunc("/{user_id}", mw.AsHandlerFunc(userAPI.get)).Methods(http.MethodGet).Name("user-get")
 	legacyUsers.HandleFunc("/{user_id}/validate", mw.AsHandlerFunc(userAPI.validate)).Methods(http.MethodPost).Name("user-validate")
-
-	return nil
 }
@@ -6,7 +6,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"math"
 	"net/http"
 	"strconv"
 
@@ -28,6 +27,25 @@ type UserAPI struct {
 	threebotConnectAPIURL string
 }
 
+// UserUpdateRequest is the body of a user update, the signature is made over
+// the encoded user
+type UserUpdateRequest struct {
+	types.User
+	Signature string `json:"sender_signature_hex"` // because why not `signature`!
+}
+
+// UserValidateRequest is the body of a signature validation, payload and
+// signature are hex encoded
+type UserValidateRequest struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// UserValidateResponse is the result of a signature validation
+type UserValidateResponse struct {
+	IsValid bool `json:"is_valid"`
+}
+
 func (u *UserAPI) isAuthenticated(r *http.Request) bool {
 	_, err := u.verifier.Verify(r)
 	return err == nil
@@ -82,10 +100,7 @@ func (u *UserAPI) register(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.BadRequest(errors.Wrap(err, "invalid user id"))
 	}
 
-	var payload struct {
-		types.User
-		Signature string `json:"sender_signature_hex"` // because why not `signature`!
-	}
+	var payload UserUpdateRequest
 
 	defer r.Body.Close()
 
@@ -120,9 +135,22 @@ func (u *UserAPI) list(r *http.Request) (interface{}, mw.Response) {
 
 	db := mw.Database(r)
 
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	var total int64
+	if pagination.Count() {
+		total, err = filter.Count(r.Context(), db)
+		if err != nil {
+			return nil, mw.Error(err, http.StatusInternalServerError)
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
 	findOpts := make([]*options.FindOptions, 0, 2)
-	pager := models.PageFromRequest(r)
-	findOpts = append(findOpts, pager)
+	findOpts = append(findOpts, pagination.FindOptions())
 
 	// hide the email of the user for any non authenticated user
 	if !u.isAuthenticated(r) {
@@ -141,15 +169,15 @@ func (u *UserAPI) list(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.Error(err)
 	}
 
-	total, err := filter.Count(r.Context(), db)
-	if err != nil {
-		return nil, mw.Error(err, http.StatusInternalServerError)
-	}
+	n, more := pagination.Trim(len(users))
+	users = users[:n]
 
-	nrPages := math.Ceil(float64(total) / float64(*pager.Limit))
-	pages := fmt.Sprintf("%d", int64(nrPages))
+	var last schema.ID
+	if n > 0 {
+		last = users[n-1].ID
+	}
 
-	return users, mw.Ok().WithHeader("Pages", pages)
+	return users, mw.Page(r, pagination, last, more, total)
 }
 
 func (u *UserAPI) parseID(id string) (schema.ID, error) {
@@ -173,7 +201,7 @@ func (u *UserAPI) get(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 	user, err := filter.Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeUserNotFound)
 	}
 
 	// hide the email of the user for any non authenticated user
@@ -185,10 +213,7 @@ func (u *UserAPI) get(r *http.Request) (interface{}, mw.Response) {
 }
 
 func (u *UserAPI) validate(r *http.Request) (interface{}, mw.Response) {
-	var payload struct {
-		Payload   string `json:"payload"`
-		Signature string `json:"signature"`
-	}
+	var payload UserValidateRequest
 
 	userID, err := u.parseID(mux.Vars(r)["user_id"])
 	if err != nil {
@@ -217,7 +242,7 @@ func (u *UserAPI) validate(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 	user, err := filter.Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeUserNotFound)
 	}
 
 	key, err := crypto.KeyFromHex(user.Pubkey)
@@ -229,9 +254,7 @@ func (u *UserAPI) validate(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.Error(fmt.Errorf("public key has the wrong size"))
 	}
 
-	return struct {
-		IsValid bool `json:"is_valid"`
-	}{
+	return UserValidateResponse{
 		IsValid: ed25519.Verify(key, data, signature),
 	}, nil
 }
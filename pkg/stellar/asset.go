@@ -2,6 +2,7 @@ package stellar
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -10,18 +11,107 @@ import (
 // Asset on the stellar network, both code and issuer in the form <CODE>:<ISSUER>
 type Asset string
 
+// AssetInfo is the configuration of an asset supported by the wallet
+type AssetInfo struct {
+	Asset Asset
+	// Capacity indicates if the asset is accepted as payment for capacity
+	Capacity bool
+	// USDRate is the price of a single unit of the asset in USD. It is only
+	// relevant if the asset is accepted for capacity
+	USDRate float64
+}
+
+// Assets is a flag type for configuring the assets supported by the wallet
+type Assets []AssetInfo
+
 // Supported assets for the wallet. Assets are different based on testnet/mainnet
 const (
 	TFTMainnet Asset = "TFT:GBOVQKJYHXRR3DX6NOX2RRYFRCUMSADGDESTDNBDS6CDVLGVESRTAC47"
+
+	// TFTMainnetUSDRate is the default price of TFT in USD
+	TFTMainnetUSDRate = 0.1
 )
 
-// internal vars to set up the wallet with supported assets
+// internal vars to set up the wallet with supported assets, used if no assets
+// are configured explicitly
 var (
-	mainnetAssets = map[Asset]struct{}{
-		TFTMainnet: {},
+	mainnetAssets = map[Asset]AssetInfo{
+		TFTMainnet: {Asset: TFTMainnet, Capacity: true, USDRate: TFTMainnetUSDRate},
 	}
 )
 
+// ParseAssetInfo parses an asset configuration in the form <CODE>:<ISSUER>[:<USD_RATE>].
+// If the USD rate is given, the asset is accepted as payment for capacity at
+// that rate.
+func ParseAssetInfo(value string) (AssetInfo, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return AssetInfo{}, fmt.Errorf("invalid asset configuration '%s', expected <CODE>:<ISSUER>[:<USD_RATE>]", value)
+	}
+
+	info := AssetInfo{Asset: Asset(fmt.Sprintf("%s:%s", parts[0], parts[1]))}
+	if err := info.Asset.validate(); err != nil {
+		return AssetInfo{}, err
+	}
+
+	if len(parts) == 3 {
+		rate, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return AssetInfo{}, errors.Wrap(err, "invalid asset usd rate")
+		}
+		if rate <= 0 {
+			return AssetInfo{}, errors.New("asset usd rate must be positive")
+		}
+		info.Capacity = true
+		info.USDRate = rate
+	}
+
+	return info, nil
+}
+
+// PriceMill is the price of a single unit of the asset in mill (1 mill = 1/1000 of a dollar)
+func (i AssetInfo) PriceMill() float64 {
+	return i.USDRate * 1000
+}
+
+func (a *Assets) String() string {
+	repr := ""
+	for _, info := range *a {
+		repr += fmt.Sprintf("%s ", info.Asset)
+	}
+	return repr
+}
+
+// Set a value on the assets flag
+func (a *Assets) Set(value string) error {
+	info, err := ParseAssetInfo(value)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, info)
+	return nil
+}
+
+// assetsMap builds the set of assets supported by the wallet. If no assets are
+// given, the default assets are used
+func assetsMap(assets []AssetInfo) (map[Asset]AssetInfo, error) {
+	if len(assets) == 0 {
+		return mainnetAssets, nil
+	}
+
+	codes := make(map[string]struct{})
+	m := make(map[Asset]AssetInfo, len(assets))
+	for _, info := range assets {
+		if _, exists := codes[info.Asset.Code()]; exists {
+			return nil, fmt.Errorf("asset code %s configured twice", info.Asset.Code())
+		}
+		codes[info.Asset.Code()] = struct{}{}
+		m[info.Asset] = info
+	}
+
+	return m, nil
+}
+
 // Code of the asset
 func (a Asset) Code() string {
 	return strings.Split(string(a), ":")[0]
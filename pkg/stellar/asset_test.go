@@ -3,6 +3,8 @@ package stellar
 import (
 	"testing"
 
+	hProtocol "github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,3 +40,67 @@ func TestMainnetAssetsCodeUniqueness(t *testing.T) {
 		}
 	}
 }
+
+func TestParseAssetInfo(t *testing.T) {
+	info, err := ParseAssetInfo("TFT:GBOVQKJYHXRR3DX6NOX2RRYFRCUMSADGDESTDNBDS6CDVLGVESRTAC47")
+	assert.NoError(t, err)
+	assert.Equal(t, TFTMainnet, info.Asset)
+	assert.False(t, info.Capacity)
+
+	info, err = ParseAssetInfo("TFTA:SomethingSomethingSomething:0.25")
+	assert.NoError(t, err)
+	assert.Equal(t, Asset("TFTA:SomethingSomethingSomething"), info.Asset)
+	assert.True(t, info.Capacity)
+	assert.Equal(t, 0.25, info.USDRate)
+	assert.Equal(t, 250.0, info.PriceMill())
+
+	_, err = ParseAssetInfo("TFT")
+	assert.Error(t, err)
+	_, err = ParseAssetInfo(":SomethingSomethingSomething")
+	assert.Error(t, err)
+	_, err = ParseAssetInfo("TFT:SomethingSomethingSomething:abc")
+	assert.Error(t, err)
+	_, err = ParseAssetInfo("TFT:SomethingSomethingSomething:0")
+	assert.Error(t, err)
+}
+
+func TestAssetsMap(t *testing.T) {
+	assets, err := assetsMap(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mainnetAssets, assets)
+
+	var flag Assets
+	assert.NoError(t, flag.Set("TFT:SomethingSomethingSomething:0.1"))
+	assert.NoError(t, flag.Set("FreeTFT:SomethingElse"))
+
+	assets, err = assetsMap(flag)
+	assert.NoError(t, err)
+	assert.Len(t, assets, 2)
+	assert.True(t, assets["TFT:SomethingSomethingSomething"].Capacity)
+	assert.False(t, assets["FreeTFT:SomethingElse"].Capacity)
+
+	assert.NoError(t, flag.Set("TFT:AnotherIssuer"))
+	_, err = assetsMap(flag)
+	assert.Error(t, err)
+}
+
+func TestMissingTrustlines(t *testing.T) {
+	w := &stellarWallet{assets: map[Asset]AssetInfo{
+		"TFT:Issuer":     {Asset: "TFT:Issuer"},
+		"FreeTFT:Issuer": {Asset: "FreeTFT:Issuer"},
+	}}
+
+	account := hProtocol.Account{
+		Balances: []hProtocol.Balance{
+			{Asset: base.Asset{Type: "native"}},
+			{Asset: base.Asset{Type: "credit_alphanum4", Code: "TFT", Issuer: "Issuer"}},
+		},
+	}
+
+	assert.Equal(t, []Asset{"FreeTFT:Issuer"}, w.missingTrustlines(account))
+
+	account.Balances = append(account.Balances, hProtocol.Balance{
+		Asset: base.Asset{Type: "credit_alphanum12", Code: "FreeTFT", Issuer: "Issuer"},
+	})
+	assert.Empty(t, w.missingTrustlines(account))
+}
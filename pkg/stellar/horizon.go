@@ -0,0 +1,400 @@
+package stellar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"github.com/stellar/go/clients/horizonclient"
+)
+
+const (
+	// horizonCheckInterval is the interval between 2 health checks of the endpoints
+	horizonCheckInterval = 30 * time.Second
+	// horizonCheckTimeout is the maximum time a health check can take
+	horizonCheckTimeout = 10 * time.Second
+	// horizonMaxLedgerLag is the number of ledgers an endpoint can be behind the
+	// most recent endpoint before it is considered unhealthy
+	horizonMaxLedgerLag = 10
+	// horizonBreakerThreshold is the number of consecutive failed requests which
+	// opens the circuit of an endpoint
+	horizonBreakerThreshold = 5
+	// horizonBreakerCooldown is the time an open circuit waits before allowing
+	// requests to the endpoint again
+	horizonBreakerCooldown = time.Minute
+	// horizonLatencyMargin is how much faster another endpoint must be before
+	// the active endpoint is switched, this prevents flapping between endpoints
+	// with similar latency
+	horizonLatencyMargin = 50 * time.Millisecond
+)
+
+var (
+	horizonActiveEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "horizon",
+		Name:      "active_endpoint",
+		Help:      "Set to 1 for the horizon endpoint currently in use, 0 for the others",
+	}, []string{"endpoint"})
+	horizonRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "horizon",
+		Name:      "requests_total",
+		Help:      "The total number of requests made to a horizon endpoint, by result",
+	}, []string{"endpoint", "result"})
+	horizonLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "horizon",
+		Name:      "latency_seconds",
+		Help:      "Latency of the last health check of a horizon endpoint",
+	}, []string{"endpoint"})
+	horizonCircuitOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "horizon",
+		Name:      "circuit_open",
+		Help:      "Set to 1 if the circuit of a horizon endpoint is open",
+	}, []string{"endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(horizonActiveEndpoint)
+	prometheus.MustRegister(horizonRequests)
+	prometheus.MustRegister(horizonLatency)
+	prometheus.MustRegister(horizonCircuitOpen)
+}
+
+type (
+	// HorizonURLs is a flag type for setting the horizon endpoints. The flag
+	// can be repeated, or given a comma separated list of urls
+	HorizonURLs []string
+
+	// HorizonPool is a set of horizon endpoints of the same network. The pool
+	// periodically checks the health and latency of every endpoint, and hands
+	// out a client for the fastest healthy one. Failed requests are tracked per
+	// endpoint, and an endpoint which keeps failing is taken out of rotation
+	// for a while (circuit breaking), so the pool fails over automatically.
+	HorizonPool struct {
+		endpoints []*horizonEndpoint
+
+		mu     sync.RWMutex
+		active *horizonEndpoint
+	}
+
+	horizonEndpoint struct {
+		url    string
+		client *horizonclient.Client
+
+		mu       sync.Mutex
+		healthy  bool
+		latency  time.Duration
+		ledger   int32
+		failures int
+		// openedAt is the time the circuit opened, zero if the circuit is closed
+		openedAt time.Time
+	}
+
+	// endpointTransport records the result of every request made to an endpoint
+	endpointTransport struct {
+		endpoint *horizonEndpoint
+		client   *http.Client
+	}
+)
+
+func (h *HorizonURLs) String() string {
+	return strings.Join(*h, ",")
+}
+
+// Set implements the flag.Value interface
+func (h *HorizonURLs) Set(value string) error {
+	for _, u := range strings.Split(value, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return errors.Wrapf(err, "invalid horizon url '%s'", u)
+		}
+		*h = append(*h, u)
+	}
+
+	return nil
+}
+
+// NewHorizonPool creates a pool for the given endpoints. If no endpoints are
+// given, the default public endpoint of the network is used.
+func NewHorizonPool(network string, urls []string) (*HorizonPool, error) {
+	if len(urls) == 0 {
+		client, err := defaultHorizonClient(network)
+		if err != nil {
+			return nil, err
+		}
+		urls = []string{client.HorizonURL}
+	}
+
+	p := &HorizonPool{}
+	seen := make(map[string]struct{})
+	for _, u := range urls {
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+
+		e := &horizonEndpoint{url: u, healthy: true}
+		e.client = &horizonclient.Client{
+			HorizonURL: u,
+			HTTP: &endpointTransport{
+				endpoint: e,
+				client:   &http.Client{},
+			},
+		}
+		p.endpoints = append(p.endpoints, e)
+		horizonActiveEndpoint.WithLabelValues(u).Set(0)
+		horizonCircuitOpen.WithLabelValues(u).Set(0)
+	}
+
+	p.setActive(p.endpoints[0])
+
+	return p, nil
+}
+
+// Client returns a client for the best available endpoint
+func (p *HorizonPool) Client() *horizonclient.Client {
+	return p.selectEndpoint().client
+}
+
+// Active returns the url of the endpoint currently in use
+func (p *HorizonPool) Active() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.active.url
+}
+
+// Run checks the health of the endpoints until the context is canceled
+func (p *HorizonPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(horizonCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		p.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs a health check on all endpoints concurrently, and marks the
+// endpoints which are unreachable or lagging behind as unhealthy
+func (p *HorizonPool) check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *horizonEndpoint) {
+			defer wg.Done()
+			e.check(ctx)
+		}(e)
+	}
+	wg.Wait()
+
+	var latest int32
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.ledger > latest {
+			latest = e.ledger
+		}
+		e.mu.Unlock()
+	}
+
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.healthy && latest-e.ledger > horizonMaxLedgerLag {
+			log.Warn().
+				Str("endpoint", e.url).
+				Int32("ledger", e.ledger).
+				Int32("latest", latest).
+				Msg("horizon endpoint is lagging behind")
+			e.healthy = false
+		}
+		e.mu.Unlock()
+	}
+
+	p.selectEndpoint()
+}
+
+// selectEndpoint picks the endpoint to use and makes it active. The active
+// endpoint is kept as long as it is available, unless another available
+// endpoint is significantly faster. If no endpoint is available, the
+// active endpoint is kept.
+func (p *HorizonPool) selectEndpoint() *horizonEndpoint {
+	p.mu.RLock()
+	active := p.active
+	p.mu.RUnlock()
+
+	now := time.Now()
+	best := active
+	bestAvailable, bestLatency := active.available(now)
+	for _, e := range p.endpoints {
+		available, latency := e.available(now)
+		if !available {
+			continue
+		}
+
+		if !bestAvailable || latency+horizonLatencyMargin < bestLatency {
+			best, bestAvailable, bestLatency = e, available, latency
+		}
+	}
+
+	if best != active {
+		log.Info().
+			Str("from", active.url).
+			Str("to", best.url).
+			Msg("switching horizon endpoint")
+		p.setActive(best)
+	}
+
+	return best
+}
+
+func (p *HorizonPool) setActive(e *horizonEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.active != nil {
+		horizonActiveEndpoint.WithLabelValues(p.active.url).Set(0)
+	}
+	p.active = e
+	horizonActiveEndpoint.WithLabelValues(e.url).Set(1)
+}
+
+// available returns if the endpoint can be used, and its last measured latency.
+// An endpoint is available if it is healthy and its circuit is closed, or
+// open for longer than the cooldown so a request can test the endpoint again
+func (e *horizonEndpoint) available(now time.Time) (bool, time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.healthy {
+		return false, e.latency
+	}
+
+	if !e.openedAt.IsZero() && now.Sub(e.openedAt) < horizonBreakerCooldown {
+		return false, e.latency
+	}
+
+	return true, e.latency
+}
+
+func (e *horizonEndpoint) check(ctx context.Context) {
+	type result struct {
+		ledger int32
+		err    error
+	}
+
+	// the horizon client doesn't support contexts, so the check is abandoned
+	// rather than canceled when it takes too long
+	ch := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		root, err := e.client.Root()
+		ch <- result{ledger: root.HorizonSequence, err: err}
+	}()
+
+	var r result
+	select {
+	case r = <-ch:
+	case <-time.After(horizonCheckTimeout):
+		r.err = fmt.Errorf("health check timed out after %s", horizonCheckTimeout)
+	case <-ctx.Done():
+		return
+	}
+	latency := time.Since(start)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r.err != nil {
+		if e.healthy {
+			log.Warn().Err(r.err).Str("endpoint", e.url).Msg("horizon endpoint is unhealthy")
+		}
+		e.healthy = false
+		return
+	}
+
+	e.healthy = true
+	e.latency = latency
+	e.ledger = r.ledger
+	horizonLatency.WithLabelValues(e.url).Set(latency.Seconds())
+}
+
+// record updates the circuit breaker of the endpoint with the result of a request
+func (e *horizonEndpoint) record(failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !failed {
+		horizonRequests.WithLabelValues(e.url, "success").Inc()
+		if !e.openedAt.IsZero() {
+			log.Info().Str("endpoint", e.url).Msg("horizon endpoint recovered, closing circuit")
+		}
+		e.failures = 0
+		e.openedAt = time.Time{}
+		horizonCircuitOpen.WithLabelValues(e.url).Set(0)
+		return
+	}
+
+	horizonRequests.WithLabelValues(e.url, "error").Inc()
+	e.failures++
+	// a failure while the circuit is half open opens it again for a full cooldown
+	if e.failures >= horizonBreakerThreshold {
+		if e.openedAt.IsZero() {
+			log.Warn().Str("endpoint", e.url).Int("failures", e.failures).Msg("horizon endpoint keeps failing, opening circuit")
+		}
+		e.openedAt = time.Now()
+		horizonCircuitOpen.WithLabelValues(e.url).Set(1)
+	}
+}
+
+// Do implements the horizonclient.HTTP interface. Transport errors and server
+// side errors count as failures of the endpoint, other responses (like a
+// missing account or a failed transaction) mean the endpoint works fine.
+func (t *endpointTransport) Do(req *http.Request) (*http.Response, error) {
+	resp, err := t.client.Do(req)
+	t.endpoint.record(err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests)
+	return resp, err
+}
+
+// Get implements the horizonclient.HTTP interface
+func (t *endpointTransport) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.Do(req)
+}
+
+// PostForm implements the horizonclient.HTTP interface
+func (t *endpointTransport) PostForm(url string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return t.Do(req)
+}
+
+// defaultHorizonClient returns the client of the public horizon endpoint of the network
+func defaultHorizonClient(network string) (*horizonclient.Client, error) {
+	switch network {
+	case NetworkTest:
+		return horizonclient.DefaultTestNetClient, nil
+	case NetworkProduction:
+		return horizonclient.DefaultPublicNetClient, nil
+	default:
+		return nil, errors.New("network is not supported")
+	}
+}
@@ -0,0 +1,106 @@
+package stellar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testHorizon struct {
+	*httptest.Server
+	ledger int32
+	fail   int32
+}
+
+func newTestHorizon(ledger int32) *testHorizon {
+	h := &testHorizon{ledger: ledger}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&h.fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"history_latest_ledger": %d}`, atomic.LoadInt32(&h.ledger))
+	}))
+
+	return h
+}
+
+func TestHorizonURLs(t *testing.T) {
+	var urls HorizonURLs
+	require.NoError(t, urls.Set("https://a.example.com, https://b.example.com"))
+	require.NoError(t, urls.Set("https://c.example.com"))
+	assert.Equal(t, HorizonURLs{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, urls)
+
+	assert.Error(t, urls.Set("not a url"))
+}
+
+func TestHorizonPoolDefault(t *testing.T) {
+	p, err := NewHorizonPool(NetworkTest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, horizonclient.DefaultTestNetClient.HorizonURL, p.Active())
+
+	_, err = NewHorizonPool(NetworkDebug, nil)
+	assert.Error(t, err)
+}
+
+func TestHorizonPoolCircuitBreaker(t *testing.T) {
+	first := newTestHorizon(100)
+	defer first.Close()
+	second := newTestHorizon(100)
+	defer second.Close()
+
+	p, err := NewHorizonPool(NetworkTest, []string{first.URL, second.URL})
+	require.NoError(t, err)
+	assert.Equal(t, first.URL, p.Active())
+
+	atomic.StoreInt32(&first.fail, 1)
+	for i := 0; i < horizonBreakerThreshold; i++ {
+		assert.Equal(t, first.URL, p.Active())
+		_, err := p.Client().Root()
+		assert.Error(t, err)
+	}
+
+	// the circuit of the first endpoint is open now
+	_, err = p.Client().Root()
+	assert.NoError(t, err)
+	assert.Equal(t, second.URL, p.Active())
+
+	// once the cooldown passed, the first endpoint is available again
+	// but the active endpoint is kept since it is not slower
+	p.endpoints[0].mu.Lock()
+	p.endpoints[0].openedAt = time.Now().Add(-horizonBreakerCooldown)
+	p.endpoints[0].mu.Unlock()
+	assert.Equal(t, second.URL, p.Client().HorizonURL)
+}
+
+func TestHorizonPoolHealthCheck(t *testing.T) {
+	first := newTestHorizon(100)
+	defer first.Close()
+	second := newTestHorizon(100)
+	defer second.Close()
+
+	p, err := NewHorizonPool(NetworkTest, []string{first.URL, second.URL})
+	require.NoError(t, err)
+
+	p.check(context.Background())
+	assert.Equal(t, first.URL, p.Active())
+
+	// an endpoint lagging behind is not used
+	atomic.StoreInt32(&second.ledger, 100+horizonMaxLedgerLag+1)
+	p.check(context.Background())
+	assert.Equal(t, second.URL, p.Active())
+
+	// an unreachable endpoint is not used
+	atomic.StoreInt32(&first.ledger, 100+horizonMaxLedgerLag+1)
+	atomic.StoreInt32(&second.fail, 1)
+	p.check(context.Background())
+	assert.Equal(t, first.URL, p.Active())
+}
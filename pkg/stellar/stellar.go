@@ -46,11 +46,11 @@ type (
 	// stellarWallet is the foundation wallet
 	// Payments will be funded and fees will be taken with this wallet
 	stellarWallet struct {
-		keypair    *keypair.Full
-		network    string
-		assets     map[Asset]struct{}
-		signers    Signers
-		horizonURL string
+		keypair *keypair.Full
+		network string
+		assets  map[Asset]AssetInfo
+		signers Signers
+		horizon *HorizonPool
 	}
 
 	// BatchTransactionsInfo mapping between transaction sequence and operation indices for a specific memo text
@@ -61,6 +61,8 @@ type (
 	// Wallet interface
 	Wallet interface {
 		AssetFromCode(code string) (Asset, error)
+		AssetInfo(asset Asset) (AssetInfo, error)
+		EnsureTrustlines(encryptedSeed string) error
 		PrecisionDigits() int
 		PublicAddress() string
 		CreateAccount() (encSeed string, address string, err error)
@@ -108,22 +110,26 @@ var (
 
 // New stellar wallet from an optional seed. If no seed is given (i.e. empty string),
 // the wallet will panic on all actions which need to be signed, or otherwise require
-// a key to be loaded.
-func New(seed, network string, signers []string, horizonURL string) (Wallet, error) {
-	assets := mainnetAssets
+// a key to be loaded. If no assets are given, the wallet supports the default
+// mainnet assets. If no horizon pool is given, the default horizon endpoint of
+// the network is used.
+func New(seed, network string, signers []string, horizon *HorizonPool, supportedAssets []AssetInfo) (Wallet, error) {
+	assets, err := assetsMap(supportedAssets)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(signers) < 3 && seed != "" {
 		log.Warn().Msg("to enable escrow account recovery, provide at least 3 signers")
 	}
 
 	w := &stellarWallet{
-		network:    network,
-		assets:     assets,
-		signers:    signers,
-		horizonURL: horizonURL,
+		network: network,
+		assets:  assets,
+		signers: signers,
+		horizon: horizon,
 	}
 
-	var err error
 	if seed != "" {
 		w.keypair, err = keypair.ParseFull(seed)
 		if err != nil {
@@ -145,6 +151,15 @@ func (w *stellarWallet) AssetFromCode(code string) (Asset, error) {
 	return "", ErrAssetCodeNotSupported
 }
 
+// AssetInfo returns the configuration of an asset supported by the wallet
+func (w *stellarWallet) AssetInfo(asset Asset) (AssetInfo, error) {
+	info, ok := w.assets[asset]
+	if !ok {
+		return AssetInfo{}, ErrAssetCodeNotSupported
+	}
+	return info, nil
+}
+
 // PrecisionDigits of the underlying currencies on chain
 func (w *stellarWallet) PrecisionDigits() int {
 	return stellarPrecisionDigits
@@ -310,8 +325,16 @@ func (w *stellarWallet) setupEscrow(newKp *keypair.Full, sourceAccount hProtocol
 }
 
 func (w *stellarWallet) setupTrustline(sourceAccount hProtocol.Account) []txnbuild.Operation {
-	ops := make([]txnbuild.Operation, 0, len(w.assets))
+	assets := make([]Asset, 0, len(w.assets))
 	for asset := range w.assets {
+		assets = append(assets, asset)
+	}
+	return trustlineOperations(sourceAccount, assets)
+}
+
+func trustlineOperations(sourceAccount hProtocol.Account, assets []Asset) []txnbuild.Operation {
+	ops := make([]txnbuild.Operation, 0, len(assets))
+	for _, asset := range assets {
 		ops = append(ops, &txnbuild.ChangeTrust{
 			SourceAccount: &sourceAccount,
 			Line: txnbuild.CreditAsset{
@@ -323,6 +346,77 @@ func (w *stellarWallet) setupTrustline(sourceAccount hProtocol.Account) []txnbui
 	return ops
 }
 
+// missingTrustlines returns the supported assets for which the account has
+// no trustline yet
+func (w *stellarWallet) missingTrustlines(account hProtocol.Account) []Asset {
+	var missing []Asset
+	for asset := range w.assets {
+		found := false
+		for _, balance := range account.Balances {
+			if balance.Code == asset.Code() && balance.Issuer == asset.Issuer() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, asset)
+		}
+	}
+	return missing
+}
+
+// EnsureTrustlines adds the trustlines for supported assets which are missing
+// on an existing escrow account. This happens if an asset was added to the
+// wallet configuration after the account was created. The additional base
+// reserve required for every new trustline is funded by the foundation wallet.
+func (w *stellarWallet) EnsureTrustlines(encryptedSeed string) error {
+	keypair, err := w.keypairFromEncryptedSeed(encryptedSeed)
+	if err != nil {
+		return errors.Wrap(err, "could not get keypair from encrypted seed")
+	}
+
+	sourceAccount, err := w.GetAccountDetails(keypair.Address())
+	if err != nil {
+		return errors.Wrap(err, "failed to get escrow account")
+	}
+
+	missing := w.missingTrustlines(sourceAccount)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Info().
+		Str("address", keypair.Address()).
+		Int("trustlines", len(missing)).
+		Msg("adding missing trustlines to escrow account")
+
+	reserve := big.NewRat(int64(len(missing))*(stellarOneCoin/2), stellarPrecision)
+	operations := []txnbuild.Operation{
+		&txnbuild.Payment{
+			Destination: keypair.Address(),
+			Amount:      reserve.FloatString(stellarPrecisionDigits),
+			Asset:       txnbuild.NativeAsset{},
+		},
+	}
+	operations = append(operations, trustlineOperations(sourceAccount, missing)...)
+
+	tx := txnbuild.TransactionParams{
+		Operations: operations,
+		Timebounds: txnbuild.NewTimeout(300),
+	}
+
+	fundedTx, err := w.fundTransaction(&tx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fund transaction")
+	}
+
+	err = w.signAndSubmitTx(&keypair, fundedTx)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign and submit transaction")
+	}
+	return nil
+}
+
 func (w *stellarWallet) setupEscrowMultisig(sourceAccount hProtocol.Account) []txnbuild.Operation {
 	if len(w.signers) < 3 {
 		// not enough signers, don't add multisig
@@ -795,20 +889,15 @@ func (w *stellarWallet) keypairFromEncryptedSeed(seed string) (keypair.Full, err
 	return *kp, nil
 }
 
-// GetHorizonClient gets the horizon client based on the wallet's network
+// GetHorizonClient gets the horizon client of the best available endpoint of
+// the wallet's horizon pool, or of the default endpoint of the wallet's network
+// if the wallet has no pool
 func (w *stellarWallet) GetHorizonClient() (*horizonclient.Client, error) {
-	if w.horizonURL != "" {
-		return &horizonclient.Client{HorizonURL: w.horizonURL}, nil
+	if w.horizon != nil {
+		return w.horizon.Client(), nil
 	}
 
-	switch w.network {
-	case "testnet":
-		return horizonclient.DefaultTestNetClient, nil
-	case "production":
-		return horizonclient.DefaultPublicNetClient, nil
-	default:
-		return nil, errors.New("network is not supported")
-	}
+	return defaultHorizonClient(w.network)
 }
 
 // GetNetworkPassPhrase gets the Stellar network passphrase based on the wallet's network
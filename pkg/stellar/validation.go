@@ -11,14 +11,17 @@ import (
 
 // AddressValidator validates stellar address
 type AddressValidator struct {
-	network    string
-	asset      Asset
-	horizonURL string
+	network string
+	asset   Asset
+	horizon *HorizonPool
 }
 
-// NewAddressValidator creates an address validator instance
-func NewAddressValidator(network, assetCode, horizonURL string) (*AddressValidator, error) {
-	w, err := New("", network, nil, "")
+// NewAddressValidator creates an address validator instance. The asset code
+// must be one of the given supported assets, or of the default assets if none
+// are given. If no horizon pool is given, the default horizon endpoint of the
+// network is used.
+func NewAddressValidator(network, assetCode string, horizon *HorizonPool, assets []AssetInfo) (*AddressValidator, error) {
+	w, err := New("", network, nil, horizon, assets)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create wallet")
 	}
@@ -26,7 +29,7 @@ func NewAddressValidator(network, assetCode, horizonURL string) (*AddressValidat
 	if err != nil {
 		return nil, errors.Wrap(err, "could not load asset code")
 	}
-	return &AddressValidator{network: network, asset: asset, horizonURL: horizonURL}, nil
+	return &AddressValidator{network: network, asset: asset, horizon: horizon}, nil
 }
 
 // Valid validates a stellar address, and only return nil if address is valid
@@ -71,16 +74,9 @@ func (a *AddressValidator) getAccountDetails(address string) (account hProtocol.
 }
 
 func (a *AddressValidator) getHorizonClient() (*horizonclient.Client, error) {
-	if a.horizonURL != "" {
-		return &horizonclient.Client{HorizonURL: a.horizonURL}, nil
+	if a.horizon != nil {
+		return a.horizon.Client(), nil
 	}
 
-	switch a.network {
-	case NetworkTest:
-		return horizonclient.DefaultTestNetClient, nil
-	case NetworkProduction:
-		return horizonclient.DefaultPublicNetClient, nil
-	default:
-		return nil, errors.New("network is not supported")
-	}
+	return defaultHorizonClient(a.network)
 }
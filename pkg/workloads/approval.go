@@ -0,0 +1,264 @@
+package workloads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	phonebook "github.com/threefoldtech/tfexplorer/pkg/phonebook/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// approvalCheckInterval is how often the workloads waiting for approval are
+// checked for timeout
+const approvalCheckInterval = time.Minute
+
+// WorkloadApprovalRequest approves or rejects a workload waiting for the
+// farmer of its node
+type WorkloadApprovalRequest struct {
+	Approved bool `json:"approved"`
+	// Signature is the farmer signature of the workload signing challenge +
+	// "approve" + farmer tid, it is required to approve the workload
+	Signature string `json:"signature"`
+	// Reason is recorded in the workload history when it is rejected
+	Reason string `json:"reason"`
+}
+
+// nodeFarmPolicy returns the farm of a node and its approval policy. Nodes
+// which are not registered in the directory, like gateways, have no farm and
+// their workloads never need approval.
+func nodeFarmPolicy(ctx context.Context, db *mongo.Database, nodeID string) (directory.Farm, directory.FarmPolicy, error) {
+	var nodeFilter directory.NodeFilter
+	nodeFilter = nodeFilter.WithNodeID(nodeID)
+	node, err := nodeFilter.Get(ctx, db, false)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return directory.Farm{}, directory.FarmPolicy{}, nil
+	} else if err != nil {
+		return directory.Farm{}, directory.FarmPolicy{}, errors.Wrap(err, "failed to retrieve node")
+	}
+
+	var farmFilter directory.FarmFilter
+	farmFilter = farmFilter.WithID(schema.ID(node.FarmId))
+	farm, err := farmFilter.Get(ctx, db)
+	if err != nil {
+		return directory.Farm{}, directory.FarmPolicy{}, errors.Wrap(err, "failed to retrieve farm")
+	}
+
+	policy, err := directory.FarmPolicyGet(ctx, db, farm.ID)
+	return farm, policy, err
+}
+
+// toDeployOrApprove schedules a new workload to deploy, unless the farm of its
+// node requires the farmer to approve it first
+func (a *API) toDeployOrApprove(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, reason string) error {
+	_, policy, err := nodeFarmPolicy(ctx, db, workload.GetNodeID())
+	if err != nil {
+		return err
+	}
+
+	if policy.RequiresApproval(workload.GetCustomerTid(), workload.GetWorkloadType()) {
+		workload.SetNextAction(types.Approve)
+		return errors.Wrap(
+			types.WorkloadSetNextAction(ctx, db, workload.GetID(), types.Approve, types.ReasonApprovalRequired),
+			"failed to set workload to APPROVE state",
+		)
+	}
+
+	return types.WorkloadToDeploy(ctx, db, workload, reason)
+}
+
+// rejectWorkload invalidates a workload waiting for approval, and releases
+// what was reserved for it
+func (a *API) rejectWorkload(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, reason string) error {
+	if err := types.WorkloadReject(ctx, db, workload, reason); err != nil {
+		return err
+	}
+
+	if workload.GetWorkloadType() == generated.WorkloadTypePublicIP {
+		if err := a.setFarmIPFree(ctx, db, workload); err != nil {
+			log.Error().Err(err).Int64("workload", int64(workload.GetID())).Msg("failed to release public ip of rejected workload")
+		}
+	}
+
+	if workload.GetMigratedFrom() != 0 {
+		if err := a.finishMigration(ctx, db, workload, generated.ResultStateError); err != nil {
+			log.Error().Err(err).Int64("workload", int64(workload.GetID())).Msg("failed to cancel migration of rejected workload")
+		}
+	}
+
+	return nil
+}
+
+// approveWorkload lets the farmer of the node of a workload waiting for
+// approval sign it so it is deployed, or reject it
+func (a *API) approveWorkload(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	var request WorkloadApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id)
+
+	db := mw.Database(r)
+	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
+	if err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	if !workload.IsAny(types.Approve) {
+		return nil, mw.Conflict(fmt.Errorf("workload is in state '%s', it is not waiting for approval", workload.GetNextAction().String()))
+	}
+
+	farm, _, err := nodeFarmPolicy(r.Context(), db, workload.GetNodeID())
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if farm.ID == 0 || farm.ThreebotID != requestUserID {
+		return nil, mw.UnAuthorized(fmt.Errorf("request user identity is not the farmer of the workload node"))
+	}
+
+	if !request.Approved {
+		reason := types.ReasonRejected
+		if request.Reason != "" {
+			reason = fmt.Sprintf("%s: %s", reason, request.Reason)
+		}
+
+		if err := a.rejectWorkload(r.Context(), db, workload, reason); errors.Is(err, types.ErrApprovalNotPending) {
+			return nil, mw.Conflict(err)
+		} else if err != nil {
+			return nil, mw.Error(err)
+		}
+
+		return nil, mw.Ok()
+	}
+
+	user, err := phonebook.UserFilter{}.WithID(schema.ID(requestUserID)).Get(r.Context(), db)
+	if err != nil {
+		return nil, mw.NotFound(errors.Wrap(err, "farmer id not found")).WithCode(mw.CodeUserNotFound)
+	}
+
+	signature := generated.SigningSignature{
+		Tid:       requestUserID,
+		Signature: request.Signature,
+		Epoch:     schema.Date{Time: time.Now()},
+	}
+
+	if err := workload.SignatureApprovalRequestVerify(user.Pubkey, signature); err != nil {
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify farmer signature")).WithCode(mw.CodeSignatureInvalid)
+	}
+
+	// the pool may have been used by other workloads while this one was
+	// waiting for the farmer
+	allowed, err := a.capacityPlanner.HasCapacity(workload, minCapacitySeconds)
+	if err != nil {
+		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+			return nil, mw.Error(errors.New("pool does not exist"))
+		}
+		log.Error().Err(err).Msg("failed to load workload capacity pool")
+		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+	}
+
+	if !allowed {
+		if err := a.rejectWorkload(r.Context(), db, workload, types.ReasonPoolEmpty); err != nil && !errors.Is(err, types.ErrApprovalNotPending) {
+			return nil, mw.Error(fmt.Errorf("failed to marked the workload as invalid:%w", err))
+		}
+		return nil, mw.PaymentRequired(errors.New("pool needs additional capacity to support this workload")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	if err := types.WorkloadApprove(r.Context(), db, workload, signature); errors.Is(err, types.ErrApprovalNotPending) {
+		return nil, mw.Conflict(err)
+	} else if err != nil {
+		log.Error().Err(err).Msg("failed to schedule the approved workload to deploy")
+		return nil, mw.Error(errors.New("could not schedule approved workload to deploy"))
+	}
+
+	if workload.HasExpiration() {
+		a.expirer.Reschedule()
+	}
+
+	return nil, mw.Ok()
+}
+
+// expireApprovals invalidates the workloads the farmer did not approve or
+// reject within the approval timeout of the farm
+func (a *API) expireApprovals(ctx context.Context, db *mongo.Database) error {
+	var filter types.WorkloadFilter
+	filter = filter.WithNextAction(types.Approve)
+
+	workloads, err := filter.Find(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "failed to list workloads waiting for approval")
+	}
+
+	// the policy is loaded once per node
+	policies := make(map[string]directory.FarmPolicy)
+	for _, workload := range workloads {
+		policy, ok := policies[workload.GetNodeID()]
+		if !ok {
+			_, policy, err = nodeFarmPolicy(ctx, db, workload.GetNodeID())
+			if err != nil {
+				log.Error().Err(err).Int64("workload", int64(workload.GetID())).Msg("failed to load farm policy")
+				continue
+			}
+			policies[workload.GetNodeID()] = policy
+		}
+
+		if time.Since(workload.GetEpoch().Time) < policy.Timeout() {
+			continue
+		}
+
+		err := a.rejectWorkload(ctx, db, workload, types.ReasonApprovalTimeout)
+		if err != nil && !errors.Is(err, types.ErrApprovalNotPending) {
+			log.Error().Err(err).Int64("workload", int64(workload.GetID())).Msg("failed to invalidate workload waiting for approval")
+		}
+	}
+
+	return nil
+}
+
+// runApprovalTimeouts checks the workloads waiting for approval for timeout
+// until the context is canceled
+func (a *API) runApprovalTimeouts(ctx context.Context, db *mongo.Database) {
+	ticker := time.NewTicker(approvalCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("context is done, stopping workload approval timeouts")
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.expireApprovals(ctx, db); err != nil {
+			log.Error().Err(err).Msg("failed to expire workloads waiting for approval")
+		}
+	}
+}
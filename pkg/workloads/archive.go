@@ -0,0 +1,211 @@
+package workloads
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// archiveInterval is how often the deleted workloads are archived
+	archiveInterval = time.Hour
+	// archiveBatchSize is the number of workloads archived at once
+	archiveBatchSize = 500
+)
+
+// Archiver moves the workloads which are deleted for longer than the
+// retention period out of the workload collection, so the nodes polling for
+// workloads and the user listings do not scan past them anymore. If an export
+// directory is set, every run also writes the archived workloads to a gzip
+// compressed JSON lines file in that directory.
+type Archiver struct {
+	db        *mongo.Database
+	retention time.Duration
+	exportDir string
+}
+
+// NewArchiver creates a new Archiver, exportDir can be empty
+func NewArchiver(db *mongo.Database, retention time.Duration, exportDir string) *Archiver {
+	return &Archiver{
+		db:        db,
+		retention: retention,
+		exportDir: exportDir,
+	}
+}
+
+// Run archives the deleted workloads until the context is canceled
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := a.Archive(ctx, time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to archive deleted workloads")
+		}
+		if count > 0 {
+			log.Info().Int("count", count).Msg("deleted workloads archived")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("context is done, stopping workload archiver")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Archive archives the workloads deleted before now minus the retention
+// period, and returns the number of archived workloads
+func (a *Archiver) Archive(ctx context.Context, now time.Time) (int, error) {
+	var filter types.WorkloadFilter
+	filter = filter.WithDeletedBefore(now.Add(-a.retention))
+
+	var export *archiveExport
+	defer func() {
+		if export == nil {
+			return
+		}
+		if err := export.Close(); err != nil {
+			log.Error().Err(err).Str("file", export.path).Msg("failed to close archive export")
+		}
+	}()
+
+	count := 0
+	var next schema.ID
+	for {
+		found, err := filter.WithIDGE(next).Find(ctx, a.db, options.Find().
+			SetSort(bson.M{"_id": 1}).
+			SetLimit(archiveBatchSize))
+		if err != nil {
+			return count, errors.Wrap(err, "failed to list deleted workloads")
+		}
+
+		if len(found) == 0 {
+			return count, nil
+		}
+		next = found[len(found)-1].GetID() + 1
+
+		workloads, err := a.archivable(ctx, found)
+		if err != nil {
+			return count, err
+		}
+
+		if a.exportDir != "" {
+			if export == nil {
+				export, err = newArchiveExport(a.exportDir, now)
+				if err != nil {
+					return count, err
+				}
+			}
+
+			// the workloads are only removed once they are exported
+			if err := export.Write(workloads); err != nil {
+				return count, err
+			}
+		}
+
+		for _, workload := range workloads {
+			if err := types.WorkloadArchive(ctx, a.db, workload); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(found) < archiveBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// archivable filters out the deleted public ip workloads whose ip is held,
+// they are still billed on their pool until the ip is released
+func (a *Archiver) archivable(ctx context.Context, workloads []types.WorkloaderType) ([]types.WorkloaderType, error) {
+	archivable := workloads[:0]
+	for _, workload := range workloads {
+		if workload.GetWorkloadType() == generated.WorkloadTypePublicIP {
+			var filter types.IPLeaseFilter
+			filter = filter.WithWorkloadID(workload.GetID()).WithState(types.IPLeaseHeld)
+			held, err := filter.Count(ctx, a.db)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to check for held ip")
+			}
+			if held != 0 {
+				continue
+			}
+		}
+		archivable = append(archivable, workload)
+	}
+
+	return archivable, nil
+}
+
+// archiveExport writes archived workloads as gzip compressed JSON lines
+type archiveExport struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+}
+
+func newArchiveExport(dir string, now time.Time) (*archiveExport, error) {
+	path := filepath.Join(dir, fmt.Sprintf("workloads-%d.jsonl.gz", now.Unix()))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive export")
+	}
+
+	return &archiveExport{
+		path: path,
+		file: file,
+		gz:   gzip.NewWriter(file),
+	}, nil
+}
+
+// Write writes the workloads one per line, and flushes them to the file
+func (e *archiveExport) Write(workloads []types.WorkloaderType) error {
+	if err := writeJSONLines(e.gz, workloads); err != nil {
+		return errors.Wrapf(err, "failed to export archived workloads to '%s'", e.path)
+	}
+
+	if err := e.gz.Flush(); err != nil {
+		return errors.Wrapf(err, "failed to export archived workloads to '%s'", e.path)
+	}
+
+	return errors.Wrapf(e.file.Sync(), "failed to export archived workloads to '%s'", e.path)
+}
+
+// Close finishes the gzip stream and closes the file
+func (e *archiveExport) Close() error {
+	if err := e.gz.Close(); err != nil {
+		e.file.Close()
+		return err
+	}
+
+	return e.file.Close()
+}
+
+func writeJSONLines(w io.Writer, workloads []types.WorkloaderType) error {
+	enc := json.NewEncoder(w)
+	for _, workload := range workloads {
+		if err := enc.Encode(workload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
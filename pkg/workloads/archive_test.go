@@ -0,0 +1,57 @@
+package workloads
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+func TestArchiveExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	volume := func(id schema.ID) types.WorkloaderType {
+		v := &workloads.Volume{}
+		v.ID = id
+		v.WorkloadType = workloads.WorkloadTypeVolume
+		v.NextAction = workloads.NextActionDeleted
+		return types.WorkloaderType{Workloader: v}
+	}
+
+	export, err := newArchiveExport(dir, time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.NoError(t, export.Write([]types.WorkloaderType{volume(1)}))
+	require.NoError(t, export.Write([]types.WorkloaderType{volume(2)}))
+	require.NoError(t, export.Close())
+
+	file, err := os.Open(export.path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	var ids []schema.ID
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var w types.WorkloaderType
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &w))
+		assert.Equal(t, workloads.WorkloadTypeVolume, w.GetWorkloadType())
+		ids = append(ids, w.GetID())
+	}
+	require.NoError(t, scanner.Err())
+
+	assert.Equal(t, []schema.ID{1, 2}, ids)
+}
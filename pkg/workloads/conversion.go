@@ -49,31 +49,43 @@ func (a *API) getConversionList(r *http.Request) (interface{}, mw.Response) {
 		return cd.Workloads, mw.Ok()
 	}
 
+	workloaders, err := a.conversionList(r.Context(), db, userTid)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return workloaders, mw.Ok()
+}
+
+// conversionList generates the workloads of the deployed legacy reservations
+// of a user, and creates a pool per farm for them. The list is saved so it is
+// only generated once.
+func (a *API) conversionList(ctx context.Context, db *mongo.Database, userTid int64) ([]workloads.Workloader, error) {
 	resPerFarm := map[int64][]workloads.Workloader{}
 
 	// get all reservations for a user
-	reservations, err := a.reservationsForUser(r.Context(), db, userTid)
+	reservations, err := a.reservationsForUser(ctx, db, userTid)
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, err
 	}
 
 	workloaders, err := loadWorkloaders(reservations)
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, err
 	}
 
 	networks, err := loadNetworks(reservations)
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, err
 	}
 
 	workloaders = append(workloaders, networks...)
 
 	for _, w := range workloaders {
 		nodeID := w.GetNodeID()
-		farmID, err := farmForNodeID(r.Context(), db, nodeID)
+		farmID, err := farmForNodeID(ctx, db, nodeID)
 		if err != nil {
-			return nil, mw.Error(err)
+			return nil, err
 		}
 		resPerFarm[farmID] = append(resPerFarm[farmID], w)
 
@@ -89,15 +101,15 @@ func (a *API) getConversionList(r *http.Request) (interface{}, mw.Response) {
 	}
 
 	for farmID := range resPerFarm {
-		nodeIDs, err := farmNodeIDs(r.Context(), db, farmID)
+		nodeIDs, err := farmNodeIDs(ctx, db, farmID)
 		if err != nil {
-			return nil, mw.Error(err)
+			return nil, err
 		}
 		// create pool
 		pool := capacitytypes.NewPool(0, userTid, 0, nodeIDs)
-		pool, err = capacitytypes.CapacityPoolCreate(r.Context(), db, pool)
+		pool, err = capacitytypes.CapacityPoolCreate(ctx, db, pool)
 		if err != nil {
-			return nil, mw.Error(err)
+			return nil, err
 		}
 
 		// set pool id on the workloads
@@ -112,11 +124,11 @@ func (a *API) getConversionList(r *http.Request) (interface{}, mw.Response) {
 	for _, wl := range workloaders {
 		wt = append(wt, types.WorkloaderType{Workloader: wl})
 	}
-	if err = types.SaveUserConversion(r.Context(), db, schema.ID(userTid), wt); err != nil {
-		return nil, mw.Error(err)
+	if err = types.SaveUserConversion(ctx, db, schema.ID(userTid), wt); err != nil {
+		return nil, err
 	}
 
-	return workloaders, mw.Ok()
+	return workloaders, nil
 }
 
 func (a *API) postConversionList(r *http.Request) (interface{}, mw.Response) {
@@ -206,87 +218,136 @@ func (a *API) postConversionList(r *http.Request) (interface{}, mw.Response) {
 		workloaders[i].SetResult(savedResult)
 	}
 
-	// calculate how much to add per pool
-	poolCU := make(map[int64]float64)
-	poolSU := make(map[int64]float64)
-	poolIPU := make(map[int64]float64)
+	if _, err := a.convert(r.Context(), db, workloaders); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if err = types.SetUserConversionSucceeded(r.Context(), db, schema.ID(userTid)); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return nil, nil
+}
+
+// conversionReservationID returns the legacy reservation a converted workload
+// comes from, it is the first part of the workload reference
+func conversionReservationID(w types.WorkloaderType) (schema.ID, error) {
+	ss := strings.Split(w.GetReference(), "-")
+	id, err := strconv.ParseInt(ss[0], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid conversion reference '%s'", w.GetReference())
+	}
+
+	return schema.ID(id), nil
+}
+
+// convert creates the converted workloads, adds the capacity left in their
+// legacy reservations to their pools, and marks the reservations as migrated
+// so they are never sent to the nodes anymore. Workloads which are already
+// converted are skipped, so a conversion which failed half way can be run
+// again. It returns the number of created workloads.
+func (a *API) convert(ctx context.Context, db *mongo.Database, workloaders []types.WorkloaderType) (int, error) {
+	pending := make([]types.WorkloaderType, 0, len(workloaders))
 	for _, wl := range workloaders {
-		ss := strings.Split(wl.GetReference(), "-")
-		reservationID, err := a.parseID(ss[0])
+		reservationID, err := conversionReservationID(wl)
 		if err != nil {
-			return nil, mw.Error(err)
+			return 0, err
 		}
-		reservation, err := types.ReservationFilter{}.WithID(reservationID).Get(r.Context(), db)
+		wl.SetConvertedFrom(reservationID)
+
+		var filter types.WorkloadFilter
+		// the network resources of a network share the same reference
+		filter = filter.WithCustomerID(wl.GetCustomerTid()).
+			WithReference(wl.GetReference()).
+			WithNodeID(wl.GetNodeID())
+		count, err := filter.Count(ctx, db)
 		if err != nil {
-			return nil, mw.Error(err)
+			return 0, err
 		}
-		if reservation.Expired() {
-			// should not happen
+		if count != 0 {
 			continue
 		}
-		secondsLeft := math.Floor(time.Until(reservation.DataReservation.ExpirationReservation.Time).Seconds())
-		rsu, err := wl.GetRSU()
-		if err != nil {
-			return nil, mw.BadRequest(err)
-		}
-		cu, su, ipu := capacity.CloudUnitsFromResourceUnits(rsu)
-		poolID := wl.GetPoolID()
-
-		log.Info().Msgf("pool %d cu %v su %v ipu %v %+v", poolID, cu, su, ipu, wl.GetWorkloadType().String())
 
-		if cu > 0 {
-			poolCU[poolID] = poolCU[poolID] + cu*secondsLeft
-		}
-		if su > 0 {
-			poolSU[poolID] = poolSU[poolID] + su*secondsLeft
-		}
-		if ipu > 0 {
-			poolIPU[poolID] = poolIPU[poolID] + ipu*secondsLeft
-		}
+		pending = append(pending, wl)
 	}
 
-	// this is fine since these pools should not be used yet
-	// TODO is it really though
-	for poolID := range poolCU {
-		pool, err := capacitytypes.GetPool(r.Context(), db, schema.ID(poolID))
+	// all reservations are as created and have valid signatures. The capacity
+	// left in the reservation of a workload is only added to its pool once the
+	// workload is created, and the workload is removed again if the pool can't
+	// be credited, so a rerun never credits a pool twice.
+	for i := range pending {
+		cu, su, ipu, err := conversionCapacity(ctx, db, pending[i])
 		if err != nil {
-			return nil, mw.Error(err)
+			return i, err
 		}
-		pool.AddCapacity(poolCU[poolID], poolSU[poolID], poolIPU[poolID])
-		if err = capacitytypes.UpdatePool(r.Context(), db, pool); err != nil {
-			return nil, mw.Error(err)
+
+		pending[i].SetID(0) //force to create a new workload ID
+		id, err := types.WorkloadCreate(ctx, db, pending[i])
+		if err != nil {
+			return i, err
 		}
-	}
 
-	// all reservations are as created and have valid signatures
-	for i := range workloaders {
-		workloaders[i].SetID(0) //force to create a new workload ID
-		if _, err = types.WorkloadCreate(r.Context(), db, workloaders[i]); err != nil {
-			return nil, mw.Error(err)
+		if err := creditPool(ctx, db, pending[i].GetPoolID(), cu, su, ipu); err != nil {
+			if err := types.WorkloadsRemove(ctx, db, []schema.ID{id}); err != nil {
+				log.Error().Err(err).Int64("workload", int64(id)).Msg("failed to remove converted workload of an uncredited pool")
+			}
+			return i, err
 		}
-		if workloaders[i].GetResult().State == workloads.ResultStateOK {
-			if err := a.capacityPlanner.AddUsedCapacity(workloaders[i]); err != nil {
-				return nil, mw.Error(err)
+
+		if pending[i].GetResult().State == workloads.ResultStateOK {
+			if err := a.capacityPlanner.AddUsedCapacity(pending[i]); err != nil {
+				return i + 1, err
 			}
 		}
 
 		// Marked the migrated reservation as migrated so it is never send to the node anymore
-		ss := strings.Split(workloaders[i].GetReference(), "-")
-		rid, err := strconv.Atoi(ss[0])
-		if err != nil {
-			return nil, mw.Error(err)
+		if err := types.ReservationSetNextAction(ctx, db, pending[i].GetConvertedFrom(), workloads.NextActionMigrated); err != nil {
+			return i + 1, err
 		}
+	}
 
-		if err := types.ReservationSetNextAction(r.Context(), db, schema.ID(rid), workloads.NextActionMigrated); err != nil {
-			return nil, mw.Error(err)
-		}
+	return len(pending), nil
+}
+
+// conversionCapacity returns the cloud units seconds left in the legacy
+// reservation of a converted workload
+func conversionCapacity(ctx context.Context, db *mongo.Database, wl types.WorkloaderType) (cu, su, ipu float64, err error) {
+	reservation, err := types.ReservationFilter{}.WithID(wl.GetConvertedFrom()).Get(ctx, db)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if reservation.Expired() {
+		// should not happen
+		return 0, 0, 0, nil
 	}
 
-	if err = types.SetUserConversionSucceeded(r.Context(), db, schema.ID(userTid)); err != nil {
-		return nil, mw.Error(err)
+	secondsLeft := math.Floor(time.Until(reservation.DataReservation.ExpirationReservation.Time).Seconds())
+	rsu, err := wl.GetRSU()
+	if err != nil {
+		return 0, 0, 0, err
 	}
+	cu, su, ipu = capacity.CloudUnitsFromResourceUnits(rsu)
 
-	return nil, nil
+	log.Info().Msgf("pool %d cu %v su %v ipu %v %+v", wl.GetPoolID(), cu, su, ipu, wl.GetWorkloadType().String())
+
+	return cu * secondsLeft, su * secondsLeft, ipu * secondsLeft, nil
+}
+
+// creditPool adds the capacity to the pool
+func creditPool(ctx context.Context, db *mongo.Database, poolID int64, cu, su, ipu float64) error {
+	if cu <= 0 && su <= 0 && ipu <= 0 {
+		return nil
+	}
+
+	// this is fine since these pools should not be used yet
+	// TODO is it really though
+	pool, err := capacitytypes.GetPool(ctx, db, schema.ID(poolID))
+	if err != nil {
+		return err
+	}
+	pool.AddCapacity(math.Max(cu, 0), math.Max(su, 0), math.Max(ipu, 0))
+
+	return capacitytypes.UpdatePool(ctx, db, pool)
 }
 
 func (a *API) reservationsForUser(ctx context.Context, db *mongo.Database, userTid int64) ([]types.Reservation, error) {
@@ -326,6 +387,9 @@ func (a *API) reservationsForUser(ctx context.Context, db *mongo.Database, userT
 func loadWorkloaders(res []types.Reservation) ([]workloads.Workloader, error) {
 	workloaders := make([]workloads.Workloader, 0, len(res))
 	for _, r := range res {
+		if r.NextAction != workloads.NextActionDeploy {
+			continue
+		}
 		for _, w := range r.Workloads("") {
 			if w.GetWorkloadType() == workloads.WorkloadTypeNetwork ||
 				w.GetWorkloadType() == workloads.WorkloadTypeNetworkResource {
@@ -429,3 +493,146 @@ func farmNodeIDs(ctx context.Context, db *mongo.Database, farmID int64) ([]strin
 
 	return nodesID, nil
 }
+
+// errConversionDone is returned when the reservations of a user are already
+// converted
+var errConversionDone = errors.New("reservations already converted")
+
+// ConversionReport is the outcome of a server side conversion of the legacy
+// reservations
+type ConversionReport struct {
+	// Users is the number of customers whose reservations were converted
+	Users int `json:"users"`
+	// Workloads is the number of created workloads
+	Workloads int `json:"workloads"`
+	// Skipped is the number of customers who already converted their reservations
+	Skipped int `json:"skipped"`
+	// Failed is the number of customers whose conversion failed, it can be run again
+	Failed int `json:"failed"`
+}
+
+// ConvertReservations converts the deployed legacy reservations of all the
+// customers who did not convert them yet into new style workloads. Since the
+// customers did not sign these workloads they are flagged as explorer
+// converted. The planner must be running.
+func ConvertReservations(ctx context.Context, db *mongo.Database, planner capacity.Planner) (ConversionReport, error) {
+	var report ConversionReport
+	a := API{capacityPlanner: planner, legacy: true}
+
+	customers, err := deployedCustomers(ctx, db)
+	if err != nil {
+		return report, err
+	}
+
+	for _, customer := range customers {
+		userTid, ok := customerID(customer)
+		if !ok {
+			log.Error().Msgf("unexpected customer id '%v' in reservations", customer)
+			report.Failed++
+			continue
+		}
+
+		created, err := a.convertUser(ctx, db, userTid)
+		report.Workloads += created
+		if errors.Is(err, errConversionDone) {
+			report.Skipped++
+			continue
+		} else if err != nil {
+			log.Error().Err(err).Int64("customer", userTid).Msg("failed to convert reservations")
+			report.Failed++
+			continue
+		}
+
+		log.Info().Int64("customer", userTid).Int("workloads", created).Msg("reservations converted")
+		report.Users++
+	}
+
+	return report, nil
+}
+
+// UnconvertedCustomers lists the customers who still have deployed legacy
+// reservations which were not converted into workloads
+func UnconvertedCustomers(ctx context.Context, db *mongo.Database) ([]int64, error) {
+	customers, err := deployedCustomers(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []int64
+	for _, customer := range customers {
+		userTid, ok := customerID(customer)
+		if !ok {
+			return nil, fmt.Errorf("unexpected customer id '%v' in reservations", customer)
+		}
+
+		cd, err := types.GetUserConversion(ctx, db, schema.ID(userTid))
+		if errors.Is(err, types.ErrNoConversion) || (err == nil && !cd.Converted) {
+			pending = append(pending, userTid)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
+
+// deployedCustomers lists the customers with deployed legacy reservations
+func deployedCustomers(ctx context.Context, db *mongo.Database) ([]interface{}, error) {
+	var filter types.ReservationFilter
+	filter = filter.WithNextAction(types.Deploy)
+	customers, err := db.Collection(types.ReservationCollection).Distinct(ctx, "customer_tid", filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list customers with deployed reservations")
+	}
+
+	return customers, nil
+}
+
+func customerID(customer interface{}) (int64, bool) {
+	switch tid := customer.(type) {
+	case int64:
+		return tid, true
+	case int32:
+		return int64(tid), true
+	}
+
+	return 0, false
+}
+
+// convertUser converts the deployed reservations of a user without their
+// signature. If the user already fetched the conversion list, the same
+// workloads and pools are used.
+func (a *API) convertUser(ctx context.Context, db *mongo.Database, userTid int64) (int, error) {
+	cd, err := types.GetUserConversion(ctx, db, schema.ID(userTid))
+	if err != nil && !errors.Is(err, types.ErrNoConversion) {
+		return 0, err
+	}
+
+	if err == nil && cd.Converted {
+		return 0, errConversionDone
+	}
+
+	workloaders := cd.Workloads
+	if errors.Is(err, types.ErrNoConversion) {
+		list, err := a.conversionList(ctx, db, userTid)
+		if err != nil {
+			return 0, err
+		}
+
+		workloaders = make([]types.WorkloaderType, 0, len(list))
+		for _, w := range list {
+			workloaders = append(workloaders, types.WorkloaderType{Workloader: w})
+		}
+	}
+
+	for i := range workloaders {
+		workloaders[i].SetExplorerConverted(true)
+	}
+
+	created, err := a.convert(ctx, db, workloaders)
+	if err != nil {
+		return created, err
+	}
+
+	return created, types.SetUserConversionSucceeded(ctx, db, schema.ID(userTid))
+}
@@ -0,0 +1,110 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+func TestLoadWorkloaders(t *testing.T) {
+	reservation := func(id schema.ID, action workloads.NextActionEnum) types.Reservation {
+		volume := workloads.Volume{}
+		volume.WorkloadId = 1
+		volume.NodeId = "node"
+
+		return types.Reservation{
+			ID:         id,
+			NextAction: action,
+			DataReservation: workloads.ReservationData{
+				Volumes: []workloads.Volume{volume},
+			},
+			Results: []workloads.Result{{
+				WorkloadId: fmt.Sprintf("%d-1", id),
+				State:      workloads.ResultStateOK,
+				NodeId:     "node",
+			}},
+		}
+	}
+
+	failed := reservation(3, workloads.NextActionDeploy)
+	failed.Results[0].State = workloads.ResultStateError
+
+	workloaders, err := loadWorkloaders([]types.Reservation{
+		reservation(1, workloads.NextActionDeploy),
+		reservation(2, workloads.NextActionDeleted),
+		failed,
+	})
+	require.NoError(t, err)
+
+	// only the deployed workloads of the deployed reservations are converted
+	require.Len(t, workloaders, 1)
+	assert.Equal(t, "1-1", workloaders[0].GetReference())
+
+	reservationID, err := conversionReservationID(types.WorkloaderType{Workloader: workloaders[0]})
+	require.NoError(t, err)
+	assert.Equal(t, schema.ID(1), reservationID)
+}
+
+func TestConversionReservationID(t *testing.T) {
+	volume := &workloads.Volume{}
+	volume.Reference = "invalid"
+
+	_, err := conversionReservationID(types.WorkloaderType{Workloader: volume})
+	assert.Error(t, err)
+}
+
+func TestConvertCreditsCreatedWorkloads(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("workload not created", func(mt *mtest.T) {
+		volume := workloads.Volume{Size: 10, Type: workloads.VolumeTypeSSD}
+		volume.WorkloadId = 1
+		volume.NodeId = "node"
+		volume.PoolId = 3
+		volume.Reference = "12-1"
+		volume.WorkloadType = workloads.WorkloadTypeVolume
+
+		reservation := types.Reservation{
+			ID: 12,
+			DataReservation: workloads.ReservationData{
+				ExpirationReservation: schema.Date{Time: time.Now().Add(time.Hour)},
+			},
+		}
+
+		mt.AddMockResponses(
+			// the workload is not converted yet
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.WorkloadCollection, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(0)}}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.ReservationCollection, mtest.FirstBatch, mockDocument(mt, reservation)),
+			// the id of the workload
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "sequence", Value: int64(20)}}}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "insert failed"}),
+		)
+
+		var a API
+		created, err := a.convert(context.Background(), mt.DB, []types.WorkloaderType{{Workloader: &volume}})
+		require.Error(mt, err)
+		assert.Equal(mt, 0, created)
+
+		// the pool is only credited once the workload exists, so the next
+		// run credits it once
+		var commands []string
+		for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+			collection, _ := started.Command.Index(0).Value().StringValueOK()
+			assert.NotEqual(mt, capacitytypes.CapacityPoolCollection, collection, started.CommandName)
+			commands = append(commands, started.CommandName)
+		}
+		assert.Equal(mt, []string{"aggregate", "find", "findAndModify", "insert"}, commands)
+	})
+}
@@ -0,0 +1,288 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// activeActions are the next actions of the workloads which can be depended on
+var activeActions = []generated.NextActionEnum{types.Create, types.Sign, types.Pay, types.Approve, types.Deploy}
+
+// DependencyError is a reference of a workload to another workload which can
+// not be resolved
+type DependencyError struct {
+	// Field is the json path of the reference in the workload
+	Field     string `json:"field"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+// DependencyErrors are all the unresolved references of a workload, they are
+// returned as the details of the error response
+type DependencyErrors []DependencyError
+
+func (e DependencyErrors) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, dep := range e {
+		problems = append(problems, fmt.Sprintf("%s '%s': %s", dep.Field, dep.Reference, dep.Reason))
+	}
+
+	return fmt.Sprintf("workload has %d invalid references: %s", len(e), strings.Join(problems, "; "))
+}
+
+// Code implements mw.ErrorCoder
+func (e DependencyErrors) Code() mw.ErrorCode {
+	return mw.CodeWorkloadDependencyInvalid
+}
+
+// Details implements mw.ErrorDetails
+func (e DependencyErrors) Details() interface{} {
+	return []DependencyError(e)
+}
+
+// dependencyResolver resolves the references of a new workload to the other
+// active workloads of its customer: the network resources of the node it is
+// connected to, the volumes it mounts, the kubernetes masters it joins and
+// the public ip it uses.
+type dependencyResolver struct {
+	db *mongo.Database
+	// pending are the workloads created in the same request, they are not
+	// saved yet and have no id, so they can only be referenced by name
+	pending []types.WorkloaderType
+}
+
+// validateDependencies checks all the references of the workload, pending are
+// the workloads created together with it
+func (a *API) validateDependencies(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, pending []types.WorkloaderType) mw.Response {
+	resolver := dependencyResolver{db: db, pending: pending}
+
+	problems, err := resolver.Validate(ctx, workload)
+	if err != nil {
+		return mw.Error(errors.Wrap(err, "failed to resolve workload dependencies"))
+	}
+
+	if len(problems) != 0 {
+		return mw.BadRequest(problems)
+	}
+
+	return nil
+}
+
+// Validate returns every reference of the workload which can not be resolved
+func (d *dependencyResolver) Validate(ctx context.Context, workload types.WorkloaderType) (DependencyErrors, error) {
+	var problems DependencyErrors
+	add := func(field, reference, reason string) {
+		problems = append(problems, DependencyError{Field: field, Reference: reference, Reason: reason})
+	}
+
+	switch w := workload.Workloader.(type) {
+	case *generated.Container:
+		for i, conn := range w.NetworkConnection {
+			field := fmt.Sprintf("network_connection[%d].network_id", i)
+			if err := d.checkNetwork(ctx, workload, conn.NetworkId, field, add); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, mount := range w.Volumes {
+			field := fmt.Sprintf("volumes[%d].volume_id", i)
+			if err := d.checkVolume(ctx, workload, mount.VolumeId, field, add); err != nil {
+				return nil, err
+			}
+		}
+	case *generated.K8S:
+		if err := d.checkNetwork(ctx, workload, w.NetworkId, "network_id", add); err != nil {
+			return nil, err
+		}
+
+		if err := d.checkMasters(ctx, workload, w.NetworkId, w.MasterIps, add); err != nil {
+			return nil, err
+		}
+
+		if err := d.checkPublicIP(ctx, workload, w.PublicIP, add); err != nil {
+			return nil, err
+		}
+	case *generated.VirtualMachine:
+		if err := d.checkNetwork(ctx, workload, w.NetworkId, "network_id", add); err != nil {
+			return nil, err
+		}
+
+		if err := d.checkPublicIP(ctx, workload, w.PublicIP, add); err != nil {
+			return nil, err
+		}
+	}
+
+	return problems, nil
+}
+
+// checkNetwork checks the customer has a network resource of the network on
+// the node of the workload
+func (d *dependencyResolver) checkNetwork(ctx context.Context, workload types.WorkloaderType, name, field string, add func(field, reference, reason string)) error {
+	if name == "" {
+		add(field, name, "network is not set")
+		return nil
+	}
+
+	for _, pending := range d.pending {
+		nr, ok := pending.Workloader.(*generated.NetworkResource)
+		if ok && nr.Name == name && pending.GetNodeID() == workload.GetNodeID() {
+			return nil
+		}
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.
+		WithCustomerID(workload.GetCustomerTid()).
+		WithWorkloadType(generated.WorkloadTypeNetworkResource).
+		WithName(name).
+		WithNodeID(workload.GetNodeID()).
+		WithNextActions(activeActions...)
+
+	count, err := filter.Count(ctx, d.db)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up network '%s'", name)
+	}
+
+	if count == 0 {
+		add(field, name, fmt.Sprintf("no network resource of the network on node '%s'", workload.GetNodeID()))
+	}
+
+	return nil
+}
+
+// parseVolumeID parses a volume reference of a container mount, which is the
+// id of the volume workload optionally followed by '-' and the workload index
+// as used by the legacy reservations
+func parseVolumeID(ref string) (schema.ID, error) {
+	if idx := strings.Index(ref, "-"); idx != -1 {
+		ref = ref[:idx]
+	}
+
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid volume id")
+	}
+
+	return schema.ID(id), nil
+}
+
+// checkVolume checks the volume mounted by a container is an active volume of
+// the customer on the same node
+func (d *dependencyResolver) checkVolume(ctx context.Context, workload types.WorkloaderType, ref, field string, add func(field, reference, reason string)) error {
+	id, err := parseVolumeID(ref)
+	if err != nil {
+		add(field, ref, err.Error())
+		return nil
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id).WithNextActions(activeActions...)
+
+	volume, err := filter.Get(ctx, d.db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		add(field, ref, "volume not found")
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to look up volume '%d'", id)
+	}
+
+	switch {
+	case volume.GetWorkloadType() != generated.WorkloadTypeVolume:
+		add(field, ref, fmt.Sprintf("workload is a %s, not a volume", volume.GetWorkloadType()))
+	case volume.GetCustomerTid() != workload.GetCustomerTid():
+		add(field, ref, "volume is not owned by the customer")
+	case volume.GetNodeID() != workload.GetNodeID():
+		add(field, ref, fmt.Sprintf("volume is on node '%s'", volume.GetNodeID()))
+	}
+
+	return nil
+}
+
+// checkMasters checks every master ip of a kubernetes worker is the ip of a
+// kubernetes workload of the customer in the same network
+func (d *dependencyResolver) checkMasters(ctx context.Context, workload types.WorkloaderType, network string, masters []net.IP, add func(field, reference, reason string)) error {
+	if len(masters) == 0 {
+		return nil
+	}
+
+	var known []net.IP
+	for _, pending := range d.pending {
+		k8s, ok := pending.Workloader.(*generated.K8S)
+		if ok && k8s.NetworkId == network {
+			known = append(known, k8s.Ipaddress)
+		}
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.
+		WithCustomerID(workload.GetCustomerTid()).
+		WithWorkloadType(generated.WorkloadTypeKubernetes).
+		WithNetworkID(network).
+		WithNextActions(activeActions...)
+
+	clusters, err := filter.Find(ctx, d.db)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up kubernetes masters in network '%s'", network)
+	}
+
+	for _, cluster := range clusters {
+		if k8s, ok := cluster.Workloader.(*generated.K8S); ok {
+			known = append(known, k8s.Ipaddress)
+		}
+	}
+
+next:
+	for i, master := range masters {
+		for _, ip := range known {
+			if ip.Equal(master) {
+				continue next
+			}
+		}
+
+		add(fmt.Sprintf("master_ips[%d]", i), master.String(), fmt.Sprintf("no kubernetes workload with this ip in network '%s'", network))
+	}
+
+	return nil
+}
+
+// checkPublicIP checks the public ip workload used by the workload is an
+// active public ip of the customer on the same node
+func (d *dependencyResolver) checkPublicIP(ctx context.Context, workload types.WorkloaderType, id schema.ID, add func(field, reference, reason string)) error {
+	if id == 0 {
+		return nil
+	}
+
+	ref := fmt.Sprint(id)
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id).WithNextActions(activeActions...)
+
+	ip, err := filter.Get(ctx, d.db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		add("public_ip", ref, "public ip workload not found")
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to look up public ip workload '%d'", id)
+	}
+
+	switch {
+	case ip.GetWorkloadType() != generated.WorkloadTypePublicIP:
+		add("public_ip", ref, fmt.Sprintf("workload is a %s, not a public ip", ip.GetWorkloadType()))
+	case ip.GetCustomerTid() != workload.GetCustomerTid():
+		add("public_ip", ref, "public ip is not owned by the customer")
+	case ip.GetNodeID() != workload.GetNodeID():
+		add("public_ip", ref, fmt.Sprintf("public ip is reserved on node '%s'", ip.GetNodeID()))
+	}
+
+	return nil
+}
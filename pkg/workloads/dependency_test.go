@@ -0,0 +1,54 @@
+package workloads
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+func TestParseVolumeID(t *testing.T) {
+	id, err := parseVolumeID("12")
+	require.NoError(t, err)
+	assert.Equal(t, schema.ID(12), id)
+
+	id, err = parseVolumeID("12-1")
+	require.NoError(t, err)
+	assert.Equal(t, schema.ID(12), id)
+
+	for _, invalid := range []string{"", "-1", "abc", "0"} {
+		_, err := parseVolumeID(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDependencyErrorsResponse(t *testing.T) {
+	problems := DependencyErrors{
+		{Field: "network_id", Reference: "net", Reason: "no network resource of the network on node 'node1'"},
+		{Field: "public_ip", Reference: "3", Reason: "public ip workload not found"},
+	}
+
+	handler := mw.AsHandlerFunc(func(r *http.Request) (interface{}, mw.Response) {
+		return nil, mw.BadRequest(errors.Wrap(problems, "workload 1"))
+	})
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var body struct {
+		Error   string            `json:"error"`
+		Code    mw.ErrorCode      `json:"code"`
+		Details []DependencyError `json:"details"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	assert.Contains(t, body.Error, "workload has 2 invalid references")
+	assert.Equal(t, mw.CodeWorkloadDependencyInvalid, body.Code)
+	assert.Equal(t, []DependencyError(problems), body.Details)
+}
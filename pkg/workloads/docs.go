@@ -0,0 +1,458 @@
+package workloads
+
+import (
+	"net/http"
+
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	escrowtypes "github.com/threefoldtech/tfexplorer/pkg/escrow/types"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+)
+
+// pages are the query parameters of the lists paginated by page number only
+var pages = openapi.Pagination[:2]
+
+// workloadFilter are the query parameters of the workload lists
+var workloadFilter = []openapi.Parameter{
+	openapi.Query("customer_tid", "filter workloads by the threebot id of their customer", int64(0)),
+	openapi.Query("pool_id", "filter workloads by pool", int64(0)),
+	openapi.Query("node_id", "filter workloads by node, comma separated", ""),
+	openapi.Query("farm_id", "filter workloads deployed on the nodes of a farm", int64(0)),
+	openapi.Query("reference", "filter workloads by reference", ""),
+	openapi.Query("next_action", "filter workloads by next action, comma separated", ""),
+	openapi.Query("workload_type", "filter workloads by type, comma separated", ""),
+	openapi.Query("result_state", "filter workloads by the state of their result, comma separated", ""),
+	openapi.Query("from_epoch", "only workloads created at or after this unix timestamp", int64(0)),
+	openapi.Query("to_epoch", "only workloads created before this unix timestamp", int64(0)),
+	openapi.Query("label", "filter workloads by label, either key=value or key to match any value. can be repeated", ""),
+	openapi.Query("sort", "fields to sort on, comma separated, prefixed with - for a descending order", ""),
+}
+
+// Docs are the documentation of the versioned routes of the package
+var Docs = openapi.Routes{
+	"prices-get": {
+		Summary:  "Get the prices of the capacity",
+		Tags:     []string{"prices"},
+		Response: prices,
+	},
+	"signing-key-get": {
+		Summary:     "Get the key signing the responses to the nodes",
+		Description: "the key is hex encoded",
+		Tags:        []string{"nodes"},
+		Response:    SigningKeyResponse{},
+		Errors: map[int]string{
+			http.StatusNotFound: "the explorer has no signing key",
+		},
+	},
+	"farm-sla-v1": {
+		Summary:     "Get the availability of the nodes of a farm over a period",
+		Description: "the period defaults to the current month. the downtime windows of the nodes list the workloads and pools deployed on the node during the window. with format=csv the report is returned as text/csv, one line per downtime window",
+		Tags:        []string{"farms"},
+		Params: []openapi.Parameter{
+			openapi.Query("from", "start of the period as a unix timestamp", int64(0)),
+			openapi.Query("to", "end of the period as a unix timestamp", int64(0)),
+			openapi.Query("format", "json or csv", ""),
+		},
+		Response: types.FarmSLA{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid period or format, the period is at most a year",
+			http.StatusNotFound:   "farm not found",
+		},
+	},
+
+	"versionned-pool-create": {
+		Summary:     "Create or extend a capacity pool",
+		Description: "the reservation must be paid with the returned escrow information before the capacity is added to the pool",
+		Tags:        []string{"pools"},
+		Request:     capacitytypes.Reservation{},
+		Response:    CapacityPoolCreateResponse{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:      "invalid reservation",
+			http.StatusConflict:        "duplicate nodes in the reservation",
+			http.StatusForbidden:       "too many unpaid reservations",
+			http.StatusTooManyRequests: "too many requests",
+		},
+	},
+	"versionned-pool-get": {
+		Summary:  "Get a capacity pool",
+		Tags:     []string{"pools"},
+		Response: capacitytypes.Pool{},
+		Errors: map[int]string{
+			http.StatusNotFound: "pool not found",
+		},
+	},
+	"versionned-pool-get-by-owner": {
+		Summary:  "List the capacity pools of a threebot",
+		Tags:     []string{"pools"},
+		Response: []capacitytypes.Pool{},
+	},
+	"versionned-pool-get-payment-info": {
+		Summary:  "Get the payment information of a capacity reservation",
+		Tags:     []string{"pools"},
+		Response: escrowtypes.CapacityReservationPaymentInformation{},
+		Errors: map[int]string{
+			http.StatusNotFound: "reservation not found",
+		},
+	},
+
+	"versionned-workloads-create": {
+		Summary:     "Create a workload",
+		Description: "the workload must be signed by the customer",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     types.WorkloaderType{},
+		Response:    ReservationCreateResponse{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:      "invalid workload or dependencies",
+			http.StatusPaymentRequired: "the pool has not enough capacity",
+			http.StatusForbidden:       "too many pending workloads, or the domain is not owned by the customer",
+			http.StatusNotFound:        "pool not found",
+			http.StatusTooManyRequests: "too many requests",
+		},
+	},
+	"versionned-workloads-update": {
+		Summary:     "Update a deployed workload",
+		Description: "the node redeploys the workload with the new version, the previous version is kept in the revisions of the workload",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     types.WorkloaderType{},
+		Response:    WorkloadUpdateResponse{},
+		Errors: map[int]string{
+			http.StatusBadRequest:      "invalid workload",
+			http.StatusPaymentRequired: "the pool has not enough capacity",
+			http.StatusNotFound:        "workload not found",
+			http.StatusConflict:        "the workload is not deployed or is being updated",
+		},
+	},
+	"versionned-workloads-labels": {
+		Summary:     "Set the labels of a workload",
+		Description: "the labels replace all the current labels of the workload",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     map[string]string{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid labels",
+			http.StatusNotFound:   "workload not found",
+		},
+	},
+	"versionned-workloads-migrate": {
+		Summary:     "Migrate a workload to another node",
+		Description: "the new workload is deployed first, the migrated workload is deleted once the new one is deployed",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     types.WorkloaderType{},
+		Response:    ReservationCreateResponse{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:      "invalid workload",
+			http.StatusPaymentRequired: "the pool has not enough capacity",
+			http.StatusNotFound:        "workload not found",
+			http.StatusConflict:        "the workload is not deployed or is already migrated",
+		},
+	},
+	"versionned-workloads-approval": {
+		Summary:     "Approve or reject a workload",
+		Description: "called by the farmer of the node of a workload waiting for approval",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     WorkloadApprovalRequest{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid signature, or the workload is not waiting for approval",
+			http.StatusNotFound:   "workload not found",
+		},
+	},
+	"versionned-workloadreservation-list": {
+		Summary:  "List the workloads",
+		Tags:     []string{"workloads"},
+		Params:   openapi.Paginated(workloadFilter...),
+		Response: []types.WorkloaderType{},
+	},
+	"versionned-workloads-events": {
+		Summary:     "Stream the events of the workloads",
+		Description: "server sent events, the events missed since the last event id are sent first",
+		Tags:        []string{"workloads"},
+		Params: []openapi.Parameter{
+			openapi.Query("customer_tid", "only the events of the workloads of a customer", int64(0)),
+			openapi.Query("pool_id", "only the events of the workloads of a pool", int64(0)),
+			openapi.Query("workload_id", "only the events of the given workloads, comma separated", ""),
+			openapi.Query("last_event_id", "resume the stream after this event", int64(0)),
+			openapi.Header("Last-Event-ID", "resume the stream after this event, set by the browsers when they reconnect", int64(0)),
+		},
+		Response:    types.WorkloadEvent{},
+		ContentType: "text/event-stream",
+	},
+	"versionned-workloadreservation-get": {
+		Summary:  "Get a workload",
+		Tags:     []string{"workloads"},
+		Response: types.WorkloaderType{},
+		Errors: map[int]string{
+			http.StatusNotFound: "workload not found",
+		},
+	},
+	"versionned-workloads-revisions": {
+		Summary:  "List the previous versions of an updated workload",
+		Tags:     []string{"workloads"},
+		Response: []types.WorkloadRevision{},
+	},
+	"versionned-workloads-event-list": {
+		Summary:  "List the events of a workload",
+		Tags:     []string{"workloads"},
+		Params:   openapi.Pagination,
+		Response: []types.WorkloadEvent{},
+		Errors: map[int]string{
+			http.StatusNotFound: "workload not found",
+		},
+	},
+	"versionned-reservation-sign-provision": {
+		Summary: "Sign the provisioning of a workload",
+		Tags:    []string{"workloads"},
+		Request: generated.SigningSignature{},
+		Status:  http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:   "invalid signature",
+			http.StatusUnauthorized: "the signer is not allowed to sign the workload",
+			http.StatusNotFound:     "workload not found",
+		},
+	},
+	"versionned-reservation-sign-delete": {
+		Summary: "Sign the deletion of a workload",
+		Tags:    []string{"workloads"},
+		Request: generated.SigningSignature{},
+		Status:  http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:   "invalid signature",
+			http.StatusUnauthorized: "the signer is not allowed to sign the workload",
+			http.StatusNotFound:     "workload not found",
+		},
+	},
+	"versionned-workloads-expiration": {
+		Summary:     "Set the expiration of a workload",
+		Description: "the workload is deleted once it expires, the expiration must be set and signed by the customer",
+		Tags:        []string{"workloads"},
+		Auth:        true,
+		Request:     WorkloadExpirationRequest{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid expiration or signature",
+			http.StatusNotFound:   "workload not found",
+		},
+	},
+
+	"versionned-groups-create": {
+		Summary:     "Create a deployment group",
+		Description: "all the workloads of the group are created, or none of them",
+		Tags:        []string{"groups"},
+		Auth:        true,
+		Request:     DeploymentGroupCreateRequest{},
+		Response:    DeploymentGroupCreateResponse{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:      "invalid workloads",
+			http.StatusPaymentRequired: "the pools have not enough capacity",
+		},
+	},
+	"versionned-groups-list": {
+		Summary: "List the deployment groups",
+		Tags:    []string{"groups"},
+		Params: openapi.Paginated(
+			openapi.Query("customer_tid", "filter groups by the threebot id of their customer", int64(0)),
+			openapi.Query("workload_id", "only the group of a workload", int64(0)),
+		),
+		Response: []DeploymentGroupInfo{},
+	},
+	"versionned-groups-get": {
+		Summary:  "Get a deployment group",
+		Tags:     []string{"groups"},
+		Response: DeploymentGroupInfo{},
+		Errors: map[int]string{
+			http.StatusNotFound: "group not found",
+		},
+	},
+	"versionned-groups-sign-delete": {
+		Summary:     "Sign the deletion of a deployment group",
+		Description: "a signature is required for each workload of the group",
+		Tags:        []string{"groups"},
+		Request:     DeploymentGroupDeleteRequest{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid signatures",
+			http.StatusNotFound:   "group not found",
+		},
+	},
+
+	"versionned-ips-list": {
+		Summary: "List the public ip leases",
+		Tags:    []string{"ips"},
+		Params: openapi.Paginated(
+			openapi.Query("customer_tid", "filter leases by the threebot id of their customer", int64(0)),
+			openapi.Query("pool_id", "filter leases by pool", int64(0)),
+			openapi.Query("farm_id", "filter leases by farm", int64(0)),
+			openapi.Query("state", "filter leases by state", types.IPLeaseState("")),
+		),
+		Response: []types.IPLease{},
+	},
+	"versionned-ips-get": {
+		Summary:  "Get a public ip lease",
+		Tags:     []string{"ips"},
+		Response: types.IPLease{},
+		Errors: map[int]string{
+			http.StatusNotFound: "lease not found",
+		},
+	},
+	"versionned-ips-hold": {
+		Summary:     "Set the hold period of a public ip lease",
+		Description: "the ip stays reserved for the customer during the hold period once its workload is deleted",
+		Tags:        []string{"ips"},
+		Auth:        true,
+		Request:     IPLeaseHoldRequest{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid hold period",
+			http.StatusNotFound:   "lease not found",
+		},
+	},
+	"versionned-ips-release": {
+		Summary: "Release a held public ip",
+		Tags:    []string{"ips"},
+		Auth:    true,
+		Errors: map[int]string{
+			http.StatusNotFound: "lease not found",
+		},
+	},
+	"versionned-ips-transfer": {
+		Summary:     "Transfer a held public ip to another pool",
+		Description: "the pool must belong to the customer of the lease, on the same farm",
+		Tags:        []string{"ips"},
+		Auth:        true,
+		Request:     IPLeaseTransferRequest{},
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid pool",
+			http.StatusNotFound:   "lease not found",
+			http.StatusConflict:   "the ip is not held",
+		},
+	},
+
+	"versionned-conversion-list": {
+		Summary:     "Get the legacy reservations of the user converted to workloads",
+		Description: "the converted workloads must be signed by the user and posted back",
+		Tags:        []string{"conversion"},
+		Auth:        true,
+		Response:    []types.WorkloaderType{},
+		Deprecated:  true,
+	},
+	"versionned-conversion-post": {
+		Summary:    "Save the signed converted workloads of the user",
+		Tags:       []string{"conversion"},
+		Auth:       true,
+		Request:    []types.WorkloaderType{},
+		Deprecated: true,
+		Errors: map[int]string{
+			http.StatusBadRequest: "invalid workloads or signatures",
+		},
+	},
+
+	"versionned-workloads-poll": {
+		Summary:     "Poll the workloads of a node",
+		Description: "called by the nodes, returns the workloads after the given id. the id to poll from next is set in the x-last-id header",
+		Tags:        []string{"nodes"},
+		Params: []openapi.Parameter{
+			openapi.Query("wait", "seconds to wait for new workloads if there are none", int64(0)),
+		},
+		Response: []types.WorkloaderType{},
+	},
+	"versionned-workload-get": {
+		Summary:  "Get a workload by its global id",
+		Tags:     []string{"nodes"},
+		Response: types.WorkloaderType{},
+		Errors: map[int]string{
+			http.StatusNotFound: "workload not found",
+		},
+	},
+	"versionned-workloads-results": {
+		Summary:     "Report the result of a workload",
+		Description: "called by the node of the workload, the result is signed with the node key",
+		Tags:        []string{"nodes"},
+		Request:     types.Result{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:   "invalid result",
+			http.StatusUnauthorized: "the workload is not deployed on the node",
+			http.StatusNotFound:     "workload not found",
+		},
+	},
+	"versionned-workloads-deleted": {
+		Summary:     "Report the deletion of a workload",
+		Description: "called by the node of the workload",
+		Tags:        []string{"nodes"},
+		Errors: map[int]string{
+			http.StatusUnauthorized: "the workload is not deployed on the node",
+			http.StatusNotFound:     "workload not found",
+		},
+	},
+}
+
+// LegacyDocs are the documentation of the legacy routes of the package
+var LegacyDocs = openapi.Merge(openapi.Legacy(Docs, map[string]string{
+	"reservation-create":         "versionned-workloads-create",
+	"reservation-sign-provision": "versionned-reservation-sign-provision",
+	"workload-create":            "versionned-workloads-create",
+	"workload-list":              "versionned-workloadreservation-list",
+	"workload-get":               "versionned-workloadreservation-get",
+	"workload-sign-provision":    "versionned-reservation-sign-provision",
+	"pool-create":                "versionned-pool-create",
+	"pool-get":                   "versionned-pool-get",
+	"pool-get-by-owner":          "versionned-pool-get-by-owner",
+	"conversion-list":            "versionned-conversion-list",
+	"conversion-post":            "versionned-conversion-post",
+	"nodes-workloads-poll":       "versionned-workloads-poll",
+	"nodes-workload-get":         "versionned-workload-get",
+	"nodes-workloads-results":    "versionned-workloads-results",
+	"nodes-workloads-deleted":    "versionned-workloads-deleted",
+}), openapi.Routes{
+	"reservation-list": {
+		Summary: "List the legacy reservations",
+		Tags:    []string{"reservations"},
+		Params: append(append([]openapi.Parameter{}, pages...),
+			openapi.Query("customer_tid", "filter reservations by the threebot id of their customer", int64(0)),
+			openapi.Query("next_action", "filter reservations by next action", int64(0)),
+		),
+		Response:   []types.Reservation{},
+		Deprecated: true,
+	},
+	"reservation-get": {
+		Summary:  "Get a legacy reservation",
+		Tags:     []string{"reservations"},
+		Response: types.Reservation{},
+		Errors: map[int]string{
+			http.StatusNotFound: "reservation not found",
+		},
+		Deprecated: true,
+	},
+	"reservation-sign-delete": {
+		Summary:     "Sign the deletion of a legacy reservation",
+		Description: "once the legacy reservations are disabled, signs the deletion of a workload",
+		Tags:        []string{"reservations"},
+		Request:     generated.SigningSignature{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:   "invalid signature",
+			http.StatusUnauthorized: "the signer is not allowed to sign the reservation",
+			http.StatusNotFound:     "reservation not found",
+		},
+		Deprecated: true,
+	},
+	"workload-sign-delete": {
+		Summary:     "Sign the deletion of a workload or of a legacy reservation",
+		Description: "signs the deletion of the legacy reservation with the id while they are served, of the workload otherwise",
+		Tags:        []string{"workloads"},
+		Request:     generated.SigningSignature{},
+		Status:      http.StatusCreated,
+		Errors: map[int]string{
+			http.StatusBadRequest:   "invalid signature",
+			http.StatusUnauthorized: "the signer is not allowed to sign the workload",
+			http.StatusNotFound:     "workload not found",
+		},
+		Deprecated: true,
+	},
+})
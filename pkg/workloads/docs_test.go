@@ -0,0 +1,18 @@
+package workloads
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/openapi"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, nil, &API{quota: mw.NewQuota(mw.QuotaLimits{}, nil), legacy: true})
+
+	require.NoError(t, openapi.Check(router, "/api/v1", Docs))
+	require.NoError(t, openapi.Check(router, "/explorer", LegacyDocs))
+}
@@ -0,0 +1,64 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// handleGatewayDomain makes sure the customer of a subdomain or delegate
+// gateway workload owns its domain. A subdomain of one of the managed domains
+// of the gateway can be used by anyone, the gateway already proved it owns
+// the managed domain when it registered. Any other domain, or one of its
+// parents, must be verified by the customer first.
+func (a *API) handleGatewayDomain(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) mw.Response {
+	var domain string
+	switch w := workload.Workloader.(type) {
+	case *generated.GatewaySubdomain:
+		domain = w.Domain
+	case *generated.GatewayDelegate:
+		domain = w.Domain
+	default:
+		return nil
+	}
+
+	domain, err := directory.NormalizeDomain(domain)
+	if err != nil {
+		return mw.BadRequest(err)
+	}
+
+	if workload.GetWorkloadType() == generated.WorkloadTypeSubDomain {
+		var filter directory.GatewayFilter
+		filter = filter.WithGWID(workload.GetNodeID())
+		gateway, err := filter.Get(ctx, db)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return mw.Error(errors.Wrap(err, "failed to load gateway"))
+		}
+
+		for _, managed := range gateway.ManagedDomains {
+			managed = strings.TrimSuffix(strings.ToLower(managed), ".")
+			if domain != managed && directory.IsSubdomain(domain, managed) {
+				return nil
+			}
+		}
+	}
+
+	owned, err := directory.DomainIsOwned(ctx, db, workload.GetCustomerTid(), domain, time.Now())
+	if err != nil {
+		return mw.Error(err)
+	}
+
+	if !owned {
+		return mw.Forbidden(fmt.Errorf("ownership of domain '%s' is not verified, verify the domain before using it in a gateway workload", domain)).WithCode(mw.CodeDomainNotOwned)
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package workloads
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+const (
+	// number of events buffered for a client, a client which can't keep up
+	// is disconnected and needs to resume with the Last-Event-ID header
+	eventStreamBuffer = 256
+	// interval of the keep alive comments sent on an idle stream
+	eventStreamKeepAlive = 30 * time.Second
+)
+
+// parseEventSelector reads the workload event selector from the query string
+func parseEventSelector(r *http.Request) (types.WorkloadEventSelector, error) {
+	var selector types.WorkloadEventSelector
+
+	customerTid, err := models.QueryInt(r, "customer_tid")
+	if err != nil {
+		return selector, errors.Wrap(err, "customer_tid should be an integer")
+	}
+	selector.CustomerTid = customerTid
+
+	poolID, err := models.QueryInt(r, "pool_id")
+	if err != nil {
+		return selector, errors.Wrap(err, "pool_id should be an integer")
+	}
+	selector.PoolID = poolID
+
+	// workload ids can be repeated, or given as a comma separated list
+	for _, value := range r.URL.Query()["workload_id"] {
+		for _, v := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return selector, errors.Wrap(err, "workload_id should be an integer")
+			}
+			selector.WorkloadIDs = append(selector.WorkloadIDs, schema.ID(id))
+		}
+	}
+
+	if selector.IsEmpty() {
+		return selector, fmt.Errorf("at least one of customer_tid, pool_id or workload_id is required")
+	}
+
+	return selector, nil
+}
+
+// lastEventID reads the id of the last event received by a client which
+// resumes its stream
+func lastEventID(r *http.Request) (schema.ID, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "last event id should be an integer")
+	}
+
+	return schema.ID(id), nil
+}
+
+// writeEvent writes the event in the server-sent events format
+func writeEvent(w io.Writer, event types.WorkloadEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Kind, data)
+	return err
+}
+
+// workloadEvents streams the state changes of the selected workloads as
+// server-sent events
+func (a *API) workloadEvents(w http.ResponseWriter, r *http.Request) {
+	fail := func(err mw.Response) {
+		mw.AsHandlerFunc(func(*http.Request) (interface{}, mw.Response) {
+			return nil, err
+		})(w, r)
+	}
+
+	selector, err := parseEventSelector(r)
+	if err != nil {
+		fail(mw.BadRequest(err))
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		fail(mw.BadRequest(err))
+		return
+	}
+
+	flusher, ok := mw.Flusher(w, r)
+	if !ok {
+		fail(mw.Error(errors.New("streaming is not supported")))
+		return
+	}
+
+	// subscribe before catching up, so no event is missed in between
+	events, cancel := types.WorkloadEvents.Subscribe(eventStreamBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var sent caughtUpEvents
+
+	ctx := r.Context()
+	if lastID != 0 {
+		db := mw.Database(r)
+		cur, err := selector.Filter().WithIDGT(lastID).FindCursor(ctx, db)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to load workload events")
+			return
+		}
+		defer cur.Close(ctx)
+
+		for cur.Next(ctx) {
+			var event types.WorkloadEvent
+			if err := cur.Decode(&event); err != nil {
+				log.Error().Err(err).Msg("failed to decode workload event")
+				return
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			sent.Add(event.ID)
+		}
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				// the client is too slow, it will reconnect and catch up
+				return
+			}
+
+			if sent.Skip(event.ID) {
+				continue
+			}
+			if !selector.Match(event) {
+				continue
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// caughtUpEvents are the events sent while catching up, which are skipped
+// from the live stream. Event ids are not published in order so only the ids
+// already sent are skipped. Once a live event newer than all of them arrives
+// they are published already, and are forgotten.
+type caughtUpEvents struct {
+	ids     map[schema.ID]struct{}
+	highest schema.ID
+}
+
+// Add records an event sent while catching up
+func (c *caughtUpEvents) Add(id schema.ID) {
+	if c.ids == nil {
+		c.ids = make(map[schema.ID]struct{})
+	}
+
+	c.ids[id] = struct{}{}
+	if id > c.highest {
+		c.highest = id
+	}
+}
+
+// Skip returns true if the live event with id was sent already
+func (c *caughtUpEvents) Skip(id schema.ID) bool {
+	if _, ok := c.ids[id]; ok {
+		delete(c.ids, id)
+		return true
+	}
+
+	if id > c.highest {
+		c.ids = nil
+	}
+
+	return false
+}
+
+// listWorkloadEvents returns the history of a workload, all the results
+// pushed by its node and all the changes done by the explorer, in the order
+// they happened
+func (a *API) listWorkloadEvents(r *http.Request) (interface{}, mw.Response) {
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	if _, err := (types.WorkloadFilter{}).WithID(id).Get(r.Context(), db); err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	var filter types.WorkloadEventFilter
+	filter = filter.WithWorkloadID(id)
+
+	var total int64
+	if pagination.Count() {
+		total, err = filter.Count(r.Context(), db)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
+	cur, err := filter.FindCursor(r.Context(), db, pagination.FindOptions())
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+	defer cur.Close(r.Context())
+
+	events := []types.WorkloadEvent{}
+	if err := cur.All(r.Context(), &events); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	n, more := pagination.Trim(len(events))
+	events = events[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = events[n-1].ID
+	}
+
+	return events, mw.Page(r, pagination, last, more, total)
+}
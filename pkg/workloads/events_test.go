@@ -0,0 +1,103 @@
+package workloads
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// mockDocument returns v as a document of a mocked database response
+func mockDocument(t require.TestingT, v interface{}) bson.D {
+	buf, err := bson.Marshal(v)
+	require.NoError(t, err)
+
+	var doc bson.D
+	require.NoError(t, bson.Unmarshal(buf, &doc))
+	return doc
+}
+
+func TestListWorkloadEvents(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("in order", func(mt *mtest.T) {
+		workload := types.WorkloaderType{Workloader: &generated.Volume{ReservationInfo: generated.ReservationInfo{
+			ID:           1,
+			WorkloadType: generated.WorkloadTypeVolume,
+		}}}
+
+		states := []generated.ResultStateEnum{generated.ResultStateError, generated.ResultStateOK, generated.ResultStateError}
+		events := make([]bson.D, len(states))
+		for i, state := range states {
+			events[i] = mockDocument(mt, types.WorkloadEvent{
+				ID:         schema.ID(i + 1),
+				Kind:       types.WorkloadEventResult,
+				WorkloadID: 1,
+				Result:     generated.Result{State: state, Signature: fmt.Sprintf("signature-%d", i)},
+			})
+		}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.WorkloadCollection, mtest.FirstBatch, mockDocument(mt, workload)),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.WorkloadEventCollection, mtest.FirstBatch, events...),
+		)
+
+		db, err := mw.NewDatabaseMiddleware(mt.DB.Name(), mt.Client)
+		require.NoError(mt, err)
+		var a API
+		router := mux.NewRouter()
+		router.Use(db.Middleware)
+		router.HandleFunc("/workloads/{res_id:\\d+}/events", mw.AsHandlerFunc(a.listWorkloadEvents))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/workloads/1/events?count=false", nil))
+		require.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+
+		var listed []types.WorkloadEvent
+		require.NoError(mt, json.Unmarshal(w.Body.Bytes(), &listed))
+		require.Len(mt, listed, len(states))
+		for i, event := range listed {
+			assert.Equal(mt, schema.ID(i+1), event.ID)
+			assert.Equal(mt, states[i], event.Result.State)
+			assert.Equal(mt, fmt.Sprintf("signature-%d", i), event.Result.Signature)
+		}
+
+		// the events of the workload are loaded in the order they happened
+		mt.GetStartedEvent()
+		find := mt.GetStartedEvent()
+		require.NotNil(mt, find)
+		assert.Equal(mt, types.WorkloadEventCollection, find.Command.Lookup("find").StringValue())
+		assert.Equal(mt, int64(1), find.Command.Lookup("filter", "workload_id").Int64())
+		assert.Equal(mt, int32(1), find.Command.Lookup("sort", "_id").Int32())
+	})
+}
+
+func TestCaughtUpEvents(t *testing.T) {
+	var sent caughtUpEvents
+	for _, id := range []schema.ID{3, 4, 6} {
+		sent.Add(id)
+	}
+
+	assert.True(t, sent.Skip(4))
+	assert.False(t, sent.Skip(4))
+	// published late, not sent while catching up
+	assert.False(t, sent.Skip(5))
+	assert.Len(t, sent.ids, 2)
+
+	// a newer event means the caught up events are all published
+	assert.False(t, sent.Skip(7))
+	assert.Empty(t, sent.ids)
+	assert.False(t, sent.Skip(3))
+}
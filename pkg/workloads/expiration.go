@@ -0,0 +1,217 @@
+package workloads
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/capacity"
+	phonebook "github.com/threefoldtech/tfexplorer/pkg/phonebook/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxExpirationDelay is the maximum time the expirer sleeps, so workloads
+	// it was not told about (deployed by another explorer instance, or once
+	// their pool is paid) are still expired in time
+	maxExpirationDelay = time.Hour
+	// expirationRetryDelay is the time the expirer waits after a failure
+	expirationRetryDelay = time.Minute
+)
+
+// WorkloadExpirationRequest changes the expiration time of a workload
+type WorkloadExpirationRequest struct {
+	// ExpiresAt is the new expiration time, 0 removes the expiration
+	ExpiresAt schema.Date `json:"expires_at"`
+	// CustomerSignature is the signature of the workload with the new
+	// expiration time
+	CustomerSignature string `json:"customer_signature"`
+}
+
+// Expirer deletes the deployed workloads once their expiration time is
+// reached. Like the capacity planner it sleeps until the next workload
+// expires.
+type Expirer struct {
+	db      *mongo.Database
+	planner capacity.Planner
+
+	// timer when next workload expires
+	timer *time.Timer
+	wake  chan struct{}
+}
+
+// NewExpirer creates a new Expirer
+func NewExpirer(db *mongo.Database, planner capacity.Planner) *Expirer {
+	return &Expirer{
+		db:      db,
+		planner: planner,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run expires the workloads until the context is canceled
+func (e *Expirer) Run(ctx context.Context) {
+	e.handleExpiration(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("context is done, stopping workload expirer")
+			return
+		case <-e.timer.C:
+			log.Debug().Msg("workload expirer timer fired, workloads should be expired")
+		case <-e.wake:
+		}
+
+		e.handleExpiration(ctx)
+	}
+}
+
+// Reschedule makes the expirer look for the next workload to expire again, it
+// must be called when a workload with an expiration time is deployed or its
+// expiration time changed
+func (e *Expirer) Reschedule() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+		// the expirer is already going to check
+	}
+}
+
+// handleExpiration expires the workloads which reached their expiration
+// time, and sets up the timer to fire as soon as the next workload expires
+func (e *Expirer) handleExpiration(ctx context.Context) {
+	if e.timer != nil {
+		// see NaivePlanner.handlePoolExpiration, the timer channel is not
+		// drained on purpose
+		e.timer.Stop()
+	}
+
+	now := time.Now()
+	next, err := e.expire(ctx, now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to expire workloads")
+		next = now.Add(expirationRetryDelay)
+	}
+
+	maxDelay := now.Add(maxExpirationDelay)
+	if next.IsZero() || next.After(maxDelay) {
+		next = maxDelay
+	}
+
+	log.Debug().Time("ExpireAt", next).Msg("next workload to expire")
+	e.timer = time.NewTimer(next.Sub(now))
+}
+
+// expire deletes all the deployed workloads which expired at now, and
+// returns the time the next workload expires at
+func (e *Expirer) expire(ctx context.Context, now time.Time) (time.Time, error) {
+	var filter types.WorkloadFilter
+	filter = filter.WithNextAction(types.Deploy).WithExpiredBefore(now)
+
+	workloads, err := filter.Find(ctx, e.db)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "could not load workloads to expire")
+	}
+
+	for _, workload := range workloads {
+		log.Debug().Int64("Workload", int64(workload.GetID())).Msg("expire workload")
+		workload.SetNextAction(types.Delete)
+		if err := types.WorkloadSetNextAction(ctx, e.db, workload.GetID(), types.Delete, types.ReasonExpired); err != nil {
+			return time.Time{}, errors.Wrap(err, "could not set workload to delete state")
+		}
+
+		if err := types.WorkloadPush(ctx, e.db, workload); err != nil {
+			return time.Time{}, errors.Wrap(err, "could not push workload to delete in workload queue")
+		}
+
+		// the capacity is released right away, so the pool stops paying for
+		// the workload even if the node takes time to delete it
+		if err := releaseDeletedCapacity(ctx, e.db, e.planner, workload); err != nil {
+			return time.Time{}, errors.Wrap(err, "could not release workload capacity")
+		}
+	}
+
+	return types.WorkloadNextExpiration(ctx, e.db)
+}
+
+// setWorkloadExpiration extends or cancels the expiration of a workload. The
+// expiration is part of the signature challenge, so the request holds the
+// customer signature of the workload with the new expiration time. The
+// request must be signed by the customer too, so a captured request can't be
+// replayed to restore a previous expiration.
+func (a *API) setWorkloadExpiration(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	var request WorkloadExpirationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to decode expiration request"))
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id)
+
+	db := mw.Database(r)
+	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
+	if err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	if workload.GetCustomerTid() != requestUserID {
+		return nil, mw.UnAuthorized(fmt.Errorf("request user identity does not match the workload customer-tid"))
+	}
+
+	if workload.IsAny(types.Invalid, types.Delete, types.Deleted) {
+		return nil, mw.Conflict(fmt.Errorf("workload is in state '%s', its expiration can not be changed", workload.GetNextAction().String()))
+	}
+
+	workload.SetExpiresAt(request.ExpiresAt)
+	if !workload.HasExpiration() {
+		workload.SetExpiresAt(schema.Date{})
+	} else if workload.GetExpiresAt().Before(time.Now()) {
+		return nil, mw.BadRequest(errors.New("expires_at can not be in the past"))
+	}
+
+	user, err := phonebook.UserFilter{}.WithID(schema.ID(workload.GetCustomerTid())).Get(r.Context(), db)
+	if err != nil {
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
+	}
+
+	signature, err := hex.DecodeString(request.CustomerSignature)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "invalid signature format, expecting hex encoded string"))
+	}
+
+	if err := workload.Verify(user.Pubkey, signature); err != nil {
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify customer signature")).WithCode(mw.CodeSignatureInvalid)
+	}
+
+	if err := types.WorkloadSetExpiration(r.Context(), db, id, workload.GetExpiresAt(), request.CustomerSignature); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	a.expirer.Reschedule()
+
+	return nil, mw.Ok()
+}
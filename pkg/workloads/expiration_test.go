@@ -0,0 +1,25 @@
+package workloads
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfexplorer/mw"
+)
+
+func TestSetWorkloadExpirationAuthenticated(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, nil, &API{quota: mw.NewQuota(mw.QuotaLimits{}, nil)})
+
+	// a captured customer signature is not enough to change the expiration
+	body := strings.NewReader(`{"expires_at": 0, "customer_signature": "00"}`)
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/reservations/workloads/1/expiration", body)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
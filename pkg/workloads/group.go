@@ -0,0 +1,445 @@
+package workloads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	phonebook "github.com/threefoldtech/tfexplorer/pkg/phonebook/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxGroupSize is the maximum number of workloads in a deployment group
+const maxGroupSize = 64
+
+type (
+	// DeploymentGroupCreateRequest holds the signed workloads of a new deployment group
+	DeploymentGroupCreateRequest struct {
+		Workloads []json.RawMessage `json:"workloads"`
+	}
+
+	// DeploymentGroupCreateResponse wraps deployment group create response
+	DeploymentGroupCreateResponse struct {
+		ID          schema.ID   `json:"group_id"`
+		WorkloadIDs []schema.ID `json:"workload_ids"`
+	}
+
+	// DeploymentGroupDeleteRequest holds the delete signatures for all the
+	// workloads of a deployment group
+	DeploymentGroupDeleteRequest struct {
+		Signatures []types.DeploymentGroupSignature `json:"signatures"`
+	}
+
+	// DeploymentGroupInfo is a deployment group with the state of its workloads
+	DeploymentGroupInfo struct {
+		types.DeploymentGroup
+		Status    types.DeploymentGroupStatus `json:"status"`
+		Workloads []DeploymentGroupWorkload   `json:"workloads"`
+	}
+
+	// DeploymentGroupWorkload is the state of a single workload of a deployment group
+	DeploymentGroupWorkload struct {
+		ID           schema.ID                  `json:"id"`
+		WorkloadType generated.WorkloadTypeEnum `json:"workload_type"`
+		NextAction   generated.NextActionEnum   `json:"next_action"`
+		Result       generated.Result           `json:"result"`
+	}
+)
+
+// createGroup creates all the workloads of a deployment group, or none of them.
+// All workloads are validated, and the capacity of their pools is checked for
+// all of them together, before anything is saved. The workloads which used the
+// public ips of the group before are only deleted once the group is scheduled.
+func (a *API) createGroup(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	var request DeploymentGroupCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	if len(request.Workloads) == 0 {
+		return nil, mw.BadRequest(errors.New("a deployment group requires at least one workload"))
+	}
+
+	if len(request.Workloads) > maxGroupSize {
+		return nil, mw.BadRequest(fmt.Errorf("a deployment group can have at most %d workloads", maxGroupSize))
+	}
+
+	db := mw.Database(r)
+	if err := a.quota.Check(r.Context(), requestUserID, mw.QuotaWorkloads, int64(len(request.Workloads))); err != nil {
+		return nil, mw.QuotaError(err)
+	}
+
+	group := make([]types.WorkloaderType, 0, len(request.Workloads))
+	publicIPs := make(map[string]struct{})
+	for i, data := range request.Workloads {
+		workload, mwErr := a.prepareWorkload(r.Context(), db, requestUserID, 0, data)
+		if mwErr != nil {
+			return nil, mw.Error(errors.Wrapf(mwErr.Err(), "workload %d", i), mwErr.Status())
+		}
+
+		if ip, ok := workload.Workloader.(*generated.PublicIP); ok {
+			address := ip.IPaddress.String()
+			if _, exists := publicIPs[address]; exists {
+				return nil, mw.Conflict(fmt.Errorf("workload %d: public ip %s is reserved more than once in the group", i, address))
+			}
+			publicIPs[address] = struct{}{}
+		}
+
+		group = append(group, workload)
+	}
+
+	// the workloads of the group can depend on each other
+	for i, workload := range group {
+		if mwErr := a.validateDependencies(r.Context(), db, workload, group); mwErr != nil {
+			return nil, mw.Error(errors.Wrapf(mwErr.Err(), "workload %d", i), mwErr.Status())
+		}
+	}
+
+	workloaders := make([]generated.Workloader, 0, len(group))
+	for _, workload := range group {
+		workloaders = append(workloaders, workload.Workloader)
+	}
+
+	allowed, err := a.capacityPlanner.HasCapacityForAll(workloaders, minCapacitySeconds)
+	if err != nil {
+		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+			return nil, mw.NotFound(errors.New("pool does not exist")).WithCode(mw.CodePoolNotFound)
+		}
+		log.Error().Err(err).Msg("failed to load workload capacity pool")
+		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+	}
+
+	if !allowed {
+		return nil, mw.PaymentRequired(errors.New("pools need additional capacity to support all workloads of the group")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	ids, reservations, mwErr := a.commitGroup(r.Context(), db, group)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	id, err := types.DeploymentGroupCreate(r.Context(), db, types.DeploymentGroup{
+		CustomerTid: requestUserID,
+		WorkloadIDs: ids,
+		Epoch:       schema.Date{Time: time.Now()},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("could not create deployment group")
+		a.rollbackGroup(r.Context(), db, group, reservations, 0)
+		return nil, mw.Error(err)
+	}
+
+	expires := false
+	for i, workload := range group {
+		if err := a.toDeployOrApprove(r.Context(), db, workload, types.ReasonGroupCreated); err != nil {
+			log.Error().Err(err).Int64("group", int64(id)).Msg("failed to schedule the group workloads to deploy")
+			a.rollbackGroup(r.Context(), db, group, reservations, i)
+			if err := types.DeploymentGroupRemove(r.Context(), db, id); err != nil {
+				log.Error().Err(err).Int64("group", int64(id)).Msg("failed to remove deployment group")
+			}
+			return nil, mw.Error(errors.New("could not schedule deployment group to deploy"))
+		}
+
+		expires = expires || workload.HasExpiration()
+	}
+
+	// the workloads which used the public ips of the group before are only
+	// deleted once the whole group is scheduled, there is no way back anymore
+	for _, reservation := range reservations {
+		if mwErr := a.completePublicIPReservation(r.Context(), db, reservation); mwErr != nil {
+			log.Error().Err(mwErr.Err()).Int64("group", int64(id)).Msg("failed to complete public ip reservation")
+		}
+	}
+
+	if expires {
+		a.expirer.Reschedule()
+	}
+
+	return DeploymentGroupCreateResponse{ID: id, WorkloadIDs: ids}, mw.Created()
+}
+
+// commitGroup saves the workloads of a group and reserves their public ips. If
+// any of this fails, everything done so far is rolled back. The reservations
+// are completed once the group is scheduled.
+func (a *API) commitGroup(ctx context.Context, db *mongo.Database, group []types.WorkloaderType) ([]schema.ID, []ipReservation, mw.Response) {
+	ids := make([]schema.ID, 0, len(group))
+	for i := range group {
+		id, err := types.WorkloadCreate(ctx, db, group[i])
+		if err != nil {
+			log.Error().Err(err).Msg("could not create workload")
+			a.rollbackGroup(ctx, db, group[:i], nil, 0)
+			return nil, nil, mw.Error(err)
+		}
+		group[i].SetID(id)
+		ids = append(ids, id)
+	}
+
+	var reservations []ipReservation
+	for i, workload := range group {
+		if workload.GetWorkloadType() != generated.WorkloadTypePublicIP {
+			continue
+		}
+
+		reservation, mwErr := a.reservePublicIP(ctx, db, workload)
+		if mwErr != nil {
+			a.rollbackGroup(ctx, db, group, reservations, 0)
+			return nil, nil, mw.Error(errors.Wrapf(mwErr.Err(), "workload %d", i), mwErr.Status())
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	return ids, reservations, nil
+}
+
+// rollbackGroup undoes the public ip reservations of a group, deletes the
+// first scheduled workloads and removes the others
+func (a *API) rollbackGroup(ctx context.Context, db *mongo.Database, group []types.WorkloaderType, reservations []ipReservation, scheduled int) {
+	for _, reservation := range reservations {
+		if err := a.undoPublicIPReservation(ctx, db, reservation); err != nil {
+			log.Error().Err(err).Int64("id", int64(reservation.workload.GetID())).Msg("failed to release public ip of deployment group")
+		}
+	}
+
+	// the scheduled workloads may already be sent to the nodes
+	for _, workload := range group[:scheduled] {
+		if _, err := a.setWorkloadDelete(ctx, db, workload, types.ReasonGroupFailed); err != nil {
+			log.Error().Err(err).Int64("id", int64(workload.GetID())).Msg("failed to delete workload of deployment group")
+		}
+	}
+
+	ids := make([]schema.ID, 0, len(group))
+	for _, workload := range group[scheduled:] {
+		ids = append(ids, workload.GetID())
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	if err := types.WorkloadsRemove(ctx, db, ids); err != nil {
+		log.Error().Err(err).Msg("failed to remove workloads of deployment group")
+	}
+}
+
+func (a *API) getGroup(r *http.Request) (interface{}, mw.Response) {
+	id, err := a.parseID(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid deployment group id"))
+	}
+
+	db := mw.Database(r)
+	group, err := types.DeploymentGroupFilter{}.WithID(id).Get(r.Context(), db)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, mw.NotFound(fmt.Errorf("deployment group not found"))
+		}
+		return nil, mw.Error(err)
+	}
+
+	info, err := a.groupInfo(r.Context(), db, group)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return info, nil
+}
+
+func (a *API) listGroups(r *http.Request) (interface{}, mw.Response) {
+	var filter types.DeploymentGroupFilter
+	filter, err := types.ApplyQueryFilterDeploymentGroup(r, filter)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	var total int64
+	if pagination.Count() {
+		total, err = filter.Count(r.Context(), db)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
+	groups, err := filter.Find(r.Context(), db, pagination.FindOptions())
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	n, more := pagination.Trim(len(groups))
+	groups = groups[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = groups[n-1].ID
+	}
+
+	infos := make([]DeploymentGroupInfo, 0, len(groups))
+	for _, group := range groups {
+		info, err := a.groupInfo(r.Context(), db, group)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, mw.Page(r, pagination, last, more, total)
+}
+
+func (a *API) groupInfo(ctx context.Context, db *mongo.Database, group types.DeploymentGroup) (DeploymentGroupInfo, error) {
+	workloads, err := a.groupWorkloads(ctx, db, group)
+	if err != nil {
+		return DeploymentGroupInfo{}, err
+	}
+
+	info := DeploymentGroupInfo{
+		DeploymentGroup: group,
+		Status:          types.GroupStatus(workloads),
+		Workloads:       make([]DeploymentGroupWorkload, 0, len(workloads)),
+	}
+
+	for _, workload := range workloads {
+		info.Workloads = append(info.Workloads, DeploymentGroupWorkload{
+			ID:           workload.GetID(),
+			WorkloadType: workload.GetWorkloadType(),
+			NextAction:   workload.GetNextAction(),
+			Result:       workload.GetResult(),
+		})
+	}
+
+	return info, nil
+}
+
+// groupWorkloads loads the workloads of a group, passed through the pipeline
+func (a *API) groupWorkloads(ctx context.Context, db *mongo.Database, group types.DeploymentGroup) ([]types.WorkloaderType, error) {
+	workloads, err := types.WorkloadFilter{}.WithIDs(group.WorkloadIDs).Find(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load deployment group workloads")
+	}
+
+	for i := range workloads {
+		workloads[i], err = a.workloadpipeline(workloads[i], nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process workload %d", workloads[i].GetID())
+		}
+	}
+
+	return workloads, nil
+}
+
+// signDeleteGroup deletes all the workloads of a group. The request must hold a
+// valid delete signature for every workload which is not deleted yet, and
+// either all signatures are accepted or none.
+func (a *API) signDeleteGroup(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	var request DeploymentGroupDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	id, err := a.parseID(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid deployment group id"))
+	}
+
+	db := mw.Database(r)
+	group, err := types.DeploymentGroupFilter{}.WithID(id).Get(r.Context(), db)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, mw.NotFound(fmt.Errorf("deployment group not found"))
+		}
+		return nil, mw.Error(err)
+	}
+
+	workloads, err := a.groupWorkloads(r.Context(), db, group)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	signatures := make(map[schema.ID]generated.SigningSignature)
+	for _, signature := range request.Signatures {
+		signatures[signature.WorkloadID] = signature.SigningSignature
+	}
+
+	pubkeys := make(map[int64]string)
+	toSign := make([]types.WorkloaderType, 0, len(workloads))
+	for _, workload := range workloads {
+		if workload.IsAny(types.Delete, types.Deleted) {
+			continue
+		}
+
+		signature, ok := signatures[workload.GetID()]
+		if !ok {
+			return nil, mw.BadRequest(fmt.Errorf("missing delete signature for workload %d", workload.GetID()))
+		}
+
+		if httpErr := userCanSign(signature.Tid, workload.GetSigningRequestDelete(), workload.GetSignaturesDelete()); httpErr != nil {
+			return nil, mw.Error(errors.Wrapf(httpErr.Err(), "workload %d", workload.GetID()), httpErr.Status())
+		}
+
+		pubkey, ok := pubkeys[signature.Tid]
+		if !ok {
+			user, err := phonebook.UserFilter{}.WithID(schema.ID(signature.Tid)).Get(r.Context(), db)
+			if err != nil {
+				return nil, mw.NotFound(errors.Wrapf(err, "user %d not found", signature.Tid)).WithCode(mw.CodeUserNotFound)
+			}
+			pubkey = user.Pubkey
+			pubkeys[signature.Tid] = pubkey
+		}
+
+		if err := workload.SignatureDeleteRequestVerify(pubkey, signature); err != nil {
+			return nil, mw.UnAuthorized(errors.Wrapf(err, "failed to verify signature of workload %d", workload.GetID())).WithCode(mw.CodeSignatureInvalid)
+		}
+
+		toSign = append(toSign, workload)
+	}
+
+	for _, workload := range toSign {
+		signature := signatures[workload.GetID()]
+		signature.Epoch = schema.Date{Time: time.Now()}
+		if err := types.WorkloadPushSignature(r.Context(), db, workload.GetID(), types.SignatureDelete, signature); err != nil {
+			return nil, mw.Error(err)
+		}
+
+		workload, err := a.workloadpipeline(types.WorkloadFilter{}.WithID(workload.GetID()).Get(r.Context(), db))
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+
+		if workload.GetNextAction() != generated.NextActionDelete {
+			continue
+		}
+
+		if _, err := a.setWorkloadDelete(r.Context(), db, workload, types.ReasonDeleteSigned); err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	return nil, mw.Created()
+}
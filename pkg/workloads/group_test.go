@@ -0,0 +1,49 @@
+package workloads
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestListGroupsCursor(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("next page", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			// one more group than the page size tells there is a next page
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.DeploymentGroupCollection, mtest.FirstBatch,
+				mockDocument(mt, types.DeploymentGroup{ID: 4, CustomerTid: 1}),
+				mockDocument(mt, types.DeploymentGroup{ID: 7, CustomerTid: 1}),
+			),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+"."+types.WorkloadCollection, mtest.FirstBatch),
+		)
+
+		db, err := mw.NewDatabaseMiddleware(mt.DB.Name(), mt.Client)
+		require.NoError(mt, err)
+		var a API
+		router := mux.NewRouter()
+		router.Use(db.Middleware)
+		router.HandleFunc("/groups", mw.AsHandlerFunc(a.listGroups))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/groups?cursor=&size=1", nil))
+		require.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+
+		var groups []DeploymentGroupInfo
+		require.NoError(mt, json.Unmarshal(w.Body.Bytes(), &groups))
+		require.Len(mt, groups, 1)
+		assert.EqualValues(mt, 4, groups[0].ID)
+		assert.Contains(mt, w.Header().Get("Link"), `rel="next"`)
+		assert.Empty(mt, w.Header().Get("Pages"))
+	})
+}
@@ -0,0 +1,379 @@
+package workloads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/capacity"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	phonebook "github.com/threefoldtech/tfexplorer/pkg/phonebook/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ipLeaseCheckInterval is how often the held ips are checked for release
+const ipLeaseCheckInterval = time.Minute
+
+// IPLeaseHoldRequest sets the time a public ip is held once its workload is
+// deleted
+type IPLeaseHoldRequest struct {
+	// HoldPeriod in seconds, 0 releases the ip as soon as its workload is deleted
+	HoldPeriod int64 `json:"hold_period"`
+}
+
+// IPLeaseTransferRequest moves a held public ip to another pool of the customer
+type IPLeaseTransferRequest struct {
+	PoolID int64 `json:"pool_id"`
+	// Signature is the customer signature of the lease transfer challenge:
+	// "transfer" + lease id + ip address + pool id
+	Signature string `json:"signature"`
+}
+
+// heldWorkload returns the deleted workload still reserving a held ip, it is
+// looked up in the archive too. Its pool is set to the pool of the lease which
+// is billed for the ip.
+func heldWorkload(ctx context.Context, db *mongo.Database, lease types.IPLease) (types.WorkloaderType, error) {
+	workload, err := types.WorkloadFilter{}.WithID(lease.WorkloadID).Get(ctx, db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		workload, err = types.WorkloadArchiveGet(ctx, db, lease.WorkloadID)
+	}
+	if err != nil {
+		return workload, errors.Wrapf(err, "failed to retrieve workload '%d' of held ip", lease.WorkloadID)
+	}
+
+	workload.SetPoolID(lease.PoolID)
+	return workload, nil
+}
+
+// holdingLease returns the lease of a public ip workload if the ip is held
+// once the workload is deleted, nil otherwise
+func holdingLease(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) (*types.IPLease, error) {
+	if workload.GetWorkloadType() != generated.WorkloadTypePublicIP {
+		return nil, nil
+	}
+
+	lease, err := types.IPLeaseFilter{}.WithWorkloadID(workload.GetID()).Get(ctx, db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve ip lease")
+	}
+
+	if lease.HoldPeriod == 0 {
+		return nil, nil
+	}
+
+	return &lease, nil
+}
+
+// releaseDeletedCapacity releases the capacity of a workload scheduled for
+// deletion right away, unless it's a public ip which is held once deleted. A
+// held ip is billed until it is released by unbillHeldIP.
+func releaseDeletedCapacity(ctx context.Context, db *mongo.Database, planner capacity.Planner, workload types.WorkloaderType) error {
+	lease, err := holdingLease(ctx, db, workload)
+	if err != nil {
+		return err
+	}
+
+	if lease != nil {
+		return nil
+	}
+
+	return planner.RemoveUsedCapacity(workload)
+}
+
+// holdPublicIP holds the ip of a deleted public ip workload if its lease has
+// a hold period. It returns true if the ip is held, in which case the ip stays
+// reserved and billed.
+func (a *API) holdPublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) (bool, error) {
+	lease, err := holdingLease(ctx, db, workload)
+	if err != nil || lease == nil {
+		return false, err
+	}
+
+	return true, types.IPLeaseHold(ctx, db, lease.ID, time.Now().Add(lease.Hold()))
+}
+
+// unbillHeldIP stops billing the deleted workload of a held ip on the pool of
+// the lease
+func (a *API) unbillHeldIP(ctx context.Context, db *mongo.Database, lease types.IPLease) error {
+	workload, err := heldWorkload(ctx, db, lease)
+	if err != nil {
+		return err
+	}
+
+	return a.capacityPlanner.RemoveUsedCapacity(workload)
+}
+
+// releaseIPLease releases a held ip, it is free to be used by anyone again
+func (a *API) releaseIPLease(ctx context.Context, db *mongo.Database, lease types.IPLease) error {
+	if err := a.unbillHeldIP(ctx, db, lease); err != nil {
+		log.Error().Err(err).Int64("lease", int64(lease.ID)).Msg("failed to stop billing held ip")
+	}
+
+	if err := directory.FarmIPRelease(ctx, db, lease.FarmID, lease.Address, lease.WorkloadID); err != nil {
+		return errors.Wrapf(err, "failed to release ip '%s'", lease.Address.String())
+	}
+
+	return types.IPLeaseRemove(ctx, db, lease.ID)
+}
+
+// expireIPLeases releases the held ips whose hold expired, or whose pool can
+// not pay for them anymore
+func (a *API) expireIPLeases(ctx context.Context, db *mongo.Database, now time.Time) error {
+	leases, err := types.IPLeaseFilter{}.WithState(types.IPLeaseHeld).Find(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "failed to list held ips")
+	}
+
+	for _, lease := range leases {
+		if lease.HeldUntil.After(now) {
+			pool, err := capacitytypes.GetPool(ctx, db, schema.ID(lease.PoolID))
+			if err != nil && !errors.Is(err, capacitytypes.ErrPoolNotFound) {
+				log.Error().Err(err).Int64("lease", int64(lease.ID)).Msg("failed to load pool of held ip")
+				continue
+			}
+
+			if err == nil && pool.IPv4us > 0 {
+				continue
+			}
+		}
+
+		if err := a.releaseIPLease(ctx, db, lease); err != nil {
+			log.Error().Err(err).Int64("lease", int64(lease.ID)).Msg("failed to release held ip")
+		}
+	}
+
+	return nil
+}
+
+// runIPLeaseExpiration releases the held ips until the context is canceled
+func (a *API) runIPLeaseExpiration(ctx context.Context, db *mongo.Database) {
+	ticker := time.NewTicker(ipLeaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("context is done, stopping ip lease expiration")
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.expireIPLeases(ctx, db, time.Now()); err != nil {
+			log.Error().Err(err).Msg("failed to release held ips")
+		}
+	}
+}
+
+// customerIPLease loads the lease from the request path, and makes sure the
+// user making the request is its customer
+func (a *API) customerIPLease(r *http.Request) (types.IPLease, mw.Response) {
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return types.IPLease{}, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["id"])
+	if err != nil {
+		return types.IPLease{}, mw.BadRequest(fmt.Errorf("invalid ip lease id"))
+	}
+
+	lease, err := types.IPLeaseFilter{}.WithID(id).Get(r.Context(), mw.Database(r))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return lease, mw.NotFound(fmt.Errorf("ip lease not found"))
+	} else if err != nil {
+		return lease, mw.Error(err)
+	}
+
+	if lease.CustomerTid != requestUserID {
+		return lease, mw.UnAuthorized(fmt.Errorf("request user identity does not match the ip lease customer-tid"))
+	}
+
+	return lease, nil
+}
+
+func (a *API) listIPLeases(r *http.Request) (interface{}, mw.Response) {
+	var filter types.IPLeaseFilter
+	filter, err := types.ApplyQueryFilterIPLease(r, filter)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	var total int64
+	if pagination.Count() {
+		total, err = filter.Count(r.Context(), db)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	filter = append(filter, pagination.Filter(false)...)
+	leases, err := filter.Find(r.Context(), db, pagination.FindOptions())
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	n, more := pagination.Trim(len(leases))
+	leases = leases[:n]
+
+	var last schema.ID
+	if n > 0 {
+		last = leases[n-1].ID
+	}
+
+	return leases, mw.Page(r, pagination, last, more, total)
+}
+
+func (a *API) getIPLease(r *http.Request) (interface{}, mw.Response) {
+	id, err := a.parseID(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid ip lease id"))
+	}
+
+	lease, err := types.IPLeaseFilter{}.WithID(id).Get(r.Context(), mw.Database(r))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, mw.NotFound(fmt.Errorf("ip lease not found"))
+	} else if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return lease, nil
+}
+
+// setIPLeaseHold sets the time the ip is held once its workload is deleted
+func (a *API) setIPLeaseHold(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	lease, mwErr := a.customerIPLease(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	var request IPLeaseHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	period := time.Duration(request.HoldPeriod) * time.Second
+	if err := types.IPLeaseSetHoldPeriod(r.Context(), mw.Database(r), lease.ID, period); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	return nil, mw.Ok()
+}
+
+// releaseIPLeaseNow releases a held ip before its hold expires
+func (a *API) releaseIPLeaseNow(r *http.Request) (interface{}, mw.Response) {
+	lease, mwErr := a.customerIPLease(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	if lease.State != types.IPLeaseHeld {
+		return nil, mw.Conflict(fmt.Errorf("ip is used by workload '%d', delete the workload to release it", lease.WorkloadID))
+	}
+
+	if err := a.releaseIPLease(r.Context(), mw.Database(r), lease); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return nil, mw.Ok()
+}
+
+// transferIPLease moves a held ip to another pool of the customer, the held
+// ip is billed on the new pool from then on
+func (a *API) transferIPLease(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	lease, mwErr := a.customerIPLease(r)
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	var request IPLeaseTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	if lease.State != types.IPLeaseHeld {
+		return nil, mw.Conflict(errors.New("only a held ip can be transferred, delete its workload first"))
+	}
+
+	if request.PoolID == lease.PoolID {
+		return nil, mw.BadRequest(errors.New("ip is already leased by this pool"))
+	}
+
+	db := mw.Database(r)
+	user, err := phonebook.UserFilter{}.WithID(schema.ID(lease.CustomerTid)).Get(r.Context(), db)
+	if err != nil {
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
+	}
+
+	if err := lease.TransferVerify(user.Pubkey, request.PoolID, request.Signature); err != nil {
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify transfer signature")).WithCode(mw.CodeSignatureInvalid)
+	}
+
+	pool, err := capacitytypes.GetPool(r.Context(), db, schema.ID(request.PoolID))
+	if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+		return nil, mw.NotFound(errors.New("pool does not exist")).WithCode(mw.CodePoolNotFound)
+	} else if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	workload, err := heldWorkload(r.Context(), db, lease)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if pool.CustomerTid != lease.CustomerTid || !pool.AllowedInPool(workload.GetNodeID()) {
+		return nil, mw.UnAuthorized(errors.New("pool is not owned by the customer or can not be used on the farm of the ip"))
+	}
+
+	workload.SetPoolID(request.PoolID)
+	allowed, err := a.capacityPlanner.HasCapacity(workload, minCapacitySeconds)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if !allowed {
+		return nil, mw.PaymentRequired(errors.New("pool needs additional capacity to hold the ip")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	if err := types.IPLeaseTransfer(r.Context(), db, lease.ID, request.PoolID); errors.Is(err, types.ErrIPLeaseNotHeld) {
+		return nil, mw.Conflict(err)
+	} else if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	// move the billing of the held ip to the new pool
+	if err := a.unbillHeldIP(r.Context(), db, lease); err != nil {
+		log.Error().Err(err).Int64("lease", int64(lease.ID)).Msg("failed to stop billing held ip on previous pool")
+	}
+
+	if err := a.capacityPlanner.AddUsedCapacity(workload); err != nil {
+		log.Error().Err(err).Int64("lease", int64(lease.ID)).Msg("failed to bill held ip on new pool")
+		return nil, mw.Error(err)
+	}
+
+	return nil, mw.Ok()
+}
@@ -0,0 +1,49 @@
+package workloads
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestListIPLeases(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("counted page", func(mt *mtest.T) {
+		ns := mt.DB.Name() + "." + types.IPLeaseCollection
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(3)}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				mockDocument(mt, types.IPLease{ID: 1, CustomerTid: 1}),
+				mockDocument(mt, types.IPLease{ID: 2, CustomerTid: 1}),
+			),
+		)
+
+		db, err := mw.NewDatabaseMiddleware(mt.DB.Name(), mt.Client)
+		require.NoError(mt, err)
+		var a API
+		router := mux.NewRouter()
+		router.Use(db.Middleware)
+		router.HandleFunc("/ips", mw.AsHandlerFunc(a.listIPLeases))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ips?page=1&size=2", nil))
+		require.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+
+		var leases []types.IPLease
+		require.NoError(mt, json.Unmarshal(w.Body.Bytes(), &leases))
+		assert.Len(mt, leases, 2)
+		assert.Equal(mt, "3", w.Header().Get("X-Total-Count"))
+		assert.Equal(mt, "2", w.Header().Get("Pages"))
+	})
+}
@@ -0,0 +1,227 @@
+package workloads
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// networkIDs returns the networks a workload is connected to
+func networkIDs(w types.WorkloaderType) []string {
+	switch workload := w.Workloader.(type) {
+	case *generated.Container:
+		ids := make([]string, 0, len(workload.NetworkConnection))
+		for _, conn := range workload.NetworkConnection {
+			ids = append(ids, conn.NetworkId)
+		}
+		return ids
+	case *generated.K8S:
+		return []string{workload.NetworkId}
+	case *generated.VirtualMachine:
+		return []string{workload.NetworkId}
+	}
+
+	return nil
+}
+
+// checkMigratable makes sure the replacement is the same stateless workload
+// as the current one, running on another node of the same pool
+func checkMigratable(current, replacement types.WorkloaderType) error {
+	switch workload := current.Workloader.(type) {
+	case *generated.Container:
+		if len(workload.Volumes) != 0 {
+			return errors.New("containers with volumes can not be migrated, volumes are bound to their node")
+		}
+	case *generated.K8S:
+		if len(workload.MasterIps) == 0 {
+			return errors.New("kubernetes masters can not be migrated, only workers can")
+		}
+	case *generated.VirtualMachine:
+	default:
+		return fmt.Errorf("workload of type '%s' can not be migrated", current.GetWorkloadType())
+	}
+
+	if replacement.GetWorkloadType() != current.GetWorkloadType() {
+		return fmt.Errorf("workload type can not be changed from '%s' to '%s'", current.GetWorkloadType(), replacement.GetWorkloadType())
+	}
+
+	if replacement.GetNodeID() == current.GetNodeID() {
+		return errors.New("workload must be migrated to another node")
+	}
+
+	if replacement.GetPoolID() != current.GetPoolID() {
+		return errors.New("workload pool can not be changed")
+	}
+
+	if replacement.GetCustomerTid() != current.GetCustomerTid() {
+		return errors.New("workload customer can not be changed")
+	}
+
+	if replacement.GetReference() != current.GetReference() {
+		return errors.New("workload reference can not be changed")
+	}
+
+	if k8s, ok := replacement.Workloader.(*generated.K8S); ok && len(k8s.MasterIps) == 0 {
+		return errors.New("kubernetes worker can not be migrated into a master")
+	}
+
+	currentNetworks, replacementNetworks := networkIDs(current), networkIDs(replacement)
+	if len(currentNetworks) != len(replacementNetworks) {
+		return errors.New("workload networks can not be changed")
+	}
+
+	for i := range currentNetworks {
+		if currentNetworks[i] != replacementNetworks[i] {
+			return errors.New("workload networks can not be changed")
+		}
+	}
+
+	return nil
+}
+
+// migrateWorkload creates a signed replacement of a deployed workload on
+// another node of the same pool. The current workload keeps running until the
+// replacement is reported deployed, it is then deleted by finishMigration.
+func (a *API) migrateWorkload(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id)
+
+	db := mw.Database(r)
+	current, err := a.workloadpipeline(filter.Get(r.Context(), db))
+	if err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	if current.GetCustomerTid() != requestUserID {
+		return nil, mw.UnAuthorized(fmt.Errorf("request user identity does not match the workload customer-tid"))
+	}
+
+	if !current.IsAny(types.Deploy) {
+		return nil, mw.Conflict(fmt.Errorf("workload is in state '%s', only deployed workloads can be migrated", current.GetNextAction().String()))
+	}
+
+	if current.GetMigratedTo() != 0 {
+		return nil, mw.Conflict(fmt.Errorf("workload is already being migrated to workload '%d'", current.GetMigratedTo()))
+	}
+
+	bodyBuf := bytes.NewBuffer(nil)
+	bodyBuf.ReadFrom(r.Body)
+
+	replacement, mwErr := a.prepareWorkload(r.Context(), db, requestUserID, 0, bodyBuf.Bytes())
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	if err := checkMigratable(current, replacement); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	if mwErr := a.validateDependencies(r.Context(), db, replacement, nil); mwErr != nil {
+		return nil, mwErr
+	}
+
+	// the current workload is released once the replacement is deployed, so
+	// the pool only needs to afford one of them
+	allowed, err := a.capacityPlanner.HasCapacityForUpdate(current, replacement, minCapacitySeconds)
+	if err != nil {
+		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+			return nil, mw.Error(errors.New("pool does not exist"))
+		}
+		log.Error().Err(err).Msg("failed to load workload capacity pool")
+		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+	}
+
+	if !allowed {
+		return nil, mw.PaymentRequired(errors.New("pool needs additional capacity to support the migrated workload")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	replacement.SetMigratedFrom(id)
+	replacementID, err := types.WorkloadCreate(r.Context(), db, replacement)
+	if err != nil {
+		log.Error().Err(err).Msg("could not create migrated workload")
+		return nil, mw.Error(err)
+	}
+
+	if err := types.WorkloadMigrationStart(r.Context(), db, current, replacement); err != nil {
+		if rmErr := types.WorkloadsRemove(r.Context(), db, []schema.ID{replacementID}); rmErr != nil {
+			log.Error().Err(rmErr).Int64("workload", int64(replacementID)).Msg("failed to remove migrated workload")
+		}
+
+		if errors.Is(err, types.ErrMigrationInProgress) {
+			return nil, mw.Conflict(err)
+		}
+		return nil, mw.Error(err)
+	}
+
+	if err := a.toDeployOrApprove(r.Context(), db, replacement, types.ReasonMigrationStarted); err != nil {
+		log.Error().Err(err).Msg("failed to schedule the migrated workload to deploy")
+		return nil, mw.Error(errors.New("could not schedule migrated workload to deploy"))
+	}
+
+	if replacement.HasExpiration() {
+		a.expirer.Reschedule()
+	}
+
+	return ReservationCreateResponse{ID: replacementID}, mw.Created()
+}
+
+// finishMigration is called when a node reports the result of a workload
+// which replaces another one. Once the replacement is deployed the replaced
+// workload is deleted, if the replacement failed the replaced workload can be
+// migrated again.
+func (a *API) finishMigration(ctx context.Context, db *mongo.Database, replacement types.WorkloaderType, state generated.ResultStateEnum) error {
+	var filter types.WorkloadFilter
+	filter = filter.WithID(replacement.GetMigratedFrom())
+
+	current, err := a.workloadpipeline(filter.Get(ctx, db))
+	if err != nil {
+		return errors.Wrap(err, "failed to load migrated workload")
+	}
+
+	// results are also reported when the replacement is updated later on,
+	// the migration is only finished once
+	if current.GetMigratedTo() != replacement.GetID() || !current.IsAny(types.Deploy) {
+		return nil
+	}
+
+	switch state {
+	case generated.ResultStateOK:
+		types.WorkloadMigrationDone(ctx, db, current, replacement)
+		if _, err := a.setWorkloadDelete(ctx, db, current, types.ReasonMigrated); err != nil {
+			return err
+		}
+
+		// the node of the replaced workload may be down and never report the
+		// workload deleted, so its capacity is released right away
+		return releaseDeletedCapacity(ctx, db, a.capacityPlanner, current)
+	case generated.ResultStateError:
+		return types.WorkloadMigrationFailed(ctx, db, current, replacement)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package workloads
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+)
+
+func Test_checkMigratable(t *testing.T) {
+	container := func(nodeID string, networks ...string) *workloads.Container {
+		c := &workloads.Container{}
+		c.WorkloadType = workloads.WorkloadTypeContainer
+		c.NodeId = nodeID
+		c.PoolId = 1
+		c.CustomerTid = 1
+		c.Reference = "ref"
+		for _, network := range networks {
+			c.NetworkConnection = append(c.NetworkConnection, workloads.NetworkConnection{NetworkId: network})
+		}
+		return c
+	}
+
+	k8s := func(nodeID string, masters ...net.IP) *workloads.K8S {
+		k := &workloads.K8S{}
+		k.WorkloadType = workloads.WorkloadTypeKubernetes
+		k.NodeId = nodeID
+		k.PoolId = 1
+		k.CustomerTid = 1
+		k.NetworkId = "net"
+		k.MasterIps = masters
+		return k
+	}
+
+	master := net.ParseIP("10.1.1.1")
+
+	withVolume := container("node", "net")
+	withVolume.Volumes = []workloads.ContainerMount{{VolumeId: "1-1", Mountpoint: "/data"}}
+
+	otherPool := container("other", "net")
+	otherPool.PoolId = 2
+
+	otherReference := container("other", "net")
+	otherReference.Reference = "other"
+
+	volume := &workloads.Volume{}
+	volume.WorkloadType = workloads.WorkloadTypeVolume
+	volume.NodeId = "node"
+
+	tests := []struct {
+		name        string
+		current     workloads.Workloader
+		replacement workloads.Workloader
+		err         bool
+	}{
+		{
+			name:        "container",
+			current:     container("node", "net"),
+			replacement: container("other", "net"),
+			err:         false,
+		},
+		{
+			name:        "same node",
+			current:     container("node", "net"),
+			replacement: container("node", "net"),
+			err:         true,
+		},
+		{
+			name:        "pool",
+			current:     container("node", "net"),
+			replacement: otherPool,
+			err:         true,
+		},
+		{
+			name:        "reference",
+			current:     container("node", "net"),
+			replacement: otherReference,
+			err:         true,
+		},
+		{
+			name:        "network",
+			current:     container("node", "net"),
+			replacement: container("other", "net", "net2"),
+			err:         true,
+		},
+		{
+			name:        "volumes",
+			current:     withVolume,
+			replacement: container("other", "net"),
+			err:         true,
+		},
+		{
+			name:        "k8s worker",
+			current:     k8s("node", master),
+			replacement: k8s("other", master),
+			err:         false,
+		},
+		{
+			name:        "k8s master",
+			current:     k8s("node"),
+			replacement: k8s("other"),
+			err:         true,
+		},
+		{
+			name:        "k8s worker to master",
+			current:     k8s("node", master),
+			replacement: k8s("other"),
+			err:         true,
+		},
+		{
+			name:        "volume",
+			current:     volume,
+			replacement: volume,
+			err:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMigratable(types.WorkloaderType{Workloader: tt.current}, types.WorkloaderType{Workloader: tt.replacement})
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package workloads
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/mw"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+)
+
+// maxNodeWait is the maximum time a node poll can wait for new work
+const maxNodeWait = 60 * time.Second
+
+const (
+	// NodeSignatureHeader holds the hex encoded signature of a node poll
+	// response
+	NodeSignatureHeader = "x-signature"
+	// NodeSignatureTimestampHeader holds the time the node poll response was
+	// signed at, as a unix timestamp
+	NodeSignatureTimestampHeader = "x-signature-timestamp"
+)
+
+// SigningKeyResponse is the public key the explorer signs node responses with
+type SigningKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+// nodeResponseMessage builds the message signed for a node poll response,
+// it covers the node, the headers used by the node and the body
+func nodeResponseMessage(nodeID string, header http.Header, body []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n%s\n%s\n%s\n",
+		nodeID,
+		header.Get("x-last-id"),
+		header.Get("x-updated"),
+		header.Get(NodeSignatureTimestampHeader),
+	)
+	buf.Write(bytes.TrimSuffix(body, []byte("\n")))
+
+	return buf.Bytes()
+}
+
+// VerifyNodeResponse verifies the signature of a node poll response against
+// the explorer public key, it returns the time the response was signed at so
+// the caller can reject responses that are too old
+func VerifyNodeResponse(pk ed25519.PublicKey, nodeID string, header http.Header, body []byte) (time.Time, error) {
+	signature, err := hex.DecodeString(header.Get(NodeSignatureHeader))
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid signature format, expecting hex encoded string")
+	}
+
+	ts, err := strconv.ParseInt(header.Get(NodeSignatureTimestampHeader), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid signature timestamp")
+	}
+
+	if !ed25519.Verify(pk, nodeResponseMessage(nodeID, header, body), signature) {
+		return time.Time{}, errors.New("invalid signature")
+	}
+
+	return time.Unix(ts, 0), nil
+}
+
+// parseNodeWait reads the time a node poll can wait for new work
+func parseNodeWait(r *http.Request) (time.Duration, error) {
+	seconds, err := models.QueryInt(r, "wait")
+	if err != nil {
+		return 0, errors.Wrap(err, "wait should be an integer")
+	}
+
+	if seconds < 0 {
+		return 0, fmt.Errorf("wait can't be negative")
+	}
+
+	wait := time.Duration(seconds) * time.Second
+	if wait > maxNodeWait {
+		wait = maxNodeWait
+	}
+
+	return wait, nil
+}
+
+// workloads returns the workloads a node needs to process. If wait is set and
+// there is no work for the node, the request blocks until new work is queued
+// for the node or the wait time expires. The response is signed if the
+// explorer has a signing key.
+func (a *API) workloads(r *http.Request) (interface{}, mw.Response) {
+	var (
+		nodeID = mux.Vars(r)["node_id"]
+	)
+
+	lastID, err := a.parseID(r.FormValue("from"))
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	wait, err := parseNodeWait(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	version := types.NodeWork.Version(nodeID)
+	workloads, nextID, updates, err := a.nodeWorkloads(r.Context(), db, nodeID, lastID)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if len(workloads) == 0 && wait > 0 {
+		// even if the wait times out the database is checked again, since the
+		// work could have been queued by another explorer instance
+		types.NodeWork.Wait(r.Context(), nodeID, version, wait)
+		if r.Context().Err() != nil {
+			return nil, mw.Error(r.Context().Err())
+		}
+
+		workloads, nextID, updates, err = a.nodeWorkloads(r.Context(), db, nodeID, lastID)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	response := mw.Ok().WithHeader("x-last-id", fmt.Sprint(nextID))
+	if len(updates) > 0 {
+		// updated workloads are sent again with the same id, this tells the
+		// node it needs to replace the workload it has with the new version
+		response = response.WithHeader("x-updated", strings.Join(updates, ","))
+	}
+
+	if a.signer == nil {
+		return workloads, response
+	}
+
+	// the body is encoded here so the signature covers the exact bytes sent
+	body, err := json.Marshal(workloads)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	response = response.WithHeader(NodeSignatureTimestampHeader, fmt.Sprint(time.Now().Unix()))
+	signature := ed25519.Sign(a.signer, nodeResponseMessage(nodeID, response.Header(), body))
+	response = response.WithHeader(NodeSignatureHeader, hex.EncodeToString(signature))
+
+	return json.RawMessage(body), response
+}
+
+func (a *API) getSigningKey(r *http.Request) (interface{}, mw.Response) {
+	if a.signer == nil {
+		return nil, mw.NotFound(errors.New("explorer has no signing key"))
+	}
+
+	return SigningKeyResponse{
+		PublicKey: hex.EncodeToString(a.signer.Public().(ed25519.PublicKey)),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package workloads
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyNodeResponse(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	now := time.Now().Unix()
+	body := []byte(`[{"workload_id":"1-1"}]`)
+	header := http.Header{}
+	header.Set("x-last-id", "10")
+	header.Set(NodeSignatureTimestampHeader, fmt.Sprint(now))
+	header.Set(NodeSignatureHeader, hex.EncodeToString(ed25519.Sign(sk, nodeResponseMessage("node", header, body))))
+
+	// the encoder adds a new line to the body
+	signed, err := VerifyNodeResponse(pk, "node", header, append(body, '\n'))
+	require.NoError(t, err)
+	assert.Equal(t, now, signed.Unix())
+
+	_, err = VerifyNodeResponse(pk, "other", header, body)
+	assert.Error(t, err)
+
+	_, err = VerifyNodeResponse(pk, "node", header, []byte(`[]`))
+	assert.Error(t, err)
+
+	header.Set("x-last-id", "11")
+	_, err = VerifyNodeResponse(pk, "node", header, body)
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package workloads
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
 	"github.com/threefoldtech/tfexplorer/schema"
 	"github.com/zaibon/httpsig"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -40,6 +42,15 @@ type (
 		escrow          escrow.Escrow
 		capacityPlanner capacity.Planner
 		network         gridnetworks.GridNetwork
+		// signer signs the node poll responses, can be nil
+		signer ed25519.PrivateKey
+		// expirer deletes the workloads once they expire
+		expirer *Expirer
+		// quota limits the workloads and reservations of the users
+		quota *mw.Quota
+		// legacy is set while the legacy reservations are still served, once
+		// they are all converted only the new style workloads are looked up
+		legacy bool
 	}
 
 	// ReservationCreateResponse wraps reservation create response
@@ -76,12 +87,85 @@ func (a *API) create(r *http.Request) (interface{}, mw.Response) {
 
 	bodyBuf := bytes.NewBuffer(nil)
 	bodyBuf.ReadFrom(r.Body)
-	w, err := workloads.UnmarshalJSON(bodyBuf.Bytes())
+
+	db := mw.Database(r)
+	workload, mwErr := a.prepareWorkload(r.Context(), db, requestUserID, 0, bodyBuf.Bytes())
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	// the customer is verified by now, so the quota is always the one of the
+	// owner of the workload
+	if err := a.quota.Check(r.Context(), workload.GetCustomerTid(), mw.QuotaWorkloads, 1); err != nil {
+		return nil, mw.QuotaError(err)
+	}
+
+	if mwErr := a.validateDependencies(r.Context(), db, workload, nil); mwErr != nil {
+		return nil, mwErr
+	}
+
+	id, err := types.WorkloadCreate(r.Context(), db, workload)
 	if err != nil {
-		return nil, mw.BadRequest(err)
+		log.Error().Err(err).Msg("could not create workload")
+		return nil, mw.Error(err)
+	}
+
+	workload, err = types.WorkloadFilter{}.WithID(id).Get(r.Context(), db)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch workload we just saved")
+		return nil, mw.Error(err)
+	}
+
+	allowed, err := a.capacityPlanner.HasCapacity(workload, minCapacitySeconds)
+	if err != nil {
+		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+			log.Error().Err(err).Int64("poolID", workload.GetPoolID()).Msg("pool disappeared")
+			return nil, mw.Error(errors.New("pool does not exist"))
+		}
+		log.Error().Err(err).Msg("failed to load workload capacity pool")
+		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+	}
+
+	if !allowed {
+		log.Debug().Msg("don't deploy workload as its pool is almost empty")
+		if err := types.WorkloadSetNextAction(r.Context(), db, id, generated.NextActionInvalid, types.ReasonPoolEmpty); err != nil {
+			return nil, mw.Error(fmt.Errorf("failed to marked the workload as invalid:%w", err))
+		}
+		return ReservationCreateResponse{ID: id}, mw.PaymentRequired(errors.New("pool needs additional capacity to support this workload")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	if workload.GetWorkloadType() == generated.WorkloadTypePublicIP {
+		if err := a.handlePublicIPReservation(r.Context(), db, workload); err != nil {
+			return nil, err
+		}
+	}
+
+	// immediately deploy the workload, unless the farmer has to approve it
+	if err := a.toDeployOrApprove(r.Context(), db, workload, types.ReasonCreated); err != nil {
+		log.Error().Err(err).Msg("failed to schedule the reservation to deploy")
+		return nil, mw.Error(errors.New("could not schedule reservation to deploy"))
 	}
 
-	workload := types.WorkloaderType{Workloader: w}
+	if workload.HasExpiration() {
+		a.expirer.Reschedule()
+	}
+
+	return ReservationCreateResponse{ID: id}, mw.Created()
+}
+
+// prepareWorkload decodes a new workload, and runs all the checks needed before
+// the workload can be saved: the workload must be valid and signed by the user
+// making the request, and the user must be allowed to use the pool.
+// replaces is the ID of the workload being updated, or 0 for a new workload.
+func (a *API) prepareWorkload(ctx context.Context, db *mongo.Database, requestUserID int64, replaces schema.ID, data []byte) (types.WorkloaderType, mw.Response) {
+	var workload types.WorkloaderType
+
+	w, err := workloads.UnmarshalJSON(data)
+	if err != nil {
+		return workload, mw.BadRequest(err)
+	}
+
+	workload = types.WorkloaderType{Workloader: w}
 
 	// we make sure those arrays are initialized correctly
 	// this will make updating the document in place much easier
@@ -92,45 +176,48 @@ func (a *API) create(r *http.Request) (interface{}, mw.Response) {
 	workload.SetResult(generated.Result{})
 	workload.SetID(schema.ID(0))
 	workload.SetVersion(lastestWorkloadVersion)
+	workload.SetMigratedFrom(0)
+	workload.SetMigratedTo(0)
+	workload.SetConvertedFrom(0)
+	workload.SetExplorerConverted(false)
+	workload.SetDeletedAt(schema.Date{})
 
 	if err := workload.Validate(); err != nil {
-		return nil, mw.BadRequest(err)
+		return workload, mw.BadRequest(err)
 	}
 
 	if workload.GetCustomerTid() != requestUserID {
-		return nil, mw.UnAuthorized(fmt.Errorf("request user identity does not match the reservation customer-tid"))
+		return workload, mw.UnAuthorized(fmt.Errorf("request user identity does not match the reservation customer-tid"))
 	}
 
 	workload, err = a.workloadpipeline(workload, nil)
 	if err != nil {
 		// if failed to create pipeline, then
 		// this reservation has failed initial validation
-		return nil, mw.BadRequest(err)
+		return workload, mw.BadRequest(err)
 	}
 
 	// force next action to create.
 	workload.SetNextAction(generated.NextActionCreate)
 
 	if workload.IsAny(types.Invalid, types.Delete) {
-		return nil, mw.BadRequest(fmt.Errorf("invalid request wrong status '%s'", workload.GetNextAction().String()))
+		return workload, mw.BadRequest(fmt.Errorf("invalid request wrong status '%s'", workload.GetNextAction().String()))
 	}
 
-	db := mw.Database(r)
-
 	var filter phonebook.UserFilter
 	filter = filter.WithID(schema.ID(workload.GetCustomerTid()))
-	user, err := filter.Get(r.Context(), db)
+	user, err := filter.Get(ctx, db)
 	if err != nil {
-		return nil, mw.BadRequest(errors.Wrapf(err, "cannot find user with id '%d'", workload.GetCustomerTid()))
+		return workload, mw.BadRequest(errors.Wrapf(err, "cannot find user with id '%d'", workload.GetCustomerTid()))
 	}
 
 	signature, err := hex.DecodeString(workload.GetCustomerSignature())
 	if err != nil {
-		return nil, mw.BadRequest(errors.Wrap(err, "invalid signature format, expecting hex encoded string"))
+		return workload, mw.BadRequest(errors.Wrap(err, "invalid signature format, expecting hex encoded string"))
 	}
 
 	if err := workload.Verify(user.Pubkey, signature); err != nil {
-		return nil, mw.BadRequest(errors.Wrap(err, "failed to verify customer signature"))
+		return workload, mw.BadRequest(errors.Wrap(err, "failed to verify customer signature"))
 	}
 
 	workload.SetEpoch(schema.Date{Time: time.Now()})
@@ -138,78 +225,40 @@ func (a *API) create(r *http.Request) (interface{}, mw.Response) {
 	allowed, err := a.capacityPlanner.IsAllowed(workload)
 	if err != nil {
 		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
-			return nil, mw.NotFound(errors.New("pool does not exist"))
+			return workload, mw.NotFound(errors.New("pool does not exist")).WithCode(mw.CodePoolNotFound)
 		}
 		log.Error().Err(err).Msg("failed to load workload capacity pool")
-		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+		return workload, mw.Error(errors.New("could not load the required capacity pool"))
 	}
 
 	if !allowed {
-		return nil, mw.Forbidden(errors.New("not allowed to deploy workload on this pool"))
+		return workload, mw.Forbidden(errors.New("not allowed to deploy workload on this pool"))
+	}
+
+	if err := a.handleGatewayDomain(ctx, db, workload); err != nil {
+		return workload, err
 	}
 
 	// this has to be done before checking the capacity planner
 	// for capacityand of course before storing the object
 	if workload.GetWorkloadType() == generated.WorkloadTypeKubernetes {
-		if err := a.handleKubernetesSize(r.Context(), db, workload); err != nil {
-			return nil, err
+		if err := a.handleKubernetesSize(ctx, db, workload); err != nil {
+			return workload, err
 		}
 	}
 
 	if workload.GetWorkloadType() == generated.WorkloadTypeKubernetes {
-		if err := a.handleKubernetesPublicIP(r.Context(), db, workload, requestUserID); err != nil {
-			return nil, err
+		if err := a.handleKubernetesPublicIP(ctx, db, workload, requestUserID, replaces); err != nil {
+			return workload, err
 		}
 	} else if workload.GetWorkloadType() == generated.WorkloadTypeVirtualMachine {
-		if err := a.handleVMPublicIP(r.Context(), db, workload, requestUserID); err != nil {
-			return nil, err
-		}
-
-	}
-
-	id, err := types.WorkloadCreate(r.Context(), db, workload)
-	if err != nil {
-		log.Error().Err(err).Msg("could not create workload")
-		return nil, mw.Error(err)
-	}
-
-	workload, err = types.WorkloadFilter{}.WithID(id).Get(r.Context(), db)
-	if err != nil {
-		log.Error().Err(err).Msg("could not fetch workload we just saved")
-		return nil, mw.Error(err)
-	}
-
-	allowed, err = a.capacityPlanner.HasCapacity(workload, minCapacitySeconds)
-	if err != nil {
-		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
-			log.Error().Err(err).Int64("poolID", workload.GetPoolID()).Msg("pool disappeared")
-			return nil, mw.Error(errors.New("pool does not exist"))
-		}
-		log.Error().Err(err).Msg("failed to load workload capacity pool")
-		return nil, mw.Error(errors.New("could not load the required capacity pool"))
-	}
-
-	if !allowed {
-		log.Debug().Msg("don't deploy workload as its pool is almost empty")
-		if err := types.WorkloadSetNextAction(r.Context(), db, id, generated.NextActionInvalid); err != nil {
-			return nil, mw.Error(fmt.Errorf("failed to marked the workload as invalid:%w", err))
-		}
-		return ReservationCreateResponse{ID: id}, mw.PaymentRequired(errors.New("pool needs additional capacity to support this workload"))
-	}
-
-	if workload.GetWorkloadType() == generated.WorkloadTypePublicIP {
-		if err := a.handlePublicIPReservation(r.Context(), db, workload); err != nil {
-			return nil, err
+		if err := a.handleVMPublicIP(ctx, db, workload, requestUserID, replaces); err != nil {
+			return workload, err
 		}
-	}
 
-	// immediately deploy the workload
-	if err := types.WorkloadToDeploy(r.Context(), db, workload); err != nil {
-		log.Error().Err(err).Msg("failed to schedule the reservation to deploy")
-		return nil, mw.Error(errors.New("could not schedule reservation to deploy"))
 	}
 
-	return ReservationCreateResponse{ID: id}, mw.Created()
+	return workload, nil
 }
 
 func (a *API) setupPool(r *http.Request) (interface{}, mw.Response) {
@@ -270,6 +319,12 @@ func (a *API) setupPool(r *http.Request) (interface{}, mw.Response) {
 	if err := reservation.Verify(user.Pubkey); err != nil {
 		return nil, mw.BadRequest(errors.Wrap(err, "failed to verify customer signature"))
 	}
+
+	// every reservation makes the escrow create a new funded account, so the
+	// number of reservations waiting for payment is limited
+	if err := a.quota.Check(r.Context(), reservation.CustomerTid, mw.QuotaUnpaidReservations, 1); err != nil {
+		return nil, mw.QuotaError(err)
+	}
 	// sponsor filter
 
 	if reservation.SponsorTid != 0 {
@@ -321,7 +376,7 @@ func (a *API) getPool(r *http.Request) (interface{}, mw.Response) {
 	pool, err := a.capacityPlanner.PoolByID(id)
 	if err != nil {
 		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
-			return nil, mw.NotFound(errors.New("capacity pool not found"))
+			return nil, mw.NotFound(errors.New("capacity pool not found")).WithCode(mw.CodePoolNotFound)
 		}
 		return nil, mw.Error(err)
 	}
@@ -427,6 +482,11 @@ func (a *API) getWorkload(r *http.Request) (interface{}, mw.Response) {
 
 	db := mw.Database(r)
 	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// deleted workloads are moved to the archive after a while
+		workload, err = types.WorkloadArchiveGet(r.Context(), db, id)
+	}
+
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, mw.NotFound(err)
@@ -490,29 +550,78 @@ func (a *API) listWorkload(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.BadRequest(err)
 	}
 
+	sort, err := types.WorkloadSortFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
 	db := mw.Database(r)
-	pager := models.PageFromRequest(r)
-	cur, err := filter.FindCursor(r.Context(), db, pager)
+
+	farmID, err := models.QueryInt(r, "farm_id")
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, mw.BadRequest(errors.Wrap(err, "farm_id should be an integer"))
+	}
+	if farmID != 0 {
+		nodeIDs, err := farmWorkerIDs(r.Context(), db, farmID)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+		filter = filter.WithNodeIDs(nodeIDs)
 	}
 
-	defer cur.Close(r.Context())
+	pagination, err := models.PaginationFromRequest(r)
+	if err != nil {
+		return nil, mw.BadRequest(err)
+	}
 
-	total, err := filter.Count(r.Context(), db)
+	var total int64
+	if pagination.Count() {
+		total, err = filter.Count(r.Context(), db)
+		if err != nil {
+			return nil, mw.Error(err)
+		}
+	}
+
+	if pagination.Keyset() {
+		// the cursor is an id, so the list can only be ordered by id
+		if len(sort) != 1 || sort[0].Key != "_id" {
+			return nil, mw.BadRequest(errors.New("workloads paginated with a cursor can only be sorted by id"))
+		}
+		filter = append(filter, pagination.Filter(sort[0].Value == -1)...)
+	}
+
+	opts := pagination.FindOptions()
+	opts.Sort = sort
+	cur, err := filter.FindCursor(r.Context(), db, opts)
 	if err != nil {
 		return nil, mw.Error(err)
 	}
 
-	reservations := []types.WorkloaderType{}
+	defer cur.Close(r.Context())
+
+	var (
+		reservations = []types.WorkloaderType{}
+		last         schema.ID
+		more         bool
+		loaded       int
+	)
 
 	for cur.Next(r.Context()) {
+		// the page is full, the extra item loaded is only used to know if
+		// there is a next page
+		if _, more = pagination.Trim(loaded + 1); more {
+			break
+		}
+		loaded++
+
+		// workloads which are skipped still move the cursor forward
+		last = schema.ID(cur.Current.Lookup("_id").Int64())
+
 		var workload types.WorkloaderType
 		if err := cur.Decode(&workload); err != nil {
 			// skip reservations we can not load
 			// this is probably an old reservation
-			currentID := cur.Current.Lookup("_id").Int64()
-			log.Error().Err(err).Int64("id", currentID).Msg("failed to decode reservation")
+			log.Error().Err(err).Int64("id", int64(last)).Msg("failed to decode reservation")
 			continue
 		}
 
@@ -525,67 +634,107 @@ func (a *API) listWorkload(r *http.Request) (interface{}, mw.Response) {
 		reservations = append(reservations, workload)
 	}
 
-	pages := fmt.Sprintf("%d", models.NrPages(total, *pager.Limit))
-	return reservations, mw.Ok().WithHeader("Pages", pages)
+	return reservations, mw.Page(r, pagination, last, more, total)
 }
 
-func (a *API) queued(ctx context.Context, db *mongo.Database, nodeID string, limit int64) ([]types.WorkloaderType, error) {
+// farmWorkerIDs returns the ids of all the nodes and gateways of the farm,
+// including the deleted ones so their workloads are still found
+func farmWorkerIDs(ctx context.Context, db *mongo.Database, farmID int64) ([]string, error) {
+	var nodeFilter directory.NodeFilter
+	nodeFilter = nodeFilter.WithFarmID(schema.ID(farmID))
+
+	var nodes []directory.Node
+	cur, err := nodeFilter.Find(ctx, db, options.Find().SetProjection(bson.M{"node_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, &nodes); err != nil {
+		return nil, err
+	}
+
+	var gwFilter directory.GatewayFilter
+	gwFilter = gwFilter.WithFarmID(int(farmID))
+
+	var gateways []directory.Gateway
+	cur, err = gwFilter.Find(ctx, db, options.Find().SetProjection(bson.M{"node_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, &gateways); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(nodes)+len(gateways))
+	for _, node := range nodes {
+		ids = append(ids, node.NodeId)
+	}
+	for _, gw := range gateways {
+		ids = append(ids, gw.NodeId)
+	}
+
+	return ids, nil
+}
+
+// queued returns the workloads in the queue of the node, and the ids of the
+// queued workloads which are updates of a workload already sent to the node
+func (a *API) queued(ctx context.Context, db *mongo.Database, nodeID string, limit int64) ([]types.WorkloaderType, []string, error) {
 
 	workloads := make([]types.WorkloaderType, 0)
+	var updated []string
 
 	var queue types.QueueFilter
 	queue = queue.WithNodeID(nodeID)
 
 	cur, err := queue.Find(ctx, db, options.Find().SetLimit(limit))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer cur.Close(ctx)
 
 	for cur.Next(ctx) {
 		var wl types.WorkloaderType
 		if err := cur.Decode(&wl); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		workloads = append(workloads, wl)
+
+		var marker struct {
+			Update bool `bson:"update"`
+		}
+		if err := cur.Decode(&marker); err != nil {
+			return nil, nil, err
+		}
+		if marker.Update {
+			updated = append(updated, wl.UniqueWorkloadID())
+		}
 	}
 
-	return workloads, nil
+	return workloads, updated, nil
 }
 
-func (a *API) workloads(r *http.Request) (interface{}, mw.Response) {
-	const (
-		maxPageSize = 200
-	)
-
-	var (
-		nodeID = mux.Vars(r)["node_id"]
-	)
-
-	db := mw.Database(r)
+// legacyNodeWorkloads returns the workloads of the legacy reservations a node
+// needs to process
+func (a *API) legacyNodeWorkloads(ctx context.Context, db *mongo.Database, nodeID string, lastID schema.ID, maxPageSize int) ([]types.WorkloaderType, schema.ID, error) {
 	var workloads []types.WorkloaderType
 
-	lastID, err := a.parseID(r.FormValue("from"))
-	if err != nil {
-		return nil, mw.BadRequest(err)
-	}
-
-	//var lastID schema.ID
-
 	rfilter := types.ReservationFilter{}.WithIDGE(lastID)
 	rfilter = rfilter.WithNodeID(nodeID)
 
-	cur, err := rfilter.Find(r.Context(), db)
+	cur, err := rfilter.Find(ctx, db)
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, 0, err
 	}
 
-	defer cur.Close(r.Context())
+	defer cur.Close(ctx)
 
-	for cur.Next(r.Context()) {
+	for cur.Next(ctx) {
 		var reservation types.Reservation
 		if err := cur.Decode(&reservation); err != nil {
-			return nil, mw.Error(err)
+			return nil, 0, err
 		}
 
 		reservation, err = a.pipeline(reservation, nil)
@@ -607,35 +756,57 @@ func (a *API) workloads(r *http.Request) (interface{}, mw.Response) {
 		}
 	}
 
-	// if we have sufficient data return
-	if len(workloads) >= maxPageSize {
-		return workloads, mw.Ok().WithHeader("x-last-id", fmt.Sprint(lastID))
+	return workloads, lastID, nil
+}
+
+// nodeWorkloads returns the workloads the node needs to process starting from
+// lastID, the id to poll from next, and the ids of the updated workloads
+func (a *API) nodeWorkloads(ctx context.Context, db *mongo.Database, nodeID string, lastID schema.ID) ([]types.WorkloaderType, schema.ID, []string, error) {
+	const (
+		maxPageSize = 200
+	)
+
+	var workloads []types.WorkloaderType
+	if a.legacy {
+		var err error
+		workloads, lastID, err = a.legacyNodeWorkloads(ctx, db, nodeID, lastID, maxPageSize)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		// if we have sufficient data return
+		if len(workloads) >= maxPageSize {
+			return workloads, lastID, nil, nil
+		}
 	}
 
 	filter := types.WorkloadFilter{}.WithIDGE(lastID)
 	filter = filter.WithNodeID(nodeID)
 
-	cur, err = filter.FindCursor(r.Context(), db)
+	cur, err := filter.FindCursor(ctx, db)
 	if err != nil {
-		return nil, mw.Error(err)
+		return nil, 0, nil, err
 	}
-	defer cur.Close(r.Context())
+	defer cur.Close(ctx)
 
-	for cur.Next(r.Context()) {
+	for cur.Next(ctx) {
 		var workloader types.WorkloaderType
 		if err := cur.Decode(&workloader); err != nil {
-			return nil, mw.Error(err)
+			return nil, 0, nil, err
 		}
 
+		stored := workloader.GetNextAction()
 		workloader, err = a.workloadpipeline(workloader, nil)
 		if err != nil {
 			log.Error().Err(err).Int64("id", int64(workloader.GetID())).Msg("failed to process workload")
 			continue
 		}
 
-		if workloader.GetNextAction() == types.Delete {
-			if err := types.WorkloadSetNextAction(r.Context(), db, workloader.GetID(), generated.NextActionDelete); err != nil {
-				return nil, mw.Error(err)
+		// the pipeline only deletes a workload once its delete signatures are
+		// complete, the other deletes are saved with their reason already
+		if stored != types.Delete && workloader.GetNextAction() == types.Delete {
+			if err := types.WorkloadSetNextAction(ctx, db, workloader.GetID(), generated.NextActionDelete, types.ReasonDeleteSigned); err != nil {
+				return nil, 0, nil, err
 			}
 		}
 
@@ -653,18 +824,20 @@ func (a *API) workloads(r *http.Request) (interface{}, mw.Response) {
 
 	// if we have sufficient data return
 	if len(workloads) >= maxPageSize {
-		return workloads, mw.Ok().WithHeader("x-last-id", fmt.Sprint(lastID))
+		return workloads, lastID, nil, nil
 	}
 
+	var updates []string
 	if len(workloads) == 0 {
 		// only if the workloads list is empty
 		// we can check the queues
 		// queues usually have the workloads with older ids that
 		// are now possible to process.
-		queued, err := a.queued(r.Context(), db, nodeID, maxPageSize)
+		queued, updated, err := a.queued(ctx, db, nodeID, maxPageSize)
 		if err != nil {
-			return nil, mw.Error(err)
+			return nil, 0, nil, err
 		}
+		updates = updated
 
 		log.Debug().Msgf("%d queue", len(queued))
 		for _, workload := range queued {
@@ -676,16 +849,20 @@ func (a *API) workloads(r *http.Request) (interface{}, mw.Response) {
 	}
 
 	if len(workloads) == 0 {
-		lastID, err = types.WorkloadsLastID(r.Context(), db)
+		lastID, err = types.WorkloadsLastID(ctx, db)
 		if err != nil {
-			return nil, mw.Error(err)
+			return nil, 0, nil, err
 		}
 	}
 
-	return workloads, mw.Ok().WithHeader("x-last-id", fmt.Sprint(lastID))
+	return workloads, lastID, updates, nil
 }
 
 func (a *API) workloadGet(r *http.Request) (interface{}, mw.Response) {
+	if !a.legacy {
+		return a.newWorkloadGet(r)
+	}
+
 	gwid := mux.Vars(r)["gwid"]
 
 	rid, err := a.parseID(strings.Split(gwid, "-")[0])
@@ -748,11 +925,11 @@ func (a *API) newWorkloadGet(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if workload.UniqueWorkloadID() != gwid {
-		return nil, mw.NotFound(fmt.Errorf("workload not found"))
+		return nil, mw.NotFound(fmt.Errorf("workload not found")).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	var result struct {
@@ -786,13 +963,17 @@ func (a *API) workloadPutResult(r *http.Request) (interface{}, mw.Response) {
 	result.Epoch = schema.Date{Time: time.Now()}
 
 	if err := result.Verify(nodeID); err != nil {
-		return nil, mw.UnAuthorized(errors.Wrap(err, "invalid result signature"))
+		return nil, mw.UnAuthorized(errors.Wrap(err, "invalid result signature")).WithCode(mw.CodeSignatureInvalid)
+	}
+
+	db := mw.Database(r)
+	if !a.legacy {
+		return a.newStyleWorkloadPutResult(r.Context(), db, gwid, rid, result)
 	}
 
 	var filter types.ReservationFilter
 	filter = filter.WithID(rid)
 
-	db := mw.Database(r)
 	reservation, err := a.pipeline(filter.Get(r.Context(), db))
 	if err != nil {
 		return a.newStyleWorkloadPutResult(r.Context(), db, gwid, rid, result)
@@ -809,7 +990,7 @@ func (a *API) workloadPutResult(r *http.Request) (interface{}, mw.Response) {
 	}
 
 	if !found {
-		return nil, mw.NotFound(errors.New("workload not found"))
+		return nil, mw.NotFound(errors.New("workload not found")).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if err := types.ResultPush(r.Context(), db, rid, result); err != nil {
@@ -843,11 +1024,11 @@ func (a *API) newStyleWorkloadPutResult(ctx context.Context, db *mongo.Database,
 
 	workload, err := a.workloadpipeline(filter.Get(ctx, db))
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if workload.Workload().ReservationWorkload.WorkloadId != gwid {
-		return nil, mw.NotFound(errors.New("workload id does not exist"))
+		return nil, mw.NotFound(errors.New("workload id does not exist")).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if err := types.WorkloadResultPush(ctx, db, globalID, result); err != nil {
@@ -865,7 +1046,7 @@ func (a *API) newStyleWorkloadPutResult(ctx context.Context, db *mongo.Database,
 			return nil, mw.Error(err)
 		}
 
-		if err := types.WorkloadSetNextAction(ctx, db, globalID, generated.NextActionDelete); err != nil {
+		if err := types.WorkloadSetNextAction(ctx, db, globalID, generated.NextActionDelete, types.ReasonDeploymentFailed); err != nil {
 			return nil, mw.Error(err)
 		}
 
@@ -881,6 +1062,14 @@ func (a *API) newStyleWorkloadPutResult(ctx context.Context, db *mongo.Database,
 			return nil, mw.Error(err)
 		}
 	}
+
+	if workload.GetMigratedFrom() != 0 {
+		if err := a.finishMigration(ctx, db, workload, result.State); err != nil {
+			log.Error().Err(err).Int64("workload", int64(globalID)).Msg("failed to finish workload migration")
+			return nil, mw.Error(err)
+		}
+	}
+
 	return nil, mw.Created()
 }
 
@@ -903,10 +1092,14 @@ func (a *API) workloadPutDeleted(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.BadRequest(errors.Wrap(err, "invalid reservation id part"))
 	}
 
+	db := mw.Database(r)
+	if !a.legacy {
+		return a.newStyleWorkloadPutDeleted(r.Context(), db, rid, gwid, nodeID)
+	}
+
 	var filter types.ReservationFilter
 	filter = filter.WithID(rid)
 
-	db := mw.Database(r)
 	reservation, err := a.pipeline(filter.Get(r.Context(), db))
 	if err != nil {
 		return a.newStyleWorkloadPutDeleted(r.Context(), db, rid, gwid, nodeID)
@@ -923,7 +1116,7 @@ func (a *API) workloadPutDeleted(r *http.Request) (interface{}, mw.Response) {
 	}
 
 	if !found {
-		return nil, mw.NotFound(errors.New("workload not found"))
+		return nil, mw.NotFound(errors.New("workload not found")).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	result := reservation.ResultOf(gwid)
@@ -974,11 +1167,11 @@ func (a *API) newStyleWorkloadPutDeleted(ctx context.Context, db *mongo.Database
 
 	workload, err := a.workloadpipeline(filter.Get(ctx, db))
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if workload.Workload().WorkloadId != gwid {
-		return nil, mw.NotFound(errors.New("workload not found"))
+		return nil, mw.NotFound(errors.New("workload not found")).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	result := workload.ResultOf(gwid)
@@ -993,12 +1186,19 @@ func (a *API) newStyleWorkloadPutDeleted(ctx context.Context, db *mongo.Database
 
 	result.State = generated.ResultStateDeleted
 
-	// remove capacity from pool
-	if err := a.capacityPlanner.RemoveUsedCapacity(workload); err != nil {
-		log.Error().Err(err).Msg("failed to decrease used capacity in pool")
+	held, err := a.holdPublicIP(ctx, db, workload)
+	if err != nil {
 		return nil, mw.Error(err)
 	}
 
+	// remove capacity from pool, a held ip is still billed until it is released
+	if !held {
+		if err := a.capacityPlanner.RemoveUsedCapacity(workload); err != nil {
+			log.Error().Err(err).Msg("failed to decrease used capacity in pool")
+			return nil, mw.Error(err)
+		}
+	}
+
 	if err := types.WorkloadResultPush(ctx, db, wid, *result); err != nil {
 		return nil, mw.Error(err)
 	}
@@ -1007,11 +1207,11 @@ func (a *API) newStyleWorkloadPutDeleted(ctx context.Context, db *mongo.Database
 		return nil, mw.Error(err)
 	}
 
-	if err := types.WorkloadSetNextAction(ctx, db, workload.GetID(), generated.NextActionDeleted); err != nil {
+	if err := types.WorkloadSetNextAction(ctx, db, workload.GetID(), generated.NextActionDeleted, types.ReasonDeletedByNode); err != nil {
 		return nil, mw.Error(err)
 	}
 
-	if workload.GetWorkloadType() == generated.WorkloadTypePublicIP {
+	if workload.GetWorkloadType() == generated.WorkloadTypePublicIP && !held {
 		if err := a.setFarmIPFree(ctx, db, workload); err != nil {
 			return nil, mw.Error(err)
 		}
@@ -1021,6 +1221,10 @@ func (a *API) newStyleWorkloadPutDeleted(ctx context.Context, db *mongo.Database
 }
 
 func (a *API) signProvision(r *http.Request) (interface{}, mw.Response) {
+	if !a.legacy {
+		return a.newSignProvision(r)
+	}
+
 	var signature generated.SigningSignature
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
@@ -1064,11 +1268,11 @@ func (a *API) signProvision(r *http.Request) (interface{}, mw.Response) {
 
 	user, err := phonebook.UserFilter{}.WithID(schema.ID(signature.Tid)).Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "customer id not found"))
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
 	}
 
 	if err := reservation.SignatureVerify(user.Pubkey, sig); err != nil {
-		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature"))
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature")).WithCode(mw.CodeSignatureInvalid)
 	}
 
 	signature.Epoch = schema.Date{Time: time.Now()}
@@ -1106,7 +1310,7 @@ func (a *API) newSignProvision(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if workload.GetNextAction() != generated.NextActionSign {
@@ -1119,11 +1323,11 @@ func (a *API) newSignProvision(r *http.Request) (interface{}, mw.Response) {
 
 	user, err := phonebook.UserFilter{}.WithID(schema.ID(signature.Tid)).Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "customer id not found"))
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
 	}
 
 	if err := workload.SignatureProvisionRequestVerify(user.Pubkey, signature); err != nil {
-		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature"))
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature")).WithCode(mw.CodeSignatureInvalid)
 	}
 
 	signature.Epoch = schema.Date{Time: time.Now()}
@@ -1146,6 +1350,10 @@ func (a *API) newSignProvision(r *http.Request) (interface{}, mw.Response) {
 }
 
 func (a *API) signDelete(r *http.Request) (interface{}, mw.Response) {
+	if !a.legacy {
+		return a.newSignDelete(r)
+	}
+
 	var signature generated.SigningSignature
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
@@ -1184,11 +1392,11 @@ func (a *API) signDelete(r *http.Request) (interface{}, mw.Response) {
 
 	user, err := phonebook.UserFilter{}.WithID(schema.ID(signature.Tid)).Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "customer id not found"))
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
 	}
 
 	if err := reservation.SignatureVerify(user.Pubkey, sig); err != nil {
-		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature"))
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature")).WithCode(mw.CodeSignatureInvalid)
 	}
 
 	signature.Epoch = schema.Date{Time: time.Now()}
@@ -1230,7 +1438,7 @@ func (a *API) newSignDelete(r *http.Request) (interface{}, mw.Response) {
 	db := mw.Database(r)
 	workload, err := a.workloadpipeline(filter.Get(r.Context(), db))
 	if err != nil {
-		return nil, mw.NotFound(err)
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
 	}
 
 	if httpErr := userCanSign(signature.Tid, workload.GetSigningRequestDelete(), workload.GetSignaturesDelete()); httpErr != nil {
@@ -1239,11 +1447,11 @@ func (a *API) newSignDelete(r *http.Request) (interface{}, mw.Response) {
 
 	user, err := phonebook.UserFilter{}.WithID(schema.ID(signature.Tid)).Get(r.Context(), db)
 	if err != nil {
-		return nil, mw.NotFound(errors.Wrap(err, "customer id not found"))
+		return nil, mw.NotFound(errors.Wrap(err, "customer id not found")).WithCode(mw.CodeUserNotFound)
 	}
 
 	if err := workload.SignatureDeleteRequestVerify(user.Pubkey, signature); err != nil {
-		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature"))
+		return nil, mw.UnAuthorized(errors.Wrap(err, "failed to verify signature")).WithCode(mw.CodeSignatureInvalid)
 	}
 
 	signature.Epoch = schema.Date{Time: time.Now()}
@@ -1260,7 +1468,7 @@ func (a *API) newSignDelete(r *http.Request) (interface{}, mw.Response) {
 		return nil, mw.Created()
 	}
 
-	workload, err = a.setWorkloadDelete(r.Context(), db, workload)
+	workload, err = a.setWorkloadDelete(r.Context(), db, workload, types.ReasonDeleteSigned)
 	if err != nil {
 		return nil, mw.Error(err)
 	}
@@ -1268,10 +1476,10 @@ func (a *API) newSignDelete(r *http.Request) (interface{}, mw.Response) {
 	return nil, mw.Created()
 }
 
-func (a *API) setWorkloadDelete(ctx context.Context, db *mongo.Database, w types.WorkloaderType) (types.WorkloaderType, error) {
+func (a *API) setWorkloadDelete(ctx context.Context, db *mongo.Database, w types.WorkloaderType, reason string) (types.WorkloaderType, error) {
 	w.SetNextAction(types.Delete)
 
-	if err := types.ReservationSetNextAction(ctx, db, w.GetID(), types.Delete); err != nil {
+	if err := types.WorkloadSetNextAction(ctx, db, w.GetID(), types.Delete, reason); err != nil {
 		return w, errors.Wrap(err, "could not update workload to delete state")
 	}
 
@@ -1279,25 +1487,54 @@ func (a *API) setWorkloadDelete(ctx context.Context, db *mongo.Database, w types
 }
 
 func (a *API) handlePublicIPReservation(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) mw.Response {
+	reservation, mwErr := a.reservePublicIP(ctx, db, workload)
+	if mwErr != nil {
+		return mwErr
+	}
+
+	return a.completePublicIPReservation(ctx, db, reservation)
+}
+
+// ipReservation is a public ip reserved for a new workload. The workload which
+// used the ip before is only deleted once the reservation is completed, until
+// then the reservation can be undone.
+type ipReservation struct {
+	workload types.WorkloaderType
+	farm     schema.ID
+	// previous is the id of the reservation of the ip in the farm before
+	previous schema.ID
+	// swapped is the deployed workload of the same pool which used the ip
+	swapped *types.WorkloaderType
+	// held is the lease of the ip if it was held for the pool
+	held *types.IPLease
+	// lease is the lease of the ip before it was acquired, nil if it had none
+	lease *types.IPLease
+}
+
+// reservePublicIP reserves the ip of a public ip workload in its farm, and
+// acquires the lease of the ip for it
+func (a *API) reservePublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) (ipReservation, mw.Response) {
 	// handling ip reservation is very special because
 	// 1- It's mostly handled by the explorer itself
 	// 2- it should be possible for the IP owner to move the IP reservation to another node (swap)
 
 	ipWorkload := workload.Workloader.(*generated.PublicIP)
+	reservation := ipReservation{workload: workload}
 
 	var nodeFilter directory.NodeFilter
 	nodeFilter = nodeFilter.WithNodeID(ipWorkload.NodeId)
 	node, err := nodeFilter.Get(ctx, db, false)
 	if err != nil {
-		return mw.BadRequest(errors.Wrap(err, "failed to retrieve node id for ip"))
+		return reservation, mw.BadRequest(errors.Wrap(err, "failed to retrieve node id for ip"))
 	}
 
 	var farmFilter directory.FarmFilter
 	farmFilter = farmFilter.WithID(schema.ID(node.FarmId))
 	farm, err := farmFilter.Get(ctx, db)
 	if err != nil {
-		return mw.BadRequest(errors.Wrap(err, "failed to retrieve farm"))
+		return reservation, mw.BadRequest(errors.Wrap(err, "failed to retrieve farm"))
 	}
+	reservation.farm = farm.ID
 
 	var pubIP *generateddirectory.PublicIP
 	for i := range farm.IPAddresses {
@@ -1311,38 +1548,108 @@ func (a *API) handlePublicIPReservation(ctx context.Context, db *mongo.Database,
 
 	if pubIP == nil {
 		// no ip found
-		return mw.NotFound(fmt.Errorf("public ip not found in farm"))
+		return reservation, mw.NotFound(fmt.Errorf("public ip not found in farm"))
 	}
 
 	swap := pubIP.ReservationID
+	reservation.previous = swap
 	// if swap != 0 then the ip is already allocated to 'someone'
 	if swap != 0 {
-		// the owner if the reservation can then be someone else or the same owner
-		var filter types.WorkloadFilter
-		filter = filter.WithID(swap).
-			WithPoolID(ipWorkload.PoolId).
-			WithNextAction(generated.NextActionDeploy)
-
-		wl, err := filter.Get(ctx, db)
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			// this reservation is owned by another user!! we can't do swap
-			return mw.Conflict(fmt.Errorf("ip address already in use by another pool"))
+		lease, err := types.IPLeaseFilter{}.WithWorkloadID(swap).WithState(types.IPLeaseHeld).Get(ctx, db)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return reservation, mw.Error(errors.Wrap(err, "failed to retrieve ip lease"))
 		}
 
-		// same user, we need to deprovision this one
-		if _, err := a.setWorkloadDelete(ctx, db, wl); err != nil {
-			return mw.Error(errors.Wrap(err, "failed to schedule ip reservation to be deleted"))
+		if err == nil {
+			// the ip is held since its previous workload was deleted, only
+			// the pool of the lease can use it again
+			if lease.PoolID != ipWorkload.PoolId {
+				return reservation, mw.Conflict(fmt.Errorf("ip address is held by another pool"))
+			}
+			reservation.held = &lease
+		} else {
+			// the owner if the reservation can then be someone else or the same owner
+			var filter types.WorkloadFilter
+			filter = filter.WithID(swap).
+				WithPoolID(ipWorkload.PoolId).
+				WithNextAction(generated.NextActionDeploy)
+
+			wl, err := filter.Get(ctx, db)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				// this reservation is owned by another user!! we can't do swap
+				return reservation, mw.Conflict(fmt.Errorf("ip address already in use by another pool"))
+			} else if err != nil {
+				return reservation, mw.Error(errors.Wrap(err, "failed to retrieve ip reservation"))
+			}
+
+			// same user, this one is deprovisioned once the reservation is completed
+			reservation.swapped = &wl
 		}
 	}
 
+	lease, err := types.IPLeaseFilter{}.WithAddress(ipWorkload.IPaddress).Get(ctx, db)
+	if err == nil {
+		reservation.lease = &lease
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return reservation, mw.Error(errors.Wrap(err, "failed to retrieve ip lease"))
+	}
+
 	// swap will atomically swap the reservation on the IP address against
 	if err := directory.FarmIPSwap(ctx, db, farm.ID, ipWorkload.IPaddress, swap, workload.GetID()); err != nil {
-		return mw.Conflict(err)
+		return reservation, mw.Conflict(err)
+	}
+
+	if _, err := types.IPLeaseAcquire(ctx, db, farm.ID, workload); err != nil {
+		if err := directory.FarmIPSwap(ctx, db, farm.ID, ipWorkload.IPaddress, workload.GetID(), swap); err != nil {
+			log.Error().Err(err).Int64("workload", int64(workload.GetID())).Msg("failed to give the public ip back")
+		}
+		return reservation, mw.Error(err)
+	}
+
+	return reservation, nil
+}
+
+// completePublicIPReservation deletes the workload which used the ip before,
+// and stops billing the held ip. It can't be undone.
+func (a *API) completePublicIPReservation(ctx context.Context, db *mongo.Database, reservation ipReservation) mw.Response {
+	if reservation.swapped != nil {
+		if _, err := a.setWorkloadDelete(ctx, db, *reservation.swapped, types.ReasonPublicIPSwapped); err != nil {
+			return mw.Error(errors.Wrap(err, "failed to schedule ip reservation to be deleted"))
+		}
+	}
+
+	if reservation.held != nil {
+		// the new workload is billed once it is deployed
+		if err := a.unbillHeldIP(ctx, db, *reservation.held); err != nil {
+			log.Error().Err(err).Int64("lease", int64(reservation.held.ID)).Msg("failed to stop billing held ip")
+		}
 	}
 
 	return nil
 }
 
+// undoPublicIPReservation gives the ip back to the workload which used it
+// before, with its lease as it was
+func (a *API) undoPublicIPReservation(ctx context.Context, db *mongo.Database, reservation ipReservation) error {
+	ipWorkload := reservation.workload.Workloader.(*generated.PublicIP)
+	if err := directory.FarmIPSwap(ctx, db, reservation.farm, ipWorkload.IPaddress, reservation.workload.GetID(), reservation.previous); err != nil {
+		return errors.Wrap(err, "failed to give the public ip back")
+	}
+
+	if reservation.lease != nil {
+		return types.IPLeaseRestore(ctx, db, *reservation.lease)
+	}
+
+	lease, err := types.IPLeaseFilter{}.WithWorkloadID(reservation.workload.GetID()).Get(ctx, db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to retrieve ip lease")
+	}
+
+	return types.IPLeaseRemove(ctx, db, lease.ID)
+}
+
 func (a *API) setFarmIPFree(ctx context.Context, db *mongo.Database, workload types.WorkloaderType) error {
 	ipWorkload, ok := workload.Workloader.(*generated.PublicIP)
 	if !ok {
@@ -1367,7 +1674,15 @@ func (a *API) setFarmIPFree(ctx context.Context, db *mongo.Database, workload ty
 	if err != nil {
 		return errors.Wrap(err, "failed to release ip reservation")
 	}
-	return nil
+
+	lease, err := types.IPLeaseFilter{}.WithWorkloadID(ipWorkload.GetID()).Get(ctx, db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to retrieve ip lease")
+	}
+
+	return types.IPLeaseRemove(ctx, db, lease.ID)
 }
 
 func (a *API) getMaxNodeCapacity(ctx context.Context, db *mongo.Database, nodeID string) (workloads.K8SCustomSize, mw.Response) {
@@ -1376,7 +1691,7 @@ func (a *API) getMaxNodeCapacity(ctx context.Context, db *mongo.Database, nodeID
 	filter = filter.WithNodeID(nodeID)
 	node, err := filter.Get(ctx, db, false)
 	if err != nil {
-		return workloads.K8SCustomSize{}, mw.NotFound(err)
+		return workloads.K8SCustomSize{}, mw.NotFound(err).WithCode(mw.CodeNodeNotFound)
 	}
 
 	resources := node.TotalResources.Diff(node.ReservedResources)
@@ -1413,45 +1728,34 @@ func (a *API) handleKubernetesSize(ctx context.Context, db *mongo.Database, work
 	return nil
 }
 
-func (a *API) handleKubernetesPublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, userID int64) mw.Response {
+func (a *API) handleKubernetesPublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, userID int64, replaces schema.ID) mw.Response {
 	k8sWorkload := workload.Workloader.(*generated.K8S)
-	return checkPublicIPAvailablity(ctx, db, k8sWorkload.PublicIP, userID)
+	return checkPublicIPAvailablity(ctx, db, k8sWorkload.PublicIP, userID, replaces)
 }
 
-func (a *API) handleVMPublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, userID int64) mw.Response {
+func (a *API) handleVMPublicIP(ctx context.Context, db *mongo.Database, workload types.WorkloaderType, userID int64, replaces schema.ID) mw.Response {
 	vmWorkload := workload.Workloader.(*generated.VirtualMachine)
-	return checkPublicIPAvailablity(ctx, db, vmWorkload.PublicIP, userID)
+	return checkPublicIPAvailablity(ctx, db, vmWorkload.PublicIP, userID, replaces)
 }
 
-func checkPublicIPAvailablity(ctx context.Context, db *mongo.Database, publicIP schema.ID, userID int64) mw.Response {
+// checkPublicIPAvailablity checks the public ip reservation is not used by
+// another workload. The workload being replaced by an update can keep its ip.
+// The ownership of the ip is checked with the other workload dependencies.
+func checkPublicIPAvailablity(ctx context.Context, db *mongo.Database, publicIP schema.ID, userID int64, replaces schema.ID) mw.Response {
 
 	if publicIP == 0 {
 		return nil
 	}
 
-	var err error
-
-	var workloadFiler types.WorkloadFilter
-	workloadFiler = workloadFiler.
-		WithID(publicIP).
-		WithWorkloadType(generated.WorkloadTypePublicIP).
-		WithNextAction(generated.NextActionDeploy).
-		WithCustomerID(userID)
-
-	_, err = workloadFiler.Get(ctx, db)
-	if err != nil {
-		return mw.NotFound(errors.Wrapf(err, "ip workload '%d' not found", publicIP))
-	}
-
 	// Check if there is already a k8s workload with this public ip reservation in the database
-	workloadFiler = types.WorkloadFilter{}.
+	workloadFiler := types.WorkloadFilter{}.
 		WithCustomerID(userID).
 		WithNextAction(generated.NextActionDeploy).
 		WithPublicIP(publicIP)
 
 	// to be tested on a node with pubip
-	_, err = workloadFiler.Get(ctx, db)
-	if err == nil {
+	inUse, err := workloadFiler.Get(ctx, db)
+	if err == nil && inUse.GetID() != replaces {
 		// some documents are returened -> ip in use
 		return mw.Conflict(fmt.Errorf("public ip is in use"))
 	} else if err != nil && err != mongo.ErrNoDocuments {
@@ -1,11 +1,16 @@
 package workloads
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
 )
 
 func Test_userCanSign(t *testing.T) {
@@ -72,3 +77,29 @@ func Test_userCanSign(t *testing.T) {
 		})
 	}
 }
+
+func TestSetWorkloadDelete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("workload collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			// the workload is already deleted, nothing is returned
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		workload := types.WorkloaderType{Workloader: &workloads.Volume{}}
+		workload.SetID(1)
+
+		var a API
+		deleted, err := a.setWorkloadDelete(context.Background(), mt.DB, workload, types.ReasonDeleteSigned)
+		require.NoError(mt, err)
+		assert.Equal(mt, types.Delete, deleted.GetNextAction())
+
+		started := mt.GetStartedEvent()
+		require.NotNil(mt, started)
+		assert.Equal(mt, "findAndModify", started.CommandName)
+		assert.Equal(mt, types.WorkloadCollection, started.Command.Lookup("findAndModify").StringValue())
+	})
+}
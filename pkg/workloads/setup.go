@@ -2,39 +2,88 @@ package workloads
 
 import (
 	"context"
+	"crypto/ed25519"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
 	"github.com/threefoldtech/tfexplorer/mw"
 	"github.com/threefoldtech/tfexplorer/pkg/capacity"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
 	"github.com/threefoldtech/tfexplorer/pkg/escrow"
+	escrowtypes "github.com/threefoldtech/tfexplorer/pkg/escrow/types"
 	"github.com/threefoldtech/tfexplorer/pkg/gridnetworks"
 	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
 	"github.com/zaibon/httpsig"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Setup injects and initializes directory package
-func Setup(parent *mux.Router, db *mongo.Database, network gridnetworks.GridNetwork, escrow escrow.Escrow, planner capacity.Planner) error {
+// Setup injects and initializes directory package. If signer is not nil, it
+// is used to sign the responses to the nodes. If quota is nil, users are not
+// limited. If legacy is false, the legacy reservations are not served anymore,
+// they must all be converted first.
+func Setup(parent *mux.Router, db *mongo.Database, network gridnetworks.GridNetwork, escrow escrow.Escrow, planner capacity.Planner, signer ed25519.PrivateKey, quota *mw.Quota, legacy bool) error {
 	if err := types.Setup(context.TODO(), db); err != nil {
 		return err
 	}
 
-	userVerifier := httpsig.NewVerifier(mw.NewUserKeyGetter(db))
+	// the public ips reserved before the leases existed are leased to their
+	// workloads, without hold period
+	if created, err := types.IPLeaseBackfill(context.TODO(), db); err != nil {
+		log.Error().Err(err).Msg("failed to create the leases of the reserved public ips")
+	} else if created > 0 {
+		log.Info().Int("leases", created).Msg("leases created for the reserved public ips")
+	}
+
+	expirer := NewExpirer(db, planner)
+	go expirer.Run(context.TODO())
 
-	service := API{
+	if quota == nil {
+		quota = mw.NewQuota(mw.QuotaLimits{}, nil)
+	}
+	quota.SetCounter(mw.QuotaWorkloads, func(ctx context.Context, userID int64) (int64, error) {
+		return types.WorkloadFilter{}.
+			WithCustomerID(userID).
+			WithNextActions(types.Create, types.Sign, types.Pay, types.Approve, types.Deploy).
+			Count(ctx, db)
+	})
+	quota.SetCounter(mw.QuotaUnpaidReservations, func(ctx context.Context, userID int64) (int64, error) {
+		return capacitytypes.CapacityReservationUnpaidCount(ctx, db, escrowtypes.CapacityEscrowCollection, userID)
+	})
+
+	service := &API{
 		escrow:          escrow,
 		capacityPlanner: planner,
 		network:         network,
+		signer:          signer,
+		expirer:         expirer,
+		quota:           quota,
+		legacy:          legacy,
 	}
 
+	go service.runApprovalTimeouts(context.TODO(), db)
+	go service.runIPLeaseExpiration(context.TODO(), db)
+
+	registerRoutes(parent, db, service)
+
+	return nil
+}
+
+// registerRoutes registers the routes of the package, the routes are only
+// bound to the database when they are called
+func registerRoutes(parent *mux.Router, db *mongo.Database, service *API) {
+	userVerifier := httpsig.NewVerifier(mw.NewUserKeyGetter(db))
+	quota, legacy := service.quota, service.legacy
+
 	// versionned endpoints
 	api := parent.PathPrefix("/api/v1").Subrouter()
 	api.HandleFunc("/prices", mw.AsHandlerFunc(service.getPrices)).Methods(http.MethodGet).Name("prices-get")
+	api.HandleFunc("/signing-key", mw.AsHandlerFunc(service.getSigningKey)).Methods(http.MethodGet).Name("signing-key-get")
+	api.HandleFunc("/farms/{farm_id:\\d+}/sla", service.farmSLAHandler).Methods(http.MethodGet).Name("farm-sla-v1")
 
 	apiReservation := api.PathPrefix("/reservations").Subrouter()
 
-	apiReservation.HandleFunc("/pools", mw.AsHandlerFunc(service.setupPool)).Methods(http.MethodPost).Name("versionned-pool-create")
+	apiReservation.Handle("/pools", quota.RateLimit(mw.AsHandlerFunc(service.setupPool))).Methods(http.MethodPost).Name("versionned-pool-create")
 	apiReservation.HandleFunc("/pools/{id:\\d+}", mw.AsHandlerFunc(service.getPool)).Methods(http.MethodGet).Name("versionned-pool-get")
 	apiReservation.HandleFunc("/pools/owner/{owner:\\d+}", mw.AsHandlerFunc(service.listPools)).Methods(http.MethodGet).Name("versionned-pool-get-by-owner")
 	apiReservation.HandleFunc("/pools/payment/{id:\\d+}", mw.AsHandlerFunc(service.getPaymentInfo)).Methods(http.MethodGet).Name("versionned-pool-get-payment-info")
@@ -43,17 +92,36 @@ func Setup(parent *mux.Router, db *mongo.Database, network gridnetworks.GridNetw
 	// one associated with the signed reservation object.
 	authenticated := apiReservation.NewRoute().Subrouter()
 	authenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
-	authenticated.HandleFunc("/workloads", mw.AsHandlerFunc(service.create)).Methods(http.MethodPost).Name("versionned-workloads-create")
+	authenticated.Handle("/workloads", quota.RateLimit(mw.AsHandlerFunc(service.create))).Methods(http.MethodPost).Name("versionned-workloads-create")
+	authenticated.Handle("/groups", quota.RateLimit(mw.AsHandlerFunc(service.createGroup))).Methods(http.MethodPost).Name("versionned-groups-create")
+	authenticated.HandleFunc("/workloads/{res_id:\\d+}/update", mw.AsHandlerFunc(service.updateWorkload)).Methods(http.MethodPost).Name("versionned-workloads-update")
+	authenticated.HandleFunc("/workloads/{res_id:\\d+}/labels", mw.AsHandlerFunc(service.setWorkloadLabels)).Methods(http.MethodPut).Name("versionned-workloads-labels")
+	authenticated.HandleFunc("/workloads/{res_id:\\d+}/migrate", mw.AsHandlerFunc(service.migrateWorkload)).Methods(http.MethodPost).Name("versionned-workloads-migrate")
+	authenticated.HandleFunc("/workloads/{res_id:\\d+}/expiration", mw.AsHandlerFunc(service.setWorkloadExpiration)).Methods(http.MethodPost).Name("versionned-workloads-expiration")
+	authenticated.HandleFunc("/workloads/{res_id:\\d+}/approval", mw.AsHandlerFunc(service.approveWorkload)).Methods(http.MethodPost).Name("versionned-workloads-approval")
+	authenticated.HandleFunc("/ips/{id:\\d+}/hold", mw.AsHandlerFunc(service.setIPLeaseHold)).Methods(http.MethodPut).Name("versionned-ips-hold")
+	authenticated.HandleFunc("/ips/{id:\\d+}/release", mw.AsHandlerFunc(service.releaseIPLeaseNow)).Methods(http.MethodPost).Name("versionned-ips-release")
+	authenticated.HandleFunc("/ips/{id:\\d+}/transfer", mw.AsHandlerFunc(service.transferIPLease)).Methods(http.MethodPost).Name("versionned-ips-transfer")
 	// other calls are public
 	apiReservation.HandleFunc("/workloads", mw.AsHandlerFunc(service.listWorkload)).Methods(http.MethodGet).Name("versionned-workloadreservation-list")
+	apiReservation.HandleFunc("/workloads/events", service.workloadEvents).Methods(http.MethodGet).Name("versionned-workloads-events")
 	apiReservation.HandleFunc("/workloads/{res_id:\\d+}", mw.AsHandlerFunc(service.getWorkload)).Methods(http.MethodGet).Name("versionned-workloadreservation-get")
+	apiReservation.HandleFunc("/workloads/{res_id:\\d+}/revisions", mw.AsHandlerFunc(service.listWorkloadRevisions)).Methods(http.MethodGet).Name("versionned-workloads-revisions")
+	apiReservation.HandleFunc("/workloads/{res_id:\\d+}/events", mw.AsHandlerFunc(service.listWorkloadEvents)).Methods(http.MethodGet).Name("versionned-workloads-event-list")
 	apiReservation.HandleFunc("/workloads/{res_id:\\d+}/sign/provision", mw.AsHandlerFunc(service.signProvision)).Methods(http.MethodPost).Name("versionned-reservation-sign-provision")
 	apiReservation.HandleFunc("/workloads/{res_id:\\d+}/sign/delete", mw.AsHandlerFunc(service.newSignDelete)).Methods(http.MethodPost).Name("versionned-reservation-sign-delete")
-
-	conversionAuthenticated := apiReservation.PathPrefix("/convert").Subrouter()
-	conversionAuthenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
-	conversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.getConversionList)).Methods(http.MethodGet).Name("versionned-conversion-list")
-	conversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.postConversionList)).Methods(http.MethodPost).Name("versionned-conversion-post")
+	apiReservation.HandleFunc("/groups", mw.AsHandlerFunc(service.listGroups)).Methods(http.MethodGet).Name("versionned-groups-list")
+	apiReservation.HandleFunc("/ips", mw.AsHandlerFunc(service.listIPLeases)).Methods(http.MethodGet).Name("versionned-ips-list")
+	apiReservation.HandleFunc("/ips/{id:\\d+}", mw.AsHandlerFunc(service.getIPLease)).Methods(http.MethodGet).Name("versionned-ips-get")
+	apiReservation.HandleFunc("/groups/{id:\\d+}", mw.AsHandlerFunc(service.getGroup)).Methods(http.MethodGet).Name("versionned-groups-get")
+	apiReservation.HandleFunc("/groups/{id:\\d+}/sign/delete", mw.AsHandlerFunc(service.signDeleteGroup)).Methods(http.MethodPost).Name("versionned-groups-sign-delete")
+
+	if legacy {
+		conversionAuthenticated := apiReservation.PathPrefix("/convert").Subrouter()
+		conversionAuthenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
+		conversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.getConversionList)).Methods(http.MethodGet).Name("versionned-conversion-list")
+		conversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.postConversionList)).Methods(http.MethodPost).Name("versionned-conversion-post")
+	}
 
 	// Nodes oriented endpoints
 	apiReservation.HandleFunc("/nodes/{node_id}/workloads", mw.AsHandlerFunc(service.workloads)).Queries("from", "{from:\\d+}").Methods(http.MethodGet).Name("versionned-workloads-poll")
@@ -64,35 +132,37 @@ func Setup(parent *mux.Router, db *mongo.Database, network gridnetworks.GridNetw
 	// legacy endpoints
 	legacyReservations := parent.PathPrefix("/explorer/reservations").Subrouter()
 
-	legacyReservations.HandleFunc("", mw.AsHandlerFunc(service.create)).Methods(http.MethodPost).Name("reservation-create")
-	legacyReservations.HandleFunc("", mw.AsHandlerFunc(service.list)).Methods(http.MethodGet).Name("reservation-list")
-	legacyReservations.HandleFunc("/{res_id:\\d+}", mw.AsHandlerFunc(service.get)).Methods(http.MethodGet).Name("reservation-get")
+	legacyReservations.Handle("", quota.RateLimit(mw.AsHandlerFunc(service.create))).Methods(http.MethodPost).Name("reservation-create")
+	if legacy {
+		legacyReservations.HandleFunc("", mw.AsHandlerFunc(service.list)).Methods(http.MethodGet).Name("reservation-list")
+		legacyReservations.HandleFunc("/{res_id:\\d+}", mw.AsHandlerFunc(service.get)).Methods(http.MethodGet).Name("reservation-get")
+	}
 	legacyReservations.HandleFunc("/{res_id:\\d+}/sign/provision", mw.AsHandlerFunc(service.signProvision)).Methods(http.MethodPost).Name("reservation-sign-provision")
 	legacyReservations.HandleFunc("/{res_id:\\d+}/sign/delete", mw.AsHandlerFunc(service.signDelete)).Methods(http.MethodPost).Name("reservation-sign-delete")
 
 	// new style workloads
 	workloads := parent.PathPrefix("/explorer/workloads").Subrouter()
-	workloads.HandleFunc("", mw.AsHandlerFunc(service.create)).Methods(http.MethodPost).Name("workload-create")
+	workloads.Handle("", quota.RateLimit(mw.AsHandlerFunc(service.create))).Methods(http.MethodPost).Name("workload-create")
 	workloads.HandleFunc("", mw.AsHandlerFunc(service.listWorkload)).Methods(http.MethodGet).Name("workload-list")
 	workloads.HandleFunc("/{res_id:\\d+}", mw.AsHandlerFunc(service.getWorkload)).Methods(http.MethodGet).Name("workload-get")
 	workloads.HandleFunc("/{res_id:\\d+}/sign/provision", mw.AsHandlerFunc(service.signProvision)).Methods(http.MethodPost).Name("workload-sign-provision")
 	workloads.HandleFunc("/{res_id:\\d+}/sign/delete", mw.AsHandlerFunc(service.signDelete)).Methods(http.MethodPost).Name("workload-sign-delete")
 
-	legacyReservations.HandleFunc("/pools", mw.AsHandlerFunc(service.setupPool)).Methods(http.MethodPost).Name("pool-create")
+	legacyReservations.Handle("/pools", quota.RateLimit(mw.AsHandlerFunc(service.setupPool))).Methods(http.MethodPost).Name("pool-create")
 	legacyReservations.HandleFunc("/pools/{id:\\d+}", mw.AsHandlerFunc(service.getPool)).Methods(http.MethodGet).Name("pool-get")
 	legacyReservations.HandleFunc("/pools/owner/{owner:\\d+}", mw.AsHandlerFunc(service.listPools)).Methods(http.MethodGet).Name("pool-get-by-owner")
 
 	// conversion
-	legacyConversionAuthenticated := legacyReservations.PathPrefix("/explorer/convert").Subrouter()
-	legacyConversionAuthenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
-	legacyConversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.getConversionList)).Methods(http.MethodGet).Name("conversion-list")
-	legacyConversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.postConversionList)).Methods(http.MethodPost).Name("conversion-post")
+	if legacy {
+		legacyConversionAuthenticated := legacyReservations.PathPrefix("/explorer/convert").Subrouter()
+		legacyConversionAuthenticated.Use(mw.NewAuthMiddleware(userVerifier).Middleware)
+		legacyConversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.getConversionList)).Methods(http.MethodGet).Name("conversion-list")
+		legacyConversionAuthenticated.HandleFunc("", mw.AsHandlerFunc(service.postConversionList)).Methods(http.MethodPost).Name("conversion-post")
+	}
 
 	// node oriented endpoints
 	legacyReservations.HandleFunc("/nodes/{node_id}/workloads", mw.AsHandlerFunc(service.workloads)).Queries("from", "{from:\\d+}").Methods(http.MethodGet).Name("nodes-workloads-poll")
 	legacyReservations.HandleFunc("/workloads/{gwid:\\d+-\\d+}", mw.AsHandlerFunc(service.workloadGet)).Methods(http.MethodGet).Name("nodes-workload-get")
 	legacyReservations.HandleFunc("/nodes/{node_id}/workloads/{gwid:\\d+-\\d+}", mw.AsHandlerFunc(service.workloadPutResult)).Methods(http.MethodPut).Name("nodes-workloads-results")
 	legacyReservations.HandleFunc("/nodes/{node_id}/workloads/{gwid:\\d+-\\d+}", mw.AsHandlerFunc(service.workloadPutDeleted)).Methods(http.MethodDelete).Name("nodes-workloads-deleted")
-
-	return nil
 }
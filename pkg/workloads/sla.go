@@ -0,0 +1,204 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/mw"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSLAPeriod is the longest period a farm sla is computed over
+const maxSLAPeriod = 366 * 24 * time.Hour
+
+// slaQuery is the farm and the period of a farm sla. The period defaults to
+// the current month.
+type slaQuery struct {
+	FarmID schema.ID
+	From   time.Time
+	To     time.Time
+	CSV    bool
+}
+
+func (q *slaQuery) Parse(r *http.Request, now time.Time) mw.Response {
+	id, err := strconv.ParseInt(mux.Vars(r)["farm_id"], 10, 64)
+	if err != nil {
+		return mw.BadRequest(errors.Wrap(err, "invalid farm id"))
+	}
+	q.FarmID = schema.ID(id)
+
+	now = now.UTC()
+	q.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	q.To = now
+	for name, value := range map[string]*time.Time{
+		"from": &q.From,
+		"to":   &q.To,
+	} {
+		ts, err := models.QueryInt(r, name)
+		if err != nil {
+			return mw.BadRequest(errors.Wrapf(err, "invalid %s", name))
+		}
+		if ts > 0 {
+			*value = time.Unix(ts, 0).UTC()
+		}
+	}
+
+	// the future is not known yet
+	if q.To.After(now) {
+		q.To = now
+	}
+	if !q.To.After(q.From) {
+		return mw.BadRequest(fmt.Errorf("the period must end after it starts"))
+	}
+	if q.To.Sub(q.From) > maxSLAPeriod {
+		return mw.BadRequest(fmt.Errorf("the period can not be longer than a year"))
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "csv":
+		q.CSV = true
+	default:
+		return mw.BadRequest(fmt.Errorf("unsupported format '%s'", format))
+	}
+
+	return nil
+}
+
+// farmSLA computes the sla of the nodes of a farm over the period of the
+// query from their uptime reports
+func (a *API) farmSLA(ctx context.Context, db *mongo.Database, q slaQuery, now time.Time) (types.FarmSLA, error) {
+	opts := options.Find().
+		SetProjection(bson.M{"node_id": 1, "created": 1}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	cur, err := directory.NodeFilter{}.WithFarmID(q.FarmID).Find(ctx, db, opts)
+	if err != nil {
+		return types.FarmSLA{}, errors.Wrap(err, "failed to list the nodes of the farm")
+	}
+	defer cur.Close(ctx)
+
+	nodes := []directory.Node{}
+	if err := cur.All(ctx, &nodes); err != nil {
+		return types.FarmSLA{}, errors.Wrap(err, "failed to load the nodes of the farm")
+	}
+
+	var ids []string
+	for _, node := range nodes {
+		// nodes registered after the period are not part of it
+		if node.Created.After(q.To) {
+			continue
+		}
+		ids = append(ids, node.NodeId)
+	}
+	if len(ids) == 0 {
+		return types.NewFarmSLA(q.FarmID, q.From, q.To, []types.NodeSLA{}), nil
+	}
+
+	// nodes which reported before the period are tracked for the whole period
+	tracked, err := directory.UptimeReportFilter{}.WithNodeIDs(ids).WithRange(time.Time{}, q.From).NodeIDs(ctx, db)
+	if err != nil {
+		return types.FarmSLA{}, errors.Wrap(err, "failed to load the tracked nodes")
+	}
+	before := make(map[string]bool, len(tracked))
+	for _, id := range tracked {
+		before[id] = true
+	}
+
+	trackers := make(map[string]*directory.AvailabilityTracker, len(ids))
+	for _, id := range ids {
+		trackers[id] = directory.NewAvailabilityTracker(before[id], q.From, q.To)
+	}
+
+	// the reports are streamed into the trackers so only the downtime of the
+	// nodes is kept in memory. The reports received shortly after the period
+	// cover its end.
+	filter := directory.UptimeReportFilter{}.WithNodeIDs(ids).WithRange(q.From, q.To.Add(2*directory.ReportInterval))
+	opts = options.Find().SetSort(bson.D{{Key: "node_id", Value: 1}, {Key: "timestamp.time", Value: 1}})
+	rcur, err := filter.Find(ctx, db, opts)
+	if err != nil {
+		return types.FarmSLA{}, errors.Wrap(err, "failed to list uptime reports")
+	}
+	defer rcur.Close(ctx)
+
+	for rcur.Next(ctx) {
+		var report directory.UptimeReport
+		if err := rcur.Decode(&report); err != nil {
+			return types.FarmSLA{}, errors.Wrap(err, "failed to load uptime report")
+		}
+		if tracker, ok := trackers[report.NodeID]; ok {
+			tracker.Add(report)
+		}
+	}
+	if err := rcur.Err(); err != nil {
+		return types.FarmSLA{}, errors.Wrap(err, "failed to load uptime reports")
+	}
+
+	workloads, err := types.WorkloadSpans(ctx, db, ids, q.From, q.To)
+	if err != nil {
+		return types.FarmSLA{}, err
+	}
+
+	slas := make([]types.NodeSLA, 0, len(ids))
+	for _, id := range ids {
+		availability := trackers[id].Availability(now)
+		slas = append(slas, types.NewNodeSLA(id, availability, workloads))
+	}
+
+	return types.NewFarmSLA(q.FarmID, q.From, q.To, slas), nil
+}
+
+// loadFarmSLA computes the sla of the farm of the request, and if it must be
+// served as csv
+func (a *API) loadFarmSLA(r *http.Request) (types.FarmSLA, bool, mw.Response) {
+	now := time.Now()
+	var q slaQuery
+	if err := q.Parse(r, now); err != nil {
+		return types.FarmSLA{}, false, err
+	}
+
+	db := mw.Database(r)
+	if _, err := (directory.FarmFilter{}).WithID(q.FarmID).Get(r.Context(), db); err != nil {
+		return types.FarmSLA{}, false, mw.NotFound(fmt.Errorf("farm '%d' not found", q.FarmID)).WithCode(mw.CodeFarmNotFound)
+	}
+
+	sla, err := a.farmSLA(r.Context(), db, q, now)
+	if err != nil {
+		return types.FarmSLA{}, false, mw.Error(err)
+	}
+
+	return sla, q.CSV, nil
+}
+
+// farmSLAHandler serves the sla of a farm as json or as csv
+func (a *API) farmSLAHandler(w http.ResponseWriter, r *http.Request) {
+	sla, csv, result := a.loadFarmSLA(r)
+	if result != nil {
+		mw.WriteError(w, r, result)
+		return
+	}
+
+	if !csv {
+		mw.AsHandlerFunc(func(*http.Request) (interface{}, mw.Response) {
+			return sla, nil
+		})(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"farm-%d-sla.csv\"", sla.FarmID))
+	if err := sla.WriteCSV(w); err != nil {
+		log.Error().Err(err).Msg("failed to write farm sla")
+	}
+}
@@ -0,0 +1,55 @@
+package workloads
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+func TestSLAQueryParse(t *testing.T) {
+	now := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)
+	request := func(query string) *slaQuery {
+		r := httptest.NewRequest("GET", "/api/v1/farms/1/sla?"+query, nil)
+		r = mux.SetURLVars(r, map[string]string{"farm_id": "1"})
+
+		var q slaQuery
+		if err := q.Parse(r, now); err != nil {
+			return nil
+		}
+		return &q
+	}
+
+	// the current month by default
+	q := request("")
+	require.NotNil(t, q)
+	assert.Equal(t, schema.ID(1), q.FarmID)
+	assert.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), q.From)
+	assert.Equal(t, now, q.To)
+	assert.False(t, q.CSV)
+
+	from := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	q = request("format=csv&from=1612137600&to=1614556800")
+	require.NotNil(t, q)
+	assert.Equal(t, from, q.From)
+	assert.Equal(t, from.AddDate(0, 1, 0), q.To)
+	assert.True(t, q.CSV)
+
+	// the end of the period is capped to now
+	q = request("from=1612137600&to=1700000000")
+	require.NotNil(t, q)
+	assert.Equal(t, now, q.To)
+
+	// a whole year is accepted, not more
+	q = request("from=1584230400")
+	require.NotNil(t, q)
+	assert.Equal(t, time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC), q.From)
+
+	for _, query := range []string{"format=xml", "from=yesterday", "from=1614556800&to=1612137600", "from=1577836800"} {
+		assert.Nil(t, request(query), query)
+	}
+}
@@ -0,0 +1,77 @@
+package types
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrApprovalNotPending is returned when a workload is approved or
+	// rejected while it is not waiting for the farmer anymore
+	ErrApprovalNotPending = errors.New("workload is not waiting for farmer approval")
+)
+
+// workloadLeaveApprove moves a workload waiting for approval to the given next
+// action, and sets the extra fields at the same time. If the workload is not
+// waiting for approval anymore ErrApprovalNotPending is returned, so a workload
+// is never both approved and rejected.
+func workloadLeaveApprove(ctx context.Context, db *mongo.Database, w WorkloaderType, action generated.NextActionEnum, set bson.M, reason string) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(w.GetID()).WithNextAction(Approve)
+
+	if set == nil {
+		set = bson.M{}
+	}
+	set["next_action"] = action
+
+	result, err := db.Collection(WorkloadCollection).UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return errors.Wrap(err, "failed to update workload waiting for approval")
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrApprovalNotPending
+	}
+
+	w.SetNextAction(action)
+	event := newWorkloadEvent(WorkloadEventNextAction, w)
+	event.Reason = reason
+	if err := recordWorkloadEvent(ctx, db, event); err != nil {
+		log.Error().Err(err).Int64("workload", int64(w.GetID())).Msg("failed to record next action change")
+	}
+
+	return nil
+}
+
+// WorkloadApprove sets the farmer signature of a workload waiting for
+// approval, and schedules it to deploy
+func WorkloadApprove(ctx context.Context, db *mongo.Database, w WorkloaderType, signature generated.SigningSignature) error {
+	w.SetSignatureFarmer(signature)
+
+	err := workloadLeaveApprove(ctx, db, w, Deploy, bson.M{"signature_farmer": signature}, ReasonApproved)
+	if err != nil {
+		return err
+	}
+
+	event := newWorkloadEvent(WorkloadEventSignatureFarmer, w)
+	event.Signature = &signature
+	if err := recordWorkloadEvent(ctx, db, event); err != nil {
+		log.Error().Err(err).Int64("workload", int64(w.GetID())).Msg("failed to record farmer signature")
+	}
+
+	if err := WorkloadTypePush(ctx, db, w); err != nil {
+		return errors.Wrap(err, "failed to schedule workload for deploying")
+	}
+
+	return nil
+}
+
+// WorkloadReject invalidates a workload waiting for approval
+func WorkloadReject(ctx context.Context, db *mongo.Database, w WorkloaderType, reason string) error {
+	return workloadLeaveApprove(ctx, db, w, Invalid, nil, reason)
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// WorkloadArchiveCollection db collection name, it holds the deleted
+	// workloads moved out of the workload collection
+	WorkloadArchiveCollection = "workload_archive"
+)
+
+// WorkloadArchive moves a deleted workload to the archive collection. The
+// archived document is kept as a tombstone so the workload can still be
+// looked up, but it is removed from the workload collection and the node
+// queue so nodes never see it again. Archiving a workload twice is a no-op.
+func WorkloadArchive(ctx context.Context, db *mongo.Database, w WorkloaderType) error {
+	doc, err := bson.Marshal(w)
+	if err != nil {
+		return errors.Wrap(err, "could not encode workload")
+	}
+
+	var archived bson.M
+	if err := bson.Unmarshal(doc, &archived); err != nil {
+		return errors.Wrap(err, "could not encode workload")
+	}
+	archived["archived_at"] = schema.Date{Time: time.Now()}
+
+	col := db.Collection(WorkloadArchiveCollection)
+	_, err = col.ReplaceOne(ctx, bson.M{"_id": w.GetID()}, archived, options.Replace().SetUpsert(true))
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive workload '%d'", w.GetID())
+	}
+
+	if err := WorkloadPop(ctx, db, w.GetID()); err != nil {
+		return errors.Wrapf(err, "failed to remove workload '%d' from the node queue", w.GetID())
+	}
+
+	// only a workload which is still deleted is removed, in case it changed
+	// since it was loaded
+	var filter WorkloadFilter
+	filter = filter.WithID(w.GetID()).WithNextAction(Deleted)
+	if _, err := db.Collection(WorkloadCollection).DeleteOne(ctx, filter); err != nil {
+		return errors.Wrapf(err, "failed to remove archived workload '%d'", w.GetID())
+	}
+
+	return nil
+}
+
+// WorkloadArchiveGet gets an archived workload
+func WorkloadArchiveGet(ctx context.Context, db *mongo.Database, id schema.ID) (WorkloaderType, error) {
+	var w WorkloaderType
+
+	result := db.Collection(WorkloadArchiveCollection).FindOne(ctx, bson.M{"_id": id})
+	if err := result.Err(); err != nil {
+		return w, err
+	}
+
+	if err := result.Decode(&w); err != nil {
+		return w, errors.Wrap(err, "could not decode workload type")
+	}
+
+	return w, nil
+}
@@ -0,0 +1,271 @@
+package types
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// WorkloadEventCollection db collection name, events are never updated
+	// or removed so it holds the full history of every workload
+	WorkloadEventCollection = "workload_event"
+)
+
+// WorkloadEventKind is the kind of state change of a workload
+type WorkloadEventKind string
+
+const (
+	// WorkloadEventNextAction is sent when the next action of a workload changed
+	WorkloadEventNextAction WorkloadEventKind = "next_action"
+	// WorkloadEventResult is sent when a node pushed a result for a workload
+	WorkloadEventResult WorkloadEventKind = "result"
+	// WorkloadEventSignatureProvision is sent when a provision signature is
+	// added to a workload
+	WorkloadEventSignatureProvision WorkloadEventKind = "signature_provision"
+	// WorkloadEventSignatureDelete is sent when a delete signature is added to
+	// a workload
+	WorkloadEventSignatureDelete WorkloadEventKind = "signature_delete"
+	// WorkloadEventSignatureFarmer is sent when the farmer approves a workload
+	WorkloadEventSignatureFarmer WorkloadEventKind = "signature_farmer"
+	// WorkloadEventMigration is sent on both workloads when a workload is
+	// migrated to another node, the other workload is set as related
+	WorkloadEventMigration WorkloadEventKind = "migration"
+)
+
+// Reasons of the next action changes done by the explorer
+const (
+	ReasonCreated          = "workload created"
+	ReasonGroupCreated     = "deployment group created"
+	ReasonGroupFailed      = "deployment group creation failed"
+	ReasonPoolEmpty        = "pool does not have enough capacity"
+	ReasonPoolPaid         = "pool paid"
+	ReasonPoolExpired      = "pool expired"
+	ReasonExpired          = "workload expired"
+	ReasonDeleteSigned     = "delete signed"
+	ReasonDeploymentFailed = "deployment failed"
+	ReasonDeletedByNode    = "deleted by node"
+	ReasonPublicIPSwapped  = "public ip moved to another workload"
+	ReasonMigrationStarted = "migration started"
+	ReasonMigrationFailed  = "migration failed"
+	ReasonMigrated         = "workload migrated"
+	ReasonApprovalRequired = "farmer approval required"
+	ReasonApproved         = "approved by farmer"
+	ReasonRejected         = "rejected by farmer"
+	ReasonApprovalTimeout  = "farmer approval timed out"
+)
+
+// WorkloadEvent is a state change of a workload
+type WorkloadEvent struct {
+	ID           schema.ID                  `bson:"_id" json:"id"`
+	Kind         WorkloadEventKind          `bson:"kind" json:"kind"`
+	WorkloadID   schema.ID                  `bson:"workload_id" json:"workload_id"`
+	WorkloadType generated.WorkloadTypeEnum `bson:"workload_type" json:"workload_type"`
+	CustomerTid  int64                      `bson:"customer_tid" json:"customer_tid"`
+	PoolID       int64                      `bson:"pool_id" json:"pool_id"`
+	NodeID       string                     `bson:"node_id" json:"node_id"`
+	NextAction   generated.NextActionEnum   `bson:"next_action" json:"next_action"`
+	// Reason of a next action change done by the explorer
+	Reason string `bson:"reason,omitempty" json:"reason,omitempty"`
+	// Result is the result pushed by the node, including the node signature
+	Result generated.Result `bson:"result" json:"result"`
+	// Signature is the signature added by a signature event
+	Signature *generated.SigningSignature `bson:"signature,omitempty" json:"signature,omitempty"`
+	// RelatedID is the other workload of a migration event
+	RelatedID schema.ID   `bson:"related_id,omitempty" json:"related_id,omitempty"`
+	Epoch     schema.Date `bson:"epoch" json:"epoch"`
+}
+
+// WorkloadEventSelector selects the events of the workloads of a customer, of
+// a pool, or of a list of workloads. Empty fields match all events.
+type WorkloadEventSelector struct {
+	CustomerTid int64
+	PoolID      int64
+	WorkloadIDs []schema.ID
+}
+
+// IsEmpty returns true if the selector matches all events
+func (s WorkloadEventSelector) IsEmpty() bool {
+	return s.CustomerTid == 0 && s.PoolID == 0 && len(s.WorkloadIDs) == 0
+}
+
+// Match checks if the event is selected
+func (s WorkloadEventSelector) Match(e WorkloadEvent) bool {
+	if s.CustomerTid != 0 && e.CustomerTid != s.CustomerTid {
+		return false
+	}
+
+	if s.PoolID != 0 && e.PoolID != s.PoolID {
+		return false
+	}
+
+	if len(s.WorkloadIDs) == 0 {
+		return true
+	}
+
+	for _, id := range s.WorkloadIDs {
+		if id == e.WorkloadID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns the db filter for the selected events
+func (s WorkloadEventSelector) Filter() WorkloadEventFilter {
+	var filter WorkloadEventFilter
+	if s.CustomerTid != 0 {
+		filter = filter.WithCustomerID(s.CustomerTid)
+	}
+	if s.PoolID != 0 {
+		filter = filter.WithPoolID(s.PoolID)
+	}
+	if len(s.WorkloadIDs) != 0 {
+		filter = filter.WithWorkloadIDs(s.WorkloadIDs)
+	}
+
+	return filter
+}
+
+// WorkloadEventFilter type
+type WorkloadEventFilter bson.D
+
+// WithWorkloadID filter events of a workload
+func (f WorkloadEventFilter) WithWorkloadID(id schema.ID) WorkloadEventFilter {
+	return append(f, bson.E{Key: "workload_id", Value: id})
+}
+
+// WithIDGT filter events that happened after the event with the given id
+func (f WorkloadEventFilter) WithIDGT(id schema.ID) WorkloadEventFilter {
+	return append(f, bson.E{Key: "_id", Value: bson.M{"$gt": id}})
+}
+
+// WithCustomerID filter events on customer
+func (f WorkloadEventFilter) WithCustomerID(customerID int64) WorkloadEventFilter {
+	return append(f, bson.E{Key: "customer_tid", Value: customerID})
+}
+
+// WithPoolID filter events on pool
+func (f WorkloadEventFilter) WithPoolID(poolID int64) WorkloadEventFilter {
+	return append(f, bson.E{Key: "pool_id", Value: poolID})
+}
+
+// WithWorkloadIDs filter events of the given workloads
+func (f WorkloadEventFilter) WithWorkloadIDs(ids []schema.ID) WorkloadEventFilter {
+	return append(f, bson.E{Key: "workload_id", Value: bson.M{"$in": ids}})
+}
+
+// FindCursor runs the filter, and return a cursor over the events in the
+// order they happened
+func (f WorkloadEventFilter) FindCursor(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	if f == nil {
+		f = WorkloadEventFilter{}
+	}
+
+	opts = append([]*options.FindOptions{options.Find().SetSort(bson.M{"_id": 1})}, opts...)
+	cursor, err := db.Collection(WorkloadEventCollection).Find(ctx, f, opts...)
+
+	return cursor, errors.Wrap(err, "failed to get workload event cursor")
+}
+
+// Count number of events matching
+func (f WorkloadEventFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	if f == nil {
+		f = WorkloadEventFilter{}
+	}
+
+	return db.Collection(WorkloadEventCollection).CountDocuments(ctx, f)
+}
+
+// newWorkloadEvent creates an event with the current state of the workload
+func newWorkloadEvent(kind WorkloadEventKind, w WorkloaderType) WorkloadEvent {
+	return WorkloadEvent{
+		Kind:         kind,
+		WorkloadID:   w.GetID(),
+		WorkloadType: w.GetWorkloadType(),
+		CustomerTid:  w.GetCustomerTid(),
+		PoolID:       w.GetPoolID(),
+		NodeID:       w.GetNodeID(),
+		NextAction:   w.GetNextAction(),
+		Result:       w.GetResult(),
+		Epoch:        schema.Date{Time: time.Now()},
+	}
+}
+
+// recordWorkloadEvent appends the event to the workload history and
+// publishes it on the WorkloadEvents bus
+func recordWorkloadEvent(ctx context.Context, db *mongo.Database, event WorkloadEvent) error {
+	id, err := models.NextID(ctx, db, WorkloadEventCollection)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate workload event id")
+	}
+
+	event.ID = id
+	if _, err := db.Collection(WorkloadEventCollection).InsertOne(ctx, event); err != nil {
+		return errors.Wrap(err, "failed to save workload event")
+	}
+
+	WorkloadEvents.Publish(event)
+	return nil
+}
+
+// WorkloadEvents is the bus where all the workload state changes are published
+var WorkloadEvents = NewWorkloadEventBus()
+
+// WorkloadEventBus dispatches workload events to all the subscribers
+type WorkloadEventBus struct {
+	m    sync.Mutex
+	subs map[chan WorkloadEvent]struct{}
+}
+
+// NewWorkloadEventBus creates a new event bus
+func NewWorkloadEventBus() *WorkloadEventBus {
+	return &WorkloadEventBus{
+		subs: make(map[chan WorkloadEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving all published events, and a function
+// to cancel the subscription. The bus never blocks on a slow subscriber, once
+// the buffer of a subscriber is full its channel is closed, and the
+// subscriber needs to catch up from the event collection.
+func (b *WorkloadEventBus) Subscribe(buffer int) (<-chan WorkloadEvent, func()) {
+	ch := make(chan WorkloadEvent, buffer)
+
+	b.m.Lock()
+	b.subs[ch] = struct{}{}
+	b.m.Unlock()
+
+	return ch, func() {
+		b.m.Lock()
+		defer b.m.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the event to all subscribers
+func (b *WorkloadEventBus) Publish(event WorkloadEvent) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWorkloadEventSelector(t *testing.T) {
+	event := WorkloadEvent{WorkloadID: 10, CustomerTid: 1, PoolID: 2}
+
+	cases := []struct {
+		name     string
+		selector WorkloadEventSelector
+		match    bool
+	}{
+		{name: "customer", selector: WorkloadEventSelector{CustomerTid: 1}, match: true},
+		{name: "other customer", selector: WorkloadEventSelector{CustomerTid: 3}, match: false},
+		{name: "pool", selector: WorkloadEventSelector{PoolID: 2}, match: true},
+		{name: "other pool", selector: WorkloadEventSelector{CustomerTid: 1, PoolID: 3}, match: false},
+		{name: "workload", selector: WorkloadEventSelector{WorkloadIDs: []schema.ID{9, 10}}, match: true},
+		{name: "other workload", selector: WorkloadEventSelector{CustomerTid: 1, WorkloadIDs: []schema.ID{11}}, match: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.match, tc.selector.Match(event))
+		})
+	}
+}
+
+func TestWorkloadEventBus(t *testing.T) {
+	bus := NewWorkloadEventBus()
+
+	fast, cancelFast := bus.Subscribe(2)
+	defer cancelFast()
+	slow, cancelSlow := bus.Subscribe(1)
+	defer cancelSlow()
+
+	bus.Publish(WorkloadEvent{ID: 1})
+	assert.Equal(t, schema.ID(1), (<-fast).ID)
+
+	bus.Publish(WorkloadEvent{ID: 2})
+	bus.Publish(WorkloadEvent{ID: 3})
+	assert.Equal(t, schema.ID(2), (<-fast).ID)
+	assert.Equal(t, schema.ID(3), (<-fast).ID)
+
+	// the slow subscriber never read, it is dropped once its buffer is full
+	event, ok := <-slow
+	require.True(t, ok)
+	assert.Equal(t, schema.ID(1), event.ID)
+	_, ok = <-slow
+	assert.False(t, ok)
+
+	// canceling a subscription twice is fine
+	cancelFast()
+	_, ok = <-fast
+	assert.False(t, ok)
+}
+
+// mockDocument returns v as a document of a mocked database response
+func mockDocument(t require.TestingT, v interface{}) bson.D {
+	buf, err := bson.Marshal(v)
+	require.NoError(t, err)
+
+	var doc bson.D
+	require.NoError(t, bson.Unmarshal(buf, &doc))
+	return doc
+}
+
+// insertedEvents returns the workload events inserted by the commands sent
+// to the mocked database
+func insertedEvents(mt *mtest.T) []WorkloadEvent {
+	var events []WorkloadEvent
+	for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+		if started.CommandName != "insert" || started.Command.Lookup("insert").StringValue() != WorkloadEventCollection {
+			continue
+		}
+
+		docs, err := started.Command.Lookup("documents").Array().Values()
+		require.NoError(mt, err)
+		for _, doc := range docs {
+			var event WorkloadEvent
+			require.NoError(mt, bson.Unmarshal(doc.Document(), &event))
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+func TestWorkloadResultPush(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	push := func(mt *mtest.T, state generated.ResultStateEnum, signature string, sequence int64) (Result, []bson.D) {
+		result := Result{WorkloadId: "1-1", State: state, Signature: signature, NodeId: "node"}
+		workload := WorkloaderType{Workloader: &generated.Volume{ReservationInfo: generated.ReservationInfo{
+			ID:           1,
+			WorkloadId:   1,
+			NodeId:       "node",
+			WorkloadType: generated.WorkloadTypeVolume,
+			NextAction:   Deploy,
+			Result:       generated.Result(result),
+		}}}
+
+		return result, []bson.D{
+			// the workload with the result
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: mockDocument(mt, workload)}),
+			// the id of the event
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "sequence", Value: sequence}}}),
+		}
+	}
+
+	mt.Run("one event per result", func(mt *mtest.T) {
+		states := []generated.ResultStateEnum{generated.ResultStateError, generated.ResultStateOK, generated.ResultStateError}
+		for i, state := range states {
+			result, responses := push(mt, state, fmt.Sprintf("signature-%d", i), int64(i+1))
+			mt.AddMockResponses(append(responses, mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))...)
+			require.NoError(mt, WorkloadResultPush(context.Background(), mt.DB, 1, result))
+		}
+
+		events := insertedEvents(mt)
+		require.Len(mt, events, len(states))
+		for i, event := range events {
+			assert.Equal(mt, schema.ID(i+1), event.ID)
+			assert.Equal(mt, WorkloadEventResult, event.Kind)
+			assert.Equal(mt, schema.ID(1), event.WorkloadID)
+			assert.Equal(mt, states[i], event.Result.State)
+			assert.Equal(mt, fmt.Sprintf("signature-%d", i), event.Result.Signature)
+		}
+	})
+
+	mt.Run("event not recorded", func(mt *mtest.T) {
+		// the node must push the result again, so it is not missing from the
+		// history
+		result, responses := push(mt, generated.ResultStateOK, "signature", 1)
+		mt.AddMockResponses(append(responses, mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "insert failed"}))...)
+		assert.Error(mt, WorkloadResultPush(context.Background(), mt.DB, 1, result))
+	})
+}
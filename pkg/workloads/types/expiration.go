@@ -0,0 +1,55 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WorkloadNextExpiration returns the expiration time of the deployed workload
+// which expires first. It returns a zero time if no deployed workload has an
+// expiration time.
+func WorkloadNextExpiration(ctx context.Context, db *mongo.Database) (time.Time, error) {
+	var filter WorkloadFilter
+	filter = filter.WithNextAction(Deploy).WithExpiration()
+
+	result := db.Collection(WorkloadCollection).FindOne(ctx, filter,
+		options.FindOne().
+			SetSort(bson.M{"expires_at.time": 1}).
+			SetProjection(bson.M{"expires_at": 1}),
+	)
+
+	var w struct {
+		ExpiresAt schema.Date `bson:"expires_at"`
+	}
+
+	if err := result.Decode(&w); errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to load next workload to expire")
+	}
+
+	return w.ExpiresAt.Time, nil
+}
+
+// WorkloadSetExpiration changes the expiration time of a workload. The
+// expiration is part of the signature challenge, so the customer signature
+// over the new challenge is stored with it.
+func WorkloadSetExpiration(ctx context.Context, db *mongo.Database, id schema.ID, expiresAt schema.Date, signature string) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(id)
+
+	_, err := db.Collection(WorkloadCollection).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"expires_at":         expiresAt,
+			"customer_signature": signature,
+		},
+	})
+
+	return errors.Wrap(err, "failed to update workload expiration")
+}
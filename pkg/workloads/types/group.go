@@ -0,0 +1,193 @@
+package types
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DeploymentGroupCollection db collection name
+	DeploymentGroupCollection = "deployment_group"
+)
+
+// DeploymentGroupStatus is the status of a deployment group, aggregated
+// from the status of its workloads
+type DeploymentGroupStatus string
+
+const (
+	// DeploymentGroupDeploying means some workloads are not deployed yet
+	DeploymentGroupDeploying DeploymentGroupStatus = "deploying"
+	// DeploymentGroupDeployed means all workloads are successfully deployed
+	DeploymentGroupDeployed DeploymentGroupStatus = "deployed"
+	// DeploymentGroupError means at least one workload failed to deploy
+	DeploymentGroupError DeploymentGroupStatus = "error"
+	// DeploymentGroupDeleting means some workloads are being deleted
+	DeploymentGroupDeleting DeploymentGroupStatus = "deleting"
+	// DeploymentGroupDeleted means all workloads are deleted
+	DeploymentGroupDeleted DeploymentGroupStatus = "deleted"
+)
+
+// DeploymentGroup is a set of workloads which are created together, and
+// deleted together
+type DeploymentGroup struct {
+	ID          schema.ID   `bson:"_id" json:"id"`
+	CustomerTid int64       `bson:"customer_tid" json:"customer_tid"`
+	WorkloadIDs []schema.ID `bson:"workload_ids" json:"workload_ids"`
+	Epoch       schema.Date `bson:"epoch" json:"epoch"`
+}
+
+// DeploymentGroupSignature is the delete signature of a single workload of a
+// deployment group
+type DeploymentGroupSignature struct {
+	WorkloadID schema.ID `json:"workload_id"`
+	generated.SigningSignature
+}
+
+// ApplyQueryFilterDeploymentGroup parses the query string
+func ApplyQueryFilterDeploymentGroup(r *http.Request, filter DeploymentGroupFilter) (DeploymentGroupFilter, error) {
+	customerid, err := models.QueryInt(r, "customer_tid")
+	if err != nil {
+		return nil, errors.Wrap(err, "customer_tid should be an integer")
+	}
+	if customerid != 0 {
+		filter = filter.WithCustomerID(customerid)
+	}
+
+	workloadID, err := models.QueryInt(r, "workload_id")
+	if err != nil {
+		return nil, errors.Wrap(err, "workload_id should be an integer")
+	}
+	if workloadID != 0 {
+		filter = filter.WithWorkloadID(schema.ID(workloadID))
+	}
+
+	return filter, nil
+}
+
+// DeploymentGroupFilter type
+type DeploymentGroupFilter bson.D
+
+// WithID filter group with ID
+func (f DeploymentGroupFilter) WithID(id schema.ID) DeploymentGroupFilter {
+	return append(f, bson.E{Key: "_id", Value: id})
+}
+
+// WithCustomerID filter groups on customer
+func (f DeploymentGroupFilter) WithCustomerID(customerID int64) DeploymentGroupFilter {
+	return append(f, bson.E{Key: "customer_tid", Value: customerID})
+}
+
+// WithWorkloadID filter the group containing the workload
+func (f DeploymentGroupFilter) WithWorkloadID(id schema.ID) DeploymentGroupFilter {
+	return append(f, bson.E{Key: "workload_ids", Value: id})
+}
+
+// Get gets single group that matches the filter
+func (f DeploymentGroupFilter) Get(ctx context.Context, db *mongo.Database) (DeploymentGroup, error) {
+	if f == nil {
+		f = DeploymentGroupFilter{}
+	}
+	var group DeploymentGroup
+
+	result := db.Collection(DeploymentGroupCollection).FindOne(ctx, f)
+	if err := result.Err(); err != nil {
+		return group, err
+	}
+
+	if err := result.Decode(&group); err != nil {
+		return group, errors.Wrap(err, "could not decode deployment group")
+	}
+
+	return group, nil
+}
+
+// Find all groups that match the filter
+func (f DeploymentGroupFilter) Find(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) ([]DeploymentGroup, error) {
+	if f == nil {
+		f = DeploymentGroupFilter{}
+	}
+
+	cursor, err := db.Collection(DeploymentGroupCollection).Find(ctx, f, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deployment group cursor")
+	}
+	defer cursor.Close(ctx)
+
+	groups := []DeploymentGroup{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, errors.Wrap(err, "could not decode deployment groups")
+	}
+
+	return groups, nil
+}
+
+// Count number of groups matching
+func (f DeploymentGroupFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	if f == nil {
+		f = DeploymentGroupFilter{}
+	}
+
+	return db.Collection(DeploymentGroupCollection).CountDocuments(ctx, f)
+}
+
+// DeploymentGroupCreate saves a new deployment group to the database
+func DeploymentGroupCreate(ctx context.Context, db *mongo.Database, group DeploymentGroup) (schema.ID, error) {
+	id, err := models.NextID(ctx, db, DeploymentGroupCollection)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to generate deployment group id")
+	}
+	group.ID = id
+
+	if _, err := db.Collection(DeploymentGroupCollection).InsertOne(ctx, group); err != nil {
+		return 0, errors.Wrap(err, "failed to save deployment group")
+	}
+
+	return id, nil
+}
+
+// DeploymentGroupRemove removes a deployment group which could not be created
+func DeploymentGroupRemove(ctx context.Context, db *mongo.Database, id schema.ID) error {
+	_, err := db.Collection(DeploymentGroupCollection).DeleteOne(ctx, DeploymentGroupFilter{}.WithID(id))
+	return errors.Wrap(err, "failed to remove deployment group")
+}
+
+// GroupStatus aggregates the status of the workloads of a group
+func GroupStatus(workloads []WorkloaderType) DeploymentGroupStatus {
+	var deleted, deleting, deployed, failed int
+	for _, w := range workloads {
+		// a workload without result has an empty workload id in the result
+		hasResult := w.GetResult().WorkloadId != ""
+
+		switch {
+		case w.IsAny(Deleted) || (hasResult && w.AllDeleted()):
+			deleted++
+		case w.IsAny(Delete):
+			deleting++
+		case w.IsAny(Invalid) || (hasResult && w.GetResult().State == generated.ResultStateError):
+			failed++
+		case w.IsAny(Deploy) && hasResult && w.GetResult().State == generated.ResultStateOK:
+			deployed++
+		}
+	}
+
+	switch {
+	case deleted == len(workloads):
+		return DeploymentGroupDeleted
+	case deleted+deleting > 0:
+		return DeploymentGroupDeleting
+	case failed > 0:
+		return DeploymentGroupError
+	case deployed == len(workloads):
+		return DeploymentGroupDeployed
+	default:
+		return DeploymentGroupDeploying
+	}
+}
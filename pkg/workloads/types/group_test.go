@@ -0,0 +1,83 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+)
+
+func TestGroupStatus(t *testing.T) {
+	workload := func(action generated.NextActionEnum, result *generated.ResultStateEnum) WorkloaderType {
+		w := WorkloaderType{Workloader: &generated.Container{}}
+		w.SetNextAction(action)
+		if result != nil {
+			w.SetResult(generated.Result{WorkloadId: "1-1", State: *result})
+		}
+		return w
+	}
+	state := func(s generated.ResultStateEnum) *generated.ResultStateEnum {
+		return &s
+	}
+
+	cases := []struct {
+		name      string
+		workloads []WorkloaderType
+		status    DeploymentGroupStatus
+	}{
+		{
+			name: "deploying",
+			workloads: []WorkloaderType{
+				workload(Deploy, state(generated.ResultStateOK)),
+				workload(Deploy, nil),
+			},
+			status: DeploymentGroupDeploying,
+		},
+		{
+			name: "deployed",
+			workloads: []WorkloaderType{
+				workload(Deploy, state(generated.ResultStateOK)),
+				workload(Deploy, state(generated.ResultStateOK)),
+			},
+			status: DeploymentGroupDeployed,
+		},
+		{
+			name: "error",
+			workloads: []WorkloaderType{
+				workload(Deploy, state(generated.ResultStateOK)),
+				workload(Deploy, state(generated.ResultStateError)),
+			},
+			status: DeploymentGroupError,
+		},
+		{
+			name: "invalid",
+			workloads: []WorkloaderType{
+				workload(Deploy, nil),
+				workload(Invalid, nil),
+			},
+			status: DeploymentGroupError,
+		},
+		{
+			name: "deleting",
+			workloads: []WorkloaderType{
+				workload(Deleted, state(generated.ResultStateDeleted)),
+				workload(Delete, state(generated.ResultStateOK)),
+			},
+			status: DeploymentGroupDeleting,
+		},
+		{
+			name: "deleted",
+			workloads: []WorkloaderType{
+				workload(Deleted, state(generated.ResultStateDeleted)),
+				workload(Deleted, nil),
+			},
+			status: DeploymentGroupDeleted,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, GroupStatus(tc.workloads))
+		})
+	}
+}
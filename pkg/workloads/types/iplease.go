@@ -0,0 +1,365 @@
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/threefoldtech/zos/pkg/crypto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// IPLeaseCollection db collection name
+	IPLeaseCollection = "ip_lease"
+
+	// MaxIPHoldPeriod is the maximum time a public ip can be held after its
+	// workload is deleted
+	MaxIPHoldPeriod = 30 * 24 * time.Hour
+)
+
+// IPLeaseState is the state of a public ip lease
+type IPLeaseState string
+
+const (
+	// IPLeaseActive is the state of a lease used by a deployed workload
+	IPLeaseActive IPLeaseState = "active"
+	// IPLeaseHeld is the state of a lease whose workload is deleted, the ip
+	// stays reserved for the customer until the hold expires
+	IPLeaseHeld IPLeaseState = "held"
+)
+
+var (
+	// ErrIPLeaseNotHeld is returned when an operation requires the lease to
+	// be held while it is not
+	ErrIPLeaseNotHeld = errors.New("public ip lease is not held")
+)
+
+// IPLease is the reservation of a public ip of a farm by a customer. The farm
+// ip is reserved by the workload of the lease, while the lease is held it
+// stays reserved by the deleted workload, which is still billed on the pool
+// of the lease.
+type IPLease struct {
+	ID          schema.ID     `bson:"_id" json:"id"`
+	FarmID      schema.ID     `bson:"farm_id" json:"farm_id"`
+	Address     schema.IPCidr `bson:"address" json:"address"`
+	CustomerTid int64         `bson:"customer_tid" json:"customer_tid"`
+	PoolID      int64         `bson:"pool_id" json:"pool_id"`
+	// WorkloadID is the workload reserving the ip on the farm
+	WorkloadID schema.ID    `bson:"workload_id" json:"workload_id"`
+	State      IPLeaseState `bson:"state" json:"state"`
+	// HoldPeriod is the number of seconds the ip is held once its workload is
+	// deleted, 0 releases the ip right away
+	HoldPeriod int64 `bson:"hold_period" json:"hold_period"`
+	// HeldUntil is the time a held ip is released at
+	HeldUntil schema.Date `bson:"held_until" json:"held_until"`
+	Epoch     schema.Date `bson:"epoch" json:"epoch"`
+}
+
+// Hold returns the time the ip is held once its workload is deleted
+func (l *IPLease) Hold() time.Duration {
+	return time.Duration(l.HoldPeriod) * time.Second
+}
+
+// TransferChallenge is the message the customer signs to consent to move the
+// lease to another pool
+func (l *IPLease) TransferChallenge(poolID int64) []byte {
+	return []byte(fmt.Sprintf("transfer%d%s%d", l.ID, l.Address.String(), poolID))
+}
+
+// TransferVerify verifies the customer signature of the lease transfer to
+// the given pool
+func (l *IPLease) TransferVerify(pk string, poolID int64, signature string) error {
+	key, err := crypto.KeyFromHex(pk)
+	if err != nil {
+		return errors.Wrap(err, "invalid verification key")
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature expecting hex encoded string")
+	}
+
+	msg := sha256.Sum256(l.TransferChallenge(poolID))
+	return crypto.Verify(key, msg[:], sig)
+}
+
+// ApplyQueryFilterIPLease parses the query string
+func ApplyQueryFilterIPLease(r *http.Request, filter IPLeaseFilter) (IPLeaseFilter, error) {
+	customerid, err := models.QueryInt(r, "customer_tid")
+	if err != nil {
+		return nil, errors.Wrap(err, "customer_tid should be an integer")
+	}
+	if customerid != 0 {
+		filter = filter.WithCustomerID(customerid)
+	}
+
+	poolID, err := models.QueryInt(r, "pool_id")
+	if err != nil {
+		return nil, errors.Wrap(err, "pool_id should be an integer")
+	}
+	if poolID != 0 {
+		filter = filter.WithPoolID(poolID)
+	}
+
+	farmID, err := models.QueryInt(r, "farm_id")
+	if err != nil {
+		return nil, errors.Wrap(err, "farm_id should be an integer")
+	}
+	if farmID != 0 {
+		filter = filter.WithFarmID(schema.ID(farmID))
+	}
+
+	switch state := IPLeaseState(r.FormValue("state")); state {
+	case "":
+	case IPLeaseActive, IPLeaseHeld:
+		filter = filter.WithState(state)
+	default:
+		return nil, fmt.Errorf("unknown ip lease state '%s'", state)
+	}
+
+	return filter, nil
+}
+
+// IPLeaseFilter type
+type IPLeaseFilter bson.D
+
+// WithID filter lease with id
+func (f IPLeaseFilter) WithID(id schema.ID) IPLeaseFilter {
+	return append(f, bson.E{Key: "_id", Value: id})
+}
+
+// WithAddress filter lease of an ip address
+func (f IPLeaseFilter) WithAddress(ip schema.IPCidr) IPLeaseFilter {
+	return append(f, bson.E{Key: "address", Value: ip})
+}
+
+// WithCustomerID filter leases on customer
+func (f IPLeaseFilter) WithCustomerID(customerID int64) IPLeaseFilter {
+	return append(f, bson.E{Key: "customer_tid", Value: customerID})
+}
+
+// WithPoolID filter leases on pool
+func (f IPLeaseFilter) WithPoolID(poolID int64) IPLeaseFilter {
+	return append(f, bson.E{Key: "pool_id", Value: poolID})
+}
+
+// WithFarmID filter leases on farm
+func (f IPLeaseFilter) WithFarmID(farmID schema.ID) IPLeaseFilter {
+	return append(f, bson.E{Key: "farm_id", Value: farmID})
+}
+
+// WithWorkloadID filter lease of a workload
+func (f IPLeaseFilter) WithWorkloadID(id schema.ID) IPLeaseFilter {
+	return append(f, bson.E{Key: "workload_id", Value: id})
+}
+
+// WithState filter leases on state
+func (f IPLeaseFilter) WithState(state IPLeaseState) IPLeaseFilter {
+	return append(f, bson.E{Key: "state", Value: state})
+}
+
+// Get gets single lease that matches the filter
+func (f IPLeaseFilter) Get(ctx context.Context, db *mongo.Database) (IPLease, error) {
+	if f == nil {
+		f = IPLeaseFilter{}
+	}
+	var lease IPLease
+
+	result := db.Collection(IPLeaseCollection).FindOne(ctx, f)
+	if err := result.Err(); err != nil {
+		return lease, err
+	}
+
+	return lease, errors.Wrap(result.Decode(&lease), "could not decode ip lease")
+}
+
+// Find all leases that match the filter
+func (f IPLeaseFilter) Find(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) ([]IPLease, error) {
+	if f == nil {
+		f = IPLeaseFilter{}
+	}
+
+	cursor, err := db.Collection(IPLeaseCollection).Find(ctx, f, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ip lease cursor")
+	}
+	defer cursor.Close(ctx)
+
+	leases := []IPLease{}
+	if err := cursor.All(ctx, &leases); err != nil {
+		return nil, errors.Wrap(err, "could not decode ip leases")
+	}
+
+	return leases, nil
+}
+
+// Count number of leases matching
+func (f IPLeaseFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	if f == nil {
+		f = IPLeaseFilter{}
+	}
+
+	return db.Collection(IPLeaseCollection).CountDocuments(ctx, f)
+}
+
+// IPLeaseAcquire sets the public ip workload as the active workload of the
+// lease of its ip. If the ip has no lease yet a new one is created for the
+// customer of the workload, the hold period of an existing lease is kept.
+func IPLeaseAcquire(ctx context.Context, db *mongo.Database, farmID schema.ID, w WorkloaderType) (IPLease, error) {
+	ipWorkload, ok := w.Workloader.(*generated.PublicIP)
+	if !ok {
+		return IPLease{}, fmt.Errorf("invalid workload type was expecting PublicIP got '%T'", w.Workloader)
+	}
+
+	var filter IPLeaseFilter
+	filter = filter.WithAddress(ipWorkload.IPaddress)
+
+	lease, err := filter.Get(ctx, db)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		id, err := models.NextID(ctx, db, IPLeaseCollection)
+		if err != nil {
+			return lease, errors.Wrap(err, "failed to generate ip lease id")
+		}
+
+		lease = IPLease{
+			ID:      id,
+			Address: ipWorkload.IPaddress,
+			Epoch:   schema.Date{Time: time.Now()},
+		}
+	} else if err != nil {
+		return lease, errors.Wrap(err, "failed to get ip lease")
+	}
+
+	if lease.CustomerTid != w.GetCustomerTid() {
+		lease.HoldPeriod = 0
+	}
+
+	lease.FarmID = farmID
+	lease.CustomerTid = w.GetCustomerTid()
+	lease.PoolID = w.GetPoolID()
+	lease.WorkloadID = w.GetID()
+	lease.State = IPLeaseActive
+	lease.HeldUntil = schema.Date{}
+
+	_, err = db.Collection(IPLeaseCollection).ReplaceOne(ctx, IPLeaseFilter{}.WithID(lease.ID), lease, options.Replace().SetUpsert(true))
+	return lease, errors.Wrap(err, "failed to save ip lease")
+}
+
+// IPLeaseBackfill creates the leases of the public ips which were reserved
+// before the leases existed, and returns the number of created leases
+func IPLeaseBackfill(ctx context.Context, db *mongo.Database) (int, error) {
+	cur, err := directory.FarmFilter{}.WithReservedIPs().Find(ctx, db)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list farms with reserved ips")
+	}
+	defer cur.Close(ctx)
+
+	var created int
+	for cur.Next(ctx) {
+		var farm directory.Farm
+		if err := cur.Decode(&farm); err != nil {
+			return created, errors.Wrap(err, "failed to load farm")
+		}
+
+		for _, ip := range farm.IPAddresses {
+			if ip.ReservationID == 0 {
+				continue
+			}
+
+			count, err := IPLeaseFilter{}.WithAddress(ip.Address).Count(ctx, db)
+			if err != nil {
+				return created, err
+			}
+			if count > 0 {
+				continue
+			}
+
+			workload, err := WorkloadFilter{}.WithID(ip.ReservationID).Get(ctx, db)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			} else if err != nil {
+				return created, errors.Wrapf(err, "failed to load workload '%d' of ip '%s'", ip.ReservationID, ip.Address.String())
+			}
+
+			if workload.GetWorkloadType() != generated.WorkloadTypePublicIP {
+				continue
+			}
+
+			if _, err := IPLeaseAcquire(ctx, db, farm.ID, workload); err != nil {
+				return created, err
+			}
+			created++
+		}
+	}
+
+	return created, cur.Err()
+}
+
+// IPLeaseHold marks the lease of a deleted workload as held until the given time
+func IPLeaseHold(ctx context.Context, db *mongo.Database, id schema.ID, until time.Time) error {
+	_, err := db.Collection(IPLeaseCollection).UpdateOne(ctx, IPLeaseFilter{}.WithID(id), bson.M{
+		"$set": bson.M{
+			"state":      IPLeaseHeld,
+			"held_until": schema.Date{Time: until},
+		},
+	})
+
+	return errors.Wrap(err, "failed to hold ip lease")
+}
+
+// IPLeaseSetHoldPeriod sets the time the ip is held once its workload is deleted
+func IPLeaseSetHoldPeriod(ctx context.Context, db *mongo.Database, id schema.ID, period time.Duration) error {
+	if period < 0 || period > MaxIPHoldPeriod {
+		return fmt.Errorf("hold period must be between 0 and %d seconds", int64(MaxIPHoldPeriod.Seconds()))
+	}
+
+	_, err := db.Collection(IPLeaseCollection).UpdateOne(ctx, IPLeaseFilter{}.WithID(id), bson.M{
+		"$set": bson.M{"hold_period": int64(period.Seconds())},
+	})
+
+	return errors.Wrap(err, "failed to set ip lease hold period")
+}
+
+// IPLeaseTransfer moves a held lease to another pool. If the lease is not held
+// anymore ErrIPLeaseNotHeld is returned.
+func IPLeaseTransfer(ctx context.Context, db *mongo.Database, id schema.ID, poolID int64) error {
+	var filter IPLeaseFilter
+	filter = filter.WithID(id).WithState(IPLeaseHeld)
+
+	result, err := db.Collection(IPLeaseCollection).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"pool_id": poolID},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to transfer ip lease")
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrIPLeaseNotHeld
+	}
+
+	return nil
+}
+
+// IPLeaseRestore saves a lease back as it was before it was acquired
+func IPLeaseRestore(ctx context.Context, db *mongo.Database, lease IPLease) error {
+	_, err := db.Collection(IPLeaseCollection).ReplaceOne(ctx, IPLeaseFilter{}.WithID(lease.ID), lease, options.Replace().SetUpsert(true))
+	return errors.Wrap(err, "failed to restore ip lease")
+}
+
+// IPLeaseRemove removes a lease, the ip is free again once its farm
+// reservation is released
+func IPLeaseRemove(ctx context.Context, db *mongo.Database, id schema.ID) error {
+	_, err := db.Collection(IPLeaseCollection).DeleteOne(ctx, IPLeaseFilter{}.WithID(id))
+	return errors.Wrap(err, "failed to remove ip lease")
+}
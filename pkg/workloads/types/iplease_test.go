@@ -0,0 +1,40 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/threefoldtech/zos/pkg/crypto"
+	"github.com/threefoldtech/zos/pkg/identity"
+)
+
+func TestIPLeaseTransferVerify(t *testing.T) {
+	kp, err := identity.GenerateKeyPair()
+	require.NoError(t, err)
+
+	address, err := schema.ParseIPCidr("185.69.166.10/24")
+	require.NoError(t, err)
+
+	lease := IPLease{
+		ID:      1,
+		Address: address,
+		PoolID:  1,
+		State:   IPLeaseHeld,
+	}
+
+	msg := sha256.Sum256(lease.TransferChallenge(2))
+	signature, err := crypto.Sign(kp.PrivateKey, msg[:])
+	require.NoError(t, err)
+
+	pk := hex.EncodeToString(kp.PublicKey)
+	sig := hex.EncodeToString(signature)
+
+	assert.NoError(t, lease.TransferVerify(pk, 2, sig))
+	// the signature only allows the transfer to the signed pool
+	assert.Error(t, lease.TransferVerify(pk, 3, sig))
+	assert.Error(t, lease.TransferVerify(pk, 2, "not hex"))
+}
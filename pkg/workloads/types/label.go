@@ -0,0 +1,75 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxLabels is the maximum number of labels of a workload
+	maxLabels = 32
+	// maxLabelValue is the maximum length of a label value
+	maxLabelValue = 255
+)
+
+// label keys are used as part of the document path, so they can't hold
+// characters with a special meaning in a query like . and $
+var labelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-/]{0,62}$`)
+
+func validateLabelKey(key string) error {
+	if !labelKeyRegex.MatchString(key) {
+		return fmt.Errorf("invalid label key '%s', keys are at most 63 characters of letters, digits, '_', '-' and '/' starting with a letter or a digit", key)
+	}
+
+	return nil
+}
+
+// ValidateLabels makes sure the workload labels can be stored and searched
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("a workload can have at most %d labels", maxLabels)
+	}
+
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+
+		if len(value) > maxLabelValue {
+			return fmt.Errorf("value of label '%s' can not be longer than %d bytes", key, maxLabelValue)
+		}
+	}
+
+	return nil
+}
+
+// WorkloadSetLabels replaces the labels of a workload. Labels are not part
+// of the signature challenge so they can be changed without signing the
+// workload again.
+func WorkloadSetLabels(ctx context.Context, db *mongo.Database, id schema.ID, labels map[string]string) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(id)
+
+	update := bson.M{"$set": bson.M{"labels": labels}}
+	if len(labels) == 0 {
+		update = bson.M{"$unset": bson.M{"labels": ""}}
+	}
+
+	col := db.Collection(WorkloadCollection)
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "failed to update workload labels")
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
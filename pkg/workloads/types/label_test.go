@@ -0,0 +1,87 @@
+package types
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateLabels(t *testing.T) {
+	require.NoError(t, ValidateLabels(nil))
+	require.NoError(t, ValidateLabels(map[string]string{"app": "web", "team/owner": "ops", "tier-1_a": ""}))
+
+	require.Error(t, ValidateLabels(map[string]string{"a.b": "dot"}))
+	require.Error(t, ValidateLabels(map[string]string{"$where": "operator"}))
+	require.Error(t, ValidateLabels(map[string]string{"-app": "leading dash"}))
+	require.Error(t, ValidateLabels(map[string]string{"app": strings.Repeat("x", maxLabelValue+1)}))
+
+	many := map[string]string{}
+	for i := 0; i <= maxLabels; i++ {
+		many[string(rune('a'+i%26))+strings.Repeat("x", i)] = ""
+	}
+	require.Error(t, ValidateLabels(many))
+}
+
+func TestApplyQueryFilterWorkload(t *testing.T) {
+	r := httptest.NewRequest("GET", "/workloads?customer_tid=1&pool_id=2&node_id=a,b&next_action=deploy,4&workload_type=container&result_state=OK&from_epoch=10&label=app=web&label=env", nil)
+
+	filter, err := ApplyQueryFilterWorkload(r, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, WorkloadFilter{
+		{Key: "customer_tid", Value: int64(1)},
+		{Key: "pool_id", Value: int64(2)},
+		{Key: "node_id", Value: bson.M{"$in": []string{"a", "b"}}},
+		{Key: "next_action", Value: bson.M{"$in": []generated.NextActionEnum{generated.NextActionDeploy, generated.NextActionDelete}}},
+		{Key: "workload_type", Value: bson.M{"$in": []generated.WorkloadTypeEnum{generated.WorkloadTypeContainer}}},
+		{Key: "result.state", Value: bson.M{"$in": []generated.ResultStateEnum{generated.ResultStateOK}}},
+		{Key: "result.workload_id", Value: bson.M{"$nin": bson.A{"", nil}}},
+		{Key: "epoch.time", Value: bson.M{"$gte": time.Unix(10, 0)}},
+		{Key: "labels.app", Value: "web"},
+		{Key: "labels.env", Value: bson.M{"$exists": true}},
+	}, filter)
+
+	for _, query := range []string{
+		"next_action=unknown",
+		"next_action=running",
+		"workload_type=300",
+		"result_state=done",
+		"to_epoch=yesterday",
+		"label=a.b=c",
+	} {
+		r := httptest.NewRequest("GET", "/workloads?"+query, nil)
+		_, err := ApplyQueryFilterWorkload(r, nil)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestWorkloadSortFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/workloads", nil)
+	sort, err := WorkloadSortFromRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "_id", Value: 1}}, sort)
+
+	r = httptest.NewRequest("GET", "/workloads?sort=-epoch,pool_id", nil)
+	sort, err = WorkloadSortFromRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "epoch.time", Value: -1},
+		{Key: "pool_id", Value: 1},
+		{Key: "_id", Value: 1},
+	}, sort)
+
+	r = httptest.NewRequest("GET", "/workloads?sort=-id", nil)
+	sort, err = WorkloadSortFromRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "_id", Value: -1}}, sort)
+
+	r = httptest.NewRequest("GET", "/workloads?sort=json", nil)
+	_, err = WorkloadSortFromRequest(r)
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrMigrationInProgress is returned when a workload is migrated while
+	// its previous migration did not finish yet
+	ErrMigrationInProgress = errors.New("workload is not deployed or is already being migrated")
+)
+
+// WorkloadMigrationStart links a deployed workload to the workload replacing
+// it on another node. A workload can only be migrated once at a time, if from
+// is not deployed or is already being migrated ErrMigrationInProgress is
+// returned.
+func WorkloadMigrationStart(ctx context.Context, db *mongo.Database, from, to WorkloaderType) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(from.GetID()).WithNextAction(Deploy)
+	filter = append(filter, bson.E{Key: "migrated_to", Value: bson.M{"$exists": false}})
+
+	result, err := db.Collection(WorkloadCollection).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"migrated_to": to.GetID()},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to mark workload as migrating")
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrMigrationInProgress
+	}
+
+	from.SetMigratedTo(to.GetID())
+	recordMigrationEvents(ctx, db, from, to, ReasonMigrationStarted)
+	return nil
+}
+
+// WorkloadMigrationFailed unlinks a workload from the workload which failed to
+// replace it, so it can be migrated again
+func WorkloadMigrationFailed(ctx context.Context, db *mongo.Database, from, to WorkloaderType) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(from.GetID())
+	filter = append(filter, bson.E{Key: "migrated_to", Value: to.GetID()})
+
+	_, err := db.Collection(WorkloadCollection).UpdateOne(ctx, filter, bson.M{
+		"$unset": bson.M{"migrated_to": ""},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to unmark workload as migrating")
+	}
+
+	from.SetMigratedTo(0)
+	recordMigrationEvents(ctx, db, from, to, ReasonMigrationFailed)
+	return nil
+}
+
+// WorkloadMigrationDone records the end of a successful migration, the
+// replaced workload still needs to be deleted by the caller
+func WorkloadMigrationDone(ctx context.Context, db *mongo.Database, from, to WorkloaderType) {
+	recordMigrationEvents(ctx, db, from, to, ReasonMigrated)
+}
+
+// recordMigrationEvents adds a migration event to the history of both
+// workloads, each pointing to the other one
+func recordMigrationEvents(ctx context.Context, db *mongo.Database, from, to WorkloaderType, reason string) {
+	for _, pair := range [][2]WorkloaderType{{from, to}, {to, from}} {
+		event := newWorkloadEvent(WorkloadEventMigration, pair[0])
+		event.Reason = reason
+		event.RelatedID = pair[1].GetID()
+		if err := recordWorkloadEvent(ctx, db, event); err != nil {
+			// the migration state is already changed, the history is best
+			// effort like for the other next action changes
+			log.Error().Err(err).Int64("workload", int64(pair[0].GetID())).Msg("failed to record migration event")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NodeWork is the index of the nodes which got new work, it is notified
+// every time a workload is queued for a node or changes state
+var NodeWork = NewNodeNotifier()
+
+// NodeNotifier is an in memory index of the nodes which have new work. Each
+// node has a version which is increased on every notification, so a waiter
+// can't miss a notification that happened before it started waiting.
+//
+// Only notified nodes, which have workloads, stay in the index. A node which
+// was never notified has version 0 and is only kept while it has waiters, so
+// polling for unknown nodes doesn't grow the index.
+//
+// The index is not shared between explorer instances, so a waiter must
+// always fall back to looking for work in the database once its wait times
+// out.
+type NodeNotifier struct {
+	m     sync.Mutex
+	nodes map[string]*nodeNotification
+}
+
+type nodeNotification struct {
+	version uint64
+	waiters int
+	ch      chan struct{}
+}
+
+// NewNodeNotifier creates a new node notifier
+func NewNodeNotifier() *NodeNotifier {
+	return &NodeNotifier{
+		nodes: make(map[string]*nodeNotification),
+	}
+}
+
+// get must be called with the lock held
+func (n *NodeNotifier) get(nodeID string) *nodeNotification {
+	node, ok := n.nodes[nodeID]
+	if !ok {
+		node = &nodeNotification{ch: make(chan struct{})}
+		n.nodes[nodeID] = node
+	}
+
+	return node
+}
+
+// Version returns the current notification version of the node
+func (n *NodeNotifier) Version(nodeID string) uint64 {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return n.version(nodeID)
+}
+
+// version must be called with the lock held
+func (n *NodeNotifier) version(nodeID string) uint64 {
+	if node, ok := n.nodes[nodeID]; ok {
+		return node.version
+	}
+
+	return 0
+}
+
+// Notify wakes up all the waiters of the given nodes
+func (n *NodeNotifier) Notify(nodeIDs ...string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	for _, nodeID := range nodeIDs {
+		if nodeID == "" {
+			continue
+		}
+
+		node := n.get(nodeID)
+		node.version++
+		close(node.ch)
+		node.ch = make(chan struct{})
+	}
+}
+
+// Wait blocks until the node is notified after the given version, or the
+// timeout expires. It returns true if the node was notified.
+func (n *NodeNotifier) Wait(ctx context.Context, nodeID string, version uint64, timeout time.Duration) bool {
+	n.m.Lock()
+	if n.version(nodeID) != version {
+		n.m.Unlock()
+		return true
+	}
+	node := n.get(nodeID)
+	node.waiters++
+	ch := node.ch
+	n.m.Unlock()
+
+	defer func() {
+		n.m.Lock()
+		defer n.m.Unlock()
+
+		node.waiters--
+		if node.waiters == 0 && node.version == 0 {
+			delete(n.nodes, nodeID)
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeNotifier(t *testing.T) {
+	n := NewNodeNotifier()
+	ctx := context.Background()
+
+	version := n.Version("node")
+	assert.False(t, n.Wait(ctx, "node", version, 10*time.Millisecond))
+
+	// a notification which happened before waiting is not missed
+	n.Notify("node")
+	assert.True(t, n.Wait(ctx, "node", version, time.Second))
+
+	version = n.Version("node")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		n.Notify("other", "node")
+	}()
+	assert.True(t, n.Wait(ctx, "node", version, time.Second))
+
+	// other nodes are not notified
+	version = n.Version("node")
+	n.Notify("other")
+	assert.False(t, n.Wait(ctx, "node", version, 10*time.Millisecond))
+}
+
+func TestNodeNotifierUnknownNodes(t *testing.T) {
+	n := NewNodeNotifier()
+	ctx := context.Background()
+
+	// polling a node which was never notified doesn't add it to the index
+	version := n.Version("node")
+	assert.False(t, n.Wait(ctx, "node", version, 10*time.Millisecond))
+	assert.Len(t, n.nodes, 0)
+
+	// a notification which happened before waiting is not missed
+	n.Notify("node")
+	assert.True(t, n.Wait(ctx, "node", version, time.Second))
+	assert.Len(t, n.nodes, 1)
+}
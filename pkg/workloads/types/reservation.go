@@ -42,6 +42,8 @@ const (
 	Invalid = generated.NextActionInvalid
 	// Deleted action
 	Deleted = generated.NextActionDeleted
+	// Approve action
+	Approve = generated.NextActionApprove
 )
 
 // ApplyQueryFilter parese the query string
@@ -652,6 +654,7 @@ func WorkloadPush(ctx context.Context, db *mongo.Database, w ...WorkloaderType)
 		if err != nil {
 			return errors.Wrap(err, "could not upsert workload")
 		}
+		NodeWork.Notify(wl.GetNodeID())
 	}
 
 	return nil
@@ -0,0 +1,166 @@
+package types
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// WorkloadRevisionCollection db collection name
+	WorkloadRevisionCollection = "workload_revision"
+)
+
+// ErrRevisionExists is returned when a revision is stored twice, which happens
+// when the same workload is updated concurrently
+var ErrRevisionExists = errors.New("workload revision already exists")
+
+// WorkloadRevision is a previous version of a workload which has been
+// replaced by an update
+type WorkloadRevision struct {
+	ID         schema.ID      `bson:"_id" json:"id"`
+	WorkloadID schema.ID      `bson:"workload_id" json:"workload_id"`
+	Revision   int64          `bson:"revision" json:"revision"`
+	Workload   WorkloaderType `bson:"workload" json:"workload"`
+	Epoch      schema.Date    `bson:"epoch" json:"epoch"`
+}
+
+// WorkloadRevisionFilter type
+type WorkloadRevisionFilter bson.D
+
+// WithWorkloadID filter revisions of a workload
+func (f WorkloadRevisionFilter) WithWorkloadID(id schema.ID) WorkloadRevisionFilter {
+	return append(f, bson.E{Key: "workload_id", Value: id})
+}
+
+// WithRevision filter revisions on revision number
+func (f WorkloadRevisionFilter) WithRevision(revision int64) WorkloadRevisionFilter {
+	return append(f, bson.E{Key: "revision", Value: revision})
+}
+
+// Get gets single revision that matches the filter
+func (f WorkloadRevisionFilter) Get(ctx context.Context, db *mongo.Database) (WorkloadRevision, error) {
+	if f == nil {
+		f = WorkloadRevisionFilter{}
+	}
+	var revision WorkloadRevision
+
+	result := db.Collection(WorkloadRevisionCollection).FindOne(ctx, f)
+	if err := result.Err(); err != nil {
+		return revision, err
+	}
+
+	if err := result.Decode(&revision); err != nil {
+		return revision, errors.Wrap(err, "could not decode workload revision")
+	}
+
+	return revision, nil
+}
+
+// Find all revisions that match the filter, ordered by revision number
+func (f WorkloadRevisionFilter) Find(ctx context.Context, db *mongo.Database, opts ...*options.FindOptions) ([]WorkloadRevision, error) {
+	if f == nil {
+		f = WorkloadRevisionFilter{}
+	}
+
+	opts = append([]*options.FindOptions{options.Find().SetSort(bson.M{"revision": 1})}, opts...)
+	cursor, err := db.Collection(WorkloadRevisionCollection).Find(ctx, f, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get workload revision cursor")
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []WorkloadRevision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, errors.Wrap(err, "could not decode workload revisions")
+	}
+
+	return revisions, nil
+}
+
+// Count number of revisions matching
+func (f WorkloadRevisionFilter) Count(ctx context.Context, db *mongo.Database) (int64, error) {
+	if f == nil {
+		f = WorkloadRevisionFilter{}
+	}
+
+	return db.Collection(WorkloadRevisionCollection).CountDocuments(ctx, f)
+}
+
+// WorkloadRevisionCreate stores the current version of a workload as the given
+// revision. Revision numbers are unique per workload, so a concurrent update
+// of the same workload fails here.
+func WorkloadRevisionCreate(ctx context.Context, db *mongo.Database, w WorkloaderType, revision int64) error {
+	id, err := models.NextID(ctx, db, WorkloadRevisionCollection)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate workload revision id")
+	}
+
+	r := WorkloadRevision{
+		ID:         id,
+		WorkloadID: w.GetID(),
+		Revision:   revision,
+		Workload:   w,
+		Epoch:      w.GetEpoch(),
+	}
+
+	if _, err := db.Collection(WorkloadRevisionCollection).InsertOne(ctx, r); err != nil {
+		if merr, ok := err.(mongo.WriteException); ok {
+			errCode := merr.WriteErrors[0].Code
+			if errCode == 11000 {
+				return ErrRevisionExists
+			}
+		}
+		return errors.Wrap(err, "failed to save workload revision")
+	}
+
+	return nil
+}
+
+// WorkloadReplace replaces the stored workload with the same ID with w.
+// NOTE: no validation is done here, this is just a CRUD operation
+func WorkloadReplace(ctx context.Context, db *mongo.Database, w WorkloaderType) error {
+	var filter WorkloadFilter
+	filter = filter.WithID(w.GetID())
+	initSigners(w)
+
+	result, err := db.Collection(WorkloadCollection).ReplaceOne(ctx, filter, w)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// WorkloadUpdatePush pushes an updated workload to the queue of its node. The
+// queue entry is marked as an update, so the node knows it has to replace the
+// workload it already runs.
+func WorkloadUpdatePush(ctx context.Context, db *mongo.Database, w WorkloaderType) error {
+	buf, err := bson.Marshal(w)
+	if err != nil {
+		return errors.Wrap(err, "could not encode workload")
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(buf, &doc); err != nil {
+		return errors.Wrap(err, "could not encode workload")
+	}
+	doc["update"] = true
+
+	col := db.Collection(queueCollection)
+	if _, err := col.UpdateOne(ctx, bson.M{"_id": w.GetID()}, bson.M{"$set": doc}, options.Update().SetUpsert(true)); err != nil {
+		return errors.Wrap(err, "could not upsert workload")
+	}
+
+	NodeWork.Notify(w.GetNodeID())
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Setup sets up indexes for types, must be called at least
@@ -73,6 +74,89 @@ func Setup(ctx context.Context, db *mongo.Database) error {
 		{
 			Keys: bson.M{"public_ip": 1},
 		},
+		{
+			Keys: bson.M{"reference": 1},
+		},
+		{
+			Keys: bson.M{"result.state": 1},
+		},
+		{
+			Keys: bson.M{"epoch.time": 1},
+		},
+		{
+			Keys: bson.M{"expires_at.time": 1},
+		},
+		{
+			Keys: bson.M{"deleted_at.time": 1},
+		},
+		{
+			// label keys are user defined, a wildcard index covers all of them
+			Keys: bson.M{"labels.$**": 1},
+		},
+	}
+
+	if _, err := col.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	col = db.Collection(DeploymentGroupCollection)
+	indexes = []mongo.IndexModel{
+		{
+			Keys: bson.M{"customer_tid": 1},
+		},
+		{
+			Keys: bson.M{"workload_ids": 1},
+		},
+	}
+
+	if _, err := col.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	col = db.Collection(WorkloadEventCollection)
+	indexes = []mongo.IndexModel{
+		{
+			Keys: bson.M{"workload_id": 1},
+		},
+		{
+			Keys: bson.M{"customer_tid": 1},
+		},
+		{
+			Keys: bson.M{"pool_id": 1},
+		},
+	}
+
+	if _, err := col.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	col = db.Collection(IPLeaseCollection)
+	indexes = []mongo.IndexModel{
+		{
+			Keys:    bson.M{"address": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.M{"workload_id": 1},
+		},
+		{
+			Keys: bson.M{"customer_tid": 1},
+		},
+		{
+			Keys: bson.M{"state": 1},
+		},
+	}
+
+	if _, err := col.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	col = db.Collection(WorkloadRevisionCollection)
+	indexes = []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workload_id", Value: 1}, {Key: "revision", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
 	}
 
 	if _, err := col.Indexes().CreateMany(ctx, indexes); err != nil {
@@ -0,0 +1,289 @@
+package types
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FarmSLA is the availability of the nodes of a farm over a period
+type FarmSLA struct {
+	FarmID schema.ID   `json:"farm_id"`
+	From   schema.Date `json:"from"`
+	To     schema.Date `json:"to"`
+	// Availability is the percentage of time the tracked nodes of the farm
+	// were up during the period
+	Availability float64 `json:"availability"`
+	// Downtime is the total downtime of the nodes in seconds
+	Downtime int64 `json:"downtime"`
+	// Workloads and Pools affected by the downtime of any node
+	Workloads []schema.ID `json:"workloads"`
+	Pools     []int64     `json:"pools"`
+	Nodes     []NodeSLA   `json:"nodes"`
+}
+
+// NodeSLA is the availability of a node over a period
+type NodeSLA struct {
+	NodeID string `json:"node_id"`
+	// Tracked is the number of seconds of the period the node was known to
+	// the explorer, the availability of a node which was not tracked is 0
+	Tracked      int64            `json:"tracked"`
+	Availability float64          `json:"availability"`
+	Uptime       int64            `json:"uptime"`
+	Downtime     int64            `json:"downtime"`
+	Reboots      int              `json:"reboots"`
+	Windows      []DowntimeWindow `json:"downtime_windows"`
+}
+
+// DowntimeWindow is a period a node was down and the workloads deployed on
+// the node during that period
+type DowntimeWindow struct {
+	Start     schema.Date `json:"start"`
+	End       schema.Date `json:"end"`
+	Duration  int64       `json:"duration"`
+	Workloads []schema.ID `json:"workloads"`
+	Pools     []int64     `json:"pools"`
+}
+
+// WorkloadSpan is the period a workload was deployed on a node
+type WorkloadSpan struct {
+	ID     schema.ID
+	NodeID string
+	PoolID int64
+	Epoch  time.Time
+	// Deleted is the time the workload was deleted, zero if it's still
+	// deployed
+	Deleted time.Time
+}
+
+// Overlaps checks if the workload was deployed during the window
+func (w *WorkloadSpan) Overlaps(window directory.TimeWindow) bool {
+	if !w.Epoch.Before(window.End) {
+		return false
+	}
+
+	return w.Deleted.IsZero() || w.Deleted.After(window.Start)
+}
+
+// WithActiveDuring filter workloads which were deployed at some point
+// between from and to. Workloads which never reached deploy, or were never
+// reported by their node, were never deployed.
+func (f WorkloadFilter) WithActiveDuring(from, to time.Time) WorkloadFilter {
+	return append(f,
+		bson.E{Key: "epoch.time", Value: bson.M{"$lt": to}},
+		bson.E{Key: "next_action", Value: bson.M{"$in": bson.A{Deploy, Delete, Deleted}}},
+		bson.E{Key: "result.workload_id", Value: bson.M{"$nin": bson.A{"", nil}}},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.M{"next_action": bson.M{"$ne": Deleted}},
+			bson.M{"deleted_at.time": bson.M{"$gt": from}},
+			bson.M{"deleted_at": bson.M{"$exists": false}, "result.epoch.time": bson.M{"$gt": from}},
+		}},
+	)
+}
+
+// WorkloadSpans loads the workloads deployed on the nodes between from and to
+func WorkloadSpans(ctx context.Context, db *mongo.Database, nodeIDs []string, from, to time.Time) ([]WorkloadSpan, error) {
+	projection := bson.M{"_id": 1, "node_id": 1, "pool_id": 1, "epoch": 1, "next_action": 1, "deleted_at": 1, "result.epoch": 1}
+	filter := WorkloadFilter{}.WithNodeIDs(nodeIDs).WithActiveDuring(from, to)
+	cur, err := filter.FindCursor(ctx, db, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the workloads of the nodes")
+	}
+	defer cur.Close(ctx)
+
+	spans := []WorkloadSpan{}
+	for cur.Next(ctx) {
+		var workload struct {
+			ID         schema.ID                `bson:"_id"`
+			NodeID     string                   `bson:"node_id"`
+			PoolID     int64                    `bson:"pool_id"`
+			Epoch      schema.Date              `bson:"epoch"`
+			NextAction generated.NextActionEnum `bson:"next_action"`
+			DeletedAt  schema.Date              `bson:"deleted_at"`
+			Result     struct {
+				Epoch schema.Date `bson:"epoch"`
+			} `bson:"result"`
+		}
+		if err := cur.Decode(&workload); err != nil {
+			return nil, errors.Wrap(err, "failed to load workload")
+		}
+
+		span := WorkloadSpan{
+			ID:     workload.ID,
+			NodeID: workload.NodeID,
+			PoolID: workload.PoolID,
+			Epoch:  workload.Epoch.Time,
+		}
+		if workload.NextAction == Deleted {
+			// workloads deleted before the deletion time was recorded use
+			// the time of their last result instead
+			span.Deleted = workload.DeletedAt.Time
+			if span.Deleted.IsZero() {
+				span.Deleted = workload.Result.Epoch.Time
+			}
+		}
+		spans = append(spans, span)
+	}
+
+	return spans, cur.Err()
+}
+
+// NewNodeSLA builds the sla of a node from its availability and the
+// workloads deployed on it
+func NewNodeSLA(nodeID string, availability directory.Availability, workloads []WorkloadSpan) NodeSLA {
+	sla := NodeSLA{
+		NodeID:       nodeID,
+		Tracked:      int64(availability.Tracked.Seconds()),
+		Availability: availability.Percentage(),
+		Uptime:       int64(availability.Up.Seconds()),
+		Reboots:      availability.Reboots,
+		Windows:      []DowntimeWindow{},
+	}
+
+	for _, window := range availability.Downtime {
+		down := DowntimeWindow{
+			Start:     schema.Date{Time: window.Start},
+			End:       schema.Date{Time: window.End},
+			Duration:  int64(window.Duration().Seconds()),
+			Workloads: []schema.ID{},
+			Pools:     []int64{},
+		}
+
+		pools := make(map[int64]struct{})
+		for i := range workloads {
+			workload := &workloads[i]
+			if workload.NodeID != nodeID || !workload.Overlaps(window) {
+				continue
+			}
+			down.Workloads = append(down.Workloads, workload.ID)
+			pools[workload.PoolID] = struct{}{}
+		}
+		down.Pools = sortedPools(pools)
+
+		sla.Downtime += down.Duration
+		sla.Windows = append(sla.Windows, down)
+	}
+
+	return sla
+}
+
+// NewFarmSLA sums up the sla of the nodes of a farm
+func NewFarmSLA(farmID schema.ID, from, to time.Time, nodes []NodeSLA) FarmSLA {
+	sla := FarmSLA{
+		FarmID:    farmID,
+		From:      schema.Date{Time: from},
+		To:        schema.Date{Time: to},
+		Workloads: []schema.ID{},
+		Nodes:     nodes,
+	}
+
+	var tracked, up int64
+	workloads := make(map[schema.ID]struct{})
+	pools := make(map[int64]struct{})
+	for _, node := range nodes {
+		tracked += node.Tracked
+		up += node.Uptime
+		sla.Downtime += node.Downtime
+
+		for _, window := range node.Windows {
+			for _, id := range window.Workloads {
+				if _, ok := workloads[id]; !ok {
+					workloads[id] = struct{}{}
+					sla.Workloads = append(sla.Workloads, id)
+				}
+			}
+			for _, id := range window.Pools {
+				pools[id] = struct{}{}
+			}
+		}
+	}
+
+	if tracked > 0 {
+		sla.Availability = float64(up) / float64(tracked) * 100
+	}
+	sort.Slice(sla.Workloads, func(i, j int) bool {
+		return sla.Workloads[i] < sla.Workloads[j]
+	})
+	sla.Pools = sortedPools(pools)
+
+	return sla
+}
+
+// WriteCSV writes the sla as csv, one line per downtime window of a node or
+// one line for a node without downtime
+func (s *FarmSLA) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{
+		"farm_id", "node_id", "tracked", "availability", "uptime", "downtime", "reboots",
+		"window_start", "window_end", "window_duration", "workloads", "pools",
+	}); err != nil {
+		return err
+	}
+
+	for _, node := range s.Nodes {
+		line := []string{
+			fmt.Sprint(s.FarmID),
+			node.NodeID,
+			fmt.Sprint(node.Tracked),
+			fmt.Sprintf("%.2f", node.Availability),
+			fmt.Sprint(node.Uptime),
+			fmt.Sprint(node.Downtime),
+			fmt.Sprint(node.Reboots),
+		}
+
+		if len(node.Windows) == 0 {
+			if err := writer.Write(append(line, "", "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, window := range node.Windows {
+			workloads := make([]string, len(window.Workloads))
+			for i, id := range window.Workloads {
+				workloads[i] = fmt.Sprint(id)
+			}
+			pools := make([]string, len(window.Pools))
+			for i, id := range window.Pools {
+				pools[i] = fmt.Sprint(id)
+			}
+
+			if err := writer.Write(append(line[:7:7],
+				window.Start.UTC().Format(time.RFC3339),
+				window.End.UTC().Format(time.RFC3339),
+				fmt.Sprint(window.Duration),
+				strings.Join(workloads, " "),
+				strings.Join(pools, " "),
+			)); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func sortedPools(pools map[int64]struct{}) []int64 {
+	ids := make([]int64, 0, len(pools))
+	for id := range pools {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	directory "github.com/threefoldtech/tfexplorer/pkg/directory/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFarmSLA(t *testing.T) {
+	from := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(10 * time.Hour)
+
+	workloads := []WorkloadSpan{
+		// deployed during the whole period
+		{ID: 1, NodeID: "node1", PoolID: 10, Epoch: from.Add(-time.Hour)},
+		// deleted before the downtime
+		{ID: 2, NodeID: "node1", PoolID: 11, Epoch: from, Deleted: from.Add(time.Hour)},
+		// deployed after the downtime
+		{ID: 3, NodeID: "node1", PoolID: 12, Epoch: from.Add(5 * time.Hour)},
+		// on another node
+		{ID: 4, NodeID: "node2", PoolID: 13, Epoch: from},
+	}
+
+	node1 := NewNodeSLA("node1", directory.Availability{
+		Tracked: 10 * time.Hour,
+		Up:      8 * time.Hour,
+		Reboots: 1,
+		Downtime: []directory.TimeWindow{
+			{Start: from.Add(2 * time.Hour), End: from.Add(4 * time.Hour)},
+		},
+	}, workloads)
+
+	assert.Equal(t, 80.0, node1.Availability)
+	assert.Equal(t, int64(7200), node1.Downtime)
+	require.Len(t, node1.Windows, 1)
+	assert.Equal(t, []schema.ID{1}, node1.Windows[0].Workloads)
+	assert.Equal(t, []int64{10}, node1.Windows[0].Pools)
+
+	node2 := NewNodeSLA("node2", directory.Availability{Tracked: 10 * time.Hour, Up: 10 * time.Hour}, workloads)
+	assert.Equal(t, 100.0, node2.Availability)
+	assert.Empty(t, node2.Windows)
+
+	sla := NewFarmSLA(1, from, to, []NodeSLA{node1, node2})
+	assert.Equal(t, 90.0, sla.Availability)
+	assert.Equal(t, int64(7200), sla.Downtime)
+	assert.Equal(t, []schema.ID{1}, sla.Workloads)
+	assert.Equal(t, []int64{10}, sla.Pools)
+
+	var buf bytes.Buffer
+	require.NoError(t, sla.WriteCSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		"farm_id,node_id,tracked,availability,uptime,downtime,reboots,window_start,window_end,window_duration,workloads,pools",
+		"1,node1,36000,80.00,28800,7200,1,2021-03-01T02:00:00Z,2021-03-01T04:00:00Z,7200,1,10",
+		"1,node2,36000,100.00,36000,0,0,,,,,",
+	}, lines)
+}
+
+func TestWithActiveDuring(t *testing.T) {
+	from := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	filter := WorkloadFilter{}.WithActiveDuring(from, to)
+	require.Len(t, filter, 4)
+	// workloads which never reached deploy were never on the node
+	assert.Equal(t, bson.E{Key: "next_action", Value: bson.M{"$in": bson.A{Deploy, Delete, Deleted}}}, filter[1])
+	assert.Equal(t, bson.E{Key: "result.workload_id", Value: bson.M{"$nin": bson.A{"", nil}}}, filter[2])
+}
@@ -10,8 +10,11 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/threefoldtech/tfexplorer/models"
 	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
 	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
@@ -28,6 +31,12 @@ const (
 )
 
 // ApplyQueryFilterWorkload parses the query string
+//
+// next_action, workload_type and result_state accept the enum values either
+// as integers or by name, and can be given as a comma separated list. Labels
+// are filtered with label=key=value or label=key for workloads which have the
+// label set, the label parameter can be repeated. The epoch range is given as
+// unix timestamps in from_epoch and to_epoch.
 func ApplyQueryFilterWorkload(r *http.Request, filter WorkloadFilter) (WorkloadFilter, error) {
 	var err error
 	customerid, err := models.QueryInt(r, "customer_tid")
@@ -37,25 +46,160 @@ func ApplyQueryFilterWorkload(r *http.Request, filter WorkloadFilter) (WorkloadF
 	if customerid != 0 {
 		filter = filter.WithCustomerID(customerid)
 	}
-	sNextAction := r.FormValue("next_action")
-	if len(sNextAction) != 0 {
-		nextAction, err := strconv.ParseInt(sNextAction, 10, 0)
-		if err != nil {
-			return nil, errors.Wrap(err, "next_action should be an integer")
+	poolID, err := models.QueryInt(r, "pool_id")
+	if err != nil {
+		return nil, errors.Wrap(err, "pool_id should be an integer")
+	}
+	if poolID != 0 {
+		filter = filter.WithPoolID(poolID)
+	}
+	if nodeIDs := queryList(r, "node_id"); len(nodeIDs) != 0 {
+		filter = filter.WithNodeIDs(nodeIDs)
+	}
+	if reference := r.FormValue("reference"); len(reference) != 0 {
+		filter = filter.WithReference(reference)
+	}
+
+	if values := queryList(r, "next_action"); len(values) != 0 {
+		actions := make([]generated.NextActionEnum, 0, len(values))
+		for _, value := range values {
+			action, err := parseEnum(value, func(e uint8) string { return generated.NextActionEnum(e).String() })
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid next_action")
+			}
+			actions = append(actions, generated.NextActionEnum(action))
 		}
-		filter = filter.WithNextAction(workloads.NextActionEnum(nextAction))
+		filter = filter.WithNextActions(actions...)
+	}
+	if values := queryList(r, "workload_type"); len(values) != 0 {
+		workloadTypes := make([]generated.WorkloadTypeEnum, 0, len(values))
+		for _, value := range values {
+			workloadType, err := parseEnum(value, func(e uint8) string { return generated.WorkloadTypeEnum(e).String() })
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid workload_type")
+			}
+			workloadTypes = append(workloadTypes, generated.WorkloadTypeEnum(workloadType))
+		}
+		filter = filter.WithWorkloadTypes(workloadTypes...)
+	}
+	if values := queryList(r, "result_state"); len(values) != 0 {
+		states := make([]generated.ResultStateEnum, 0, len(values))
+		for _, value := range values {
+			state, err := parseEnum(value, func(e uint8) string { return generated.ResultStateEnum(e).String() })
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid result_state")
+			}
+			states = append(states, generated.ResultStateEnum(state))
+		}
+		filter = filter.WithResultStates(states...)
+	}
+
+	fromEpoch, err := models.QueryInt(r, "from_epoch")
+	if err != nil {
+		return nil, errors.Wrap(err, "from_epoch should be a unix timestamp")
 	}
-	sWorkloadType := r.FormValue("workload_type")
-	if len(sWorkloadType) != 0 {
-		workloadType, err := strconv.ParseUint(sWorkloadType, 10, 8)
-		if err != nil {
-			return nil, errors.Wrap(err, "workload_type should be an integer")
+	toEpoch, err := models.QueryInt(r, "to_epoch")
+	if err != nil {
+		return nil, errors.Wrap(err, "to_epoch should be a unix timestamp")
+	}
+	if fromEpoch != 0 || toEpoch != 0 {
+		var from, to time.Time
+		if fromEpoch != 0 {
+			from = time.Unix(fromEpoch, 0)
+		}
+		if toEpoch != 0 {
+			to = time.Unix(toEpoch, 0)
+		}
+		filter = filter.WithEpochRange(from, to)
+	}
+
+	for _, label := range r.URL.Query()["label"] {
+		parts := strings.SplitN(label, "=", 2)
+		if err := validateLabelKey(parts[0]); err != nil {
+			return nil, err
+		}
+		if len(parts) == 1 {
+			filter = filter.WithLabelSet(parts[0])
+		} else {
+			filter = filter.WithLabel(parts[0], parts[1])
 		}
-		filter = filter.WithWorkloadType(workloads.WorkloadTypeEnum(workloadType))
 	}
+
 	return filter, nil
 }
 
+// workloadSortFields are the fields the workloads can be sorted on
+var workloadSortFields = map[string]string{
+	"id":            "_id",
+	"epoch":         "epoch.time",
+	"pool_id":       "pool_id",
+	"node_id":       "node_id",
+	"customer_tid":  "customer_tid",
+	"next_action":   "next_action",
+	"workload_type": "workload_type",
+}
+
+// WorkloadSortFromRequest parses the sort order of the workloads from the
+// query string. The sort parameter is a comma separated list of fields, a
+// field prefixed with - is sorted in descending order. The workloads are
+// always sorted by id last, so the pages are stable.
+func WorkloadSortFromRequest(r *http.Request) (bson.D, error) {
+	sort := bson.D{}
+	for _, field := range queryList(r, "sort") {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+			field = field[1:]
+		}
+
+		key, ok := workloadSortFields[field]
+		if !ok {
+			return nil, fmt.Errorf("can not sort workloads on '%s'", field)
+		}
+
+		sort = append(sort, bson.E{Key: key, Value: order})
+		if key == "_id" {
+			return sort, nil
+		}
+	}
+
+	return append(sort, bson.E{Key: "_id", Value: 1}), nil
+}
+
+// queryList gets the values of a query parameter which can be repeated, or
+// given as a comma separated list
+func queryList(r *http.Request, q string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[q] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); len(v) != 0 {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values
+}
+
+// parseEnum parses an enum value given either as an integer or by its name
+func parseEnum(value string, name func(uint8) string) (uint8, error) {
+	if e, err := strconv.ParseUint(value, 10, 8); err == nil {
+		return uint8(e), nil
+	}
+
+	// enums without a name are reported as unknown, they can only be
+	// given as integers
+	if !strings.EqualFold(value, "unknown") {
+		for e := 0; e <= math.MaxUint8; e++ {
+			if strings.EqualFold(name(uint8(e)), value) {
+				return uint8(e), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unknown value '%s'", value)
+}
+
 // WorkloadFilter type
 type WorkloadFilter bson.D
 
@@ -64,6 +208,11 @@ func (f WorkloadFilter) WithID(id schema.ID) WorkloadFilter {
 	return append(f, bson.E{Key: "_id", Value: id})
 }
 
+// WithIDs filter workloads with any of the given IDs
+func (f WorkloadFilter) WithIDs(ids []schema.ID) WorkloadFilter {
+	return append(f, bson.E{Key: "_id", Value: bson.M{"$in": ids}})
+}
+
 // WithIDGE return find workloads with
 func (f WorkloadFilter) WithIDGE(id schema.ID) WorkloadFilter {
 	return append(f, bson.E{
@@ -78,6 +227,13 @@ func (f WorkloadFilter) WithNextAction(action generated.NextActionEnum) Workload
 	})
 }
 
+// WithNextActions filter workloads with any of the given next actions
+func (f WorkloadFilter) WithNextActions(actions ...generated.NextActionEnum) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "next_action", Value: bson.M{"$in": actions},
+	})
+}
+
 // WithCustomerID filter workload on customer
 func (f WorkloadFilter) WithCustomerID(customerID int64) WorkloadFilter {
 	return append(f, bson.E{
@@ -92,6 +248,13 @@ func (f WorkloadFilter) WithNodeID(id string) WorkloadFilter {
 	})
 }
 
+// WithNodeIDs search workloads deployed on any of the given nodes
+func (f WorkloadFilter) WithNodeIDs(ids []string) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "node_id", Value: bson.M{"$in": ids},
+	})
+}
+
 // WithReference searches workloads with reference
 func (f WorkloadFilter) WithReference(ref string) WorkloadFilter {
 	return append(f, bson.E{
@@ -106,6 +269,80 @@ func (f WorkloadFilter) WithWorkloadType(workloadType generated.WorkloadTypeEnum
 	})
 }
 
+// WithWorkloadTypes filter workloads with any of the given workload types
+func (f WorkloadFilter) WithWorkloadTypes(workloadTypes ...generated.WorkloadTypeEnum) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "workload_type", Value: bson.M{"$in": workloadTypes},
+	})
+}
+
+// WithResultStates filter workloads which have a result in any of the given
+// states
+func (f WorkloadFilter) WithResultStates(states ...generated.ResultStateEnum) WorkloadFilter {
+	// a workload without result has an empty result with the zero state, so
+	// only results sent by a node are matched
+	return append(f,
+		bson.E{Key: "result.state", Value: bson.M{"$in": states}},
+		bson.E{Key: "result.workload_id", Value: bson.M{"$nin": bson.A{"", nil}}},
+	)
+}
+
+// WithEpochRange filter workloads created in the given time range, a zero
+// time leaves that side of the range open
+func (f WorkloadFilter) WithEpochRange(from, to time.Time) WorkloadFilter {
+	epoch := bson.M{}
+	if !from.IsZero() {
+		epoch["$gte"] = from
+	}
+	if !to.IsZero() {
+		epoch["$lte"] = to
+	}
+
+	return append(f, bson.E{Key: "epoch.time", Value: epoch})
+}
+
+// WithExpiredBefore filter workloads which have an expiration time at or
+// before t
+func (f WorkloadFilter) WithExpiredBefore(t time.Time) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "expires_at.time", Value: bson.M{"$gt": time.Unix(0, 0), "$lte": t},
+	})
+}
+
+// WithExpiration filter workloads which have an expiration time
+func (f WorkloadFilter) WithExpiration() WorkloadFilter {
+	return append(f, bson.E{
+		Key: "expires_at.time", Value: bson.M{"$gt": time.Unix(0, 0)},
+	})
+}
+
+// WithDeletedBefore filter deleted workloads which were deleted before t.
+// Workloads deleted before the deletion time was recorded use the time of
+// their last result instead.
+func (f WorkloadFilter) WithDeletedBefore(t time.Time) WorkloadFilter {
+	return append(f,
+		bson.E{Key: "next_action", Value: Deleted},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.M{"deleted_at.time": bson.M{"$lte": t}},
+			bson.M{"deleted_at": bson.M{"$exists": false}, "result.epoch.time": bson.M{"$lte": t}},
+		}},
+	)
+}
+
+// WithLabel filter workloads with the label key set to value
+func (f WorkloadFilter) WithLabel(key, value string) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "labels." + key, Value: value,
+	})
+}
+
+// WithLabelSet filter workloads which have the label key, whatever its value
+func (f WorkloadFilter) WithLabelSet(key string) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "labels." + key, Value: bson.M{"$exists": true},
+	})
+}
+
 // WithPublicIP filter workloads with a certain public ip
 func (f WorkloadFilter) WithPublicIP(publicIP schema.ID) WorkloadFilter {
 	return append(f, bson.E{
@@ -113,6 +350,20 @@ func (f WorkloadFilter) WithPublicIP(publicIP schema.ID) WorkloadFilter {
 	})
 }
 
+// WithName filter workloads with a certain name, like network resources
+func (f WorkloadFilter) WithName(name string) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "name", Value: name,
+	})
+}
+
+// WithNetworkID filter workloads connected to a certain network
+func (f WorkloadFilter) WithNetworkID(networkID string) WorkloadFilter {
+	return append(f, bson.E{
+		Key: "network_id", Value: networkID,
+	})
+}
+
 // Or returns filter that reads as (f or o)
 func (f WorkloadFilter) Or(o WorkloadFilter) WorkloadFilter {
 	return WorkloadFilter{
@@ -241,6 +492,25 @@ func (w *WorkloaderType) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+// OneOf implements openapi.OneOf, a workload is encoded as the workload of
+// its type
+func (w WorkloaderType) OneOf() []interface{} {
+	return []interface{}{
+		generated.Container{},
+		generated.GatewayDelegate{},
+		generated.Gateway4To6{},
+		generated.K8S{},
+		generated.NetworkResource{},
+		generated.GatewayProxy{},
+		generated.GatewayReverseProxy{},
+		generated.GatewaySubdomain{},
+		generated.Volume{},
+		generated.ZDB{},
+		generated.PublicIP{},
+		generated.VirtualMachine{},
+	}
+}
+
 // Verify signature against Workload.JSON
 // pk is the public key used as verification key in hex encoded format
 // the signature is the signature to verify (in raw binary format)
@@ -342,6 +612,37 @@ func (w *WorkloaderType) SignatureProvisionRequestVerify(pk string, sig generate
 	return crypto.Verify(key, msg[:], signature)
 }
 
+// SignatureApprovalRequestVerify verify the farmer signature of a workload
+// approval. The signature is created from the workload signing challenge +
+// "approve" + farmer tid
+func (w *WorkloaderType) SignatureApprovalRequestVerify(pk string, sig generated.SigningSignature) error {
+	key, err := crypto.KeyFromHex(pk)
+	if err != nil {
+		return errors.Wrap(err, "invalid verification key")
+	}
+
+	b, err := w.SignatureChallenge()
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(b)
+	if _, err := buf.WriteString("approve"); err != nil {
+		return err
+	}
+	if _, err := buf.WriteString(fmt.Sprintf("%d", sig.Tid)); err != nil {
+		return err
+	}
+
+	msg := sha256.Sum256(buf.Bytes())
+	signature, err := hex.DecodeString(sig.Signature)
+	if err != nil {
+		return err
+	}
+
+	return crypto.Verify(key, msg[:], signature)
+}
+
 // IsAny checks if the workload status is any of the given status
 func (w *WorkloaderType) IsAny(status ...generated.NextActionEnum) bool {
 	for _, s := range status {
@@ -384,9 +685,19 @@ func (w *WorkloaderType) IsSuccessfullyDeployed() bool {
 func WorkloadCreate(ctx context.Context, db *mongo.Database, w WorkloaderType) (schema.ID, error) {
 	id := models.MustID(ctx, db, ReservationCollection)
 	w.SetID(id)
+	initSigners(w)
+
+	_, err := db.Collection(WorkloadCollection).InsertOne(ctx, w)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
 
-	// ensure the signers array are never nill cause it would cause issue
-	// in mongo when trying to push signature later on
+// initSigners ensure the signers array are never nill cause it would cause issue
+// in mongo when trying to push signature later on
+func initSigners(w WorkloaderType) {
 	reqDel := w.GetSigningRequestDelete()
 	if reqDel.Signers == nil {
 		reqDel.Signers = make([]int64, 0)
@@ -395,16 +706,20 @@ func WorkloadCreate(ctx context.Context, db *mongo.Database, w WorkloaderType) (
 
 	reqPro := w.GetSigningRequestProvision()
 	if reqPro.Signers == nil {
-		reqDel.Signers = make([]int64, 0)
+		reqPro.Signers = make([]int64, 0)
 		w.SetSigningRequestProvision(reqPro)
 	}
+}
 
-	_, err := db.Collection(WorkloadCollection).InsertOne(ctx, w)
-	if err != nil {
-		return 0, err
-	}
+// WorkloadsRemove removes workloads from the database. This must only be used
+// for workloads which are never scheduled to a node, like when creating a
+// deployment group fails halfway.
+func WorkloadsRemove(ctx context.Context, db *mongo.Database, ids []schema.ID) error {
+	var filter WorkloadFilter
+	filter = filter.WithIDs(ids)
 
-	return id, nil
+	_, err := db.Collection(WorkloadCollection).DeleteMany(ctx, filter)
+	return err
 }
 
 // WorkloadsLastID get the current last ID number in the workloads collection
@@ -412,30 +727,55 @@ func WorkloadsLastID(ctx context.Context, db *mongo.Database) (schema.ID, error)
 	return models.LastID(ctx, db, ReservationCollection)
 }
 
-// WorkloadSetNextAction update the workload next action in db
-func WorkloadSetNextAction(ctx context.Context, db *mongo.Database, id schema.ID, action generated.NextActionEnum) error {
+// WorkloadSetNextAction update the workload next action in db, a workload
+// event is recorded with the reason of the change if the next action changed.
+// The time a workload is deleted at is kept so it can be archived later.
+func WorkloadSetNextAction(ctx context.Context, db *mongo.Database, id schema.ID, action generated.NextActionEnum, reason string) error {
 	var filter WorkloadFilter
 	filter = filter.WithID(id)
 
+	set := bson.M{"next_action": action}
+	if action == Deleted {
+		set["deleted_at"] = schema.Date{Time: time.Now()}
+	}
+
 	col := db.Collection(WorkloadCollection)
-	_, err := col.UpdateOne(ctx, filter, bson.M{
-		"$set": bson.M{
-			"next_action": action,
-		},
-	})
+	result := col.FindOneAndUpdate(ctx, filter, bson.M{
+		"$set": set,
+	}, options.FindOneAndUpdate().SetReturnDocument(options.Before))
 
-	if err != nil {
+	if err := result.Err(); err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
 		return err
 	}
 
+	var w WorkloaderType
+	if err := result.Decode(&w); err != nil {
+		return errors.Wrap(err, "could not decode workload type")
+	}
+
+	if w.GetNextAction() != action {
+		w.SetNextAction(action)
+		NodeWork.Notify(w.GetNodeID())
+
+		event := newWorkloadEvent(WorkloadEventNextAction, w)
+		event.Reason = reason
+		if err := recordWorkloadEvent(ctx, db, event); err != nil {
+			// the next action is already changed, failing here would leave
+			// the caller half way through the transition
+			log.Error().Err(err).Int64("workload", int64(id)).Msg("failed to record next action change")
+		}
+	}
+
 	return nil
 }
 
 // WorkloadToDeploy marks a workload to deploy and schedule it for the nodes
 // it's a short cut to SetNextAction then PushWorkloads
-func WorkloadToDeploy(ctx context.Context, db *mongo.Database, w WorkloaderType) error {
+func WorkloadToDeploy(ctx context.Context, db *mongo.Database, w WorkloaderType, reason string) error {
 	// update workload
-	if err := WorkloadSetNextAction(ctx, db, w.GetID(), Deploy); err != nil {
+	if err := WorkloadSetNextAction(ctx, db, w.GetID(), Deploy, reason); err != nil {
 		return errors.Wrap(err, "failed to set workload to DEPLOY state")
 	}
 
@@ -447,7 +787,7 @@ func WorkloadToDeploy(ctx context.Context, db *mongo.Database, w WorkloaderType)
 	return nil
 }
 
-//WorkloadPushSignature push signature to workload
+//WorkloadPushSignature push signature to workload, and records a workload event
 func WorkloadPushSignature(ctx context.Context, db *mongo.Database, id schema.ID, mode SignatureMode, signature generated.SigningSignature) error {
 	// this function just push the signature to the reservation array
 	// there are not other checks involved here. So before calling this function
@@ -455,21 +795,48 @@ func WorkloadPushSignature(ctx context.Context, db *mongo.Database, id schema.ID
 	var filter WorkloadFilter
 	filter = filter.WithID(id)
 	col := db.Collection(WorkloadCollection)
-	_, err := col.UpdateOne(ctx, filter, bson.M{
+	updated := col.FindOneAndUpdate(ctx, filter, bson.M{
 		"$push": bson.M{
 			string(mode): signature,
 		},
-	})
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
 
-	return err
+	if err := updated.Err(); err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var w WorkloaderType
+	if err := updated.Decode(&w); err != nil {
+		return errors.Wrap(err, "could not decode workload type")
+	}
+
+	kind := WorkloadEventSignatureProvision
+	if mode == SignatureDelete {
+		kind = WorkloadEventSignatureDelete
+	}
+
+	event := newWorkloadEvent(kind, w)
+	event.Signature = &signature
+	if err := recordWorkloadEvent(ctx, db, event); err != nil {
+		// a user can't sign twice, so the signature is kept even if it is
+		// missing from the history
+		log.Error().Err(err).Int64("workload", int64(id)).Msg("failed to record signature")
+	}
+
+	return nil
 }
 
 // WorkloadTypePush pushes a workload to the queue
 func WorkloadTypePush(ctx context.Context, db *mongo.Database, w WorkloaderType) error {
 	col := db.Collection(queueCollection)
-	_, err := col.InsertOne(ctx, w)
+	if _, err := col.InsertOne(ctx, w); err != nil {
+		return err
+	}
 
-	return err
+	NodeWork.Notify(w.GetNodeID())
+	return nil
 }
 
 // WorkloadTypePop removes workload from queue
@@ -480,22 +847,38 @@ func WorkloadTypePop(ctx context.Context, db *mongo.Database, id string, nodeID
 	return err
 }
 
-// WorkloadResultPush pushes result to a reservation result array.
+// WorkloadResultPush pushes result to a reservation result array, and records
+// a workload event. The workload only keeps the last result, the previous
+// ones are found in the workload events.
 // NOTE: this is just a crud operation, no validation is done here
 func WorkloadResultPush(ctx context.Context, db *mongo.Database, id schema.ID, result Result) error {
 	col := db.Collection(WorkloadCollection)
 	var filter WorkloadFilter
 	filter = filter.WithID(id)
 
-	_, err := col.UpdateOne(ctx, filter,
+	updated := col.FindOneAndUpdate(ctx, filter,
 		bson.M{
 			"$set": bson.M{
 				"result": result,
 			},
 		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
 	)
 
-	return err
+	if err := updated.Err(); err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var w WorkloaderType
+	if err := updated.Decode(&w); err != nil {
+		return errors.Wrap(err, "could not decode workload type")
+	}
+
+	// the result is sent again by the node if this fails, so it is never
+	// missing from the history
+	return recordWorkloadEvent(ctx, db, newWorkloadEvent(WorkloadEventResult, w))
 }
 
 // Validate that the reservation is valid
@@ -520,6 +903,14 @@ func (w *WorkloaderType) Validate() error {
 		return errors.New("reference is illegal for new workloads")
 	}
 
+	if err := ValidateLabels(w.GetLabels()); err != nil {
+		return err
+	}
+
+	if w.HasExpiration() && w.GetExpiresAt().Before(time.Now()) {
+		return errors.New("expires_at can not be in the past")
+	}
+
 	return nil
 }
 
@@ -86,6 +86,9 @@ func (p *WorkloadPipeline) Next() (WorkloaderType, bool) {
 			// NOTE: validation of the pools is static, and must happen when the
 			// explorer receives the reservation.
 			slog.Debug().Msg("reservation workloads attached to capacity pools - block until pool is confirmed to be ready")
+		case generated.NextActionApprove:
+			// the farmer approves or rejects the workload through the api
+			slog.Debug().Msg("workload waiting for farmer approval")
 		case generated.NextActionDeploy:
 			//nothing to do
 			slog.Debug().Msg("let's deploy")
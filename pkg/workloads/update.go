@@ -0,0 +1,238 @@
+package workloads
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	generated "github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/mw"
+	capacitytypes "github.com/threefoldtech/tfexplorer/pkg/capacity/types"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"github.com/zaibon/httpsig"
+)
+
+// WorkloadUpdateResponse wraps workload update response
+type WorkloadUpdateResponse struct {
+	ID       schema.ID `json:"workload_id"`
+	Revision int64     `json:"revision"`
+}
+
+// checkUpdatable makes sure the updated workload only changes what can be
+// changed on a running workload
+func checkUpdatable(current, updated types.WorkloaderType) error {
+	if current.GetWorkloadType() == generated.WorkloadTypePublicIP {
+		return errors.New("public ip reservations can not be updated")
+	}
+
+	if updated.GetWorkloadType() != current.GetWorkloadType() {
+		return fmt.Errorf("workload type can not be changed from '%s' to '%s'", current.GetWorkloadType(), updated.GetWorkloadType())
+	}
+
+	if updated.GetNodeID() != current.GetNodeID() {
+		return errors.New("workload node can not be changed")
+	}
+
+	if updated.GetPoolID() != current.GetPoolID() {
+		return errors.New("workload pool can not be changed")
+	}
+
+	if updated.GetCustomerTid() != current.GetCustomerTid() {
+		return errors.New("workload customer can not be changed")
+	}
+
+	return nil
+}
+
+// updateWorkload replaces a deployed workload with a new signed version. The
+// current version is kept as a revision, and the node is notified about the
+// update through its queue.
+func (a *API) updateWorkload(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	var filter types.WorkloadFilter
+	filter = filter.WithID(id)
+
+	db := mw.Database(r)
+	current, err := a.workloadpipeline(filter.Get(r.Context(), db))
+	if err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	if current.GetCustomerTid() != requestUserID {
+		return nil, mw.UnAuthorized(fmt.Errorf("request user identity does not match the workload customer-tid"))
+	}
+
+	if !current.IsAny(types.Deploy) {
+		return nil, mw.Conflict(fmt.Errorf("workload is in state '%s', only deployed workloads can be updated", current.GetNextAction().String()))
+	}
+
+	if current.GetMigratedTo() != 0 {
+		return nil, mw.Conflict(fmt.Errorf("workload is being migrated to workload '%d'", current.GetMigratedTo()))
+	}
+
+	bodyBuf := bytes.NewBuffer(nil)
+	bodyBuf.ReadFrom(r.Body)
+
+	updated, mwErr := a.prepareWorkload(r.Context(), db, requestUserID, id, bodyBuf.Bytes())
+	if mwErr != nil {
+		return nil, mwErr
+	}
+
+	if err := checkUpdatable(current, updated); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	if mwErr := a.validateDependencies(r.Context(), db, updated, nil); mwErr != nil {
+		return nil, mwErr
+	}
+
+	// the farmer only approved the current version of the workload
+	_, policy, err := nodeFarmPolicy(r.Context(), db, current.GetNodeID())
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	if policy.RequiresApproval(updated.GetCustomerTid(), updated.GetWorkloadType()) {
+		return nil, mw.Conflict(errors.New("the farm requires approval of its workloads, they can not be updated"))
+	}
+
+	updated.SetID(id)
+	updated.SetNextAction(types.Deploy)
+	updated.SetMigratedFrom(current.GetMigratedFrom())
+	updated.SetConvertedFrom(current.GetConvertedFrom())
+
+	allowed, err := a.capacityPlanner.HasCapacityForUpdate(current, updated, minCapacitySeconds)
+	if err != nil {
+		if errors.Is(err, capacitytypes.ErrPoolNotFound) {
+			return nil, mw.Error(errors.New("pool does not exist"))
+		}
+		log.Error().Err(err).Msg("failed to load workload capacity pool")
+		return nil, mw.Error(errors.New("could not load the required capacity pool"))
+	}
+
+	if !allowed {
+		return nil, mw.PaymentRequired(errors.New("pool needs additional capacity to support the updated workload")).WithCode(mw.CodePoolInsufficientCapacity)
+	}
+
+	revision, err := types.WorkloadRevisionFilter{}.WithWorkloadID(id).Count(r.Context(), db)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	// revisions are numbered from 1, the current version of the workload is
+	// always the last revision + 1
+	revision++
+	if err := types.WorkloadRevisionCreate(r.Context(), db, current, revision); err != nil {
+		if errors.Is(err, types.ErrRevisionExists) {
+			return nil, mw.Conflict(errors.New("workload is being updated concurrently"))
+		}
+		return nil, mw.Error(err)
+	}
+
+	if err := types.WorkloadReplace(r.Context(), db, updated); err != nil {
+		log.Error().Err(err).Msg("could not save updated workload")
+		return nil, mw.Error(err)
+	}
+
+	// the used capacity is only accounted for once the node reports the
+	// workload deployed, in which case the difference is applied right away
+	if current.GetResult().State == generated.ResultStateOK && current.GetResult().WorkloadId != "" {
+		if err := a.capacityPlanner.RemoveUsedCapacity(current); err != nil {
+			log.Error().Err(err).Msg("failed to decrease used capacity in pool")
+			return nil, mw.Error(err)
+		}
+
+		if err := a.capacityPlanner.AddUsedCapacity(updated); err != nil {
+			log.Error().Err(err).Msg("failed to increase used capacity in pool")
+			return nil, mw.Error(err)
+		}
+	}
+
+	if err := types.WorkloadUpdatePush(r.Context(), db, updated); err != nil {
+		log.Error().Err(err).Msg("failed to schedule the workload update")
+		return nil, mw.Error(errors.New("could not schedule workload update"))
+	}
+
+	if updated.HasExpiration() {
+		a.expirer.Reschedule()
+	}
+
+	return WorkloadUpdateResponse{ID: id, Revision: revision + 1}, mw.Ok()
+}
+
+func (a *API) listWorkloadRevisions(r *http.Request) (interface{}, mw.Response) {
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	db := mw.Database(r)
+	if _, err := (types.WorkloadFilter{}).WithID(id).Get(r.Context(), db); err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	revisions, err := types.WorkloadRevisionFilter{}.WithWorkloadID(id).Find(r.Context(), db)
+	if err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return revisions, nil
+}
+
+// setWorkloadLabels replaces the labels of a workload. Labels are not signed
+// so only the workload customer can change them.
+func (a *API) setWorkloadLabels(r *http.Request) (interface{}, mw.Response) {
+	defer r.Body.Close()
+
+	requestUserID, err := strconv.ParseInt(httpsig.KeyIDFromContext(r.Context()), 10, 64)
+	if err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to parse request user id"))
+	}
+
+	id, err := a.parseID(mux.Vars(r)["res_id"])
+	if err != nil {
+		return nil, mw.BadRequest(fmt.Errorf("invalid reservation id"))
+	}
+
+	var labels map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+		return nil, mw.BadRequest(errors.Wrap(err, "failed to decode labels"))
+	}
+
+	if err := types.ValidateLabels(labels); err != nil {
+		return nil, mw.BadRequest(err)
+	}
+
+	db := mw.Database(r)
+	workload, err := (types.WorkloadFilter{}).WithID(id).Get(r.Context(), db)
+	if err != nil {
+		return nil, mw.NotFound(err).WithCode(mw.CodeWorkloadNotFound)
+	}
+
+	if workload.GetCustomerTid() != requestUserID {
+		return nil, mw.UnAuthorized(fmt.Errorf("request user identity does not match the workload customer-tid"))
+	}
+
+	if err := types.WorkloadSetLabels(r.Context(), db, id, labels); err != nil {
+		return nil, mw.Error(err)
+	}
+
+	return nil, mw.Ok()
+}
@@ -0,0 +1,84 @@
+package workloads
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/pkg/workloads/types"
+)
+
+func Test_checkUpdatable(t *testing.T) {
+	container := func(nodeID string, poolID, customer int64) types.WorkloaderType {
+		c := &workloads.Container{}
+		c.WorkloadType = workloads.WorkloadTypeContainer
+		c.NodeId = nodeID
+		c.PoolId = poolID
+		c.CustomerTid = customer
+		return types.WorkloaderType{Workloader: c}
+	}
+
+	volume := &workloads.Volume{}
+	volume.WorkloadType = workloads.WorkloadTypeVolume
+	volume.NodeId = "node"
+	volume.PoolId = 1
+	volume.CustomerTid = 1
+
+	ip := &workloads.PublicIP{}
+	ip.WorkloadType = workloads.WorkloadTypePublicIP
+
+	tests := []struct {
+		name    string
+		current types.WorkloaderType
+		updated types.WorkloaderType
+		err     bool
+	}{
+		{
+			name:    "same",
+			current: container("node", 1, 1),
+			updated: container("node", 1, 1),
+			err:     false,
+		},
+		{
+			name:    "node",
+			current: container("node", 1, 1),
+			updated: container("other", 1, 1),
+			err:     true,
+		},
+		{
+			name:    "pool",
+			current: container("node", 1, 1),
+			updated: container("node", 2, 1),
+			err:     true,
+		},
+		{
+			name:    "customer",
+			current: container("node", 1, 1),
+			updated: container("node", 1, 2),
+			err:     true,
+		},
+		{
+			name:    "type",
+			current: container("node", 1, 1),
+			updated: types.WorkloaderType{Workloader: volume},
+			err:     true,
+		},
+		{
+			name:    "public_ip",
+			current: types.WorkloaderType{Workloader: ip},
+			updated: types.WorkloaderType{Workloader: ip},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUpdatable(tt.current, tt.updated)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,517 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ManifestLabel is the label holding the name of the manifest a workload
+	// is deployed from
+	ManifestLabel = "manifest"
+	// ManifestHashLabel is the label holding the hash of the manifest entry
+	// a workload is deployed from, a workload whose entry changed is replaced
+	ManifestHashLabel = "manifest-hash"
+)
+
+// names in a manifest are used in the workload references
+var manifestNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-]{0,62}$`)
+
+// Manifest describes the workloads of a deployment by name. Every workload
+// deployed from a manifest is labeled with the manifest name, and its
+// reference is derived from the names in the manifest, so the live workloads
+// can be matched against the manifest.
+type Manifest struct {
+	Name string `yaml:"name" json:"name"`
+	// Pools maps the pool names used in the manifest to the ids of existing
+	// capacity pools
+	Pools      map[string]int64     `yaml:"pools" json:"pools"`
+	Networks   []NetworkManifest    `yaml:"networks" json:"networks"`
+	Volumes    []VolumeManifest     `yaml:"volumes" json:"volumes"`
+	Containers []ContainerManifest  `yaml:"containers" json:"containers"`
+	Kubernetes []KubernetesManifest `yaml:"kubernetes" json:"kubernetes"`
+	Gateways   []GatewayManifest    `yaml:"gateways" json:"gateways"`
+}
+
+// NetworkManifest is a private network spanning a set of nodes
+type NetworkManifest struct {
+	Name    string                `yaml:"name" json:"name"`
+	Pool    string                `yaml:"pool" json:"pool"`
+	IPRange string                `yaml:"ip_range" json:"ip_range"`
+	Nodes   []NetworkNodeManifest `yaml:"nodes" json:"nodes"`
+}
+
+// NetworkNodeManifest is the part of a network on a node
+type NetworkNodeManifest struct {
+	Node   string `yaml:"node" json:"node"`
+	Subnet string `yaml:"subnet" json:"subnet"`
+	// WireguardPort is picked automatically if it is not set
+	WireguardPort uint `yaml:"wireguard_port" json:"wireguard_port"`
+}
+
+// VolumeManifest is a volume which can be mounted by the containers on the
+// same node
+type VolumeManifest struct {
+	Name string `yaml:"name" json:"name"`
+	Pool string `yaml:"pool" json:"pool"`
+	Node string `yaml:"node" json:"node"`
+	// Size in GiB
+	Size int64 `yaml:"size" json:"size"`
+	// Type is either ssd or hdd
+	Type string `yaml:"type" json:"type"`
+}
+
+// ContainerManifest is a container connected to a network
+type ContainerManifest struct {
+	Name        string            `yaml:"name" json:"name"`
+	Pool        string            `yaml:"pool" json:"pool"`
+	Node        string            `yaml:"node" json:"node"`
+	Flist       string            `yaml:"flist" json:"flist"`
+	HubURL      string            `yaml:"hub_url" json:"hub_url"`
+	Entrypoint  string            `yaml:"entrypoint" json:"entrypoint"`
+	Interactive bool              `yaml:"interactive" json:"interactive"`
+	Env         map[string]string `yaml:"env" json:"env"`
+	// SecretEnv is encrypted for the node before it is sent. The values are
+	// not part of the hash of the container, a container is only replaced
+	// when a secret is added or removed.
+	SecretEnv map[string]string `yaml:"secret_env" json:"secret_env"`
+	Network   string            `yaml:"network" json:"network"`
+	IP        string            `yaml:"ip" json:"ip"`
+	PublicIP6 bool              `yaml:"public_ip6" json:"public_ip6"`
+	CPU       int64             `yaml:"cpu" json:"cpu"`
+	// Memory in MiB
+	Memory int64 `yaml:"memory" json:"memory"`
+	// DiskSize of the root filesystem in MiB
+	DiskSize uint64 `yaml:"disk_size" json:"disk_size"`
+	// DiskType is either ssd or hdd
+	DiskType string          `yaml:"disk_type" json:"disk_type"`
+	Mounts   []MountManifest `yaml:"mounts" json:"mounts"`
+}
+
+// MountManifest mounts a volume of the manifest in a container
+type MountManifest struct {
+	Volume     string `yaml:"volume" json:"volume"`
+	Mountpoint string `yaml:"mountpoint" json:"mountpoint"`
+}
+
+// KubernetesManifest is a kubernetes cluster with a master and its workers
+type KubernetesManifest struct {
+	Name    string `yaml:"name" json:"name"`
+	Pool    string `yaml:"pool" json:"pool"`
+	Network string `yaml:"network" json:"network"`
+	// Secret is not part of the hash of the cluster, changing it does not
+	// replace the cluster
+	Secret  string                   `yaml:"secret" json:"secret"`
+	Size    int64                    `yaml:"size" json:"size"`
+	SSHKeys []string                 `yaml:"ssh_keys" json:"ssh_keys"`
+	Master  KubernetesNodeManifest   `yaml:"master" json:"master"`
+	Workers []KubernetesNodeManifest `yaml:"workers" json:"workers"`
+}
+
+// KubernetesNodeManifest is a virtual machine of a kubernetes cluster
+type KubernetesNodeManifest struct {
+	// Name is only required for the workers
+	Name string `yaml:"name" json:"name"`
+	Node string `yaml:"node" json:"node"`
+	IP   string `yaml:"ip" json:"ip"`
+}
+
+// GatewayManifest exposes a domain on a gateway
+type GatewayManifest struct {
+	Name string `yaml:"name" json:"name"`
+	Pool string `yaml:"pool" json:"pool"`
+	// Node is the id of the gateway
+	Node string `yaml:"node" json:"node"`
+	// Type is either subdomain or delegate
+	Type   string   `yaml:"type" json:"type"`
+	Domain string   `yaml:"domain" json:"domain"`
+	IPs    []string `yaml:"ips" json:"ips"`
+}
+
+// LoadManifest decodes and validates a YAML manifest
+func LoadManifest(reader io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := yaml.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifest")
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func validateName(kind, name string, seen map[string]struct{}) error {
+	if !manifestNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid %s name '%s', names are at most 63 characters of letters, digits, '_' and '-'", kind, name)
+	}
+
+	if _, ok := seen[name]; ok {
+		return fmt.Errorf("%s '%s' is defined more than once", kind, name)
+	}
+	seen[name] = struct{}{}
+
+	return nil
+}
+
+func validateIP(kind, name, ip string) error {
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%s '%s' has an invalid ip '%s'", kind, name, ip)
+	}
+
+	return nil
+}
+
+func parseDiskType(kind, name, diskType string) (workloads.DiskTypeEnum, error) {
+	switch diskType {
+	case "", "ssd":
+		return workloads.DiskTypeSSD, nil
+	case "hdd":
+		return workloads.DiskTypeHDD, nil
+	}
+
+	return 0, fmt.Errorf("%s '%s' has an unknown disk type '%s', expecting ssd or hdd", kind, name, diskType)
+}
+
+// Validate checks the manifest is complete and all the names it references
+// are defined
+func (m *Manifest) Validate() error {
+	if err := validateName("manifest", m.Name, map[string]struct{}{}); err != nil {
+		return err
+	}
+
+	pool := func(kind, name, pool string) error {
+		if _, ok := m.Pools[pool]; !ok {
+			return fmt.Errorf("%s '%s' uses the unknown pool '%s'", kind, name, pool)
+		}
+		return nil
+	}
+
+	networks := make(map[string]NetworkManifest)
+	seen := make(map[string]struct{})
+	for _, network := range m.Networks {
+		if err := validateName("network", network.Name, seen); err != nil {
+			return err
+		}
+		if err := pool("network", network.Name, network.Pool); err != nil {
+			return err
+		}
+		if _, err := schema.ParseIPRange(network.IPRange); err != nil {
+			return errors.Wrapf(err, "network '%s' has an invalid ip range", network.Name)
+		}
+		if len(network.Nodes) == 0 {
+			return fmt.Errorf("network '%s' has no nodes", network.Name)
+		}
+
+		nodes := make(map[string]struct{})
+		for _, node := range network.Nodes {
+			if _, ok := nodes[node.Node]; ok {
+				return fmt.Errorf("network '%s' has node '%s' more than once", network.Name, node.Node)
+			}
+			nodes[node.Node] = struct{}{}
+		}
+
+		networks[network.Name] = network
+	}
+
+	// a network which is not in the manifest is expected to exist already
+	onNetwork := func(kind, name, network, node string) error {
+		if network == "" {
+			return fmt.Errorf("%s '%s' has no network", kind, name)
+		}
+
+		nw, ok := networks[network]
+		if !ok {
+			return nil
+		}
+
+		for _, n := range nw.Nodes {
+			if n.Node == node {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%s '%s' is on node '%s' which is not part of network '%s'", kind, name, node, network)
+	}
+
+	volumes := make(map[string]VolumeManifest)
+	seen = make(map[string]struct{})
+	for _, volume := range m.Volumes {
+		if err := validateName("volume", volume.Name, seen); err != nil {
+			return err
+		}
+		if err := pool("volume", volume.Name, volume.Pool); err != nil {
+			return err
+		}
+		if volume.Size <= 0 {
+			return fmt.Errorf("volume '%s' must have a size", volume.Name)
+		}
+		if _, err := parseDiskType("volume", volume.Name, volume.Type); err != nil {
+			return err
+		}
+
+		volumes[volume.Name] = volume
+	}
+
+	seen = make(map[string]struct{})
+	for _, container := range m.Containers {
+		if err := validateName("container", container.Name, seen); err != nil {
+			return err
+		}
+		if err := pool("container", container.Name, container.Pool); err != nil {
+			return err
+		}
+		if container.Flist == "" {
+			return fmt.Errorf("container '%s' has no flist", container.Name)
+		}
+		if err := onNetwork("container", container.Name, container.Network, container.Node); err != nil {
+			return err
+		}
+		if err := validateIP("container", container.Name, container.IP); err != nil {
+			return err
+		}
+		if _, err := parseDiskType("container", container.Name, container.DiskType); err != nil {
+			return err
+		}
+
+		for _, mount := range container.Mounts {
+			volume, ok := volumes[mount.Volume]
+			if !ok {
+				return fmt.Errorf("container '%s' mounts the unknown volume '%s'", container.Name, mount.Volume)
+			}
+			if volume.Node != container.Node {
+				return fmt.Errorf("container '%s' mounts volume '%s' which is on another node", container.Name, mount.Volume)
+			}
+		}
+	}
+
+	seen = make(map[string]struct{})
+	for _, cluster := range m.Kubernetes {
+		if err := validateName("kubernetes cluster", cluster.Name, seen); err != nil {
+			return err
+		}
+		if err := pool("kubernetes cluster", cluster.Name, cluster.Pool); err != nil {
+			return err
+		}
+
+		vms := append([]KubernetesNodeManifest{cluster.Master}, cluster.Workers...)
+		workers := map[string]struct{}{"master": {}}
+		for i, vm := range vms {
+			if i > 0 {
+				if err := validateName("kubernetes worker", vm.Name, workers); err != nil {
+					return errors.Wrapf(err, "kubernetes cluster '%s'", cluster.Name)
+				}
+			}
+			if err := onNetwork("kubernetes cluster", cluster.Name, cluster.Network, vm.Node); err != nil {
+				return err
+			}
+			if err := validateIP("kubernetes cluster", cluster.Name, vm.IP); err != nil {
+				return err
+			}
+		}
+	}
+
+	seen = make(map[string]struct{})
+	for _, gateway := range m.Gateways {
+		if err := validateName("gateway", gateway.Name, seen); err != nil {
+			return err
+		}
+		if err := pool("gateway", gateway.Name, gateway.Pool); err != nil {
+			return err
+		}
+		if gateway.Domain == "" {
+			return fmt.Errorf("gateway '%s' has no domain", gateway.Name)
+		}
+
+		switch gateway.Type {
+		case "subdomain":
+			if len(gateway.IPs) == 0 {
+				return fmt.Errorf("gateway '%s' has no ips to point the subdomain to", gateway.Name)
+			}
+			for _, ip := range gateway.IPs {
+				if err := validateIP("gateway", gateway.Name, ip); err != nil {
+					return err
+				}
+			}
+		case "delegate":
+		default:
+			return fmt.Errorf("gateway '%s' has an unknown type '%s', expecting subdomain or delegate", gateway.Name, gateway.Type)
+		}
+	}
+
+	return nil
+}
+
+// entry is a workload described by the manifest
+type entry struct {
+	Reference string
+	// Hash changes whenever the workload or one of its dependencies changes
+	Hash string
+	// Requires are the references of the workloads of the manifest whose id
+	// is needed to build this workload, they are created before it
+	Requires []string
+	// Network is the network of a network resource, or the network a
+	// workload is connected to
+	Network string
+	// Resource is set for the network resources
+	Resource bool
+	build    func(b *builder) (workloads.Workloader, error)
+}
+
+// hashSpec hashes a manifest entry with the hashes of its dependencies. The
+// hash is public, the specs must not contain any secret.
+func hashSpec(spec interface{}, dependencies ...string) string {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		// the specs are plain structs, this can't happen
+		panic(err)
+	}
+
+	h := sha256.New()
+	h.Write(data)
+	for _, dep := range dependencies {
+		h.Write([]byte(dep))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// public returns the container without the values of its secrets
+func (c ContainerManifest) public() ContainerManifest {
+	secrets := make(map[string]string, len(c.SecretEnv))
+	for name := range c.SecretEnv {
+		secrets[name] = ""
+	}
+	c.SecretEnv = secrets
+
+	return c
+}
+
+// public returns the cluster without its secret
+func (k KubernetesManifest) public() KubernetesManifest {
+	k.Secret = ""
+	return k
+}
+
+func (m *Manifest) reference(kind string, names ...string) string {
+	ref := fmt.Sprintf("%s/%s", m.Name, kind)
+	for _, name := range names {
+		ref += "/" + name
+	}
+
+	return ref
+}
+
+// entries returns the workloads described by the manifest, every workload
+// comes after the workloads it depends on
+func (m *Manifest) entries() []entry {
+	var entries []entry
+
+	networkHashes := make(map[string]string)
+	for _, network := range m.Networks {
+		network := network
+		hash := hashSpec(network, fmt.Sprint(m.Pools[network.Pool]))
+		networkHashes[network.Name] = hash
+
+		for _, node := range network.Nodes {
+			node := node
+			entries = append(entries, entry{
+				Reference: m.reference("network", network.Name, node.Node),
+				Hash:      hash,
+				Network:   network.Name,
+				Resource:  true,
+				build: func(b *builder) (workloads.Workloader, error) {
+					return b.networkResource(m, network, node.Node)
+				},
+			})
+		}
+	}
+
+	volumeHashes := make(map[string]string)
+	for _, volume := range m.Volumes {
+		volume := volume
+		ref := m.reference("volume", volume.Name)
+		hash := hashSpec(volume, fmt.Sprint(m.Pools[volume.Pool]))
+		volumeHashes[volume.Name] = hash
+
+		entries = append(entries, entry{
+			Reference: ref,
+			Hash:      hash,
+			build: func(b *builder) (workloads.Workloader, error) {
+				return b.volume(m, volume)
+			},
+		})
+	}
+
+	for _, container := range m.Containers {
+		container := container
+		deps := []string{fmt.Sprint(m.Pools[container.Pool]), networkHashes[container.Network]}
+		var requires []string
+		for _, mount := range container.Mounts {
+			deps = append(deps, volumeHashes[mount.Volume])
+			requires = append(requires, m.reference("volume", mount.Volume))
+		}
+
+		entries = append(entries, entry{
+			Reference: m.reference("container", container.Name),
+			Hash:      hashSpec(container.public(), deps...),
+			Requires:  requires,
+			Network:   container.Network,
+			build: func(b *builder) (workloads.Workloader, error) {
+				return b.container(m, container)
+			},
+		})
+	}
+
+	for _, cluster := range m.Kubernetes {
+		cluster := cluster
+		// the workers join the master, so they are replaced with it
+		hash := hashSpec(cluster.public(), fmt.Sprint(m.Pools[cluster.Pool]), networkHashes[cluster.Network])
+		master := m.reference("kubernetes", cluster.Name, "master")
+
+		entries = append(entries, entry{
+			Reference: master,
+			Hash:      hash,
+			Network:   cluster.Network,
+			build: func(b *builder) (workloads.Workloader, error) {
+				return b.kubernetes(m, cluster, cluster.Master, nil)
+			},
+		})
+
+		for _, worker := range cluster.Workers {
+			worker := worker
+			entries = append(entries, entry{
+				Reference: m.reference("kubernetes", cluster.Name, worker.Name),
+				Hash:      hash,
+				Network:   cluster.Network,
+				build: func(b *builder) (workloads.Workloader, error) {
+					return b.kubernetes(m, cluster, worker, []net.IP{net.ParseIP(cluster.Master.IP)})
+				},
+			})
+		}
+	}
+
+	for _, gateway := range m.Gateways {
+		gateway := gateway
+		entries = append(entries, entry{
+			Reference: m.reference("gateway", gateway.Name),
+			Hash:      hashSpec(gateway, fmt.Sprint(m.Pools[gateway.Pool])),
+			build: func(b *builder) (workloads.Workloader, error) {
+				return b.gateway(m, gateway)
+			},
+		})
+	}
+
+	return entries
+}
@@ -0,0 +1,163 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+const testManifest = `
+name: staging
+pools:
+  main: 12
+networks:
+  - name: net
+    pool: main
+    ip_range: 10.1.0.0/16
+    nodes:
+      - node: node1
+        subnet: 10.1.1.0/24
+volumes:
+  - name: data
+    pool: main
+    node: node1
+    size: 10
+containers:
+  - name: web
+    pool: main
+    node: node1
+    flist: https://hub.grid.tf/tf-official-apps/nginx.flist
+    network: net
+    ip: 10.1.1.10
+    mounts:
+      - volume: data
+        mountpoint: /data
+gateways:
+  - name: www
+    pool: main
+    node: gw1
+    type: subdomain
+    domain: www.example.com
+    ips: [185.69.166.10]
+`
+
+func loadTestManifest(t *testing.T) *Manifest {
+	manifest, err := LoadManifest(strings.NewReader(testManifest))
+	require.NoError(t, err)
+	return manifest
+}
+
+func TestLoadManifestValidation(t *testing.T) {
+	loadTestManifest(t)
+
+	cases := map[string]string{
+		"unknown pool":   strings.Replace(testManifest, "pool: main\n    node: gw1", "pool: other\n    node: gw1", 1),
+		"unknown volume": strings.Replace(testManifest, "volume: data", "volume: logs", 1),
+		"node off net":   strings.Replace(testManifest, "node: node1\n    flist", "node: node2\n    flist", 1),
+		"invalid name":   strings.Replace(testManifest, "name: web", "name: web/1", 1),
+		"gateway type":   strings.Replace(testManifest, "type: subdomain", "type: proxy", 1),
+	}
+
+	for name, manifest := range cases {
+		_, err := LoadManifest(strings.NewReader(manifest))
+		assert.Error(t, err, name)
+	}
+}
+
+func liveWorkloads(m *Manifest) []workloads.Workloader {
+	var live []workloads.Workloader
+	for i, e := range m.entries() {
+		w := &workloads.Volume{}
+		w.SetID(schema.ID(i + 1))
+		w.SetReference(e.Reference)
+		w.SetLabels(map[string]string{ManifestLabel: m.Name, ManifestHashLabel: e.Hash})
+		live = append(live, w)
+	}
+
+	return live
+}
+
+func TestDiff(t *testing.T) {
+	manifest := loadTestManifest(t)
+
+	plan := Diff(manifest, nil)
+	require.Len(t, plan.Actions, 4)
+	for _, action := range plan.Actions {
+		assert.Equal(t, ActionCreate, action.Type)
+	}
+	// dependencies are created first
+	assert.Equal(t, "staging/network/net/node1", plan.Actions[0].Reference)
+	assert.Equal(t, "staging/volume/data", plan.Actions[1].Reference)
+	assert.Equal(t, "staging/container/web", plan.Actions[2].Reference)
+
+	live := liveWorkloads(manifest)
+	plan = Diff(manifest, live)
+	assert.True(t, plan.Empty())
+	assert.Len(t, plan.Unchanged, 4)
+
+	// a changed volume replaces the container mounting it
+	manifest.Volumes[0].Size = 20
+	plan = Diff(manifest, live)
+	var actions []string
+	for _, action := range plan.Actions {
+		actions = append(actions, string(action.Type)+" "+action.Reference)
+	}
+	assert.Equal(t, []string{
+		"delete staging/container/web",
+		"delete staging/volume/data",
+		"create staging/volume/data",
+		"create staging/container/web",
+	}, actions)
+
+	// workloads removed from the manifest are deleted
+	manifest = loadTestManifest(t)
+	manifest.Gateways = nil
+	plan = Diff(manifest, live)
+	require.Len(t, plan.Actions, 1)
+	assert.Equal(t, ActionDelete, plan.Actions[0].Type)
+	assert.Equal(t, "staging/gateway/www", plan.Actions[0].Reference)
+	assert.Equal(t, schema.ID(4), plan.Actions[0].WorkloadID)
+
+	// a missing network resource recreates the network with the workloads
+	// connected to it
+	plan = Diff(manifest, live[1:])
+	actions = nil
+	for _, action := range plan.Actions {
+		actions = append(actions, string(action.Type)+" "+action.Reference)
+	}
+	assert.Equal(t, []string{
+		"delete staging/container/web",
+		"delete staging/gateway/www",
+		"create staging/network/net/node1",
+		"create staging/container/web",
+	}, actions)
+	assert.Equal(t, "network is recreated", plan.Actions[0].Reason)
+}
+
+func TestManifestHashSecrets(t *testing.T) {
+	manifest := loadTestManifest(t)
+	manifest.Containers[0].SecretEnv = map[string]string{"TOKEN": "first"}
+	manifest.Kubernetes = []KubernetesManifest{{Name: "k8s", Pool: "main", Network: "net", Secret: "first"}}
+	hashes := make(map[string]string)
+	for _, e := range manifest.entries() {
+		hashes[e.Reference] = e.Hash
+	}
+
+	// the secrets are not part of the public hashes
+	manifest.Containers[0].SecretEnv["TOKEN"] = "second"
+	manifest.Kubernetes[0].Secret = "second"
+	for _, e := range manifest.entries() {
+		assert.Equal(t, hashes[e.Reference], e.Hash, e.Reference)
+	}
+
+	manifest.Containers[0].SecretEnv["KEY"] = "value"
+	for _, e := range manifest.entries() {
+		if e.Reference == "staging/container/web" {
+			assert.NotEqual(t, hashes[e.Reference], e.Hash)
+		}
+	}
+}
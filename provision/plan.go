@@ -0,0 +1,441 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfexplorer/client"
+	"github.com/threefoldtech/tfexplorer/models/generated/workloads"
+	"github.com/threefoldtech/tfexplorer/provision/builders"
+	"github.com/threefoldtech/tfexplorer/schema"
+)
+
+// planPageSize is the number of live workloads fetched at once
+const planPageSize = 100
+
+// ActionType is the kind of change of a plan action
+type ActionType string
+
+const (
+	// ActionCreate creates a workload of the manifest
+	ActionCreate ActionType = "create"
+	// ActionDelete deletes a live workload
+	ActionDelete ActionType = "delete"
+)
+
+// Action is a change to the live workloads of a manifest
+type Action struct {
+	Type      ActionType `json:"type"`
+	Reference string     `json:"reference"`
+	// WorkloadID is the live workload deleted by a delete action, or the
+	// workload created by a create action once it is applied
+	WorkloadID schema.ID `json:"workload_id,omitempty"`
+	// Reason explains why the action is needed
+	Reason string `json:"reason"`
+
+	entry *entry
+}
+
+func (a Action) String() string {
+	if a.WorkloadID != 0 {
+		return fmt.Sprintf("%s %s (workload %d): %s", a.Type, a.Reference, a.WorkloadID, a.Reason)
+	}
+
+	return fmt.Sprintf("%s %s: %s", a.Type, a.Reference, a.Reason)
+}
+
+// Plan is the list of actions which bring the live workloads of a manifest in
+// line with it. A workload whose manifest entry changed is deleted and created
+// again, the deletes always come first.
+type Plan struct {
+	Manifest string   `json:"manifest"`
+	Actions  []Action `json:"actions"`
+	// Unchanged are the references of the live workloads which match the
+	// manifest
+	Unchanged []string `json:"unchanged"`
+
+	manifest *Manifest
+	// ids of the unchanged live workloads by reference
+	ids map[string]schema.ID
+}
+
+// Empty checks if the live workloads already match the manifest
+func (p *Plan) Empty() bool {
+	return len(p.Actions) == 0
+}
+
+// deleteRank orders the deletes so the workloads are deleted before the
+// volumes and networks they use
+func deleteRank(reference string) int {
+	parts := strings.SplitN(reference, "/", 3)
+	if len(parts) < 2 {
+		return 0
+	}
+
+	switch parts[1] {
+	case "volume":
+		return 1
+	case "network":
+		return 2
+	}
+
+	return 0
+}
+
+// Diff compares the manifest with its live workloads, which are matched by
+// reference
+func Diff(m *Manifest, live []workloads.Workloader) *Plan {
+	plan := &Plan{
+		Manifest:  m.Name,
+		Actions:   []Action{},
+		Unchanged: []string{},
+		manifest:  m,
+		ids:       make(map[string]schema.ID),
+	}
+
+	byReference := make(map[string][]workloads.Workloader)
+	for _, w := range live {
+		if w.GetLabels()[ManifestLabel] != m.Name {
+			continue
+		}
+		byReference[w.GetReference()] = append(byReference[w.GetReference()], w)
+	}
+
+	entries := m.entries()
+
+	// every network resource gets a new wireguard key when it is created, so
+	// its peers must be created again with it. A network is recreated with all
+	// its resources and the workloads connected to it.
+	recreated := make(map[string]bool)
+	for _, e := range entries {
+		if !e.Resource {
+			continue
+		}
+
+		deployed := false
+		for _, w := range byReference[e.Reference] {
+			deployed = deployed || w.GetLabels()[ManifestHashLabel] == e.Hash
+		}
+		if !deployed {
+			recreated[e.Network] = true
+		}
+	}
+
+	var deletes, creates []Action
+	desired := make(map[string]struct{})
+	for _, e := range entries {
+		e := e
+		desired[e.Reference] = struct{}{}
+
+		reason := "new in the manifest"
+		recreate := recreated[e.Network]
+		if recreate && len(byReference[e.Reference]) > 0 {
+			reason = "network is recreated"
+		}
+
+		matched := false
+		for _, w := range byReference[e.Reference] {
+			switch {
+			case w.GetLabels()[ManifestHashLabel] != e.Hash:
+				reason = "changed in the manifest"
+				deletes = append(deletes, Action{Type: ActionDelete, Reference: e.Reference, WorkloadID: w.GetID(), Reason: reason})
+			case recreate:
+				deletes = append(deletes, Action{Type: ActionDelete, Reference: e.Reference, WorkloadID: w.GetID(), Reason: "network is recreated"})
+			case !matched:
+				matched = true
+				plan.ids[e.Reference] = w.GetID()
+				plan.Unchanged = append(plan.Unchanged, e.Reference)
+			default:
+				deletes = append(deletes, Action{Type: ActionDelete, Reference: e.Reference, WorkloadID: w.GetID(), Reason: "deployed more than once"})
+			}
+		}
+
+		if !matched {
+			creates = append(creates, Action{Type: ActionCreate, Reference: e.Reference, Reason: reason, entry: &e})
+		}
+	}
+
+	for reference, ws := range byReference {
+		if _, ok := desired[reference]; ok {
+			continue
+		}
+		for _, w := range ws {
+			deletes = append(deletes, Action{Type: ActionDelete, Reference: reference, WorkloadID: w.GetID(), Reason: "removed from the manifest"})
+		}
+	}
+
+	sort.SliceStable(deletes, func(i, j int) bool {
+		ri, rj := deleteRank(deletes[i].Reference), deleteRank(deletes[j].Reference)
+		if ri != rj {
+			return ri < rj
+		}
+		return deletes[i].WorkloadID < deletes[j].WorkloadID
+	})
+
+	plan.Actions = append(deletes, creates...)
+	return plan
+}
+
+// Plan fetches the live workloads of the manifest and compares them with it
+func (r *ReservationClient) Plan(m *Manifest) (*Plan, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	var filter client.WorkloadFilter
+	filter = filter.
+		WithCustomer(int64(r.userID.ThreebotID)).
+		WithLabel(ManifestLabel, m.Name).
+		WithNextActions(
+			workloads.NextActionCreate,
+			workloads.NextActionSign,
+			workloads.NextActionPay,
+			workloads.NextActionApprove,
+			workloads.NextActionDeploy,
+		)
+
+	var live []workloads.Workloader
+	for page := 1; ; page++ {
+		list, err := r.explorer.Workloads.ListWorkloads(filter, client.Page(page, planPageSize))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list the live workloads of the manifest")
+		}
+
+		live = append(live, list...)
+		if len(list) < planPageSize {
+			break
+		}
+	}
+
+	return Diff(m, live), nil
+}
+
+// Apply executes the actions of the plan in order, and stops at the first one
+// which fails. The ids of the created workloads are set on their actions.
+func (r *ReservationClient) Apply(plan *Plan) error {
+	b := &builder{
+		explorer: r.explorer,
+		ids:      make(map[string]schema.ID),
+		networks: make(map[string]*builders.NetworkBuilder),
+	}
+	for ref, id := range plan.ids {
+		b.ids[ref] = id
+	}
+
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+
+		switch action.Type {
+		case ActionDelete:
+			if err := r.DeleteWorkload(action.WorkloadID); err != nil {
+				return errors.Wrapf(err, "failed to delete '%s'", action.Reference)
+			}
+		case ActionCreate:
+			id, err := r.create(b, plan.manifest, action.entry)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create '%s'", action.Reference)
+			}
+			action.WorkloadID = id
+			b.ids[action.Reference] = id
+		}
+	}
+
+	return nil
+}
+
+func (r *ReservationClient) create(b *builder, m *Manifest, e *entry) (schema.ID, error) {
+	for _, ref := range e.Requires {
+		if _, ok := b.ids[ref]; !ok {
+			return 0, fmt.Errorf("'%s' is not deployed", ref)
+		}
+	}
+
+	workload, err := e.build(b)
+	if err != nil {
+		return 0, err
+	}
+
+	workload.SetReference(e.Reference)
+	workload.SetLabels(map[string]string{
+		ManifestLabel:     m.Name,
+		ManifestHashLabel: e.Hash,
+	})
+
+	workload, err = r.DryRun(workload)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := r.explorer.Workloads.Create(workload)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to send workload")
+	}
+
+	return response.ID, nil
+}
+
+// DeleteWorkload signs the deletion of a workload
+func (r *ReservationClient) DeleteWorkload(id schema.ID) error {
+	userID := int64(r.userID.ThreebotID)
+
+	workload, err := r.explorer.Workloads.Get(id)
+	if err != nil {
+		return errors.Wrap(err, "failed to get workload")
+	}
+
+	signer, err := client.NewSigner(r.userID.Key().PrivateKey.Seed())
+	if err != nil {
+		return errors.Wrap(err, "failed to load signer")
+	}
+
+	challenge, err := workload.SignatureChallenge()
+	if err != nil {
+		return err
+	}
+
+	msg := sha256.Sum256([]byte(fmt.Sprintf("%sdelete%d", challenge, userID)))
+	_, signature, err := signer.SignHex(msg[:])
+	if err != nil {
+		return errors.Wrap(err, "failed to sign the workload deletion")
+	}
+
+	return r.explorer.Workloads.SignDelete(id, schema.ID(userID), signature)
+}
+
+// builder builds the workloads of a manifest while a plan is applied
+type builder struct {
+	explorer *client.Client
+	// ids of the workloads of the manifest by reference
+	ids map[string]schema.ID
+	// networks are built once, all their resources are generated together
+	networks map[string]*builders.NetworkBuilder
+}
+
+func (b *builder) networkResource(m *Manifest, network NetworkManifest, node string) (workloads.Workloader, error) {
+	nb, ok := b.networks[network.Name]
+	if !ok {
+		iprange, err := schema.ParseIPRange(network.IPRange)
+		if err != nil {
+			return nil, err
+		}
+
+		nb = builders.NewNetworkBuilder(network.Name, iprange, b.explorer)
+		for _, n := range network.Nodes {
+			if _, err := nb.AddNode(n.Node, n.Subnet, n.WireguardPort, false); err != nil {
+				return nil, errors.Wrapf(err, "failed to add node '%s' to network '%s'", n.Node, network.Name)
+			}
+		}
+		b.networks[network.Name] = nb
+	}
+
+	for _, nr := range nb.Build() {
+		if nr.NodeId != node {
+			continue
+		}
+
+		nr := nr
+		nr.Name = network.Name
+		nr.WorkloadId = 1
+		nr.WorkloadType = workloads.WorkloadTypeNetworkResource
+		nr.PoolId = m.Pools[network.Pool]
+		nr.Epoch = schema.Date{Time: time.Now()}
+		return &nr, nil
+	}
+
+	return nil, fmt.Errorf("network '%s' has no resource on node '%s'", network.Name, node)
+}
+
+func (b *builder) volume(m *Manifest, volume VolumeManifest) (workloads.Workloader, error) {
+	diskType, err := parseDiskType("volume", volume.Name, volume.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeType := workloads.VolumeTypeSSD
+	if diskType == workloads.DiskTypeHDD {
+		volumeType = workloads.VolumeTypeHDD
+	}
+
+	v := builders.NewVolumeBuilder(volume.Node, volume.Size, volumeType).
+		WithPoolID(m.Pools[volume.Pool]).
+		Build()
+	return &v, nil
+}
+
+func (b *builder) container(m *Manifest, container ContainerManifest) (workloads.Workloader, error) {
+	diskType, err := parseDiskType("container", container.Name, container.DiskType)
+	if err != nil {
+		return nil, err
+	}
+
+	cb := builders.NewContainerBuilder(container.Node, container.Flist, []workloads.NetworkConnection{
+		{
+			NetworkId: container.Network,
+			Ipaddress: net.ParseIP(container.IP),
+			PublicIp6: container.PublicIP6,
+		},
+	})
+	if container.HubURL != "" {
+		cb.HubUrl = container.HubURL
+	}
+	cb.Entrypoint = container.Entrypoint
+	cb.Interactive = container.Interactive
+	if container.CPU != 0 {
+		cb.Capacity.Cpu = container.CPU
+	}
+	if container.Memory != 0 {
+		cb.Capacity.Memory = container.Memory
+	}
+	cb.Capacity.DiskSize = container.DiskSize
+	cb.Capacity.DiskType = diskType
+	cb.PoolId = m.Pools[container.Pool]
+
+	for _, mount := range container.Mounts {
+		id := b.ids[m.reference("volume", mount.Volume)]
+		cb.Volumes = append(cb.Volumes, workloads.ContainerMount{
+			VolumeId:   fmt.Sprintf("%d-1", id),
+			Mountpoint: mount.Mountpoint,
+		})
+	}
+
+	// the builder encrypts the environment for the node
+	cb.Environment = container.SecretEnv
+	c, err := cb.Build()
+	if err != nil {
+		return nil, err
+	}
+	c.Environment = container.Env
+
+	return &c, nil
+}
+
+func (b *builder) kubernetes(m *Manifest, cluster KubernetesManifest, vm KubernetesNodeManifest, masters []net.IP) (workloads.Workloader, error) {
+	k := builders.NewK8sBuilder(vm.Node, cluster.Network, cluster.Secret, cluster.Size, net.ParseIP(vm.IP)).
+		WithMasterIPs(masters).
+		WithSSHKeys(cluster.SSHKeys).
+		WithPoolID(m.Pools[cluster.Pool]).
+		Build()
+	return &k, nil
+}
+
+func (b *builder) gateway(m *Manifest, gateway GatewayManifest) (workloads.Workloader, error) {
+	info := workloads.ReservationInfo{
+		WorkloadId: 1,
+		NodeId:     gateway.Node,
+		PoolId:     m.Pools[gateway.Pool],
+		Epoch:      schema.Date{Time: time.Now()},
+	}
+
+	if gateway.Type == "delegate" {
+		info.WorkloadType = workloads.WorkloadTypeDomainDelegate
+		return &workloads.GatewayDelegate{ReservationInfo: info, Domain: gateway.Domain}, nil
+	}
+
+	info.WorkloadType = workloads.WorkloadTypeSubDomain
+	return &workloads.GatewaySubdomain{ReservationInfo: info, Domain: gateway.Domain, IPs: gateway.IPs}, nil
+}